@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/apply"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Converges the groups in the DB to the ones declared in a yaml file
+// Usage: membership-service apply -f groups.yaml [-dry-run] [-prune]
+func runApply(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := flags.String("f", "", "yaml file with the desired groups and members")
+	dryRun := flags.Bool("dry-run", false, "only print the plan")
+	prune := flags.Bool("prune", false, "delete groups that are not declared in the file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("apply: -f is required")
+	}
+
+	desired, err := readDesiredState(*file)
+	if err != nil {
+		return err
+	}
+
+	config, err := app.InitializeConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := app.OpenDb(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	service := apply.NewService(db)
+
+	var actions []apply.Action
+	if *dryRun {
+		actions, err = service.Plan(context.Background(), desired, *prune)
+	} else {
+		actions, err = service.Apply(context.Background(), desired, *prune)
+	}
+	if err != nil {
+		return err
+	}
+
+	printPlan(out, actions, *dryRun)
+	return nil
+}
+
+// Reads and validates the desired state from a yaml file
+func readDesiredState(file string) (model.RestDesiredState, error) {
+	var desired model.RestDesiredState
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return desired, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, &desired); err != nil {
+		return desired, fmt.Errorf("%s: %v", file, err)
+	}
+
+	if err, _ := desired.Validate(); err != nil {
+		return desired, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return desired, nil
+}
+
+// Prints one line per action followed by a summary
+func printPlan(out io.Writer, actions []apply.Action, dryRun bool) {
+	for _, action := range actions {
+		fmt.Fprintln(out, action)
+	}
+
+	switch {
+	case len(actions) == 0:
+		fmt.Fprintln(out, "no changes, groups are up to date")
+	case dryRun:
+		fmt.Fprintf(out, "dry run: %d change(s) planned, nothing applied\n", len(actions))
+	default:
+		fmt.Fprintf(out, "%d change(s) applied\n", len(actions))
+	}
+}
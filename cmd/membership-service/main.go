@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/logging"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
 )
 
 // Entrypoint
 func main() {
-	if err := start(); err != nil {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "apply" {
+		err = runApply(os.Args[2:], os.Stdout)
+	} else {
+		err = start()
+	}
+
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
@@ -15,15 +30,34 @@ func main() {
 
 // Initializes the config and the app, and starts the server
 func start() error {
-	config, err := InitializeConfig()
+	config, err := app.InitializeConfig()
 	if err != nil {
 		return err
 	}
 
-	app := App{}
-	if err := app.Initialize(config); err != nil {
+	logger, err := logging.New(os.Stdout, config.LOG_LEVEL, config.LOG_FORMAT)
+	if err != nil {
 		return err
 	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Init(context.Background(), config.TRACE_EXPORTER, config.TRACE_OTLP_ENDPOINT)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("could not flush spans", slog.Any("error", err))
+		}
+	}()
+
+	a := app.App{}
+	if err := a.Initialize(config); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	return app.Run(config.SERVE_ADDR)
+	return a.Run(ctx, config.SERVE_ADDR, config.GRPC_ADDR)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+var (
+	ConfigName      string    = "membershipctl"
+	ConfigExtension string    = "yaml"
+	ConfigPath      [3]string = [3]string{".", "./config", "$HOME/.config/membershipctl"}
+	EnvVarPrefix    string    = "MEMBERSHIPCTL"
+)
+
+type Config struct {
+	SERVER  string
+	API_KEY string
+	TOKEN   string
+	// empty uses the tenant of the client certificate, or the default tenant
+	TENANT string
+
+	TIMEOUT time.Duration
+	RETRIES int
+
+	TLS_CA_FILE   string
+	TLS_CERT_FILE string
+	TLS_KEY_FILE  string
+
+	OUTPUT string
+}
+
+// Uses viper lib to read an optional config file and env variables
+// Env variables have precedence, e.g. MEMBERSHIPCTL_SERVER overrides server
+// An explicit file can be given, otherwise membershipctl.yaml is looked up in ConfigPath
+func InitializeConfig(file string) (*Config, error) {
+	viper.SetDefault("SERVER", "http://127.0.0.1:8080")
+	viper.SetDefault("API_KEY", "")
+	viper.SetDefault("TOKEN", "")
+	viper.SetDefault("TENANT", "")
+	viper.SetDefault("TIMEOUT", 10*time.Second)
+	viper.SetDefault("RETRIES", 2)
+	viper.SetDefault("TLS_CA_FILE", "")
+	viper.SetDefault("TLS_CERT_FILE", "")
+	viper.SetDefault("TLS_KEY_FILE", "")
+	viper.SetDefault("OUTPUT", "table")
+
+	if file != "" {
+		viper.SetConfigFile(file)
+	} else {
+		viper.SetConfigName(ConfigName)
+		viper.SetConfigType(ConfigExtension)
+		for _, path := range ConfigPath {
+			viper.AddConfigPath(path)
+		}
+	}
+
+	// the config file is optional, env variables and defaults are enough
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if file != "" || !errors.As(err, &notFound) {
+			return nil, err
+		}
+	}
+
+	viper.SetEnvPrefix(EnvVarPrefix)
+	viper.AutomaticEnv()
+
+	var config Config
+	if err := viper.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Creates a client of the server with the credentials of the config
+func NewClient(config *Config) (*client.Client, error) {
+	opts := []client.Option{
+		client.WithTimeout(config.TIMEOUT),
+		client.WithRetries(config.RETRIES, 200*time.Millisecond),
+	}
+
+	if config.API_KEY != "" {
+		opts = append(opts, client.WithAPIKey(config.API_KEY))
+	}
+	if config.TOKEN != "" {
+		opts = append(opts, client.WithBearerToken(config.TOKEN))
+	}
+	if config.TENANT != "" {
+		opts = append(opts, client.WithTenant(config.TENANT))
+	}
+
+	if config.TLS_CA_FILE != "" || config.TLS_CERT_FILE != "" {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		// WithTimeout must come after WithHTTPClient, which replaces the client
+		opts = append([]client.Option{client.WithHTTPClient(&http.Client{Transport: transport})}, opts...)
+	}
+
+	return client.New(config.SERVER, opts...), nil
+}
+
+// Trusts the CA of the server and presents a client certificate when one is configured
+func newTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.TLS_CA_FILE != "" {
+		pem, err := os.ReadFile(config.TLS_CA_FILE)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", config.TLS_CA_FILE)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.TLS_CERT_FILE != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLS_CERT_FILE, config.TLS_KEY_FILE)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a config file, viper is reset when the test ends so tests do not share its state
+func writeConfig(t *testing.T, content string) string {
+	t.Cleanup(viper.Reset)
+
+	file := filepath.Join(t.TempDir(), "membershipctl.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func Test_Config_Defaults(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	chdir(t, t.TempDir())
+
+	config, err := InitializeConfig("")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", config.SERVER)
+	assert.Equal(t, 10*time.Second, config.TIMEOUT)
+	assert.Equal(t, 2, config.RETRIES)
+	assert.Equal(t, FormatTable, config.OUTPUT)
+}
+
+func Test_Config_FileOverridesDefaults(t *testing.T) {
+	file := writeConfig(t, "server: https://membership:8443\ntenant: acme\ntimeout: 3s\noutput: json\n")
+
+	config, err := InitializeConfig(file)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://membership:8443", config.SERVER)
+	assert.Equal(t, "acme", config.TENANT)
+	assert.Equal(t, 3*time.Second, config.TIMEOUT)
+	assert.Equal(t, FormatJson, config.OUTPUT)
+	assert.Equal(t, 2, config.RETRIES)
+}
+
+func Test_Config_EnvOverridesFile(t *testing.T) {
+	file := writeConfig(t, "server: https://membership:8443\ntenant: acme\n")
+	t.Setenv("MEMBERSHIPCTL_SERVER", "https://other:8443")
+	t.Setenv("MEMBERSHIPCTL_RETRIES", "0")
+
+	config, err := InitializeConfig(file)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://other:8443", config.SERVER)
+	assert.Equal(t, 0, config.RETRIES)
+	// values without an env variable still come from the file
+	assert.Equal(t, "acme", config.TENANT)
+}
+
+func Test_Config_MissingExplicitFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	_, err := InitializeConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+
+	assert.NotNil(t, err)
+}
+
+// Runs the test in dir, also as the home directory, so no membershipctl.yaml of the machine is found
+func chdir(t *testing.T, dir string) {
+	t.Setenv("HOME", dir)
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Runs groups list|create|delete|members
+func (c command) groups(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usagef("groups: missing subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		return c.listGroups(ctx, args[1:])
+	case "create":
+		return c.createGroup(ctx, args[1:])
+	case "delete":
+		return c.deleteGroup(ctx, args[1:])
+	case "members":
+		return c.members(ctx, args[1:])
+	}
+	return usagef("groups: unknown subcommand %q", args[0])
+}
+
+func (c command) listGroups(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("groups list", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("groups list", args, 0, 0); err != nil {
+		return err
+	}
+
+	groups, err := c.client.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.printer.print(client.GroupList{Groups: groups}, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME")
+		for _, group := range groups {
+			fmt.Fprintln(w, group.Name)
+		}
+	})
+}
+
+func (c command) createGroup(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("groups create", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("groups create", args, 1, 1); err != nil {
+		return err
+	}
+
+	if err := c.client.CreateGroup(ctx, args[0]); err != nil {
+		return err
+	}
+	return c.printer.result("group %s created", args[0])
+}
+
+func (c command) deleteGroup(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("groups delete", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("groups delete", args, 1, 1); err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteGroup(ctx, args[0]); err != nil {
+		return err
+	}
+	return c.printer.result("group %s deleted", args[0])
+}
+
+// Runs groups members list|add|remove
+func (c command) members(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usagef("groups members: missing subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		return c.listMembers(ctx, args[1:])
+	case "add":
+		return c.changeMembers(ctx, args[1:], true)
+	case "remove":
+		return c.changeMembers(ctx, args[1:], false)
+	}
+	return usagef("groups members: unknown subcommand %q", args[0])
+}
+
+func (c command) listMembers(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("groups members list", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("groups members list", args, 1, 1); err != nil {
+		return err
+	}
+
+	members, err := c.client.GetGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.printer.print(members, func(w io.Writer) {
+		fmt.Fprintln(w, "USERID")
+		for _, userId := range list(members.UserIds) {
+			fmt.Fprintln(w, userId)
+		}
+	})
+}
+
+// Adds or removes users from a group
+// The api replaces all the members at once so the current ones are read first;
+// a concurrent change of the same group between the read and the write is lost
+func (c command) changeMembers(ctx context.Context, args []string, add bool) error {
+	name := "groups members remove"
+	if add {
+		name = "groups members add"
+	}
+
+	args, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(name, args, 2, -1); err != nil {
+		return err
+	}
+	groupName, userIds := args[0], args[1:]
+
+	members, err := c.client.GetGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	current := list(members.UserIds)
+	changed := []string{}
+	if add {
+		// unknown userids are silently ignored by the api, fail instead
+		for _, userId := range userIds {
+			if _, err := c.client.GetUser(ctx, userId); err != nil {
+				return err
+			}
+		}
+		for _, userId := range userIds {
+			if !contains(current, userId) {
+				current = append(current, userId)
+				changed = append(changed, userId)
+			}
+		}
+	} else {
+		kept := []string{}
+		for _, userId := range current {
+			if contains(userIds, userId) {
+				changed = append(changed, userId)
+			} else {
+				kept = append(kept, userId)
+			}
+		}
+		current = kept
+	}
+
+	if len(changed) == 0 {
+		return c.printer.result("group %s unchanged", groupName)
+	}
+
+	if err := c.client.UpdateGroup(ctx, groupName, client.GroupMembers{UserIds: &current}); err != nil {
+		return err
+	}
+
+	if add {
+		return c.printer.result("added %s to group %s", cell(changed), groupName)
+	}
+	return c.printer.result("removed %s from group %s", cell(changed), groupName)
+}
+
+// Checks whether value is in values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
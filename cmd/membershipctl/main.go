@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+const usage = `Usage: membershipctl [-config file] [-server url] [-tenant name] [-o table|json|yaml] <command>
+
+Commands:
+  users get <userid>
+  users create <userid> -first <name> -last <name> [-groups a,b]
+  users update <userid> [-first <name>] [-last <name>] [-groups a,b]
+  users delete <userid>
+  groups list
+  groups create <name>
+  groups delete <name>
+  groups members list <name>
+  groups members add <name> <userid>...
+  groups members remove <name> <userid>...
+  whois <userid>
+
+The server address and credentials are read from membershipctl.yaml in ., ./config
+or ~/.config/membershipctl, and from MEMBERSHIPCTL_* env variables.
+`
+
+// Returned when the command line is invalid, the usage is printed with it
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// Everything a subcommand needs to talk to the server and print the result
+type command struct {
+	client  *client.Client
+	printer printer
+}
+
+// Entrypoint
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout)
+	if err == nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	if errors.As(err, &usageError{}) {
+		fmt.Fprint(os.Stderr, "\n"+usage)
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
+
+// Parses the global flags and runs the subcommand
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("membershipctl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	file := flags.String("config", "", "config file, instead of looking up membershipctl.yaml")
+	server := flags.String("server", "", "base url of the server, overrides the config")
+	tenant := flags.String("tenant", "", "tenant of the users and groups, overrides the config")
+	format := flags.String("o", "", "output format: table, json or yaml")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(out, usage)
+			return nil
+		}
+		return usagef("%v", err)
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		return usagef("missing command")
+	}
+
+	config, err := InitializeConfig(*file)
+	if err != nil {
+		return err
+	}
+	if *server != "" {
+		config.SERVER = *server
+	}
+	if *tenant != "" {
+		config.TENANT = *tenant
+	}
+	if *format != "" {
+		config.OUTPUT = *format
+	}
+
+	p, err := newPrinter(out, config.OUTPUT)
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	c, err := NewClient(config)
+	if err != nil {
+		return err
+	}
+
+	cmd := command{client: c, printer: p}
+
+	switch args[0] {
+	case "users":
+		return cmd.users(ctx, args[1:])
+	case "groups":
+		return cmd.groups(ctx, args[1:])
+	case "whois":
+		return cmd.whois(ctx, args[1:])
+	case "help":
+		fmt.Fprint(out, usage)
+		return nil
+	}
+	return usagef("unknown command %q", args[0])
+}
+
+// Parses flags placed before, between or after the positional arguments
+// The flag package alone stops at the first positional argument
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	flags.SetOutput(io.Discard)
+
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, usagef("%s: %v", flags.Name(), err)
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// Checks the number of positional arguments of a subcommand
+func expectArgs(name string, args []string, min int, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return usagef("%s: wrong number of arguments", name)
+	}
+	return nil
+}
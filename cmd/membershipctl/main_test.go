@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+)
+
+func Test_ParseArgs_FlagsAnywhere(t *testing.T) {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	first := flags.String("first", "", "")
+	last := flags.String("last", "", "")
+
+	args, err := parseArgs(flags, []string{"-first", "Lex", "lex", "-last", "Luthor"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"lex"}, args)
+	assert.Equal(t, "Lex", *first)
+	assert.Equal(t, "Luthor", *last)
+}
+
+func Test_Run_UsageErrors(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	chdir(t, t.TempDir())
+
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"groups"},
+		{"groups", "create"},
+		{"groups", "create", "a", "b"},
+		{"-o", "xml", "groups", "list"},
+		{"-unknown", "groups", "list"},
+	} {
+		err := run(context.Background(), args, &bytes.Buffer{})
+
+		assert.True(t, errors.As(err, &usageError{}), "%v: %v", args, err)
+	}
+}
+
+func Test_Run_AgainstServer(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	chdir(t, t.TempDir())
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+
+	ctl := func(args ...string) string {
+		var out bytes.Buffer
+		err := run(context.Background(), append([]string{"-server", srv.URL}, args...), &out)
+		assert.Nil(t, err, "%v", args)
+		return out.String()
+	}
+
+	assert.Equal(t, "group admins created\n", ctl("groups", "create", "admins"))
+	ctl("groups", "members", "add", "admins", "lex")
+	assert.Equal(t, "NAME\nadmins\n", ctl("groups", "list"))
+	assert.Equal(t, "groups:\n- name: admins\n", ctl("-o", "yaml", "groups", "list"))
+	assert.Contains(t, ctl("-o", "json", "users", "get", "lex"), `"groups": [
+    "admins"
+  ]`)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FormatTable = "table"
+	FormatJson  = "json"
+	FormatYaml  = "yaml"
+)
+
+// Writes command results in the format chosen with -o
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+// Checks the format is one the printer supports
+func newPrinter(out io.Writer, format string) (printer, error) {
+	switch format {
+	case FormatTable, FormatJson, FormatYaml:
+		return printer{out, format}, nil
+	}
+	return printer{}, fmt.Errorf("unknown output format %q, expected table, json or yaml", format)
+}
+
+// Prints value as json or yaml, or as the rows written by table
+func (p printer) print(value interface{}, table func(w io.Writer)) error {
+	switch p.format {
+	case FormatJson:
+		body, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.out, string(body))
+		return err
+	case FormatYaml:
+		// going through json keeps the field names and order of the api
+		body, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var doc yaml.MapSlice
+		if err := yaml.Unmarshal(body, &doc); err != nil {
+			return err
+		}
+		body, err = yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = p.out.Write(body)
+		return err
+	default:
+		w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
+
+// Prints the outcome of a change
+func (p printer) result(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return p.print(map[string]string{"result": msg}, func(w io.Writer) {
+		fmt.Fprintln(w, msg)
+	})
+}
+
+// Joins a list for a table cell, - when it is empty
+func cell(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
+
+// Dereferences an optional list
+func list(values *[]string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return *values
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Prints a user in the given format and returns the output
+func printUser(t *testing.T, format string) string {
+	var out bytes.Buffer
+	p, err := newPrinter(&out, format)
+	assert.Nil(t, err)
+
+	groups := []string{"admins", "ops"}
+	user := client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex", Groups: &groups}
+	err = p.print(user, func(w io.Writer) {
+		fmt.Fprintln(w, "USERID\tFIRST NAME\tGROUPS")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", user.UserId, user.FirstName, cell(list(user.Groups)))
+	})
+	assert.Nil(t, err)
+	return out.String()
+}
+
+func Test_Printer_Table(t *testing.T) {
+	assert.Equal(t, "USERID  FIRST NAME  GROUPS\nlex     Lex         admins,ops\n", printUser(t, FormatTable))
+}
+
+func Test_Printer_Json(t *testing.T) {
+	assert.Equal(t, `{
+  "first_name": "Lex",
+  "last_name": "Luthor",
+  "userid": "lex",
+  "groups": [
+    "admins",
+    "ops"
+  ]
+}
+`, printUser(t, FormatJson))
+}
+
+func Test_Printer_YamlKeepsApiFieldOrder(t *testing.T) {
+	assert.Equal(t, `first_name: Lex
+last_name: Luthor
+userid: lex
+groups:
+- admins
+- ops
+`, printUser(t, FormatYaml))
+}
+
+func Test_Printer_Result(t *testing.T) {
+	for format, want := range map[string]string{
+		FormatTable: "group admins created\n",
+		FormatJson:  "{\n  \"result\": \"group admins created\"\n}\n",
+		FormatYaml:  "result: group admins created\n",
+	} {
+		var out bytes.Buffer
+		p, err := newPrinter(&out, format)
+		assert.Nil(t, err)
+
+		assert.Nil(t, p.result("group %s created", "admins"))
+		assert.Equal(t, want, out.String(), format)
+	}
+}
+
+func Test_Printer_UnknownFormat(t *testing.T) {
+	_, err := newPrinter(io.Discard, "xml")
+
+	assert.NotNil(t, err)
+}
+
+func Test_Cell_EmptyIsADash(t *testing.T) {
+	assert.Equal(t, "-", cell(list(nil)))
+	assert.Equal(t, "-", cell([]string{}))
+	assert.Equal(t, "a,b", cell([]string{"a", "b"}))
+}
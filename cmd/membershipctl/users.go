@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Runs users get|create|update|delete
+func (c command) users(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usagef("users: missing subcommand")
+	}
+
+	switch args[0] {
+	case "get":
+		return c.getUser(ctx, args[1:])
+	case "create":
+		return c.saveUser(ctx, args[1:], true)
+	case "update":
+		return c.saveUser(ctx, args[1:], false)
+	case "delete":
+		return c.deleteUser(ctx, args[1:])
+	}
+	return usagef("users: unknown subcommand %q", args[0])
+}
+
+func (c command) getUser(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users get", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("users get", args, 1, 1); err != nil {
+		return err
+	}
+
+	user, err := c.client.GetUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	return c.printer.print(user, func(w io.Writer) {
+		fmt.Fprintln(w, "USERID\tFIRST NAME\tLAST NAME\tGROUPS")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.UserId, user.FirstName, user.LastName, cell(list(user.Groups)))
+	})
+}
+
+// Creates a user, or updates the fields given as flags of an existing one
+// PUT replaces the whole user so the current one is read first
+func (c command) saveUser(ctx context.Context, args []string, create bool) error {
+	name := "users update"
+	if create {
+		name = "users create"
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	first := flags.String("first", "", "first name")
+	last := flags.String("last", "", "last name")
+	groups := flags.String("groups", "", "comma separated group names, replaces the current ones")
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(name, args, 1, 1); err != nil {
+		return err
+	}
+
+	user := client.User{UserId: args[0]}
+	if !create {
+		if user, err = c.client.GetUser(ctx, args[0]); err != nil {
+			return err
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "first":
+			user.FirstName = *first
+		case "last":
+			user.LastName = *last
+		case "groups":
+			names := splitList(*groups)
+			user.Groups = &names
+		}
+	})
+
+	if create {
+		if err := c.client.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		return c.printer.result("user %s created", user.UserId)
+	}
+
+	if err := c.client.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	return c.printer.result("user %s updated", user.UserId)
+}
+
+func (c command) deleteUser(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("users delete", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("users delete", args, 1, 1); err != nil {
+		return err
+	}
+
+	if err := c.client.DeleteUser(ctx, args[0]); err != nil {
+		return err
+	}
+	return c.printer.result("user %s deleted", args[0])
+}
+
+// Splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
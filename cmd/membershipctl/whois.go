@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// A user with the size of each of their groups
+type whoisResult struct {
+	UserId    string       `json:"userid"`
+	FirstName string       `json:"first_name"`
+	LastName  string       `json:"last_name"`
+	Groups    []whoisGroup `json:"groups"`
+}
+
+type whoisGroup struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
+// Shows who a user is and which groups, and how large, give them access
+func (c command) whois(ctx context.Context, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("whois", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs("whois", args, 1, 1); err != nil {
+		return err
+	}
+
+	user, err := c.client.GetUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	result := whoisResult{
+		UserId:    user.UserId,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Groups:    []whoisGroup{},
+	}
+	for _, groupName := range list(user.Groups) {
+		members, err := c.client.GetGroup(ctx, groupName)
+		if err != nil {
+			return err
+		}
+		result.Groups = append(result.Groups, whoisGroup{groupName, len(list(members.UserIds))})
+	}
+
+	return c.printer.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "User:\t%s\n", result.UserId)
+		fmt.Fprintf(w, "Name:\t%s %s\n", result.FirstName, result.LastName)
+		fmt.Fprintf(w, "Groups:\t%d\n", len(result.Groups))
+		if len(result.Groups) == 0 {
+			return
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "GROUP\tMEMBERS")
+		for _, group := range result.Groups {
+			fmt.Fprintf(w, "%s\t%d\n", group.Name, group.Members)
+		}
+	})
+}
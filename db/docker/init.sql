@@ -7,98 +7,447 @@ CREATE DATABASE membership_service;
 USE membership_service;
 
 ### user Table Creation ###
+# every user, group and membership belongs to a tenant, names are only unique within it
 CREATE TABLE user(
 	id INT NOT NULL AUTO_INCREMENT,
+    tenant VARCHAR(64) NOT NULL,
     first_name VARCHAR(32) NOT NULL,
     last_name VARCHAR(32) NOT NULL,
     user_id VARCHAR(64) NOT NULL,
     PRIMARY KEY (id)
 );
 
+# uniq_tenant_id is the target of the membership foreign key
 ALTER TABLE user
-ADD UNIQUE `uniq_user_id` (user_id);
+ADD UNIQUE `uniq_user_id` (tenant, user_id),
+ADD UNIQUE `uniq_tenant_id` (tenant, id);
+
+# prefix searches and last_name filters of search_users, user_id is covered by uniq_user_id
+ALTER TABLE user
+ADD INDEX `idx_first_name` (tenant, first_name),
+ADD INDEX `idx_last_name` (tenant, last_name);
 
 ### group Table Creation ###
 CREATE TABLE `group`(
 	id INT NOT NULL AUTO_INCREMENT,
+    tenant VARCHAR(64) NOT NULL,
     name VARCHAR(64) NOT NULL,
     PRIMARY KEY (id)
 );
 
-ALTER TABLE `group` ADD UNIQUE `uniq_name` (name);
+ALTER TABLE `group`
+ADD UNIQUE `uniq_name` (tenant, name),
+ADD UNIQUE `uniq_tenant_id` (tenant, id);
 
 ### membership Table Creation ###
+# both foreign keys include the tenant, so a membership can never link a user and a group of different tenants
 CREATE TABLE `membership`(
 	id INT NOT NULL AUTO_INCREMENT,
+    tenant VARCHAR(64) NOT NULL,
     group_id INT NOT NULL,
     user_id INT NOT NULL,
     PRIMARY KEY (id),
-    FOREIGN KEY (group_id) REFERENCES `group`(id),
-    FOREIGN KEY (user_id) REFERENCES user(id)
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id)
 );
 
 ALTER TABLE `membership` ADD UNIQUE `uniq_group_id_user_id` (`group_id`, `user_id`);
 
+### group_policy Table Creation ###
+# how requests to join a group are approved: auto, owner or two_approvers
+# groups without a row need one owner to approve
+# max_members, min_members and userid_pattern limit the members, NULL for no limit
+CREATE TABLE group_policy(
+	group_id INT NOT NULL,
+    approval VARCHAR(16) NOT NULL,
+    max_members INT NULL,
+    min_members INT NULL,
+    userid_pattern VARCHAR(256) NULL,
+    PRIMARY KEY (group_id),
+    FOREIGN KEY (group_id) REFERENCES `group`(id)
+);
+
+### group_exclusion Table Creation ###
+# a user can not be in both groups, the row is kept on the group that declared it and applies both ways
+CREATE TABLE group_exclusion(
+    tenant VARCHAR(64) NOT NULL,
+	group_id INT NOT NULL,
+    excluded_group_id INT NOT NULL,
+    PRIMARY KEY (group_id, excluded_group_id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, excluded_group_id) REFERENCES `group`(tenant, id)
+);
+
+ALTER TABLE group_exclusion ADD INDEX `idx_excluded_group_id` (excluded_group_id);
+
+### group_owner Table Creation ###
+# the users that approve requests to join a group, always of the tenant of the group
+CREATE TABLE group_owner(
+    tenant VARCHAR(64) NOT NULL,
+	group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id)
+);
+
+### membership_request Table Creation ###
+# a request of a user to join a group, state is pending, approved, rejected or expired
+# pending_key is group_id-user_id while the request is pending and NULL after, so a user has one pending request per group
+# approvers are kept as userids, so the history survives the owner being deleted
+CREATE TABLE membership_request(
+	id INT NOT NULL AUTO_INCREMENT,
+    tenant VARCHAR(64) NOT NULL,
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    pending_key VARCHAR(32) NULL,
+    reason VARCHAR(256) NOT NULL,
+    first_approver VARCHAR(64) NULL,
+    decided_by VARCHAR(64) NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id)
+);
+
+ALTER TABLE membership_request
+ADD UNIQUE `uniq_pending_request` (pending_key),
+ADD INDEX `idx_group_id_state` (group_id, state),
+ADD INDEX `idx_state_expires_at` (state, expires_at);
+
+### schema_version Table Creation ###
+CREATE TABLE schema_version(
+	version INT NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (10);
+
+### idempotency_key Table Creation ###
+# id is a hash of the Idempotency-Key header and the client that sent it
+# status, content_type and body stay NULL until the first request is done, and expires_at is the end of
+# its lease until then, the end of the TTL of the stored response after
+CREATE TABLE idempotency_key(
+	id CHAR(64) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status INT,
+    content_type VARCHAR(255),
+    body MEDIUMTEXT,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_expires_at (expires_at)
+);
+
 ### Store Procedures ###
 
 DELIMITER //
+# every procedure on users, groups and memberships takes the tenant first and only sees its rows
 CREATE PROCEDURE get_user(
+	IN tenant VARCHAR(64),
+	IN user_id VARCHAR(64)
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM `user` AS U
+    WHERE U.tenant = tenant AND U.user_id = user_id;
+END //
+
+# locks the user until the transaction ends and gets them with the ids and names of their groups, one row per group
+# and a NULL group for a user without any. The reads are locking reads, they see the latest user and groups and
+# not the snapshot of the transaction
+CREATE PROCEDURE lock_user(
+	IN tenant VARCHAR(64),
 	IN user_id VARCHAR(64)
 )
 BEGIN
-	SELECT *
+	SELECT U.id, U.first_name, U.last_name, U.user_id, G.id, G.name
+    FROM `user` AS U
+    LEFT JOIN membership AS M
+		ON M.user_id = U.id
+    LEFT JOIN `group` AS G
+		ON M.group_id = G.id
+    WHERE U.tenant = tenant AND U.user_id = user_id
+    ORDER BY G.name
+    FOR UPDATE OF U
+    FOR SHARE OF M, G;
+END //
+
+CREATE PROCEDURE get_users(
+	IN tenant VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM `user` AS U
+    WHERE U.tenant = tenant
+    ORDER BY U.user_id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+CREATE PROCEDURE count_users(
+	IN tenant VARCHAR(64)
+)
+BEGIN
+	SELECT COUNT(*)
+    FROM `user` AS U
+    WHERE U.tenant = tenant;
+END //
+
+# q matches first_name, last_name or user_id, from the start when prefix_only is set and anywhere otherwise
+# empty arguments match every user, group_name and not_in_group filter on membership
+# exact matches come first, then prefix matches, then substring matches, each ordered by user_id
+CREATE PROCEDURE search_users(
+	IN tenant VARCHAR(64),
+	IN q VARCHAR(64),
+    IN prefix_only BOOLEAN,
+    IN last_name VARCHAR(32),
+    IN group_name VARCHAR(64),
+    IN not_in_group VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	DECLARE q_prefix VARCHAR(256);
+	DECLARE q_substring VARCHAR(256);
+    SET q_prefix = CONCAT(REPLACE(REPLACE(REPLACE(q, '\\', '\\\\'), '%', '\\%'), '_', '\\_'), '%');
+    SET q_substring = IF(prefix_only, q_prefix, CONCAT('%', q_prefix));
+
+	SELECT U.id, U.first_name, U.last_name, U.user_id
     FROM `user` AS U
-    WHERE U.user_id = user_id;
+    WHERE U.tenant = tenant
+		AND (q = ''
+			OR U.user_id LIKE q_substring
+			OR U.first_name LIKE q_substring
+			OR U.last_name LIKE q_substring)
+		AND (last_name = '' OR U.last_name = last_name)
+        AND (group_name = '' OR EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = group_name))
+        AND (not_in_group = '' OR NOT EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = not_in_group))
+    ORDER BY
+		CASE
+			WHEN q = '' THEN 0
+			WHEN U.user_id = q OR U.first_name = q OR U.last_name = q THEN 0
+            WHEN U.user_id LIKE q_prefix OR U.first_name LIKE q_prefix OR U.last_name LIKE q_prefix THEN 1
+            ELSE 2
+		END,
+        U.user_id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+# the number of users search_users finds, ignoring the page
+CREATE PROCEDURE count_search_users(
+	IN tenant VARCHAR(64),
+	IN q VARCHAR(64),
+    IN prefix_only BOOLEAN,
+    IN last_name VARCHAR(32),
+    IN group_name VARCHAR(64),
+    IN not_in_group VARCHAR(64)
+)
+BEGIN
+	DECLARE q_substring VARCHAR(256);
+    SET q_substring = CONCAT(REPLACE(REPLACE(REPLACE(q, '\\', '\\\\'), '%', '\\%'), '_', '\\_'), '%');
+    SET q_substring = IF(prefix_only, q_substring, CONCAT('%', q_substring));
+
+	SELECT COUNT(*)
+    FROM `user` AS U
+    WHERE U.tenant = tenant
+		AND (q = ''
+			OR U.user_id LIKE q_substring
+			OR U.first_name LIKE q_substring
+			OR U.last_name LIKE q_substring)
+		AND (last_name = '' OR U.last_name = last_name)
+        AND (group_name = '' OR EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = group_name))
+        AND (not_in_group = '' OR NOT EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = not_in_group));
 END //
 
 CREATE PROCEDURE get_user_membership(
+	IN tenant VARCHAR(64),
 	IN user_id int
 )
 BEGIN
-	SELECT G.*
+	SELECT G.id, G.name
     FROM `membership` M
     INNER JOIN `group` G
 		ON M.group_id = G.id
-        AND M.user_id = user_id;
+        AND M.user_id = user_id
+	WHERE M.tenant = tenant
+    ORDER BY G.name;
+END //
+
+# batched version of get_user_membership, user_ids is a comma delimited list of user.id
+CREATE PROCEDURE get_users_membership(
+	IN tenant VARCHAR(64),
+	IN user_ids TEXT
+)
+BEGIN
+	SELECT M.user_id, G.id, G.name
+    FROM `membership` M
+    INNER JOIN `group` G
+		ON M.group_id = G.id
+    WHERE M.tenant = tenant AND FIND_IN_SET(M.user_id, user_ids)
+    ORDER BY G.name;
 END //
 
 CREATE PROCEDURE get_group(
+	IN tenant VARCHAR(64),
 	IN group_name VARCHAR(256)
 )
 BEGIN
-	SELECT *
-    FROM `group`
-    WHERE name = group_name;
+	SELECT G.id, G.name
+    FROM `group` AS G
+    WHERE G.tenant = tenant AND G.name = group_name;
+END //
+
+CREATE PROCEDURE get_groups(
+	IN tenant VARCHAR(64)
+)
+BEGIN
+	SELECT G.id, G.name
+    FROM `group` AS G
+    WHERE G.tenant = tenant
+    ORDER BY G.name;
 END //
 
 CREATE PROCEDURE get_group_membership(
+	IN tenant VARCHAR(64),
 	IN group_id INT
 )
 BEGIN
-	SELECT U.*
+	SELECT U.id, U.first_name, U.last_name, U.user_id
     FROM user U
     INNER JOIN membership M
 		ON U.id = M.user_id
 	INNER JOIN `group` G
 		ON M.group_id = G.id
-        AND M.group_id = group_id;
+        AND M.group_id = group_id
+	WHERE M.tenant = tenant
+    ORDER BY U.user_id;
+END //
+
+# batched version of get_group_membership, group_ids is a comma delimited list of group.id
+CREATE PROCEDURE get_groups_membership(
+	IN tenant VARCHAR(64),
+	IN group_ids TEXT
+)
+BEGIN
+	SELECT M.group_id, U.id, U.first_name, U.last_name, U.user_id
+    FROM user U
+    INNER JOIN membership M
+		ON U.id = M.user_id
+    WHERE M.tenant = tenant AND FIND_IN_SET(M.group_id, group_ids)
+    ORDER BY U.user_id;
+END //
+
+# the users whose groups make the predicate true, ordered by user_id. predicate is a fully parenthesized expression
+# of group ids joined by & (in both), | (in either) and - (in the first but not the second), e.g. ((3|5)-7).
+# It is checked to hold nothing else, turned into a HAVING clause over the memberships of each user and run as a
+# prepared statement, so a user only has to be in one of the groups to be counted
+CREATE PROCEDURE query_group_users(
+	IN tenant VARCHAR(64),
+    IN predicate VARCHAR(4096),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	IF predicate NOT REGEXP '^[0-9()&|-]+$' THEN
+		SIGNAL SQLSTATE '45000'
+			SET MESSAGE_TEXT = 'invalid group predicate';
+	END IF;
+
+	SET @tenant = tenant;
+	SET @page_offset = page_offset;
+	SET @page_limit = page_limit;
+	SET @sql_stmt = CONCAT('SELECT U.id, U.first_name, U.last_name, U.user_id
+	FROM `user` AS U
+	INNER JOIN membership AS M
+		ON M.user_id = U.id
+	WHERE M.tenant = ? AND M.group_id IN (', TRIM(BOTH ',' FROM REGEXP_REPLACE(predicate, '[^0-9]+', ',')), ')
+	GROUP BY U.id, U.first_name, U.last_name, U.user_id
+	HAVING ', REPLACE(REPLACE(REPLACE(
+		REGEXP_REPLACE(predicate, '([0-9]+)', '(SUM(M.group_id = $1) > 0)'),
+		'&', ' AND '), '|', ' OR '), '-', ' AND NOT '), '
+	ORDER BY U.user_id
+	LIMIT ? OFFSET ?;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant, @page_limit, @page_offset;
+	DEALLOCATE PREPARE stmt;
+END //
+
+# the number of users query_group_users finds, ignoring the page
+CREATE PROCEDURE count_query_group_users(
+	IN tenant VARCHAR(64),
+    IN predicate VARCHAR(4096)
+)
+BEGIN
+	IF predicate NOT REGEXP '^[0-9()&|-]+$' THEN
+		SIGNAL SQLSTATE '45000'
+			SET MESSAGE_TEXT = 'invalid group predicate';
+	END IF;
+
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('SELECT COUNT(*)
+	FROM (
+		SELECT M.user_id
+		FROM membership AS M
+		WHERE M.tenant = ? AND M.group_id IN (', TRIM(BOTH ',' FROM REGEXP_REPLACE(predicate, '[^0-9]+', ',')), ')
+		GROUP BY M.user_id
+		HAVING ', REPLACE(REPLACE(REPLACE(
+			REGEXP_REPLACE(predicate, '([0-9]+)', '(SUM(M.group_id = $1) > 0)'),
+			'&', ' AND '), '|', ' OR '), '-', ' AND NOT '), '
+	) AS Q;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
 END //
 
 CREATE PROCEDURE ins_user(
+	IN tenant VARCHAR(64),
 	IN first_name VARCHAR(32),
     IN last_name VARCHAR(32),
     IN user_id VARCHAR(64)
 )
 BEGIN
 
-	INSERT INTO `user` (first_name, last_name, user_id)
-    VALUES (first_name, last_name, user_id);
+	INSERT INTO `user` (tenant, first_name, last_name, user_id)
+    VALUES (tenant, first_name, last_name, user_id);
 
-    SELECT U.id FROM `user` AS U WHERE U.user_id = user_id;
+    SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id;
 
 END //
 
 CREATE PROCEDURE ins_membership(
+	IN tenant VARCHAR(64),
 	IN user_id INT,
     # comma delimited list of group names
     IN group_names TEXT
@@ -107,55 +456,60 @@ BEGIN
 	### dynamic sql used to insert multiple rows with one call
 	### this can lead to a sql injection
 	### limiting user permissions and validating input values should provide more security
+	### the tenant is bound as a parameter, the user must be in it for the foreign key to hold
+	SET @tenant = tenant;
 	SET @sql_stmt = CONCAT('
-    INSERT INTO `membership` (group_id, user_id)
-    SELECT G.id, ', user_id, '
+    INSERT INTO `membership` (tenant, group_id, user_id)
+    SELECT G.tenant, G.id, ', user_id, '
     FROM `group` AS G
-    WHERE `name` IN (', group_names, ');');
+    WHERE G.tenant = ? AND `name` IN (', group_names, ');');
 
     PREPARE stmt FROM @sql_stmt;
-    EXECUTE stmt;
+    EXECUTE stmt USING @tenant;
     DEALLOCATE PREPARE stmt;
 
 END //
 
+# no transaction handling here, the caller runs this inside of its own transaction
 CREATE PROCEDURE del_user(
+	IN tenant VARCHAR(64),
     IN user_id VARCHAR(64)
 )
 BEGIN
     DECLARE id INT;
     
-	DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-		ROLLBACK;
-		RESIGNAL;
-	END;
-    
-    SET id = (SELECT U.id FROM `user` AS U WHERE U.user_id = user_id);
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
     IF id IS NULL THEN
         SIGNAL SQLSTATE '45000'
             SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
 	END IF;
     
-    START TRANSACTION;
-		DELETE M
-		FROM membership M
-		WHERE M.user_id = id;
+	DELETE M
+	FROM membership M
+	WHERE M.user_id = id;
+
+	DELETE O
+	FROM group_owner AS O
+	WHERE O.user_id = id;
+
+	DELETE R
+	FROM membership_request AS R
+	WHERE R.user_id = id;
 
-		DELETE U
-		FROM `user` AS U
-		WHERE U.id = id;
-	COMMIT;
+	DELETE U
+	FROM `user` AS U
+	WHERE U.id = id;
 END //
 
 CREATE PROCEDURE upd_user(
+	IN tenant VARCHAR(64),
 	IN first_name VARCHAR(32),
     IN last_name VARCHAR(32),
     IN user_id VARCHAR(32)
 )
 BEGIN
 	DECLARE id INT;
-    SET id = (SELECT U.id FROM `user` AS U WHERE U.user_id = user_id);
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
     
     IF id IS NULL THEN
         SIGNAL SQLSTATE '45000'
@@ -170,53 +524,54 @@ BEGIN
     SELECT id;
 END //
 
+# no transaction handling here, the caller runs this inside of its own transaction
 CREATE PROCEDURE upd_membership(
+	IN tenant VARCHAR(64),
 	IN user_id INT,
     # comma delimited list of groups names
     IN group_names TEXT
 )
 BEGIN
-	DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-		ROLLBACK;
-		RESIGNAL;
-	END;
-    
-    IF (SELECT U.id FROM `user` AS U WHERE U.id = user_id) IS NULL THEN
+    IF (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.id = user_id) IS NULL THEN
         SIGNAL SQLSTATE '45000'
             SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
 	END IF;
     
-    START TRANSACTION;
-		SET @sql_stmt = CONCAT( '
-		DELETE M
-		FROM membership AS M
-		WHERE M.user_id = ', user_id, ';');
-		
-		PREPARE stmt FROM @sql_stmt;
-		EXECUTE stmt;
-		DEALLOCATE PREPARE stmt;
-		
-		SET @sql_stmt = CONCAT('INSERT INTO `membership` (group_id, user_id)
-		SELECT id, ', user_id, '
+	SET @sql_stmt = CONCAT( '
+	DELETE M
+	FROM membership AS M
+	WHERE M.user_id = ', user_id, ';');
+	
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt;
+	DEALLOCATE PREPARE stmt;
+	
+	# an empty list only removes the user from its groups
+	IF group_names <> '' THEN
+		SET @tenant = tenant;
+		SET @sql_stmt = CONCAT('INSERT INTO `membership` (tenant, group_id, user_id)
+		SELECT tenant, id, ', user_id, '
 		FROM `group`
-		WHERE `name` IN (', group_names, ');');
+		WHERE tenant = ? AND `name` IN (', group_names, ');');
 
 		PREPARE stmt FROM @sql_stmt;
-		EXECUTE stmt;
+		EXECUTE stmt USING @tenant;
 		DEALLOCATE PREPARE stmt;
-	COMMIT;
+	END IF;
 END //
 
 CREATE PROCEDURE ins_group(
+	IN tenant VARCHAR(64),
 	IN group_name VARCHAR(256)
 )
 BEGIN
-	INSERT INTO `group` (name)
-    VALUES (group_name);
+	INSERT INTO `group` (tenant, name)
+    VALUES (tenant, group_name);
 END //
 
+# no transaction handling here, the caller runs this inside of its own transaction
 CREATE PROCEDURE upd_group_membership(
+	IN tenant VARCHAR(64),
 	IN group_name VARCHAR(256),
     # Comma delimited list
     IN user_ids TEXT
@@ -224,68 +579,541 @@ CREATE PROCEDURE upd_group_membership(
 BEGIN
 	DECLARE group_id INT;
     
-	DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-		ROLLBACK;
-		RESIGNAL;
-	END;
-    
-    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.name = group_name);
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
     
     IF group_id IS NULL THEN
         SIGNAL SQLSTATE '45000'
             SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
 	END IF;
     
-    START TRANSACTION;
-		SET @sql_stmt = CONCAT( '
-		DELETE M
-		FROM membership AS M
-		WHERE M.group_id = ', group_id, ';');
-		
-		PREPARE stmt FROM @sql_stmt;
-		EXECUTE stmt;
-		DEALLOCATE PREPARE stmt;
-		
-		SET @sql_stmt = CONCAT('INSERT INTO membership (group_id, user_id)
-		SELECT ', group_id, ', id
-		FROM `user`
-		WHERE user_id IN (', user_ids, ');');
-        
-		PREPARE stmt FROM @sql_stmt;
-		EXECUTE stmt;
-		DEALLOCATE PREPARE stmt;
-	COMMIT;
+	SET @sql_stmt = CONCAT( '
+	DELETE M
+	FROM membership AS M
+	WHERE M.group_id = ', group_id, ';');
+	
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt;
+	DEALLOCATE PREPARE stmt;
+	
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('INSERT INTO membership (tenant, group_id, user_id)
+	SELECT tenant, ', group_id, ', id
+	FROM `user`
+	WHERE tenant = ? AND user_id IN (', user_ids, ');');
+    
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
 END //
 
+# no transaction handling here, the caller runs this inside of its own transaction
 CREATE PROCEDURE del_group(
+	IN tenant VARCHAR(64),
 	IN group_name VARCHAR(256)
 )
 BEGIN
 	DECLARE group_id INT;
     
-	DECLARE EXIT HANDLER FOR SQLEXCEPTION
-    BEGIN
-		ROLLBACK;
-		RESIGNAL;
-	END;
-    
-    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.name = group_name);
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
     
     IF group_id IS NULL THEN
         SIGNAL SQLSTATE '45000'
             SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
 	END IF;
     
-    START TRANSACTION;
-		DELETE M
-        FROM membership M
-        WHERE M.group_id = group_id;
-    
-		DELETE
-		FROM `group`
-		WHERE id = group_id;
-	COMMIT;
+    DELETE M
+    FROM membership M
+    WHERE M.group_id = group_id;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    DELETE R
+    FROM membership_request AS R
+    WHERE R.group_id = group_id;
+
+    DELETE E
+    FROM group_exclusion AS E
+    WHERE E.group_id = group_id OR E.excluded_group_id = group_id;
+
+    DELETE P
+    FROM group_policy AS P
+    WHERE P.group_id = group_id;
+
+    DELETE
+    FROM `group`
+    WHERE id = group_id;
+END //
+
+# adds a single user to a group, caller handles the transaction
+CREATE PROCEDURE ins_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO membership (tenant, group_id, user_id)
+    VALUES (tenant, group_id, id);
+END //
+
+# removes a single user from a group, caller handles the transaction
+CREATE PROCEDURE del_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DELETE M
+    FROM membership AS M
+    INNER JOIN `group` AS G
+		ON M.group_id = G.id
+    INNER JOIN `user` AS U
+		ON M.user_id = U.id
+    WHERE M.tenant = tenant
+		AND G.name = group_name
+		AND U.user_id = user_id;
+END //
+
+# locks the groups until the transaction ends and gets their members, with a NULL user_id for a group without any
+# every write to memberships locks the groups it changes first, so writes to the same group run one after the other.
+# The reads are locking reads, they see the latest members and not the snapshot of the transaction
+CREATE PROCEDURE lock_groups(
+	IN tenant VARCHAR(64),
+    # comma delimited list of group names
+    IN group_names TEXT
+)
+BEGIN
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('SELECT G.id, M.user_id
+	FROM `group` AS G
+	LEFT JOIN membership AS M
+		ON M.group_id = G.id
+	WHERE G.tenant = ? AND G.name IN (', group_names, ')
+	ORDER BY G.id, M.user_id
+	FOR UPDATE;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
+END //
+
+# signals 3001 when the members of a group break its policy or an exclusion, caller handles the transaction
+# delta is how many members the write added, negative when it removed some. The member limits only stop a group
+# from growing past max_members or shrinking below min_members, so a group outside them can still move towards them.
+# The userid pattern and the exclusions are only checked for the users the write added, or every member when
+# added_user_ids is NULL. The group is locked and the members counted with a locking read, so a write that
+# committed since the transaction began is counted
+CREATE PROCEDURE chk_group_limits(
+	IN tenant VARCHAR(64),
+	IN group_id INT,
+    IN delta INT,
+    # comma delimited list of user ids
+    IN added_user_ids TEXT
+)
+BEGIN
+	DECLARE group_name VARCHAR(256);
+	DECLARE max_members INT;
+	DECLARE min_members INT;
+	DECLARE userid_pattern VARCHAR(256);
+	DECLARE members INT;
+	DECLARE violation VARCHAR(512);
+
+    # subqueries instead of SELECT INTO, a missing policy must not raise NOT FOUND in the caller
+    SET group_name = (SELECT G.name FROM `group` AS G WHERE G.tenant = tenant AND G.id = group_id FOR UPDATE);
+    SET max_members = (SELECT P.max_members FROM group_policy AS P WHERE P.group_id = group_id);
+    SET min_members = (SELECT P.min_members FROM group_policy AS P WHERE P.group_id = group_id);
+    SET userid_pattern = (SELECT P.userid_pattern FROM group_policy AS P WHERE P.group_id = group_id);
+    SET members = (SELECT COUNT(*) FROM membership AS M WHERE M.group_id = group_id FOR SHARE);
+
+    IF delta > 0 AND members > max_members THEN
+		SET violation = CONCAT('group ', group_name, ' is full (max_members is ', max_members, ')');
+	ELSEIF delta < 0 AND members < min_members THEN
+		SET violation = CONCAT('group ', group_name, ' can not lose members (min_members is ', min_members, ')');
+	ELSE
+		SET violation = (
+			SELECT CONCAT('userid ', U.user_id, ' does not match the userid_pattern of group ', group_name)
+            FROM membership AS M
+            INNER JOIN `user` AS U
+				ON M.user_id = U.id
+            WHERE M.group_id = group_id
+				AND (added_user_ids IS NULL OR FIND_IN_SET(U.id, added_user_ids))
+				AND U.user_id NOT REGEXP userid_pattern
+            ORDER BY U.user_id
+            LIMIT 1);
+	END IF;
+
+    IF violation IS NULL THEN
+		SET violation = (
+			SELECT CONCAT('user ', U.user_id, ' can not be in both ', group_name, ' and ', G.name, ' (exclusive_with)')
+            FROM membership AS M
+            INNER JOIN membership AS O
+				ON O.user_id = M.user_id
+            INNER JOIN group_exclusion AS E
+				ON (E.group_id = M.group_id AND E.excluded_group_id = O.group_id)
+                OR (E.group_id = O.group_id AND E.excluded_group_id = M.group_id)
+            INNER JOIN `user` AS U
+				ON M.user_id = U.id
+            INNER JOIN `group` AS G
+				ON O.group_id = G.id
+            WHERE M.group_id = group_id
+				AND (added_user_ids IS NULL OR FIND_IN_SET(U.id, added_user_ids))
+            ORDER BY U.user_id, G.name
+            LIMIT 1);
+	END IF;
+
+    IF violation IS NOT NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = violation, MYSQL_ERRNO = 3001;
+	END IF;
+END //
+
+# the id, approval policy and member limits of a group, owner and no limits when the group has no policy
+CREATE PROCEDURE get_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	SELECT G.id, COALESCE(P.approval, 'owner'), P.max_members, P.min_members, COALESCE(P.userid_pattern, '')
+    FROM `group` AS G
+    LEFT JOIN group_policy AS P
+		ON P.group_id = G.id
+    WHERE G.tenant = tenant AND G.name = group_name;
+END //
+
+CREATE PROCEDURE get_group_owners(
+	IN tenant VARCHAR(64),
+	IN group_id INT
+)
+BEGIN
+	SELECT U.user_id
+    FROM group_owner AS O
+    INNER JOIN `user` AS U
+		ON O.user_id = U.id
+    WHERE O.tenant = tenant AND O.group_id = group_id
+    ORDER BY U.user_id;
+END //
+
+# the names of the groups a group declared itself exclusive with
+CREATE PROCEDURE get_group_exclusions(
+	IN tenant VARCHAR(64),
+	IN group_id INT
+)
+BEGIN
+	SELECT G.name
+    FROM group_exclusion AS E
+    INNER JOIN `group` AS G
+		ON E.excluded_group_id = G.id
+    WHERE E.tenant = tenant AND E.group_id = group_id
+    ORDER BY G.name;
+END //
+
+# sets the approval policy and member limits and removes every owner and exclusion,
+# caller handles the transaction and adds the owners and exclusions back
+CREATE PROCEDURE upd_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN approval VARCHAR(16),
+    IN max_members INT,
+    IN min_members INT,
+    IN userid_pattern VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    DELETE E
+    FROM group_exclusion AS E
+    WHERE E.group_id = group_id;
+
+    REPLACE INTO group_policy (group_id, approval, max_members, min_members, userid_pattern)
+    VALUES (group_id, approval, max_members, min_members, NULLIF(userid_pattern, ''));
+END //
+
+# adds a single owner to a group, caller handles the transaction
+CREATE PROCEDURE ins_group_owner(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO group_owner (tenant, group_id, user_id)
+    VALUES (tenant, group_id, id);
+END //
+
+# keeps the members of a group out of another group and the other way round, caller handles the transaction
+CREATE PROCEDURE ins_group_exclusion(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN excluded_group_name VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE excluded_group_id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    SET excluded_group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = excluded_group_name);
+    IF group_id IS NULL OR excluded_group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO group_exclusion (tenant, group_id, excluded_group_id)
+    VALUES (tenant, group_id, excluded_group_id);
+END //
+
+# creates a pending request of a user to join a group and returns its id, caller handles the transaction
+CREATE PROCEDURE ins_membership_request(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64),
+    IN reason VARCHAR(256),
+    IN ttl_seconds INT
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    # raised like the unique key of membership would be
+    IF EXISTS (SELECT 1 FROM membership AS M WHERE M.group_id = group_id AND M.user_id = id) THEN
+        SIGNAL SQLSTATE '23000'
+            SET MESSAGE_TEXT = 'Duplicate entry for key ''membership.uniq_group_id_user_id''', MYSQL_ERRNO = 1062;
+	END IF;
+
+    # a pending request past its expiry no longer blocks a new one
+    UPDATE membership_request AS R
+    SET R.state = 'expired', R.pending_key = NULL
+    WHERE R.pending_key = CONCAT(group_id, '-', id) AND R.expires_at <= NOW();
+
+    INSERT INTO membership_request (tenant, group_id, user_id, state, pending_key, reason, created_at, expires_at)
+    VALUES (tenant, group_id, id, 'pending', CONCAT(group_id, '-', id), reason, NOW(), NOW() + INTERVAL ttl_seconds SECOND);
+
+    SELECT LAST_INSERT_ID();
+END //
+
+# a pending request past its expiry is returned as expired, even before expire_membership_requests marks it
+# times are unix seconds
+CREATE PROCEDURE get_membership_request(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN request_id INT
+)
+BEGIN
+	SELECT R.id, G.name, U.user_id,
+		IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state),
+        R.reason, COALESCE(R.first_approver, ''), COALESCE(R.decided_by, ''),
+        UNIX_TIMESTAMP(R.created_at), UNIX_TIMESTAMP(R.expires_at)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name AND R.id = request_id;
+END //
+
+# the requests to join a group, oldest first, empty state and user_id arguments match every request
+CREATE PROCEDURE get_membership_requests(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN state VARCHAR(16),
+    IN user_id VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	SELECT R.id, G.name, U.user_id,
+		IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state),
+        R.reason, COALESCE(R.first_approver, ''), COALESCE(R.decided_by, ''),
+        UNIX_TIMESTAMP(R.created_at), UNIX_TIMESTAMP(R.expires_at)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name
+		AND (user_id = '' OR U.user_id = user_id)
+		AND (state = '' OR IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state) = state)
+    ORDER BY R.id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+# the number of requests get_membership_requests finds, ignoring the page
+CREATE PROCEDURE count_membership_requests(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN state VARCHAR(16),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	SELECT COUNT(*)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name
+		AND (user_id = '' OR U.user_id = user_id)
+		AND (state = '' OR IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state) = state);
+END //
+
+# moves a pending request to its next state, caller handles the transaction
+# only a request that is still pending and was first approved by previous_approver (empty for none) changes,
+# the number of changed rows tells the caller whether another decision came first
+CREATE PROCEDURE upd_membership_request(
+	IN tenant VARCHAR(64),
+    IN request_id INT,
+    IN previous_approver VARCHAR(64),
+    IN state VARCHAR(16),
+    IN first_approver VARCHAR(64),
+    IN decided_by VARCHAR(64)
+)
+BEGIN
+	UPDATE membership_request AS R
+    SET R.state = state,
+		R.pending_key = IF(state = 'pending', R.pending_key, NULL),
+        R.first_approver = NULLIF(first_approver, ''),
+        R.decided_by = NULLIF(decided_by, '')
+    WHERE R.tenant = tenant
+		AND R.id = request_id
+		AND R.state = 'pending'
+		AND R.expires_at > NOW()
+        AND COALESCE(R.first_approver, '') = previous_approver;
+
+    SELECT ROW_COUNT();
+END //
+
+# marks the pending requests past their expiry as expired, for every tenant
+CREATE PROCEDURE expire_membership_requests()
+BEGIN
+	UPDATE membership_request AS R
+    SET R.state = 'expired', R.pending_key = NULL
+    WHERE R.state = 'pending' AND R.expires_at <= NOW();
+
+    SELECT ROW_COUNT();
+END //
+
+CREATE PROCEDURE get_schema_version()
+BEGIN
+	SELECT MAX(version)
+    FROM schema_version;
+END //
+
+# reserves a key for a lease, fails with a duplicate entry while an unexpired reservation exists
+CREATE PROCEDURE ins_idempotency_key(
+	IN key_id CHAR(64),
+    IN req_hash CHAR(64),
+    IN lease_seconds INT
+)
+BEGIN
+	DELETE K
+    FROM idempotency_key AS K
+    WHERE K.id = key_id AND K.expires_at <= NOW();
+
+	INSERT INTO idempotency_key (id, request_hash, expires_at)
+    VALUES (key_id, req_hash, NOW() + INTERVAL lease_seconds SECOND);
+END //
+
+CREATE PROCEDURE get_idempotency_key(
+	IN key_id CHAR(64)
+)
+BEGIN
+	SELECT K.request_hash, K.status, K.content_type, K.body
+    FROM idempotency_key AS K
+    WHERE K.id = key_id AND K.expires_at > NOW();
+END //
+
+# stores the response of the request that reserved the key and keeps it for the TTL
+CREATE PROCEDURE upd_idempotency_key(
+	IN key_id CHAR(64),
+    IN res_status INT,
+    IN res_content_type VARCHAR(255),
+    IN res_body MEDIUMTEXT,
+    IN ttl_seconds INT
+)
+BEGIN
+	UPDATE idempotency_key AS K
+    SET K.status = res_status,
+		K.content_type = res_content_type,
+		K.body = res_body,
+		K.expires_at = NOW() + INTERVAL ttl_seconds SECOND
+    WHERE K.id = key_id;
+END //
+
+CREATE PROCEDURE del_idempotency_key(
+	IN key_id CHAR(64)
+)
+BEGIN
+	DELETE K
+    FROM idempotency_key AS K
+    WHERE K.id = key_id;
+END //
+
+CREATE PROCEDURE del_expired_idempotency_keys()
+BEGIN
+	DELETE K
+    FROM idempotency_key AS K
+    WHERE K.expires_at <= NOW();
+
+    SELECT ROW_COUNT();
+END //
+
+CREATE PROCEDURE get_counts()
+BEGIN
+	SELECT
+		(SELECT COUNT(*) FROM `user`),
+		(SELECT COUNT(*) FROM `group`),
+		(SELECT COUNT(*) FROM membership);
 END //
 
 DELIMITER ;
@@ -0,0 +1,535 @@
+### Schema version 4 to 5 ###
+# every user, group and membership belongs to a tenant. Existing rows are moved to the tenant `default`, the one of
+# requests without an X-Tenant-ID header, so they are still served as before
+# Run against an existing database: mysql membership_service < db/migrations/005_tenants.sql
+
+USE membership_service;
+
+# the default fills the column of existing rows and is dropped afterwards, new rows always name their tenant
+ALTER TABLE user
+ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id;
+
+ALTER TABLE user
+ALTER COLUMN tenant DROP DEFAULT;
+
+ALTER TABLE `group`
+ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id;
+
+ALTER TABLE `group`
+ALTER COLUMN tenant DROP DEFAULT;
+
+ALTER TABLE membership
+ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id;
+
+ALTER TABLE membership
+ALTER COLUMN tenant DROP DEFAULT;
+
+# names are only unique within a tenant, uniq_tenant_id is the target of the membership foreign keys
+ALTER TABLE user
+DROP INDEX `uniq_user_id`,
+DROP INDEX `idx_first_name`,
+DROP INDEX `idx_last_name`,
+ADD UNIQUE `uniq_user_id` (tenant, user_id),
+ADD UNIQUE `uniq_tenant_id` (tenant, id),
+ADD INDEX `idx_first_name` (tenant, first_name),
+ADD INDEX `idx_last_name` (tenant, last_name);
+
+ALTER TABLE `group`
+DROP INDEX `uniq_name`,
+ADD UNIQUE `uniq_name` (tenant, name),
+ADD UNIQUE `uniq_tenant_id` (tenant, id);
+
+# membership_ibfk_1 and membership_ibfk_2 are the names MySQL gave the unnamed foreign keys on group_id and user_id
+# of the version 4 script. Check SHOW CREATE TABLE membership first if the table was created another way
+ALTER TABLE membership
+DROP FOREIGN KEY `membership_ibfk_1`,
+DROP FOREIGN KEY `membership_ibfk_2`;
+
+ALTER TABLE membership
+ADD FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+ADD FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id);
+
+# every procedure on users, groups and memberships takes the tenant first and only sees its rows
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS get_user //
+
+CREATE PROCEDURE get_user(
+	IN tenant VARCHAR(64),
+	IN user_id VARCHAR(64)
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM `user` AS U
+    WHERE U.tenant = tenant AND U.user_id = user_id;
+END //
+
+DROP PROCEDURE IF EXISTS get_users //
+
+CREATE PROCEDURE get_users(
+	IN tenant VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM `user` AS U
+    WHERE U.tenant = tenant
+    ORDER BY U.user_id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+DROP PROCEDURE IF EXISTS count_users //
+
+CREATE PROCEDURE count_users(
+	IN tenant VARCHAR(64)
+)
+BEGIN
+	SELECT COUNT(*)
+    FROM `user` AS U
+    WHERE U.tenant = tenant;
+END //
+
+DROP PROCEDURE IF EXISTS search_users //
+
+# q matches first_name, last_name or user_id, from the start when prefix_only is set and anywhere otherwise
+# empty arguments match every user, group_name and not_in_group filter on membership
+# exact matches come first, then prefix matches, then substring matches, each ordered by user_id
+CREATE PROCEDURE search_users(
+	IN tenant VARCHAR(64),
+	IN q VARCHAR(64),
+    IN prefix_only BOOLEAN,
+    IN last_name VARCHAR(32),
+    IN group_name VARCHAR(64),
+    IN not_in_group VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	DECLARE q_prefix VARCHAR(256);
+	DECLARE q_substring VARCHAR(256);
+    SET q_prefix = CONCAT(REPLACE(REPLACE(REPLACE(q, '\\', '\\\\'), '%', '\\%'), '_', '\\_'), '%');
+    SET q_substring = IF(prefix_only, q_prefix, CONCAT('%', q_prefix));
+
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM `user` AS U
+    WHERE U.tenant = tenant
+		AND (q = ''
+			OR U.user_id LIKE q_substring
+			OR U.first_name LIKE q_substring
+			OR U.last_name LIKE q_substring)
+		AND (last_name = '' OR U.last_name = last_name)
+        AND (group_name = '' OR EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = group_name))
+        AND (not_in_group = '' OR NOT EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = not_in_group))
+    ORDER BY
+		CASE
+			WHEN q = '' THEN 0
+			WHEN U.user_id = q OR U.first_name = q OR U.last_name = q THEN 0
+            WHEN U.user_id LIKE q_prefix OR U.first_name LIKE q_prefix OR U.last_name LIKE q_prefix THEN 1
+            ELSE 2
+		END,
+        U.user_id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+DROP PROCEDURE IF EXISTS count_search_users //
+
+# the number of users search_users finds, ignoring the page
+CREATE PROCEDURE count_search_users(
+	IN tenant VARCHAR(64),
+	IN q VARCHAR(64),
+    IN prefix_only BOOLEAN,
+    IN last_name VARCHAR(32),
+    IN group_name VARCHAR(64),
+    IN not_in_group VARCHAR(64)
+)
+BEGIN
+	DECLARE q_substring VARCHAR(256);
+    SET q_substring = CONCAT(REPLACE(REPLACE(REPLACE(q, '\\', '\\\\'), '%', '\\%'), '_', '\\_'), '%');
+    SET q_substring = IF(prefix_only, q_substring, CONCAT('%', q_substring));
+
+	SELECT COUNT(*)
+    FROM `user` AS U
+    WHERE U.tenant = tenant
+		AND (q = ''
+			OR U.user_id LIKE q_substring
+			OR U.first_name LIKE q_substring
+			OR U.last_name LIKE q_substring)
+		AND (last_name = '' OR U.last_name = last_name)
+        AND (group_name = '' OR EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = group_name))
+        AND (not_in_group = '' OR NOT EXISTS (
+			SELECT 1
+            FROM membership AS M
+            INNER JOIN `group` AS G
+				ON M.group_id = G.id
+			WHERE M.user_id = U.id
+				AND G.tenant = tenant
+				AND G.name = not_in_group));
+END //
+
+DROP PROCEDURE IF EXISTS get_user_membership //
+
+CREATE PROCEDURE get_user_membership(
+	IN tenant VARCHAR(64),
+	IN user_id int
+)
+BEGIN
+	SELECT G.id, G.name
+    FROM `membership` M
+    INNER JOIN `group` G
+		ON M.group_id = G.id
+        AND M.user_id = user_id
+	WHERE M.tenant = tenant
+    ORDER BY G.name;
+END //
+
+DROP PROCEDURE IF EXISTS get_users_membership //
+
+# batched version of get_user_membership, user_ids is a comma delimited list of user.id
+CREATE PROCEDURE get_users_membership(
+	IN tenant VARCHAR(64),
+	IN user_ids TEXT
+)
+BEGIN
+	SELECT M.user_id, G.id, G.name
+    FROM `membership` M
+    INNER JOIN `group` G
+		ON M.group_id = G.id
+    WHERE M.tenant = tenant AND FIND_IN_SET(M.user_id, user_ids)
+    ORDER BY G.name;
+END //
+
+DROP PROCEDURE IF EXISTS get_group //
+
+CREATE PROCEDURE get_group(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	SELECT G.id, G.name
+    FROM `group` AS G
+    WHERE G.tenant = tenant AND G.name = group_name;
+END //
+
+DROP PROCEDURE IF EXISTS get_groups //
+
+CREATE PROCEDURE get_groups(
+	IN tenant VARCHAR(64)
+)
+BEGIN
+	SELECT G.id, G.name
+    FROM `group` AS G
+    WHERE G.tenant = tenant
+    ORDER BY G.name;
+END //
+
+DROP PROCEDURE IF EXISTS get_group_membership //
+
+CREATE PROCEDURE get_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_id INT
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id
+    FROM user U
+    INNER JOIN membership M
+		ON U.id = M.user_id
+	INNER JOIN `group` G
+		ON M.group_id = G.id
+        AND M.group_id = group_id
+	WHERE M.tenant = tenant
+    ORDER BY U.user_id;
+END //
+
+DROP PROCEDURE IF EXISTS get_groups_membership //
+
+# batched version of get_group_membership, group_ids is a comma delimited list of group.id
+CREATE PROCEDURE get_groups_membership(
+	IN tenant VARCHAR(64),
+	IN group_ids TEXT
+)
+BEGIN
+	SELECT M.group_id, U.id, U.first_name, U.last_name, U.user_id
+    FROM user U
+    INNER JOIN membership M
+		ON U.id = M.user_id
+    WHERE M.tenant = tenant AND FIND_IN_SET(M.group_id, group_ids)
+    ORDER BY U.user_id;
+END //
+
+DROP PROCEDURE IF EXISTS ins_user //
+
+CREATE PROCEDURE ins_user(
+	IN tenant VARCHAR(64),
+	IN first_name VARCHAR(32),
+    IN last_name VARCHAR(32),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+
+	INSERT INTO `user` (tenant, first_name, last_name, user_id)
+    VALUES (tenant, first_name, last_name, user_id);
+
+    SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id;
+
+END //
+
+DROP PROCEDURE IF EXISTS ins_membership //
+
+CREATE PROCEDURE ins_membership(
+	IN tenant VARCHAR(64),
+	IN user_id INT,
+    # comma delimited list of group names
+    IN group_names TEXT
+)
+BEGIN
+	### dynamic sql used to insert multiple rows with one call
+	### this can lead to a sql injection
+	### limiting user permissions and validating input values should provide more security
+	### the tenant is bound as a parameter, the user must be in it for the foreign key to hold
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('
+    INSERT INTO `membership` (tenant, group_id, user_id)
+    SELECT G.tenant, G.id, ', user_id, '
+    FROM `group` AS G
+    WHERE G.tenant = ? AND `name` IN (', group_names, ');');
+
+    PREPARE stmt FROM @sql_stmt;
+    EXECUTE stmt USING @tenant;
+    DEALLOCATE PREPARE stmt;
+
+END //
+
+DROP PROCEDURE IF EXISTS del_user //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE del_user(
+	IN tenant VARCHAR(64),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+    DECLARE id INT;
+    
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+	DELETE M
+	FROM membership M
+	WHERE M.user_id = id;
+
+	DELETE U
+	FROM `user` AS U
+	WHERE U.id = id;
+END //
+
+DROP PROCEDURE IF EXISTS upd_user //
+
+CREATE PROCEDURE upd_user(
+	IN tenant VARCHAR(64),
+	IN first_name VARCHAR(32),
+    IN last_name VARCHAR(32),
+    IN user_id VARCHAR(32)
+)
+BEGIN
+	DECLARE id INT;
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+    UPDATE `user` AS U
+    SET U.first_name = first_name,
+		U.last_name = last_name
+    WHERE U.id = id;
+    
+    SELECT id;
+END //
+
+DROP PROCEDURE IF EXISTS upd_membership //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE upd_membership(
+	IN tenant VARCHAR(64),
+	IN user_id INT,
+    # comma delimited list of groups names
+    IN group_names TEXT
+)
+BEGIN
+    IF (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.id = user_id) IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+	SET @sql_stmt = CONCAT( '
+	DELETE M
+	FROM membership AS M
+	WHERE M.user_id = ', user_id, ';');
+	
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt;
+	DEALLOCATE PREPARE stmt;
+	
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('INSERT INTO `membership` (tenant, group_id, user_id)
+	SELECT tenant, id, ', user_id, '
+	FROM `group`
+	WHERE tenant = ? AND `name` IN (', group_names, ');');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
+END //
+
+DROP PROCEDURE IF EXISTS ins_group //
+
+CREATE PROCEDURE ins_group(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	INSERT INTO `group` (tenant, name)
+    VALUES (tenant, group_name);
+END //
+
+DROP PROCEDURE IF EXISTS upd_group_membership //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE upd_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    # Comma delimited list
+    IN user_ids TEXT
+)
+BEGIN
+	DECLARE group_id INT;
+    
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+	SET @sql_stmt = CONCAT( '
+	DELETE M
+	FROM membership AS M
+	WHERE M.group_id = ', group_id, ';');
+	
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt;
+	DEALLOCATE PREPARE stmt;
+	
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('INSERT INTO membership (tenant, group_id, user_id)
+	SELECT tenant, ', group_id, ', id
+	FROM `user`
+	WHERE tenant = ? AND user_id IN (', user_ids, ');');
+    
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
+END //
+
+DROP PROCEDURE IF EXISTS del_group //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE del_group(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+    
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+    DELETE M
+    FROM membership M
+    WHERE M.group_id = group_id;
+
+    DELETE
+    FROM `group`
+    WHERE id = group_id;
+END //
+
+DROP PROCEDURE IF EXISTS ins_group_membership //
+
+# adds a single user to a group, caller handles the transaction
+CREATE PROCEDURE ins_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO membership (tenant, group_id, user_id)
+    VALUES (tenant, group_id, id);
+END //
+
+DROP PROCEDURE IF EXISTS del_group_membership //
+
+# removes a single user from a group, caller handles the transaction
+CREATE PROCEDURE del_group_membership(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DELETE M
+    FROM membership AS M
+    INNER JOIN `group` AS G
+		ON M.group_id = G.id
+    INNER JOIN `user` AS U
+		ON M.user_id = U.id
+    WHERE M.tenant = tenant
+		AND G.name = group_name
+		AND U.user_id = user_id;
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (5);
@@ -0,0 +1,366 @@
+### Schema version 5 to 6 ###
+# groups get an approval policy and owners, and users ask to join them with membership requests
+# Run against an existing database: mysql membership_service < db/migrations/006_membership_requests.sql
+
+USE membership_service;
+
+### group_policy Table Creation ###
+# how requests to join a group are approved: auto, owner or two_approvers
+# groups without a row need one owner to approve
+CREATE TABLE group_policy(
+	group_id INT NOT NULL,
+    approval VARCHAR(16) NOT NULL,
+    PRIMARY KEY (group_id),
+    FOREIGN KEY (group_id) REFERENCES `group`(id)
+);
+
+### group_owner Table Creation ###
+# the users that approve requests to join a group, always of the tenant of the group
+CREATE TABLE group_owner(
+    tenant VARCHAR(64) NOT NULL,
+	group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id)
+);
+
+### membership_request Table Creation ###
+# a request of a user to join a group, state is pending, approved, rejected or expired
+# pending_key is group_id-user_id while the request is pending and NULL after, so a user has one pending request per group
+# approvers are kept as userids, so the history survives the owner being deleted
+CREATE TABLE membership_request(
+	id INT NOT NULL AUTO_INCREMENT,
+    tenant VARCHAR(64) NOT NULL,
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    pending_key VARCHAR(32) NULL,
+    reason VARCHAR(256) NOT NULL,
+    first_approver VARCHAR(64) NULL,
+    decided_by VARCHAR(64) NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, user_id) REFERENCES user(tenant, id)
+);
+
+ALTER TABLE membership_request
+ADD UNIQUE `uniq_pending_request` (pending_key),
+ADD INDEX `idx_group_id_state` (group_id, state),
+ADD INDEX `idx_state_expires_at` (state, expires_at);
+
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS del_user //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE del_user(
+	IN tenant VARCHAR(64),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+    DECLARE id INT;
+    
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+	DELETE M
+	FROM membership M
+	WHERE M.user_id = id;
+
+	DELETE O
+	FROM group_owner AS O
+	WHERE O.user_id = id;
+
+	DELETE R
+	FROM membership_request AS R
+	WHERE R.user_id = id;
+
+	DELETE U
+	FROM `user` AS U
+	WHERE U.id = id;
+END //
+
+DROP PROCEDURE IF EXISTS del_group //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE del_group(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+    
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+    DELETE M
+    FROM membership M
+    WHERE M.group_id = group_id;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    DELETE R
+    FROM membership_request AS R
+    WHERE R.group_id = group_id;
+
+    DELETE P
+    FROM group_policy AS P
+    WHERE P.group_id = group_id;
+
+    DELETE
+    FROM `group`
+    WHERE id = group_id;
+END //
+
+DROP PROCEDURE IF EXISTS get_group_policy //
+
+# the id and approval policy of a group, owner when the group has no policy
+CREATE PROCEDURE get_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	SELECT G.id, COALESCE(P.approval, 'owner')
+    FROM `group` AS G
+    LEFT JOIN group_policy AS P
+		ON P.group_id = G.id
+    WHERE G.tenant = tenant AND G.name = group_name;
+END //
+
+DROP PROCEDURE IF EXISTS get_group_owners //
+
+CREATE PROCEDURE get_group_owners(
+	IN tenant VARCHAR(64),
+	IN group_id INT
+)
+BEGIN
+	SELECT U.user_id
+    FROM group_owner AS O
+    INNER JOIN `user` AS U
+		ON O.user_id = U.id
+    WHERE O.tenant = tenant AND O.group_id = group_id
+    ORDER BY U.user_id;
+END //
+
+DROP PROCEDURE IF EXISTS upd_group_policy //
+
+# sets the approval policy and removes every owner, caller handles the transaction and adds the owners back
+CREATE PROCEDURE upd_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN approval VARCHAR(16)
+)
+BEGIN
+	DECLARE group_id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    REPLACE INTO group_policy (group_id, approval)
+    VALUES (group_id, approval);
+END //
+
+DROP PROCEDURE IF EXISTS ins_group_owner //
+
+# adds a single owner to a group, caller handles the transaction
+CREATE PROCEDURE ins_group_owner(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO group_owner (tenant, group_id, user_id)
+    VALUES (tenant, group_id, id);
+END //
+
+DROP PROCEDURE IF EXISTS ins_membership_request //
+
+# creates a pending request of a user to join a group and returns its id, caller handles the transaction
+CREATE PROCEDURE ins_membership_request(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN user_id VARCHAR(64),
+    IN reason VARCHAR(256),
+    IN ttl_seconds INT
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    SET id = (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.user_id = user_id);
+    IF id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    # raised like the unique key of membership would be
+    IF EXISTS (SELECT 1 FROM membership AS M WHERE M.group_id = group_id AND M.user_id = id) THEN
+        SIGNAL SQLSTATE '23000'
+            SET MESSAGE_TEXT = 'Duplicate entry for key ''membership.uniq_group_id_user_id''', MYSQL_ERRNO = 1062;
+	END IF;
+
+    # a pending request past its expiry no longer blocks a new one
+    UPDATE membership_request AS R
+    SET R.state = 'expired', R.pending_key = NULL
+    WHERE R.pending_key = CONCAT(group_id, '-', id) AND R.expires_at <= NOW();
+
+    INSERT INTO membership_request (tenant, group_id, user_id, state, pending_key, reason, created_at, expires_at)
+    VALUES (tenant, group_id, id, 'pending', CONCAT(group_id, '-', id), reason, NOW(), NOW() + INTERVAL ttl_seconds SECOND);
+
+    SELECT LAST_INSERT_ID();
+END //
+
+DROP PROCEDURE IF EXISTS get_membership_request //
+
+# a pending request past its expiry is returned as expired, even before expire_membership_requests marks it
+# times are unix seconds
+CREATE PROCEDURE get_membership_request(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN request_id INT
+)
+BEGIN
+	SELECT R.id, G.name, U.user_id,
+		IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state),
+        R.reason, COALESCE(R.first_approver, ''), COALESCE(R.decided_by, ''),
+        UNIX_TIMESTAMP(R.created_at), UNIX_TIMESTAMP(R.expires_at)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name AND R.id = request_id;
+END //
+
+DROP PROCEDURE IF EXISTS get_membership_requests //
+
+# the requests to join a group, oldest first, empty state and user_id arguments match every request
+CREATE PROCEDURE get_membership_requests(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN state VARCHAR(16),
+    IN user_id VARCHAR(64),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	SELECT R.id, G.name, U.user_id,
+		IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state),
+        R.reason, COALESCE(R.first_approver, ''), COALESCE(R.decided_by, ''),
+        UNIX_TIMESTAMP(R.created_at), UNIX_TIMESTAMP(R.expires_at)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name
+		AND (user_id = '' OR U.user_id = user_id)
+		AND (state = '' OR IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state) = state)
+    ORDER BY R.id
+    LIMIT page_limit OFFSET page_offset;
+END //
+
+DROP PROCEDURE IF EXISTS count_membership_requests //
+
+# the number of requests get_membership_requests finds, ignoring the page
+CREATE PROCEDURE count_membership_requests(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN state VARCHAR(16),
+    IN user_id VARCHAR(64)
+)
+BEGIN
+	SELECT COUNT(*)
+    FROM membership_request AS R
+    INNER JOIN `group` AS G
+		ON R.group_id = G.id
+    INNER JOIN `user` AS U
+		ON R.user_id = U.id
+    WHERE R.tenant = tenant AND G.name = group_name
+		AND (user_id = '' OR U.user_id = user_id)
+		AND (state = '' OR IF(R.state = 'pending' AND R.expires_at <= NOW(), 'expired', R.state) = state);
+END //
+
+DROP PROCEDURE IF EXISTS upd_membership_request //
+
+# moves a pending request to its next state, caller handles the transaction
+# only a request that is still pending and was first approved by previous_approver (empty for none) changes,
+# the number of changed rows tells the caller whether another decision came first
+CREATE PROCEDURE upd_membership_request(
+	IN tenant VARCHAR(64),
+    IN request_id INT,
+    IN previous_approver VARCHAR(64),
+    IN state VARCHAR(16),
+    IN first_approver VARCHAR(64),
+    IN decided_by VARCHAR(64)
+)
+BEGIN
+	UPDATE membership_request AS R
+    SET R.state = state,
+		R.pending_key = IF(state = 'pending', R.pending_key, NULL),
+        R.first_approver = NULLIF(first_approver, ''),
+        R.decided_by = NULLIF(decided_by, '')
+    WHERE R.tenant = tenant
+		AND R.id = request_id
+		AND R.state = 'pending'
+		AND R.expires_at > NOW()
+        AND COALESCE(R.first_approver, '') = previous_approver;
+
+    SELECT ROW_COUNT();
+END //
+
+DROP PROCEDURE IF EXISTS expire_membership_requests //
+
+# marks the pending requests past their expiry as expired, for every tenant
+CREATE PROCEDURE expire_membership_requests()
+BEGIN
+	UPDATE membership_request AS R
+    SET R.state = 'expired', R.pending_key = NULL
+    WHERE R.state = 'pending' AND R.expires_at <= NOW();
+
+    SELECT ROW_COUNT();
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (6);
@@ -0,0 +1,294 @@
+### Schema version 6 to 7 ###
+# group policies limit the number and userids of members, and groups can exclude each other
+# Run against an existing database: mysql membership_service < db/migrations/007_group_constraints.sql
+
+USE membership_service;
+
+# max_members, min_members and userid_pattern limit the members, NULL for no limit
+ALTER TABLE group_policy
+ADD COLUMN max_members INT NULL,
+ADD COLUMN min_members INT NULL,
+ADD COLUMN userid_pattern VARCHAR(256) NULL;
+
+### group_exclusion Table Creation ###
+# a user can not be in both groups, the row is kept on the group that declared it and applies both ways
+CREATE TABLE group_exclusion(
+    tenant VARCHAR(64) NOT NULL,
+	group_id INT NOT NULL,
+    excluded_group_id INT NOT NULL,
+    PRIMARY KEY (group_id, excluded_group_id),
+    FOREIGN KEY (tenant, group_id) REFERENCES `group`(tenant, id),
+    FOREIGN KEY (tenant, excluded_group_id) REFERENCES `group`(tenant, id)
+);
+
+ALTER TABLE group_exclusion ADD INDEX `idx_excluded_group_id` (excluded_group_id);
+
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS upd_membership //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE upd_membership(
+	IN tenant VARCHAR(64),
+	IN user_id INT,
+    # comma delimited list of groups names
+    IN group_names TEXT
+)
+BEGIN
+    IF (SELECT U.id FROM `user` AS U WHERE U.tenant = tenant AND U.id = user_id) IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'user does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+	SET @sql_stmt = CONCAT( '
+	DELETE M
+	FROM membership AS M
+	WHERE M.user_id = ', user_id, ';');
+	
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt;
+	DEALLOCATE PREPARE stmt;
+	
+	# an empty list only removes the user from its groups
+	IF group_names <> '' THEN
+		SET @tenant = tenant;
+		SET @sql_stmt = CONCAT('INSERT INTO `membership` (tenant, group_id, user_id)
+		SELECT tenant, id, ', user_id, '
+		FROM `group`
+		WHERE tenant = ? AND `name` IN (', group_names, ');');
+
+		PREPARE stmt FROM @sql_stmt;
+		EXECUTE stmt USING @tenant;
+		DEALLOCATE PREPARE stmt;
+	END IF;
+END //
+
+DROP PROCEDURE IF EXISTS del_group //
+
+# no transaction handling here, the caller runs this inside of its own transaction
+CREATE PROCEDURE del_group(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+    
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+    
+    DELETE M
+    FROM membership M
+    WHERE M.group_id = group_id;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    DELETE R
+    FROM membership_request AS R
+    WHERE R.group_id = group_id;
+
+    DELETE E
+    FROM group_exclusion AS E
+    WHERE E.group_id = group_id OR E.excluded_group_id = group_id;
+
+    DELETE P
+    FROM group_policy AS P
+    WHERE P.group_id = group_id;
+
+    DELETE
+    FROM `group`
+    WHERE id = group_id;
+END //
+
+DROP PROCEDURE IF EXISTS lock_groups //
+
+# locks the groups until the transaction ends and gets their members, with a NULL user_id for a group without any
+# every write to memberships locks the groups it changes first, so writes to the same group run one after the other.
+# The reads are locking reads, they see the latest members and not the snapshot of the transaction
+CREATE PROCEDURE lock_groups(
+	IN tenant VARCHAR(64),
+    # comma delimited list of group names
+    IN group_names TEXT
+)
+BEGIN
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('SELECT G.id, M.user_id
+	FROM `group` AS G
+	LEFT JOIN membership AS M
+		ON M.group_id = G.id
+	WHERE G.tenant = ? AND G.name IN (', group_names, ')
+	ORDER BY G.id, M.user_id
+	FOR UPDATE;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
+END //
+
+DROP PROCEDURE IF EXISTS chk_group_limits //
+
+# signals 3001 when the members of a group break its policy or an exclusion, caller handles the transaction
+# delta is how many members the write added, negative when it removed some. The member limits only stop a group
+# from growing past max_members or shrinking below min_members, so a group outside them can still move towards them.
+# The userid pattern and the exclusions are only checked for the users the write added, or every member when
+# added_user_ids is NULL. The group is locked and the members counted with a locking read, so a write that
+# committed since the transaction began is counted
+CREATE PROCEDURE chk_group_limits(
+	IN tenant VARCHAR(64),
+	IN group_id INT,
+    IN delta INT,
+    # comma delimited list of user ids
+    IN added_user_ids TEXT
+)
+BEGIN
+	DECLARE group_name VARCHAR(256);
+	DECLARE max_members INT;
+	DECLARE min_members INT;
+	DECLARE userid_pattern VARCHAR(256);
+	DECLARE members INT;
+	DECLARE violation VARCHAR(512);
+
+    # subqueries instead of SELECT INTO, a missing policy must not raise NOT FOUND in the caller
+    SET group_name = (SELECT G.name FROM `group` AS G WHERE G.tenant = tenant AND G.id = group_id FOR UPDATE);
+    SET max_members = (SELECT P.max_members FROM group_policy AS P WHERE P.group_id = group_id);
+    SET min_members = (SELECT P.min_members FROM group_policy AS P WHERE P.group_id = group_id);
+    SET userid_pattern = (SELECT P.userid_pattern FROM group_policy AS P WHERE P.group_id = group_id);
+    SET members = (SELECT COUNT(*) FROM membership AS M WHERE M.group_id = group_id FOR SHARE);
+
+    IF delta > 0 AND members > max_members THEN
+		SET violation = CONCAT('group ', group_name, ' is full (max_members is ', max_members, ')');
+	ELSEIF delta < 0 AND members < min_members THEN
+		SET violation = CONCAT('group ', group_name, ' can not lose members (min_members is ', min_members, ')');
+	ELSE
+		SET violation = (
+			SELECT CONCAT('userid ', U.user_id, ' does not match the userid_pattern of group ', group_name)
+            FROM membership AS M
+            INNER JOIN `user` AS U
+				ON M.user_id = U.id
+            WHERE M.group_id = group_id
+				AND (added_user_ids IS NULL OR FIND_IN_SET(U.id, added_user_ids))
+				AND U.user_id NOT REGEXP userid_pattern
+            ORDER BY U.user_id
+            LIMIT 1);
+	END IF;
+
+    IF violation IS NULL THEN
+		SET violation = (
+			SELECT CONCAT('user ', U.user_id, ' can not be in both ', group_name, ' and ', G.name, ' (exclusive_with)')
+            FROM membership AS M
+            INNER JOIN membership AS O
+				ON O.user_id = M.user_id
+            INNER JOIN group_exclusion AS E
+				ON (E.group_id = M.group_id AND E.excluded_group_id = O.group_id)
+                OR (E.group_id = O.group_id AND E.excluded_group_id = M.group_id)
+            INNER JOIN `user` AS U
+				ON M.user_id = U.id
+            INNER JOIN `group` AS G
+				ON O.group_id = G.id
+            WHERE M.group_id = group_id
+				AND (added_user_ids IS NULL OR FIND_IN_SET(U.id, added_user_ids))
+            ORDER BY U.user_id, G.name
+            LIMIT 1);
+	END IF;
+
+    IF violation IS NOT NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = violation, MYSQL_ERRNO = 3001;
+	END IF;
+END //
+
+DROP PROCEDURE IF EXISTS get_group_policy //
+
+# the id, approval policy and member limits of a group, owner and no limits when the group has no policy
+CREATE PROCEDURE get_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256)
+)
+BEGIN
+	SELECT G.id, COALESCE(P.approval, 'owner'), P.max_members, P.min_members, COALESCE(P.userid_pattern, '')
+    FROM `group` AS G
+    LEFT JOIN group_policy AS P
+		ON P.group_id = G.id
+    WHERE G.tenant = tenant AND G.name = group_name;
+END //
+
+DROP PROCEDURE IF EXISTS get_group_exclusions //
+
+# the names of the groups a group declared itself exclusive with
+CREATE PROCEDURE get_group_exclusions(
+	IN tenant VARCHAR(64),
+	IN group_id INT
+)
+BEGIN
+	SELECT G.name
+    FROM group_exclusion AS E
+    INNER JOIN `group` AS G
+		ON E.excluded_group_id = G.id
+    WHERE E.tenant = tenant AND E.group_id = group_id
+    ORDER BY G.name;
+END //
+
+DROP PROCEDURE IF EXISTS upd_group_policy //
+
+# sets the approval policy and member limits and removes every owner and exclusion,
+# caller handles the transaction and adds the owners and exclusions back
+CREATE PROCEDURE upd_group_policy(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN approval VARCHAR(16),
+    IN max_members INT,
+    IN min_members INT,
+    IN userid_pattern VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    IF group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    DELETE O
+    FROM group_owner AS O
+    WHERE O.group_id = group_id;
+
+    DELETE E
+    FROM group_exclusion AS E
+    WHERE E.group_id = group_id;
+
+    REPLACE INTO group_policy (group_id, approval, max_members, min_members, userid_pattern)
+    VALUES (group_id, approval, max_members, min_members, NULLIF(userid_pattern, ''));
+END //
+
+DROP PROCEDURE IF EXISTS ins_group_exclusion //
+
+# keeps the members of a group out of another group and the other way round, caller handles the transaction
+CREATE PROCEDURE ins_group_exclusion(
+	IN tenant VARCHAR(64),
+	IN group_name VARCHAR(256),
+    IN excluded_group_name VARCHAR(256)
+)
+BEGIN
+	DECLARE group_id INT;
+	DECLARE excluded_group_id INT;
+
+    SET group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = group_name);
+    SET excluded_group_id = (SELECT G.id FROM `group` AS G WHERE G.tenant = tenant AND G.name = excluded_group_name);
+    IF group_id IS NULL OR excluded_group_id IS NULL THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'group does not exist', MYSQL_ERRNO = 3000;
+	END IF;
+
+    INSERT IGNORE INTO group_exclusion (tenant, group_id, excluded_group_id)
+    VALUES (tenant, group_id, excluded_group_id);
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (7);
@@ -0,0 +1,46 @@
+### Schema version 7 to 8 ###
+# Reservations of idempotency keys expire after a lease, the stored response after the TTL
+# Run against an existing database: mysql membership_service < db/migrations/008_idempotency_lease.sql
+
+USE membership_service;
+
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS ins_idempotency_key //
+DROP PROCEDURE IF EXISTS upd_idempotency_key //
+
+# reserves a key for a lease, fails with a duplicate entry while an unexpired reservation exists
+CREATE PROCEDURE ins_idempotency_key(
+	IN key_id CHAR(64),
+    IN req_hash CHAR(64),
+    IN lease_seconds INT
+)
+BEGIN
+	DELETE K
+    FROM idempotency_key AS K
+    WHERE K.id = key_id AND K.expires_at <= NOW();
+
+	INSERT INTO idempotency_key (id, request_hash, expires_at)
+    VALUES (key_id, req_hash, NOW() + INTERVAL lease_seconds SECOND);
+END //
+
+# stores the response of the request that reserved the key and keeps it for the TTL
+CREATE PROCEDURE upd_idempotency_key(
+	IN key_id CHAR(64),
+    IN res_status INT,
+    IN res_content_type VARCHAR(255),
+    IN res_body MEDIUMTEXT,
+    IN ttl_seconds INT
+)
+BEGIN
+	UPDATE idempotency_key AS K
+    SET K.status = res_status,
+		K.content_type = res_content_type,
+		K.body = res_body,
+		K.expires_at = NOW() + INTERVAL ttl_seconds SECOND
+    WHERE K.id = key_id;
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (8);
@@ -0,0 +1,33 @@
+### Schema version 8 to 9 ###
+# PATCH /users/{userid} reads the user and their groups with a locking read in its transaction
+# Run against an existing database: mysql membership_service < db/migrations/009_lock_user.sql
+
+USE membership_service;
+
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS lock_user //
+
+# locks the user until the transaction ends and gets them with the ids and names of their groups, one row per group
+# and a NULL group for a user without any. The reads are locking reads, they see the latest user and groups and
+# not the snapshot of the transaction
+CREATE PROCEDURE lock_user(
+	IN tenant VARCHAR(64),
+	IN user_id VARCHAR(64)
+)
+BEGIN
+	SELECT U.id, U.first_name, U.last_name, U.user_id, G.id, G.name
+    FROM `user` AS U
+    LEFT JOIN membership AS M
+		ON M.user_id = U.id
+    LEFT JOIN `group` AS G
+		ON M.group_id = G.id
+    WHERE U.tenant = tenant AND U.user_id = user_id
+    ORDER BY G.name
+    FOR UPDATE OF U
+    FOR SHARE OF M, G;
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (9);
@@ -0,0 +1,78 @@
+### Schema version 9 to 10 ###
+# GET /groups:query works out the set expression over groups in the database
+# Run against an existing database: mysql membership_service < db/migrations/010_query_group_users.sql
+
+USE membership_service;
+
+DELIMITER //
+
+DROP PROCEDURE IF EXISTS query_group_users //
+DROP PROCEDURE IF EXISTS count_query_group_users //
+
+# the users whose groups make the predicate true, ordered by user_id. predicate is a fully parenthesized expression
+# of group ids joined by & (in both), | (in either) and - (in the first but not the second), e.g. ((3|5)-7).
+# It is checked to hold nothing else, turned into a HAVING clause over the memberships of each user and run as a
+# prepared statement, so a user only has to be in one of the groups to be counted
+CREATE PROCEDURE query_group_users(
+	IN tenant VARCHAR(64),
+    IN predicate VARCHAR(4096),
+	IN page_offset INT,
+    IN page_limit INT
+)
+BEGIN
+	IF predicate NOT REGEXP '^[0-9()&|-]+$' THEN
+		SIGNAL SQLSTATE '45000'
+			SET MESSAGE_TEXT = 'invalid group predicate';
+	END IF;
+
+	SET @tenant = tenant;
+	SET @page_offset = page_offset;
+	SET @page_limit = page_limit;
+	SET @sql_stmt = CONCAT('SELECT U.id, U.first_name, U.last_name, U.user_id
+	FROM `user` AS U
+	INNER JOIN membership AS M
+		ON M.user_id = U.id
+	WHERE M.tenant = ? AND M.group_id IN (', TRIM(BOTH ',' FROM REGEXP_REPLACE(predicate, '[^0-9]+', ',')), ')
+	GROUP BY U.id, U.first_name, U.last_name, U.user_id
+	HAVING ', REPLACE(REPLACE(REPLACE(
+		REGEXP_REPLACE(predicate, '([0-9]+)', '(SUM(M.group_id = $1) > 0)'),
+		'&', ' AND '), '|', ' OR '), '-', ' AND NOT '), '
+	ORDER BY U.user_id
+	LIMIT ? OFFSET ?;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant, @page_limit, @page_offset;
+	DEALLOCATE PREPARE stmt;
+END //
+
+# the number of users query_group_users finds, ignoring the page
+CREATE PROCEDURE count_query_group_users(
+	IN tenant VARCHAR(64),
+    IN predicate VARCHAR(4096)
+)
+BEGIN
+	IF predicate NOT REGEXP '^[0-9()&|-]+$' THEN
+		SIGNAL SQLSTATE '45000'
+			SET MESSAGE_TEXT = 'invalid group predicate';
+	END IF;
+
+	SET @tenant = tenant;
+	SET @sql_stmt = CONCAT('SELECT COUNT(*)
+	FROM (
+		SELECT M.user_id
+		FROM membership AS M
+		WHERE M.tenant = ? AND M.group_id IN (', TRIM(BOTH ',' FROM REGEXP_REPLACE(predicate, '[^0-9]+', ',')), ')
+		GROUP BY M.user_id
+		HAVING ', REPLACE(REPLACE(REPLACE(
+			REGEXP_REPLACE(predicate, '([0-9]+)', '(SUM(M.group_id = $1) > 0)'),
+			'&', ' AND '), '|', ' OR '), '-', ' AND NOT '), '
+	) AS Q;');
+
+	PREPARE stmt FROM @sql_stmt;
+	EXECUTE stmt USING @tenant;
+	DEALLOCATE PREPARE stmt;
+END //
+
+DELIMITER ;
+
+INSERT INTO schema_version (version) VALUES (10);
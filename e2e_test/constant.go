@@ -1,3 +0,0 @@
-package e2e_test
-
-const URL = "http://127.0.0.1:8080"
\ No newline at end of file
@@ -0,0 +1,202 @@
+package harness
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/logging"
+	"github.com/yassinekhaliqui/go-rest-service/internal/memdb"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Header whose value the harness sets as the caller identity of a request, as if it was the subject of a verified
+// client certificate, so tests can act as different callers without mutual TLS
+const IdentityHeader = "X-Harness-Identity"
+
+// Userid of the admin of the membership policies of every server, the common name of the identity of Server.Admin
+const AdminUserId = "admin"
+
+var (
+	setup     sync.Once
+	databases atomic.Int64
+)
+
+// A membership service running in-process on its own empty in-memory database,
+// or on a MySQL database of its own when MysqlDsnEnv is set
+// Servers share the metrics registry and the caches of the process, so tests using them must not run in parallel
+type Server struct {
+	// Base url of the REST api
+	URL string
+	// Address of the gRPC api
+	GrpcAddr string
+	// Client of the REST api, fails fast instead of retrying
+	Client *client.Client
+	// Client of the REST api acting as AdminUserId
+	Admin *client.Client
+	App   *app.App
+
+	t   testing.TB
+	dsn string
+	// the connection to the MySQL server and the name of the database, when running against MySQL
+	admin   *sql.DB
+	mysqlDb string
+}
+
+// Changes the config of a Server before it starts
+type Option func(config *app.Config)
+
+// Starts a server on an empty database, it is stopped and its database dropped when the test ends
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	setup.Do(initGlobals)
+
+	config := &app.Config{
+		VALIDATE_REQUESTS: true,
+		CACHE_SIZE:        1000,
+		CACHE_TTL:         time.Minute,
+		MEMBERSHIP_ADMINS: []string{AdminUserId},
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	n := databases.Add(1)
+	s := &Server{t: t, dsn: fmt.Sprintf("%s-%d", t.Name(), n)}
+
+	driverName := memdb.DriverName
+	if serverDsn := os.Getenv(MysqlDsnEnv); serverDsn != "" {
+		dsn, err := s.createMysqlDb(serverDsn, fmt.Sprintf("harness_%d_%d", os.Getpid(), n))
+		if err != nil {
+			t.Fatalf("harness: creating the MySQL database: %v", err)
+		}
+		driverName, s.dsn = "mysql", dsn
+	}
+
+	db, err := dbx.OpenDb(driverName, s.dsn)
+	if err != nil {
+		t.Fatalf("harness: opening the database: %v", err)
+	}
+
+	s.App = &app.App{}
+	if err := s.App.InitializeWithDb(config, db); err != nil {
+		t.Fatalf("harness: initializing the app: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("harness: listening for grpc: %v", err)
+	}
+	go s.App.GrpcServer.Serve(lis)
+	s.GrpcAddr = lis.Addr().String()
+
+	srv := httptest.NewServer(withIdentity(s.App.Router))
+	s.URL = srv.URL
+	s.Client = client.New(srv.URL, client.WithRetries(0, 0))
+	s.Admin = s.ClientAs("CN=" + AdminUserId)
+
+	s.App.Workers.Start()
+
+	t.Cleanup(func() {
+		srv.Close()
+		s.App.GrpcServer.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.App.Workers.Stop(ctx); err != nil {
+			t.Errorf("harness: stopping the workers: %v", err)
+		}
+
+		s.App.Db.Close()
+		if s.admin == nil {
+			memdb.Drop(s.dsn)
+		} else if err := s.dropMysqlDb(); err != nil {
+			t.Errorf("harness: dropping the MySQL database: %v", err)
+		}
+	})
+
+	return s
+}
+
+// Empties the database and the caches, for tests that need a clean state half way
+func (s *Server) Reset() {
+	if s.admin == nil {
+		memdb.Reset(s.dsn)
+	} else if err := s.emptyMysqlDb(); err != nil {
+		s.t.Fatalf("harness: emptying the MySQL database: %v", err)
+	}
+	cache.Configure(s.App.Config.CACHE_SIZE, s.App.Config.CACHE_TTL)
+}
+
+// Gets a client of the REST api whose requests have the given caller identity
+func (s *Server) ClientAs(identity string) *client.Client {
+	return client.New(s.URL, client.WithRetries(0, 0), client.WithHeader(IdentityHeader, identity))
+}
+
+// Creates a user named after their userid in the given groups, failing the test if it can not
+func (s *Server) CreateUser(userId string, groups ...string) client.User {
+	s.t.Helper()
+
+	user := client.User{FirstName: userId + "-first", LastName: userId + "-last", UserId: userId}
+	if len(groups) != 0 {
+		user.Groups = &groups
+	}
+
+	if err := s.Client.CreateUser(context.Background(), user); err != nil {
+		s.t.Fatalf("harness: creating user %s: %v", userId, err)
+	}
+	return user
+}
+
+// Creates a group with the given members, failing the test if it can not
+func (s *Server) CreateGroup(name string, members ...string) {
+	s.t.Helper()
+
+	ctx := context.Background()
+	if err := s.Client.CreateGroup(ctx, name); err != nil {
+		s.t.Fatalf("harness: creating group %s: %v", name, err)
+	}
+
+	if len(members) == 0 {
+		return
+	}
+	if err := s.Client.UpdateGroup(ctx, name, client.GroupMembers{UserIds: &members}); err != nil {
+		s.t.Fatalf("harness: adding members to group %s: %v", name, err)
+	}
+}
+
+// Records spans without exporting them so traceparent propagation can be checked,
+// and keeps the access logs out of the test output
+func initGlobals() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	logger, _ := logging.New(os.Stderr, "warn", "text")
+	slog.SetDefault(logger)
+}
+
+// Sets the caller identity of requests with an IdentityHeader
+func withIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity := r.Header.Get(IdentityHeader); identity != "" {
+			r = r.WithContext(mw.WithCallerIdentity(r.Context(), identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package harness
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Set to the DSN of a MySQL server without a database name, e.g. "root:secret@tcp(127.0.0.1:3306)/",
+// to run the tests against MySQL and the stored procedures of db/docker/init.sql instead of memdb
+const MysqlDsnEnv = "TEST_MYSQL_DSN"
+
+// Name of the database created by db/docker/init.sql, replaced by the name of the database of the test
+const scriptDatabase = "membership_service"
+
+// Creates a database of its own for the server on the MySQL server of MysqlDsnEnv and loads init.sql into it
+// Returns the DSN of the database
+func (s *Server) createMysqlDb(serverDsn string, name string) (string, error) {
+	config, err := mysql.ParseDSN(serverDsn)
+	if err != nil {
+		return "", err
+	}
+
+	script, err := os.ReadFile(InitScript())
+	if err != nil {
+		return "", err
+	}
+
+	if s.admin, err = sql.Open("mysql", config.FormatDSN()); err != nil {
+		return "", err
+	}
+
+	// USE only changes the database of one connection, so the script runs on a single one
+	ctx := context.Background()
+	conn, err := s.admin.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	for _, statement := range splitScript(strings.ReplaceAll(string(script), scriptDatabase, name)) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return "", fmt.Errorf("%w, running %.80q", err, statement)
+		}
+	}
+
+	s.mysqlDb = name
+	config.DBName = name
+	return config.FormatDSN(), nil
+}
+
+// Deletes every row of the database but its schema version, on one connection so the foreign keys can be off
+func (s *Server) emptyMysqlDb() error {
+	ctx := context.Background()
+	conn, err := s.admin.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_name <> 'schema_version'", s.mysqlDb)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	statements := []string{"SET FOREIGN_KEY_CHECKS = 0"}
+	for _, table := range tables {
+		statements = append(statements, fmt.Sprintf("DELETE FROM `%s`.`%s`", s.mysqlDb, table))
+	}
+	statements = append(statements, "SET FOREIGN_KEY_CHECKS = 1")
+
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drops the database of the server and closes the admin connection
+func (s *Server) dropMysqlDb() error {
+	defer s.admin.Close()
+	_, err := s.admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", s.mysqlDb))
+	return err
+}
+
+// Gets the path of db/docker/init.sql from the path of this file
+func InitScript() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "db", "docker", "init.sql")
+}
+
+// Splits a script written for the mysql client into statements
+// Honours DELIMITER lines and drops the # comment lines, which would make a statement of their own empty
+func splitScript(script string) []string {
+	delimiter := ";"
+	var statements []string
+	var statement strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(strings.ToUpper(trimmed), "DELIMITER "):
+			delimiter = strings.TrimSpace(trimmed[len("DELIMITER "):])
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, delimiter) {
+			text := strings.TrimSpace(statement.String())
+			statements = append(statements, strings.TrimSpace(strings.TrimSuffix(text, delimiter)))
+			statement.Reset()
+		}
+	}
+
+	if text := strings.TrimSpace(statement.String()); text != "" {
+		statements = append(statements, text)
+	}
+	return statements
+}
@@ -0,0 +1,106 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func Test_Apply_DryRunDoesNotChangeState(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+
+	groupName := util.RandStringBytes(32)
+	desired := client.DesiredState{Groups: []client.DesiredGroup{{Name: groupName, Members: []string{}}}}
+
+	// plan the group creation
+	plan, err := srv.Client.Apply(ctx, desired, client.ApplyOptions{DryRun: true})
+
+	assert.Nil(t, err)
+	assert.True(t, plan.DryRun)
+	assert.Contains(t, plan.Actions, model.RestAction{Op: "create_group", Group: groupName})
+
+	// group was not created
+	_, err = srv.Client.GetGroup(ctx, groupName)
+
+	assert.True(t, client.IsNotFound(err))
+}
+
+func Test_Apply_CreatesGroupWithMembers(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+
+	// create user
+	randStr := util.RandStringBytes(32)
+	err := srv.Client.CreateUser(ctx, client.User{FirstName: randStr, LastName: randStr, UserId: randStr})
+
+	assert.Nil(t, err)
+
+	// apply a group containing the user
+	groupName := util.RandStringBytes(32)
+	desired := client.DesiredState{Groups: []client.DesiredGroup{{Name: groupName, Members: []string{randStr}}}}
+	_, err = srv.Client.Apply(ctx, desired, client.ApplyOptions{})
+
+	assert.Nil(t, err)
+
+	// get group
+	members, err := srv.Client.GetGroup(ctx, groupName)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{randStr}, members.UserIds)
+
+	// applying again is a no-op for this group
+	plan, err := srv.Client.Apply(ctx, desired, client.ApplyOptions{DryRun: true})
+
+	assert.Nil(t, err)
+	for _, action := range plan.Actions {
+		assert.NotEqual(t, groupName, action.Group)
+	}
+}
+
+func Test_Apply_UnknownUserRollsBack(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+
+	groupName := util.RandStringBytes(32)
+	userId := util.RandStringBytes(32)
+	desired := client.DesiredState{Groups: []client.DesiredGroup{{Name: groupName, Members: []string{userId}}}}
+	_, err := srv.Client.Apply(ctx, desired, client.ApplyOptions{})
+
+	assert.True(t, client.IsNotFound(err))
+
+	// group creation was rolled back
+	_, err = srv.Client.GetGroup(ctx, groupName)
+
+	assert.True(t, client.IsNotFound(err))
+}
+
+func Test_Apply_DuplicateGroup(t *testing.T) {
+	srv := harness.New(t)
+	groupName := util.RandStringBytes(32)
+	desired := client.DesiredState{Groups: []client.DesiredGroup{{Name: groupName}, {Name: groupName}}}
+	_, err := srv.Client.Apply(context.Background(), desired, client.ApplyOptions{})
+
+	assert.Equal(t, 400, client.StatusCode(err))
+}
+
+func Test_Apply_DuplicateMember(t *testing.T) {
+	srv := harness.New(t)
+	userId := srv.CreateUser(util.RandStringBytes(16)).UserId
+
+	groupName := util.RandStringBytes(32)
+	desired := client.DesiredState{Groups: []client.DesiredGroup{{Name: groupName, Members: []string{userId, userId}}}}
+	_, err := srv.Client.Apply(context.Background(), desired, client.ApplyOptions{})
+
+	assert.Equal(t, 400, client.StatusCode(err))
+
+	// nothing was applied
+	_, err = srv.Client.GetGroup(context.Background(), groupName)
+
+	assert.True(t, client.IsNotFound(err))
+}
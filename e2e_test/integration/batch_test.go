@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+func Test_Batch_CreatesGroupAndMembers(t *testing.T) {
+	ctx := context.Background()
+	srv := harness.New(t)
+
+	results, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceGroup, Group: "admins"},
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceUser, User: &client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex"}},
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceUser, User: &client.User{FirstName: "Lois", LastName: "Lane", UserId: "lois", Groups: &[]string{"admins"}}},
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceMembership, Group: "admins", UserId: "lex"},
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []client.OperationResult{
+		{Index: 0, Op: "create", Resource: "group", Status: 201},
+		{Index: 1, Op: "create", Resource: "user", Status: 201},
+		{Index: 2, Op: "create", Resource: "user", Status: 201},
+		{Index: 3, Op: "create", Resource: "membership", Status: 201},
+	}, results)
+
+	members, err := srv.Client.GetGroup(ctx, "admins")
+
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"lex", "lois"}, members.UserIds)
+}
+
+func Test_Batch_FailureRollsBackEverything(t *testing.T) {
+	ctx := context.Background()
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
+
+	_, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceGroup, Group: "users"},
+		client.Operation{Op: client.OpDelete, Resource: client.ResourceUser, UserId: "lex"},
+		client.Operation{Op: client.OpUpdate, Resource: client.ResourceGroup, Group: "missing", UserIds: &[]string{"lex"}},
+	)
+
+	// the failing operation is reported
+	var clientErr *client.Error
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, 404, clientErr.StatusCode)
+	assert.Equal(t, client.ErrorCode("GROUP_NOT_FOUND"), clientErr.Problem.Code)
+	if assert.NotNil(t, clientErr.Problem.Index) {
+		assert.Equal(t, 2, *clientErr.Problem.Index)
+	}
+
+	// and nothing before it was kept
+	_, err = srv.Client.GetGroup(ctx, "users")
+
+	assert.True(t, client.IsNotFound(err))
+
+	user, err := srv.Client.GetUser(ctx, "lex")
+
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"admins"}, user.Groups)
+}
+
+func Test_Batch_DuplicateInsideBatch(t *testing.T) {
+	ctx := context.Background()
+	srv := harness.New(t)
+
+	_, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceGroup, Group: "admins"},
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceGroup, Group: "admins"},
+	)
+
+	assert.True(t, client.HasCode(err, "DUPLICATE_GROUP"))
+
+	groups, err := srv.Client.ListGroups(ctx)
+
+	assert.Nil(t, err)
+	assert.Empty(t, groups)
+}
+
+func Test_Batch_InvalidOperationRunsNothing(t *testing.T) {
+	ctx := context.Background()
+	srv := harness.New(t)
+
+	_, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceGroup, Group: "admins"},
+		client.Operation{Op: client.OpUpdate, Resource: client.ResourceMembership, Group: "admins", UserId: "lex"},
+	)
+
+	var clientErr *client.Error
+	assert.True(t, errors.As(err, &clientErr))
+	assert.Equal(t, client.ErrorCode("VALIDATION_FAILED"), clientErr.Problem.Code)
+	assert.Equal(t, "operations[1].op", clientErr.Problem.Errors[0].Field)
+
+	_, err = srv.Client.GetGroup(ctx, "admins")
+
+	assert.True(t, client.IsNotFound(err))
+}
+
+func Test_Batch_UpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateGroup("users")
+	srv.CreateUser("lex", "admins")
+	srv.CreateUser("lois")
+
+	results, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpUpdate, Resource: client.ResourceUser, User: &client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex", Groups: &[]string{"users"}}},
+		client.Operation{Op: client.OpUpdate, Resource: client.ResourceGroup, Group: "admins", UserIds: &[]string{"lois"}},
+		client.Operation{Op: client.OpDelete, Resource: client.ResourceMembership, Group: "users", UserId: "lex"},
+		client.Operation{Op: client.OpDelete, Resource: client.ResourceGroup, Group: "users"},
+	)
+
+	assert.Nil(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, 200, results[3].Status)
+
+	user, err := srv.Client.GetUser(ctx, "lex")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Lex", user.FirstName)
+	assert.Equal(t, &[]string{}, user.Groups)
+
+	members, err := srv.Client.GetGroup(ctx, "admins")
+
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"lois"}, members.UserIds)
+}
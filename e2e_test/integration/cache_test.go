@@ -0,0 +1,102 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func getUser(t *testing.T, srv *harness.Server, userId string) client.User {
+	user, err := srv.Client.GetUser(context.Background(), userId)
+
+	assert.Nil(t, err)
+	return user
+}
+
+func getGroupUsers(t *testing.T, srv *harness.Server, groupName string) []string {
+	members, err := srv.Client.GetGroup(context.Background(), groupName)
+
+	assert.Nil(t, err)
+	if members.UserIds == nil {
+		return []string{}
+	}
+	return *members.UserIds
+}
+
+func getUserGroups(t *testing.T, srv *harness.Server, userId string) []string {
+	user := getUser(t, srv, userId)
+	if user.Groups == nil {
+		return []string{}
+	}
+	return *user.Groups
+}
+
+func Test_Cache_UserUpdateIsVisible(t *testing.T) {
+	srv := harness.New(t)
+	groupName := util.RandStringBytes(32)
+	ctx := context.Background()
+	err := srv.Client.CreateGroup(ctx, groupName)
+	assert.Nil(t, err)
+
+	userId := util.RandStringBytes(32)
+	err = srv.Client.CreateUser(ctx, client.User{FirstName: "a", LastName: "b", UserId: userId})
+	assert.Nil(t, err)
+
+	// fill the caches of the user and the group
+	assert.Empty(t, getUserGroups(t, srv, userId))
+	assert.Empty(t, getGroupUsers(t, srv, groupName))
+
+	err = srv.Client.UpdateUser(ctx, client.User{FirstName: "c", LastName: "b", UserId: userId, Groups: &[]string{groupName}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "c", getUser(t, srv, userId).FirstName)
+	assert.Equal(t, []string{groupName}, getUserGroups(t, srv, userId))
+	assert.Equal(t, []string{userId}, getGroupUsers(t, srv, groupName))
+}
+
+func Test_Cache_GroupDeleteIsVisible(t *testing.T) {
+	srv := harness.New(t)
+	groupName := util.RandStringBytes(32)
+	ctx := context.Background()
+	err := srv.Client.CreateGroup(ctx, groupName)
+	assert.Nil(t, err)
+
+	userId := util.RandStringBytes(32)
+	err = srv.Client.CreateUser(ctx, client.User{FirstName: "a", LastName: "b", UserId: userId, Groups: &[]string{groupName}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{groupName}, getUserGroups(t, srv, userId))
+
+	err = srv.Client.DeleteGroup(ctx, groupName)
+	assert.Nil(t, err)
+
+	assert.Empty(t, getUserGroups(t, srv, userId))
+}
+
+func Test_Cache_BatchIsVisible(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("eng")
+	srv.CreateGroup("ops")
+	srv.CreateUser("ann", "eng")
+	ctx := context.Background()
+
+	// fill the caches of the user and the groups
+	assert.Equal(t, []string{"eng"}, getUserGroups(t, srv, "ann"))
+	assert.Equal(t, []string{"ann"}, getGroupUsers(t, srv, "eng"))
+	assert.Empty(t, getGroupUsers(t, srv, "ops"))
+
+	// the user update sees the membership the batch added before it
+	_, err := srv.Client.Batch(ctx,
+		client.Operation{Op: client.OpCreate, Resource: client.ResourceMembership, Group: "ops", UserId: "ann"},
+		client.Operation{Op: client.OpUpdate, Resource: client.ResourceUser, User: &client.User{FirstName: "a", LastName: "b", UserId: "ann", Groups: &[]string{"eng"}}},
+	)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"eng"}, getUserGroups(t, srv, "ann"))
+	assert.Equal(t, []string{"ann"}, getGroupUsers(t, srv, "eng"))
+	assert.Empty(t, getGroupUsers(t, srv, "ops"))
+}
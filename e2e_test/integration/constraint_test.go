@@ -0,0 +1,252 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Sets the member constraints of a group under the auto approval, failing the test if it can not
+func constrainGroup(t *testing.T, srv *harness.Server, group string, policy client.GroupPolicy) {
+	t.Helper()
+	policy.Approval = model.ApprovalAuto
+	if err := srv.Admin.UpdateGroupPolicy(context.Background(), group, policy); err != nil {
+		t.Fatalf("constraining group %s: %v", group, err)
+	}
+}
+
+// Returns a pointer to a member limit
+func limit(n uint64) *uint64 {
+	return &n
+}
+
+func Test_Constraint_MaxMembers(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("eng")
+	srv.CreateUser("ann", "eng")
+	srv.CreateUser("bob")
+	constrainGroup(t, srv, "eng", client.GroupPolicy{MaxMembers: limit(2)})
+	ctx := context.Background()
+
+	srv.CreateUser("cat")
+	err := srv.Client.UpdateGroup(ctx, "eng", client.GroupMembers{UserIds: &[]string{"ann", "bob", "cat"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+	assert.Equal(t, http.StatusConflict, client.StatusCode(err))
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "ann").Groups)
+	assert.Equal(t, &[]string{}, getUser(t, srv, "bob").Groups)
+
+	bob := getUser(t, srv, "bob")
+	bob.Groups = &[]string{"eng"}
+	assert.Nil(t, srv.Client.UpdateUser(ctx, bob))
+
+	err = srv.Client.CreateUser(ctx, client.User{FirstName: "dan", LastName: "dan", UserId: "dan", Groups: &[]string{"eng"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+	_, err = srv.Client.GetUser(ctx, "dan")
+	assert.True(t, client.IsNotFound(err))
+
+	cat := getUser(t, srv, "cat")
+	cat.Groups = &[]string{"eng"}
+	assert.True(t, client.HasCode(srv.Client.UpdateUser(ctx, cat), model.PolicyViolation))
+
+	// swapping a member keeps the size
+	assert.Nil(t, srv.Client.UpdateGroup(ctx, "eng", client.GroupMembers{UserIds: &[]string{"ann", "cat"}}))
+}
+
+func Test_Constraint_MinMembers(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("ann")
+	srv.CreateUser("bob")
+	srv.CreateGroup("eng", "ann", "bob")
+	srv.CreateGroup("ops")
+	constrainGroup(t, srv, "eng", client.GroupPolicy{MinMembers: limit(2)})
+	ctx := context.Background()
+
+	err := srv.Client.UpdateGroup(ctx, "eng", client.GroupMembers{UserIds: &[]string{"ann"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+
+	ann := getUser(t, srv, "ann")
+	ann.Groups = &[]string{"ops"}
+	assert.True(t, client.HasCode(srv.Client.UpdateUser(ctx, ann), model.PolicyViolation))
+
+	status, code := sendPatch(t, srv.URL+"/groups/eng", "application/json-patch+json", `[{"op":"remove","path":"/userids/0"}]`)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, model.PolicyViolation, code)
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "ann").Groups)
+
+	// growing is still allowed
+	srv.CreateUser("cat", "eng")
+}
+
+func Test_Constraint_ConcurrentAddsRespectMaxMembers(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("eng")
+	constrainGroup(t, srv, "eng", client.GroupPolicy{MaxMembers: limit(1)})
+
+	users := make([]client.User, 16)
+	for i := range users {
+		users[i] = client.User{FirstName: "user", LastName: "user", UserId: fmt.Sprintf("user%d", i), Groups: &[]string{"eng"}}
+		srv.CreateUser(users[i].UserId)
+	}
+
+	// a connection per user, opened beforehand, so the writes reach the server together and their transactions overlap
+	c := client.New(srv.URL, client.WithRetries(0, 0), client.WithHTTPClient(&http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: len(users)}}))
+	concurrently := func(call func(user client.User) error) []error {
+		start := make(chan struct{})
+		errs := make([]error, len(users))
+		var wg sync.WaitGroup
+		for i := range users {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				errs[i] = call(users[i])
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		return errs
+	}
+	concurrently(func(user client.User) error {
+		_, err := c.GetUser(context.Background(), user.UserId)
+		return err
+	})
+
+	added := 0
+	for _, err := range concurrently(func(user client.User) error { return c.UpdateUser(context.Background(), user) }) {
+		if err == nil {
+			added++
+		} else {
+			assert.True(t, client.HasCode(err, model.PolicyViolation), err)
+		}
+	}
+	assert.Equal(t, 1, added)
+	assert.Len(t, getGroupUsers(t, srv, "eng"), 1)
+}
+
+func Test_Constraint_MinMembersOnUserDelete(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("ann")
+	srv.CreateUser("bob")
+	srv.CreateGroup("eng", "ann", "bob")
+	constrainGroup(t, srv, "eng", client.GroupPolicy{MinMembers: limit(2)})
+	ctx := context.Background()
+
+	err := srv.Client.DeleteUser(ctx, "ann")
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "ann").Groups)
+
+	srv.CreateUser("cat", "eng")
+	assert.Nil(t, srv.Client.DeleteUser(ctx, "ann"))
+	assert.Equal(t, []string{"bob", "cat"}, getGroupUsers(t, srv, "eng"))
+}
+
+func Test_Constraint_UserIdPattern(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("svc")
+	constrainGroup(t, srv, "svc", client.GroupPolicy{UserIdPattern: "^svc-"})
+	srv.CreateUser("svc-build", "svc")
+	ctx := context.Background()
+
+	err := srv.Client.CreateUser(ctx, client.User{FirstName: "ann", LastName: "ann", UserId: "ann", Groups: &[]string{"svc"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+
+	srv.CreateUser("ann")
+	err = srv.Client.UpdateGroup(ctx, "svc", client.GroupMembers{UserIds: &[]string{"svc-build", "ann"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+}
+
+func Test_Constraint_ExclusiveWith(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("interns")
+	srv.CreateGroup("admins")
+	constrainGroup(t, srv, "admins", client.GroupPolicy{ExclusiveWith: &[]string{"interns"}})
+	srv.CreateUser("ann", "interns")
+	ctx := context.Background()
+
+	policy, err := srv.Client.GetGroupPolicy(ctx, "admins")
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"interns"}, policy.ExclusiveWith)
+
+	ann := getUser(t, srv, "ann")
+	ann.Groups = &[]string{"interns", "admins"}
+	assert.True(t, client.HasCode(srv.Client.UpdateUser(ctx, ann), model.PolicyViolation))
+
+	// the exclusion holds from either side
+	srv.CreateUser("bob", "admins")
+	err = srv.Client.UpdateGroup(ctx, "interns", client.GroupMembers{UserIds: &[]string{"ann", "bob"}})
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+
+	// moving between the groups in one write is fine
+	ann.Groups = &[]string{"admins"}
+	assert.Nil(t, srv.Client.UpdateUser(ctx, ann))
+}
+
+func Test_Constraint_PolicyCheckedAgainstMembers(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("ann")
+	srv.CreateUser("bob")
+	srv.CreateGroup("eng", "ann", "bob")
+	srv.CreateGroup("ops", "bob")
+	ctx := context.Background()
+
+	for _, policy := range []client.GroupPolicy{
+		{Approval: model.ApprovalAuto, MaxMembers: limit(1)},
+		{Approval: model.ApprovalAuto, UserIdPattern: "^a"},
+		{Approval: model.ApprovalAuto, ExclusiveWith: &[]string{"ops"}},
+	} {
+		err := srv.Admin.UpdateGroupPolicy(ctx, "eng", policy)
+		assert.True(t, client.HasCode(err, model.PolicyViolation))
+	}
+
+	policy, err := srv.Client.GetGroupPolicy(ctx, "eng")
+	assert.Nil(t, err)
+	assert.Nil(t, policy.MaxMembers)
+	assert.Equal(t, "", policy.UserIdPattern)
+
+	err = srv.Admin.UpdateGroupPolicy(ctx, "eng", client.GroupPolicy{Approval: model.ApprovalAuto, ExclusiveWith: &[]string{"nope"}})
+	assert.True(t, client.HasCode(err, model.GroupNotFound))
+}
+
+func Test_Constraint_ApprovalBlockedWhenFull(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+
+	policy, err := srv.Client.GetGroupPolicy(ctx, "eng")
+	assert.Nil(t, err)
+	policy.MaxMembers = limit(0)
+	assert.Nil(t, srv.Admin.UpdateGroupPolicy(ctx, "eng", policy))
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+
+	_, err = as(srv, "ann").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.PolicyViolation))
+
+	request, err = srv.Client.GetMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestPending, request.State)
+	assert.Equal(t, &[]string{}, getUser(t, srv, "cat").Groups)
+}
+
+func Test_Constraint_InvalidPolicy(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("eng")
+	ctx := context.Background()
+
+	for _, policy := range []client.GroupPolicy{
+		{Approval: model.ApprovalAuto, MaxMembers: limit(1), MinMembers: limit(2)},
+		{Approval: model.ApprovalAuto, UserIdPattern: "[a-"},
+		{Approval: model.ApprovalAuto, ExclusiveWith: &[]string{"ENG"}},
+	} {
+		err := srv.Admin.UpdateGroupPolicy(ctx, "eng", policy)
+		assert.True(t, client.HasCode(err, model.ValidationFailed))
+	}
+}
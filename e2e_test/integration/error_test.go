@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func Test_Error_UserNotFoundIsAProblem(t *testing.T) {
+	srv := harness.New(t)
+	randStr := util.RandStringBytes(32)
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/users/%s", srv.URL, randStr), nil)
+	req.Header.Set("X-Request-ID", randStr)
+
+	var problem model.RestProblem
+	r, err := http.DefaultClient.Do(req)
+	if err := json.NewDecoder(r.Body).Decode(&problem); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, "application/problem+json", r.Header.Get("Content-Type"))
+	assert.Equal(t, randStr, r.Header.Get("X-Request-ID"))
+	assert.Equal(t, model.UserNotFound, problem.Code)
+	assert.Equal(t, 404, problem.Status)
+	assert.Equal(t, "/users/"+randStr, problem.Instance)
+	assert.Equal(t, randStr, problem.RequestId)
+}
+
+func Test_Error_ValidationListsEveryField(t *testing.T) {
+	srv := harness.New(t)
+	payload := `{"first_name":"", "last_name":"", "userid":""}`
+
+	var problem model.RestProblem
+	r, err := http.Post(fmt.Sprintf("%s/users", srv.URL), "application/json", strings.NewReader(payload))
+	if err := json.NewDecoder(r.Body).Decode(&problem); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, r.StatusCode)
+	assert.Equal(t, model.ValidationFailed, problem.Code)
+	assert.NotEmpty(t, problem.RequestId)
+
+	fields := []string{}
+	for _, fieldError := range problem.Errors {
+		fields = append(fields, fieldError.Field)
+	}
+	assert.Contains(t, fields, "first_name")
+	assert.Contains(t, fields, "last_name")
+	assert.Contains(t, fields, "userid")
+}
+
+func Test_Error_DuplicateUserHasCode(t *testing.T) {
+	srv := harness.New(t)
+	randStr := util.RandStringBytes(32)
+	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `"}`
+	r, err := http.Post(fmt.Sprintf("%s/users", srv.URL), "application/json", strings.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, 201, r.StatusCode)
+	r.Body.Close()
+
+	var problem model.RestProblem
+	r, err = http.Post(fmt.Sprintf("%s/users", srv.URL), "application/json", strings.NewReader(payload))
+	if err := json.NewDecoder(r.Body).Decode(&problem); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, r.StatusCode)
+	assert.Equal(t, model.DuplicateUser, problem.Code)
+}
+
+func Test_Error_UnknownRouteIsAProblem(t *testing.T) {
+	srv := harness.New(t)
+	var problem model.RestProblem
+	r, err := http.Get(fmt.Sprintf("%s/no-such-route", srv.URL))
+	if err := json.NewDecoder(r.Body).Decode(&problem); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, model.RouteNotFound, problem.Code)
+}
+
+func Test_Error_BodyTooLarge(t *testing.T) {
+	srv := harness.New(t)
+	randStr := util.RandStringBytes(32)
+	payload := `{"first_name":"` + strings.Repeat("a", 2<<20) + `", "last_name":"` + randStr + `", "userid":"` + randStr + `"}`
+
+	var problem model.RestProblem
+	r, err := http.Post(fmt.Sprintf("%s/users", srv.URL), "application/json", strings.NewReader(payload))
+	if err := json.NewDecoder(r.Body).Decode(&problem); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 413, r.StatusCode)
+	assert.Equal(t, model.RequestTooLarge, problem.Code)
+}
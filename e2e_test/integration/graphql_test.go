@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func sendGraphql(t *testing.T, srv *harness.Server, query string) graphqlResponse {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	r, err := http.Post(fmt.Sprintf("%s/graphql", srv.URL), "application/json", bytes.NewBuffer(body))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+
+	var resp graphqlResponse
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		log.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	return resp
+}
+
+func Test_Graphql_UserGroupsMembers(t *testing.T) {
+	srv := harness.New(t)
+	// create group
+	groupName := util.RandStringBytes(32)
+	err := srv.Client.CreateGroup(context.Background(), groupName)
+
+	assert.Nil(t, err)
+
+	// create two users in the group
+	first := util.RandStringBytes(32)
+	second := util.RandStringBytes(32)
+	for _, userId := range []string{first, second} {
+		err := srv.Client.CreateUser(context.Background(), client.User{FirstName: userId, LastName: userId, UserId: userId, Groups: &[]string{groupName}})
+
+		assert.Nil(t, err)
+	}
+
+	// user -> groups -> other members in one round trip
+	resp := sendGraphql(t, srv, `{ user(userid: "`+first+`") { firstName groups { nodes { name members { totalCount nodes { userid } } } } } }`)
+
+	var data struct {
+		User struct {
+			FirstName string
+			Groups    struct {
+				Nodes []struct {
+					Name    string
+					Members struct {
+						TotalCount int
+						Nodes      []struct{ Userid string }
+					}
+				}
+			}
+		}
+	}
+	assert.Empty(t, resp.Errors)
+	assert.Nil(t, json.Unmarshal(resp.Data, &data))
+	assert.Equal(t, first, data.User.FirstName)
+	assert.Equal(t, groupName, data.User.Groups.Nodes[0].Name)
+	assert.Equal(t, 2, data.User.Groups.Nodes[0].Members.TotalCount)
+}
+
+func Test_Graphql_UserDoesNotExist(t *testing.T) {
+	srv := harness.New(t)
+	resp := sendGraphql(t, srv, `{ user(userid: "`+util.RandStringBytes(32)+`") { userid } }`)
+
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"user":null}`, string(resp.Data))
+}
+
+func Test_Graphql_CreateUserDuplicate(t *testing.T) {
+	srv := harness.New(t)
+	randStr := util.RandStringBytes(32)
+	mutation := `mutation { createUser(input: {userid: "` + randStr + `", firstName: "a", lastName: "b"}) { userid } }`
+
+	resp := sendGraphql(t, srv, mutation)
+	assert.Empty(t, resp.Errors)
+
+	resp = sendGraphql(t, srv, mutation)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, float64(400), resp.Errors[0].Extensions["status"])
+}
+
+func Test_Graphql_PageTooLarge(t *testing.T) {
+	srv := harness.New(t)
+	resp := sendGraphql(t, srv, `{ users(first: 1000) { totalCount } }`)
+
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, float64(400), resp.Errors[0].Extensions["status"])
+}
@@ -1,226 +1,154 @@
 package integration
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 	"testing"
-	"encoding/json"
-	"log"
 
 	"github.com/stretchr/testify/assert"
-	e "github.com/yassinekhaliqui/go-rest-service/e2e_test"
-	h "github.com/yassinekhaliqui/go-rest-service/pkg/http"
-	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
-	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
 )
 
 func Test_GroupGet_GroupExists(t *testing.T) {
-	// create group
-	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
 
 	// get group
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
+	_, err := srv.Client.GetGroup(context.Background(), "admins")
 
 	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
 }
 
 func Test_GroupGet_GroupWithUsers(t *testing.T) {
-	// create group
-	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
-
-	// create user
-	randStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
 
 	// get group
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
-	var restGroupMembers model.RestGroupMembers
-	if err := json.NewDecoder(r.Body).Decode(&restGroupMembers); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	members, err := srv.Client.GetGroup(context.Background(), "admins")
 
 	// check member is in the group
 	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
-	assert.Equal(t, &[]string{randStr}, restGroupMembers.UserIds)
+	assert.Equal(t, &[]string{"lex"}, members.UserIds)
 }
 
 func Test_GroupGet_GroupDoesNotExist(t *testing.T) {
-	groupName := util.RandStringBytes(32)
+	srv := harness.New(t)
+
+	_, err := srv.Client.GetGroup(context.Background(), "admins")
+
+	assert.True(t, client.IsNotFound(err))
+}
+
+func Test_GroupList_ContainsGroup(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateGroup("users")
 
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
+	// list groups
+	groups, err := srv.Client.ListGroups(context.Background())
 
 	assert.Nil(t, err)
-	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, []client.Group{{Name: "admins"}, {Name: "users"}}, groups)
 }
 
 func Test_GroupPost_GroupCreated(t *testing.T) {
-	randStr := util.RandStringBytes(32)
-	payload := `{"name":"` + randStr + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
+	srv := harness.New(t)
+
+	err := srv.Client.CreateGroup(context.Background(), "admins")
 
 	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
 }
 
 func Test_GroupPost_GroupAlreadyExists(t *testing.T) {
-	randStr := util.RandStringBytes(32)
-	payload := `{"name":"` + randStr + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
 
-	payload = `{"name":"` + randStr + `"}`
-	statusCode, err = h.SendPostRequest(e.URL, "/groups", payload)
+	err := srv.Client.CreateGroup(context.Background(), "admins")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 400, statusCode)
+	assert.Equal(t, 400, client.StatusCode(err))
 }
 
 func Test_GroupPost_InvalidPayload(t *testing.T) {
-	payload := `{"name":""}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
+	srv := harness.New(t)
 
-	assert.Nil(t, err)
-	assert.Equal(t, 400, statusCode)
+	err := srv.Client.CreateGroup(context.Background(), "")
+
+	assert.Equal(t, 400, client.StatusCode(err))
 }
 
 func Test_GroupPut_UpdateGroup(t *testing.T) {
-	// create group w/out members
-	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
+	ctx := context.Background()
+	srv := harness.New(t)
 
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
-
-	// create user w/out groups
-	randStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	// group and user w/out membership
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex")
 
 	// update group to add user
-	statusCode, err = h.SendPutRequest(e.URL, "/groups", groupName, `{"userids":["` + randStr +`"]}`)
+	err := srv.Client.UpdateGroup(ctx, "admins", client.GroupMembers{UserIds: &[]string{"lex"}})
 
 	assert.Nil(t, err)
-	assert.Equal(t, 200, statusCode)
 
 	// get group
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
-	var restGroupMembers model.RestGroupMembers
-	if err := json.NewDecoder(r.Body).Decode(&restGroupMembers); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	members, err := srv.Client.GetGroup(ctx, "admins")
 
 	// check member is in the group
 	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
-	assert.Equal(t, &[]string{randStr}, restGroupMembers.UserIds)
+	assert.Equal(t, &[]string{"lex"}, members.UserIds)
 }
 
 func Test_GroupPut_GroupDoesNotExist(t *testing.T) {
-	groupName := util.RandStringBytes(32)
+	srv := harness.New(t)
 
-	statusCode, err := h.SendPutRequest(e.URL, "/groups", groupName, `{"userids":["lex"]}`)
+	err := srv.Client.UpdateGroup(context.Background(), "admins", client.GroupMembers{UserIds: &[]string{"lex"}})
 
-	assert.Nil(t, err)
-	assert.Equal(t, 404, statusCode)
+	assert.True(t, client.IsNotFound(err))
 }
 
 func Test_GroupDel_GroupExist(t *testing.T) {
-	// create group w/out members
-	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	ctx := context.Background()
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
 
 	// delete group
-	statusCode, err = h.SendDelRequest(e.URL, "/groups", groupName)
+	err := srv.Client.DeleteGroup(ctx, "admins")
 
 	assert.Nil(t, err)
-	assert.Equal(t, 200, statusCode)
 
 	// try to get group
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
-	var restGroupMembers model.RestGroupMembers
-	if err := json.NewDecoder(r.Body).Decode(&restGroupMembers); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	_, err = srv.Client.GetGroup(ctx, "admins")
 
-	// check member is in the group
-	assert.Nil(t, err)
-	assert.Equal(t, 404, r.StatusCode)
+	assert.True(t, client.IsNotFound(err))
 }
 
 func Test_GroupDel_GroupDoesNotExist(t *testing.T) {
-	groupName := util.RandStringBytes(32)
+	srv := harness.New(t)
 
-	statusCode, err := h.SendDelRequest(e.URL, "/groups", groupName)
+	err := srv.Client.DeleteGroup(context.Background(), "admins")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 404, statusCode)
+	assert.True(t, client.IsNotFound(err))
 }
 
 func Test_GroupDel_GroupWithUsers(t *testing.T) {
-	// create group w/out members
-	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
-
-	// create user with group
-	randStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
-
-	assert.Nil(t, err)
-	assert.Equal(t, 201, statusCode)
+	ctx := context.Background()
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
 
 	// delete group
-	statusCode, err = h.SendDelRequest(e.URL, "/groups", groupName)
+	err := srv.Client.DeleteGroup(ctx, "admins")
 
 	assert.Nil(t, err)
-	assert.Equal(t, 200, statusCode)
 
 	// try to get group
-	r, err := http.Get(fmt.Sprintf("%s/groups/%s", e.URL, groupName))
-	var restGroupMembers model.RestGroupMembers
-	if err := json.NewDecoder(r.Body).Decode(&restGroupMembers); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	_, err = srv.Client.GetGroup(ctx, "admins")
+
+	assert.True(t, client.IsNotFound(err))
+
+	// user is still there w/out the group
+	user, err := srv.Client.GetUser(ctx, "lex")
 
-	// check member is in the group
 	assert.Nil(t, err)
-	assert.Equal(t, 404, r.StatusCode)
+	assert.Empty(t, *user.Groups)
 }
@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func dialGrpc(t *testing.T, srv *harness.Server) *grpc.ClientConn {
+	conn, err := grpc.NewClient(srv.GrpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func Test_Grpc_CreateUserWithGroup(t *testing.T) {
+	srv := harness.New(t)
+	conn := dialGrpc(t, srv)
+	groups := pb.NewGroupServiceClient(conn)
+	users := pb.NewUserServiceClient(conn)
+
+	// create group
+	groupName := util.RandStringBytes(32)
+	_, err := groups.CreateGroup(context.Background(), &pb.CreateGroupRequest{Name: groupName})
+	assert.Nil(t, err)
+
+	// create user in the group
+	randStr := util.RandStringBytes(32)
+	user, err := users.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{
+		FirstName: randStr,
+		LastName:  randStr,
+		Userid:    randStr,
+		Groups:    []string{groupName},
+	}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, randStr, user.GetUserid())
+	assert.Equal(t, []string{groupName}, user.GetGroups())
+
+	// group sees the member
+	group, err := groups.GetGroup(context.Background(), &pb.GetGroupRequest{Name: groupName})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{randStr}, group.GetUserids())
+}
+
+func Test_Grpc_UserDoesNotExist(t *testing.T) {
+	srv := harness.New(t)
+	users := pb.NewUserServiceClient(dialGrpc(t, srv))
+
+	_, err := users.GetUser(context.Background(), &pb.GetUserRequest{Userid: util.RandStringBytes(32)})
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func Test_Grpc_InvalidUser(t *testing.T) {
+	srv := harness.New(t)
+	users := pb.NewUserServiceClient(dialGrpc(t, srv))
+
+	_, err := users.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Grpc_AddAndRemoveMember(t *testing.T) {
+	srv := harness.New(t)
+	conn := dialGrpc(t, srv)
+	groups := pb.NewGroupServiceClient(conn)
+	users := pb.NewUserServiceClient(conn)
+	memberships := pb.NewMembershipServiceClient(conn)
+
+	groupName := util.RandStringBytes(32)
+	_, err := groups.CreateGroup(context.Background(), &pb.CreateGroupRequest{Name: groupName})
+	assert.Nil(t, err)
+
+	randStr := util.RandStringBytes(32)
+	_, err = users.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{FirstName: randStr, LastName: randStr, Userid: randStr}})
+	assert.Nil(t, err)
+
+	// add member
+	_, err = memberships.AddGroupMember(context.Background(), &pb.AddGroupMemberRequest{Group: groupName, Userid: randStr})
+	assert.Nil(t, err)
+
+	resp, err := memberships.ListUserGroups(context.Background(), &pb.ListUserGroupsRequest{Userid: randStr})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{groupName}, resp.GetGroups())
+
+	// remove member
+	_, err = memberships.RemoveGroupMember(context.Background(), &pb.RemoveGroupMemberRequest{Group: groupName, Userid: randStr})
+	assert.Nil(t, err)
+
+	members, err := memberships.ListGroupMembers(context.Background(), &pb.ListGroupMembersRequest{Group: groupName})
+	assert.Nil(t, err)
+	assert.Empty(t, members.GetUserids())
+}
+
+func Test_Grpc_DuplicateUser(t *testing.T) {
+	srv := harness.New(t)
+	users := pb.NewUserServiceClient(dialGrpc(t, srv))
+	userId := srv.CreateUser(util.RandStringBytes(16)).UserId
+
+	_, err := users.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{FirstName: userId, LastName: userId, Userid: userId}})
+
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
@@ -0,0 +1,46 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/health"
+)
+
+func Test_Health_Healthz(t *testing.T) {
+	srv := harness.New(t)
+	var report health.Report
+	r, err := http.Get(fmt.Sprintf("%s/healthz", srv.URL))
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, health.StatusOk, report.Status)
+}
+
+func Test_Health_ReadyzReportsEveryCheck(t *testing.T) {
+	srv := harness.New(t)
+	var report health.Report
+	r, err := http.Get(fmt.Sprintf("%s/readyz", srv.URL))
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, health.StatusOk, report.Status)
+	for _, name := range []string{"db", "schema", "workers"} {
+		assert.Equal(t, health.StatusOk, report.Checks[name].Status, "check %s", name)
+	}
+}
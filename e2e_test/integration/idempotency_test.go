@@ -0,0 +1,209 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Sends a POST with an Idempotency-Key and returns the status, the replayed header and the body
+func postWithKey(t *testing.T, url string, key string, payload string, header ...string) (int, string, string) {
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	assert.Nil(t, err)
+
+	return r.StatusCode, r.Header.Get("Idempotent-Replayed"), string(body)
+}
+
+func Test_Idempotency_RetryIsReplayed(t *testing.T) {
+	srv := harness.New(t)
+	url := fmt.Sprintf("%s/users", srv.URL)
+	payload := `{"first_name":"Lex","last_name":"Luthor","userid":"lex"}`
+
+	status, replayed, body := postWithKey(t, url, "create-lex", payload)
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "", replayed)
+
+	// the retry gets the first response instead of a duplicate error
+	retryStatus, retryReplayed, retryBody := postWithKey(t, url, "create-lex", payload)
+
+	assert.Equal(t, 201, retryStatus)
+	assert.Equal(t, "true", retryReplayed)
+	assert.Equal(t, body, retryBody)
+
+	// the same request without the key is a duplicate
+	status, _, _ = postWithKey(t, url, "", payload)
+
+	assert.Equal(t, 400, status)
+}
+
+func Test_Idempotency_KeyReusedWithDifferentRequest(t *testing.T) {
+	srv := harness.New(t)
+
+	status, _, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`)
+
+	assert.Equal(t, 201, status)
+
+	status, _, body := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"users"}`)
+
+	var problem model.RestProblem
+	assert.Nil(t, json.Unmarshal([]byte(body), &problem))
+	assert.Equal(t, 422, status)
+	assert.Equal(t, model.IdempotencyKeyReuse, problem.Code)
+
+	// nothing was created by the second request
+	groups, err := srv.Client.ListGroups(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, groups, 1)
+}
+
+func Test_Idempotency_KeysAreScopedToTheCaller(t *testing.T) {
+	srv := harness.New(t)
+
+	status, _, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`, harness.IdentityHeader, "CN=first")
+
+	assert.Equal(t, 201, status)
+
+	// another caller's key does not replay the first response
+	status, replayed, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`, harness.IdentityHeader, "CN=second")
+
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "", replayed)
+}
+
+func Test_Idempotency_ApiKeyDoesNotChangeTheScope(t *testing.T) {
+	srv := harness.New(t)
+
+	status, _, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`, "X-API-Key", "first")
+
+	assert.Equal(t, 201, status)
+
+	// the unverified header does not make the same caller another one
+	status, replayed, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`, "X-API-Key", "second")
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "true", replayed)
+}
+
+func Test_Idempotency_PanicReleasesTheKey(t *testing.T) {
+	srv := harness.New(t)
+	var calls atomic.Int32
+	srv.App.Router.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}).Methods(http.MethodPost)
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/flaky", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "flaky")
+	_, err := http.DefaultClient.Do(req)
+
+	assert.NotNil(t, err)
+
+	// the retry runs again instead of finding the key in progress
+	status, replayed, _ := postWithKey(t, srv.URL+"/flaky", "flaky", `{}`)
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "", replayed)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_Idempotency_ReservationExpiresAfterTheLease(t *testing.T) {
+	srv := harness.New(t, func(config *app.Config) { config.IDEMPOTENCY_LEASE = time.Second })
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.App.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}).Methods(http.MethodPost)
+
+	done := make(chan int)
+	go func() {
+		status, _, _ := postWithKey(t, srv.URL+"/slow", "slow", `{}`)
+		done <- status
+	}()
+	<-started
+
+	// a retry while the first request runs is rejected
+	status, _, _ := postWithKey(t, srv.URL+"/slow", "slow", `{}`)
+
+	assert.Equal(t, 409, status)
+
+	// a request that outlives its lease no longer holds the key
+	time.Sleep(1100 * time.Millisecond)
+	status, replayed, _ := postWithKey(t, srv.URL+"/slow", "slow", `{}`)
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "", replayed)
+	assert.Equal(t, int32(2), calls.Load())
+
+	close(release)
+	assert.Equal(t, 201, <-done)
+
+	// a stored response is kept for the TTL, not the lease
+	time.Sleep(1100 * time.Millisecond)
+	status, replayed, _ = postWithKey(t, srv.URL+"/slow", "slow", `{}`)
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "true", replayed)
+}
+
+func Test_Idempotency_ErrorsAreReplayed(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+
+	status, _, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`)
+
+	assert.Equal(t, 400, status)
+
+	// deleting the group does not change the outcome of a retry
+	assert.Nil(t, srv.Client.DeleteGroup(context.Background(), "admins"))
+
+	status, replayed, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`)
+
+	assert.Equal(t, 400, status)
+	assert.Equal(t, "true", replayed)
+}
+
+func Test_Idempotency_KeyExpires(t *testing.T) {
+	srv := harness.New(t, func(config *app.Config) { config.IDEMPOTENCY_TTL = time.Second })
+
+	status, _, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"admins"}`)
+
+	assert.Equal(t, 201, status)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// once expired the key can be used for another request
+	status, replayed, _ := postWithKey(t, srv.URL+"/groups", "create-group", `{"name":"users"}`)
+
+	assert.Equal(t, 201, status)
+	assert.Equal(t, "", replayed)
+}
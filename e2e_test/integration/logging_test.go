@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/logging"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+// Collects the json records logged while a test runs, the default logger is restored when it ends
+type logRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func recordLogs(t *testing.T) *logRecorder {
+	recorder := &logRecorder{}
+	logger, err := logging.New(recorder, "info", "json")
+	assert.Nil(t, err)
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return recorder
+}
+
+func (l *logRecorder) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+// Waits for the access log record of the request with the given id
+func (l *logRecorder) accessRecord(t *testing.T, requestId string) map[string]interface{} {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		lines := bytes.Split(l.buf.Bytes(), []byte("\n"))
+		l.mu.Unlock()
+
+		for _, line := range lines {
+			var record map[string]interface{}
+			if json.Unmarshal(line, &record) == nil && record["msg"] == "request" && record["request_id"] == requestId {
+				return record
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("no access log record for request %s", requestId)
+	return nil
+}
+
+func Test_Logging_AccessLogHasRequestFields(t *testing.T) {
+	srv := harness.New(t)
+	logs := recordLogs(t)
+
+	requestId := util.RandStringBytes(32)
+	userId := util.RandStringBytes(32)
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/users/%s", srv.URL, userId), nil)
+	req.Header.Set("X-Request-ID", requestId)
+	req.Header.Set("User-Agent", "logging-test")
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	r.Body.Close()
+
+	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, requestId, r.Header.Get("X-Request-ID"))
+
+	record := logs.accessRecord(t, requestId)
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, http.MethodGet, record["method"])
+	assert.Equal(t, "/users/"+userId, record["path"])
+	assert.Equal(t, "/users/{userid}", record["route"])
+	assert.Equal(t, float64(404), record["status"])
+	assert.NotZero(t, record["bytes"])
+	assert.Contains(t, record, "duration_ms")
+	assert.Equal(t, "127.0.0.1", record["client"])
+	assert.Equal(t, "logging-test", record["user_agent"])
+	assert.Contains(t, record, "trace_id")
+}
+
+func Test_Logging_GeneratesMissingRequestId(t *testing.T) {
+	srv := harness.New(t)
+	logs := recordLogs(t)
+
+	r, err := http.Get(fmt.Sprintf("%s/users/%s", srv.URL, util.RandStringBytes(32)))
+	assert.Nil(t, err)
+	r.Body.Close()
+
+	// the generated id is echoed and logged
+	requestId := r.Header.Get("X-Request-ID")
+	assert.Len(t, requestId, 32)
+	logs.accessRecord(t, requestId)
+}
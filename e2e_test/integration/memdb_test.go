@@ -0,0 +1,70 @@
+package integration
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/health"
+	"github.com/yassinekhaliqui/go-rest-service/internal/memdb"
+)
+
+var (
+	createProcedureRegex = regexp.MustCompile(`(?i)CREATE PROCEDURE\s+(\w+)\s*\(`)
+	schemaVersionRegex   = regexp.MustCompile(`(?i)INSERT INTO schema_version\s*\(version\)\s*VALUES\s*\((\d+)\)`)
+)
+
+// Gets the number of parameters of every procedure declared in init.sql by name
+func declaredProcedures(script string) map[string]int {
+	procedures := map[string]int{}
+	for _, match := range createProcedureRegex.FindAllStringSubmatchIndex(script, -1) {
+		name := script[match[2]:match[3]]
+
+		// the parameter list ends at the parenthesis that closes the one after the name, types like VARCHAR(64) nest
+		depth, params, empty := 1, 1, true
+		for _, c := range script[match[1]:] {
+			switch {
+			case c == '(':
+				depth++
+			case c == ')':
+				depth--
+			case c == ',' && depth == 1:
+				params++
+			case !strings.ContainsRune(" \t\r\n", c):
+				empty = false
+			}
+			if depth == 0 {
+				break
+			}
+		}
+
+		if empty {
+			params = 0
+		}
+		procedures[name] = params
+	}
+	return procedures
+}
+
+// The default test run uses memdb, so its procedures must be the ones that ship in init.sql
+// Run the tests with TEST_MYSQL_DSN to also check they behave the same
+func Test_Memdb_MatchesInitScript(t *testing.T) {
+	script, err := os.ReadFile(harness.InitScript())
+	assert.Nil(t, err)
+
+	declared := declaredProcedures(string(script))
+
+	assert.NotEmpty(t, declared)
+	assert.Equal(t, declared, memdb.Procedures())
+
+	match := schemaVersionRegex.FindStringSubmatch(string(script))
+	if assert.NotNil(t, match, "init.sql does not insert a schema_version") {
+		version, _ := strconv.Atoi(match[1])
+		assert.Equal(t, version, memdb.SchemaVersion)
+		assert.Equal(t, version, health.SchemaVersion)
+	}
+}
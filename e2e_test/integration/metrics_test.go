@@ -0,0 +1,34 @@
+package integration
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func Test_Metrics_RecordsRouteTemplates(t *testing.T) {
+	srv := harness.New(t)
+	// a request for a user that does not exist is recorded under the route template
+	r, err := http.Get(fmt.Sprintf("%s/users/%s", srv.URL, util.RandStringBytes(32)))
+	assert.Nil(t, err)
+	r.Body.Close()
+
+	r, err = http.Get(fmt.Sprintf("%s/metrics", srv.URL))
+	assert.Nil(t, err)
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Contains(t, string(body), `membership_http_requests_total{code="404",method="GET",route="/users/{userid}"}`)
+	assert.Contains(t, string(body), `membership_db_query_duration_seconds_count{outcome="ok",query="get_user"}`)
+	assert.Contains(t, string(body), `go_sql_max_open_connections{db_name="membership"}`)
+	assert.Contains(t, string(body), "membership_users ")
+	assert.Contains(t, string(body), "membership_groups ")
+	assert.Contains(t, string(body), "membership_memberships ")
+}
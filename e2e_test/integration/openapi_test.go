@@ -0,0 +1,66 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+)
+
+// Routes that are not part of the REST api the document describes
+// SCIM follows RFC 7644, GraphQL serves its own schema and the others are for operators
+var undocumentedRoutes = []string{"/scim/v2/", "/graphql", "/metrics", "/healthz", "/readyz", "/openapi.json"}
+
+func Test_OpenApi_DocumentsEveryRoute(t *testing.T) {
+	srv := harness.New(t)
+	r, err := http.Get(fmt.Sprintf("%s/openapi.json", srv.URL))
+	var document struct {
+		OpenApi string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, "3.0.3", document.OpenApi)
+
+	// every route of the router, also the ones under the tenant prefix, has an operation
+	routes := 0
+	err = srv.App.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path = strings.TrimPrefix(path, "/tenants/{"+tenant.PathVar+"}")
+		for _, prefix := range undocumentedRoutes {
+			if strings.HasPrefix(path, prefix) {
+				return nil
+			}
+		}
+
+		for _, method := range methods {
+			routes++
+			assert.Contains(t, document.Paths[path], strings.ToLower(method), "%s %s is not documented", method, path)
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.NotZero(t, routes)
+}
@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Sends a PATCH with the given content type and returns the status and the problem code, if any
+func sendPatch(t *testing.T, url string, contentType string, payload string) (int, model.ErrorCode) {
+	req, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(payload))
+	req.Header.Set("Content-Type", contentType)
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	assert.Nil(t, err)
+
+	var problem model.RestProblem
+	json.Unmarshal(body, &problem)
+	return r.StatusCode, problem.Code
+}
+
+func Test_UserPatch_MergePatchChangesOneField(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
+
+	status, _ := sendPatch(t, srv.URL+"/users/lex", "application/merge-patch+json", `{"last_name":"Luthor"}`)
+
+	assert.Equal(t, 200, status)
+
+	user := getUser(t, srv, "lex")
+	assert.Equal(t, "lex-first", user.FirstName)
+	assert.Equal(t, "Luthor", user.LastName)
+	assert.Equal(t, &[]string{"admins"}, user.Groups)
+}
+
+func Test_UserPatch_NameChangeRefreshesGroups(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
+
+	// the members of a SCIM group show their names, this fills the cache of the group
+	memberName := func() string {
+		r, err := http.Get(srv.URL + "/scim/v2/Groups/admins")
+		assert.Nil(t, err)
+		defer r.Body.Close()
+
+		var group model.ScimGroup
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&group))
+		assert.Len(t, group.Members, 1)
+		return group.Members[0].Display
+	}
+	assert.Equal(t, "lex-first lex-last", memberName())
+
+	status, _ := sendPatch(t, srv.URL+"/users/lex", "application/merge-patch+json", `{"last_name":"Luthor"}`)
+
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "lex-first Luthor", memberName())
+}
+
+func Test_UserPatch_JsonPatchAddsAndRemovesGroups(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateGroup("devs")
+	srv.CreateGroup("ops")
+	srv.CreateUser("lex", "admins", "devs")
+
+	payload := `[
+		{"op":"test","path":"/groups/0","value":"admins"},
+		{"op":"remove","path":"/groups/0"},
+		{"op":"add","path":"/groups/-","value":"ops"}
+	]`
+	status, _ := sendPatch(t, srv.URL+"/users/lex", "application/json-patch+json", payload)
+
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{"devs", "ops"}, getUserGroups(t, srv, "lex"))
+	assert.Equal(t, []string{}, getGroupUsers(t, srv, "admins"))
+	assert.Equal(t, []string{"lex"}, getGroupUsers(t, srv, "ops"))
+}
+
+func Test_UserPatch_FailedTestChangesNothing(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
+
+	payload := `[
+		{"op":"replace","path":"/last_name","value":"Luthor"},
+		{"op":"test","path":"/groups/0","value":"devs"}
+	]`
+	status, code := sendPatch(t, srv.URL+"/users/lex", "application/json-patch+json", payload)
+
+	assert.Equal(t, 409, status)
+	assert.Equal(t, model.PatchFailed, code)
+	assert.Equal(t, "lex-last", getUser(t, srv, "lex").LastName)
+}
+
+func Test_UserPatch_ConcurrentPatchesSeeEachOther(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+
+	// every patch only applies to the last name it was created with, so only one of them can
+	const patches = 8
+	statuses := make(chan int, patches)
+	var wg sync.WaitGroup
+	for i := 0; i < patches; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := fmt.Sprintf(`[
+				{"op":"test","path":"/last_name","value":"lex-last"},
+				{"op":"replace","path":"/last_name","value":"Luthor %d"}
+			]`, i)
+			status, _ := sendPatch(t, srv.URL+"/users/lex", "application/json-patch+json", payload)
+			statuses <- status
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	assert.Equal(t, map[int]int{200: 1, 409: patches - 1}, counts)
+	assert.Contains(t, getUser(t, srv, "lex").LastName, "Luthor")
+}
+
+func Test_UserPatch_UnknownGroupRollsBack(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	srv.CreateUser("lex", "admins")
+
+	status, code := sendPatch(t, srv.URL+"/users/lex", "application/merge-patch+json", `{"last_name":"Luthor","groups":["nope"]}`)
+
+	assert.Equal(t, 404, status)
+	assert.Equal(t, model.GroupNotFound, code)
+
+	user := getUser(t, srv, "lex")
+	assert.Equal(t, "lex-last", user.LastName)
+	assert.Equal(t, &[]string{"admins"}, user.Groups)
+}
+
+func Test_UserPatch_Rejected(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+
+	tests := []struct {
+		name        string
+		userId      string
+		contentType string
+		payload     string
+		status      int
+		code        model.ErrorCode
+	}{
+		{"unknown user", "clark", "application/merge-patch+json", `{"last_name":"Kent"}`, 404, model.UserNotFound},
+		{"plain json", "lex", "application/json", `{"last_name":"Luthor"}`, 415, model.UnsupportedMediaType},
+		{"changed userid", "lex", "application/merge-patch+json", `{"userid":"clark"}`, 400, model.ValidationFailed},
+		{"removed field", "lex", "application/merge-patch+json", `{"first_name":null}`, 400, model.ValidationFailed},
+		{"malformed patch", "lex", "application/json-patch+json", `[{"op":"jump","path":"/x"}]`, 400, model.MalformedRequest},
+		{"missing path", "lex", "application/json-patch+json", `[{"op":"remove","path":"/groups/3"}]`, 409, model.PatchFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, code := sendPatch(t, srv.URL+"/users/"+test.userId, test.contentType, test.payload)
+
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.code, code)
+		})
+	}
+}
+
+func Test_GroupPatch_JsonPatchAddsAndRemovesMembers(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+	srv.CreateUser("clark")
+	srv.CreateUser("bruce")
+	srv.CreateGroup("admins", "lex", "clark")
+
+	payload := `[
+		{"op":"remove","path":"/userids/1"},
+		{"op":"add","path":"/userids/-","value":"bruce"}
+	]`
+	status, _ := sendPatch(t, srv.URL+"/groups/admins", "application/json-patch+json", payload)
+
+	assert.Equal(t, 200, status)
+	assert.ElementsMatch(t, []string{"bruce", "clark"}, getGroupUsers(t, srv, "admins"))
+	assert.Equal(t, []string{}, getUserGroups(t, srv, "lex"))
+	assert.Equal(t, []string{"admins"}, getUserGroups(t, srv, "bruce"))
+}
+
+func Test_GroupPatch_EmptyGroup(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+	srv.CreateGroup("admins")
+
+	status, _ := sendPatch(t, srv.URL+"/groups/admins", "application/json-patch+json", `[{"op":"add","path":"/userids/-","value":"lex"}]`)
+
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{"lex"}, getGroupUsers(t, srv, "admins"))
+
+	// a merge patch replaces the list, but only the difference is applied
+	status, _ = sendPatch(t, srv.URL+"/groups/admins", "application/merge-patch+json", `{"userids":null}`)
+
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{}, getGroupUsers(t, srv, "admins"))
+}
+
+func Test_GroupPatch_UnknownUser(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+
+	status, code := sendPatch(t, srv.URL+"/groups/admins", "application/merge-patch+json", `{"userids":["lex"]}`)
+
+	assert.Equal(t, 404, status)
+	assert.Equal(t, model.UserNotFound, code)
+}
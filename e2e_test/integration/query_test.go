@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Creates eng with ann, bob and cat, oncall with bob, cat and dan, and "on call" with ann
+func createTeams(srv *harness.Server) {
+	for _, userId := range []string{"ann", "bob", "cat", "dan"} {
+		srv.CreateUser(userId)
+	}
+	srv.CreateGroup("eng", "ann", "bob", "cat")
+	srv.CreateGroup("oncall", "bob", "cat", "dan")
+	srv.CreateGroup("on call", "ann")
+}
+
+func queryUserIds(t *testing.T, srv *harness.Server, expr string) []string {
+	page, err := srv.Client.QueryGroups(context.Background(), expr, 0, 0)
+	assert.Nil(t, err)
+
+	userIds := []string{}
+	for _, user := range page.Users {
+		userIds = append(userIds, user.UserId)
+	}
+	return userIds
+}
+
+func Test_GroupQuery_SetOperations(t *testing.T) {
+	srv := harness.New(t)
+	createTeams(srv)
+
+	tests := []struct {
+		expr    string
+		userIds []string
+	}{
+		{"eng", []string{"ann", "bob", "cat"}},
+		{"eng union oncall", []string{"ann", "bob", "cat", "dan"}},
+		{"eng intersect oncall", []string{"bob", "cat"}},
+		{"eng except oncall", []string{"ann"}},
+		{"oncall except eng", []string{"dan"}},
+		// intersect binds tighter than union and except
+		{"eng except oncall intersect eng", []string{"ann"}},
+		{"(eng except oncall) union \"on call\"", []string{"ann"}},
+		{"ENG INTERSECT OnCall except \"on call\"", []string{"bob", "cat"}},
+		{"oncall intersect (eng except \"on call\")", []string{"bob", "cat"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			assert.Equal(t, test.userIds, queryUserIds(t, srv, test.expr))
+		})
+	}
+}
+
+func Test_GroupQuery_ReturnsFullUsers(t *testing.T) {
+	srv := harness.New(t)
+	createTeams(srv)
+
+	page, err := srv.Client.QueryGroups(context.Background(), "eng union oncall", 1, 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), page.Total)
+	assert.Equal(t, []client.User{
+		{FirstName: "bob-first", LastName: "bob-last", UserId: "bob", Groups: &[]string{"eng", "oncall"}},
+		{FirstName: "cat-first", LastName: "cat-last", UserId: "cat", Groups: &[]string{"eng", "oncall"}},
+	}, page.Users)
+}
+
+func Test_GroupQuery_Pages(t *testing.T) {
+	srv := harness.New(t)
+	createTeams(srv)
+	srv.CreateUser("100%d", "eng")
+
+	page, err := srv.Client.QueryGroups(context.Background(), "eng except oncall", 0, 1)
+
+	// the page is cut by the database, the total counts every user
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Len(t, page.Users, 1)
+	assert.Equal(t, "100%d", page.Users[0].UserId)
+
+	page, err = srv.Client.QueryGroups(context.Background(), "eng except oncall", 5, 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Len(t, page.Users, 0)
+}
+
+func Test_GroupQuery_Rejected(t *testing.T) {
+	srv := harness.New(t)
+	createTeams(srv)
+	ctx := context.Background()
+
+	for _, expr := range []string{"", "eng union", "(eng", "eng oncall", "union eng", "\"eng"} {
+		_, err := srv.Client.QueryGroups(ctx, expr, 0, 0)
+		assert.True(t, client.HasCode(err, model.ValidationFailed), expr)
+	}
+
+	_, err := srv.Client.QueryGroups(ctx, "eng except nope", 0, 0)
+	assert.True(t, client.HasCode(err, model.GroupNotFound))
+}
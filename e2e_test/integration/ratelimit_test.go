@@ -0,0 +1,75 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+// Creates a group with a raw request, sending the given X-API-Key when it is set
+func postGroup(t *testing.T, srv *harness.Server, apiKey string) *http.Response {
+	payload := fmt.Sprintf(`{"name":"%s"}`, util.RandStringBytes(16))
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/groups", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	return r
+}
+
+func Test_RateLimit_WritesOverTheBurstAreRejected(t *testing.T) {
+	srv := harness.New(t, func(config *app.Config) {
+		config.RATE_LIMIT_WRITE_RPS = 0.1
+		config.RATE_LIMIT_WRITE_BURST = 2
+	})
+
+	for i := 0; i < 2; i++ {
+		r := postGroup(t, srv, "")
+		r.Body.Close()
+
+		assert.Equal(t, 201, r.StatusCode)
+	}
+
+	// the bucket is empty, the next token is 10 seconds away
+	r := postGroup(t, srv, "")
+	defer r.Body.Close()
+
+	var problem model.RestProblem
+	assert.Nil(t, json.NewDecoder(r.Body).Decode(&problem))
+	assert.Equal(t, 429, r.StatusCode)
+	assert.Equal(t, "10", r.Header.Get("Retry-After"))
+	assert.Equal(t, model.RateLimited, problem.Code)
+
+	// reads have their own bucket
+	_, err := srv.Client.ListGroups(context.Background())
+	assert.Nil(t, err)
+}
+
+func Test_RateLimit_ApiKeyDoesNotResetTheBucket(t *testing.T) {
+	srv := harness.New(t, func(config *app.Config) {
+		config.RATE_LIMIT_WRITE_RPS = 0.1
+		config.RATE_LIMIT_WRITE_BURST = 1
+	})
+
+	r := postGroup(t, srv, "first")
+	r.Body.Close()
+	assert.Equal(t, 201, r.StatusCode)
+
+	// an unverified key is not a new client
+	r = postGroup(t, srv, "second")
+	r.Body.Close()
+	assert.Equal(t, 429, r.StatusCode)
+	assert.NotEmpty(t, r.Header.Get("Retry-After"))
+}
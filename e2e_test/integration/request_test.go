@@ -0,0 +1,261 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Gets a client acting as the user, whose client certificate has the userid as its common name
+func as(srv *harness.Server, userId string) *client.Client {
+	return srv.ClientAs("CN=" + userId)
+}
+
+// Creates the owners ann and bob, the requester cat and the group eng approved under the policy
+func createApprovalGroup(t *testing.T, srv *harness.Server, approval string) {
+	for _, userId := range []string{"ann", "bob", "cat"} {
+		srv.CreateUser(userId)
+	}
+	srv.CreateGroup("eng")
+	assert.Nil(t, srv.Admin.UpdateGroupPolicy(context.Background(), "eng", client.GroupPolicy{Approval: approval, Owners: &[]string{"ann", "bob"}}))
+}
+
+func Test_Request_OwnerApproves(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "on call rotation")
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestPending, request.State)
+	assert.Equal(t, "on call rotation", request.Reason)
+	assert.True(t, request.ExpiresAt.After(request.CreatedAt))
+	assert.Equal(t, &[]string{}, getUser(t, srv, "cat").Groups)
+
+	request, err = as(srv, "BOB").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestApproved, request.State)
+	assert.Equal(t, []string{"bob"}, request.Approvers)
+	assert.Equal(t, "bob", request.DecidedBy)
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "cat").Groups)
+
+	_, err = as(srv, "ann").RejectMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.RequestNotPending))
+}
+
+func Test_Request_TwoApprovers(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalTwoApprovers)
+	ctx := context.Background()
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+
+	request, err = as(srv, "ann").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestPending, request.State)
+	assert.Equal(t, []string{"ann"}, request.Approvers)
+	assert.Equal(t, &[]string{}, getUser(t, srv, "cat").Groups)
+
+	// the same owner can not approve twice
+	_, err = as(srv, "ann").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.ApprovalForbidden))
+
+	request, err = as(srv, "bob").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestApproved, request.State)
+	assert.Equal(t, []string{"ann", "bob"}, request.Approvers)
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "cat").Groups)
+}
+
+func Test_Request_AutoApproved(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalAuto)
+
+	request, err := srv.Client.RequestMembership(context.Background(), "eng", "cat", "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestApproved, request.State)
+	assert.Equal(t, []string{}, request.Approvers)
+	assert.Equal(t, &[]string{"eng"}, getUser(t, srv, "cat").Groups)
+}
+
+func Test_Request_Rejected(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalTwoApprovers)
+	ctx := context.Background()
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+
+	// a non owner can not decide
+	_, err = as(srv, "cat").RejectMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.ApprovalForbidden))
+
+	request, err = as(srv, "ann").RejectMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestRejected, request.State)
+	assert.Equal(t, "ann", request.DecidedBy)
+	assert.Equal(t, &[]string{}, getUser(t, srv, "cat").Groups)
+
+	// a rejected request no longer blocks a new one
+	_, err = srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+}
+
+func Test_Request_Duplicate(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+
+	_, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+	_, err = srv.Client.RequestMembership(ctx, "eng", "CAT", "")
+	assert.True(t, client.HasCode(err, model.DuplicateRequest))
+
+	// members can not ask to join again
+	srv.CreateUser("dan", "eng")
+	_, err = srv.Client.RequestMembership(ctx, "eng", "dan", "")
+	assert.True(t, client.HasCode(err, model.DuplicateMembership))
+
+	_, err = srv.Client.RequestMembership(ctx, "eng", "nope", "")
+	assert.True(t, client.HasCode(err, model.UserNotFound))
+	_, err = srv.Client.RequestMembership(ctx, "nope", "cat", "")
+	assert.True(t, client.HasCode(err, model.GroupNotFound))
+}
+
+func Test_Request_Expires(t *testing.T) {
+	srv := harness.New(t, func(config *app.Config) { config.MEMBERSHIP_REQUEST_TTL = time.Second })
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	request, err = srv.Client.GetMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, model.RequestExpired, request.State)
+
+	_, err = as(srv, "ann").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.RequestNotPending))
+
+	// an expired request no longer blocks a new one
+	_, err = srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+}
+
+func Test_Request_List(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	srv.CreateUser("dan")
+	ctx := context.Background()
+
+	first, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+	_, err = srv.Client.RequestMembership(ctx, "eng", "dan", "")
+	assert.Nil(t, err)
+	_, err = as(srv, "ann").RejectMembershipRequest(ctx, "eng", first.Id)
+	assert.Nil(t, err)
+
+	page, err := srv.Client.ListMembershipRequests(ctx, "eng", client.MembershipRequestList{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), page.Total)
+	assert.Equal(t, "cat", page.Requests[0].UserId)
+
+	page, err = srv.Client.ListMembershipRequests(ctx, "eng", client.MembershipRequestList{State: model.RequestPending})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), page.Total)
+	assert.Equal(t, "dan", page.Requests[0].UserId)
+
+	page, err = srv.Client.ListMembershipRequests(ctx, "eng", client.MembershipRequestList{UserId: "cat", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), page.Total)
+	assert.Equal(t, model.RequestRejected, page.Requests[0].State)
+
+	_, err = srv.Client.GetMembershipRequest(ctx, "eng", 999)
+	assert.True(t, client.HasCode(err, model.ResourceNotFound))
+}
+
+func Test_Request_Policy(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("ann")
+	srv.CreateGroup("eng")
+	ctx := context.Background()
+
+	policy, err := srv.Client.GetGroupPolicy(ctx, "eng")
+	assert.Nil(t, err)
+	assert.Equal(t, client.GroupPolicy{Approval: model.ApprovalOwner, Owners: &[]string{}}, policy)
+
+	err = srv.Admin.UpdateGroupPolicy(ctx, "eng", client.GroupPolicy{Approval: model.ApprovalTwoApprovers, Owners: &[]string{"ann"}})
+	assert.True(t, client.HasCode(err, model.ValidationFailed))
+	err = srv.Admin.UpdateGroupPolicy(ctx, "eng", client.GroupPolicy{Approval: model.ApprovalOwner, Owners: &[]string{"nope"}})
+	assert.True(t, client.HasCode(err, model.UserNotFound))
+	_, err = srv.Client.GetGroupPolicy(ctx, "nope")
+	assert.True(t, client.HasCode(err, model.GroupNotFound))
+
+	// a deleted owner no longer decides
+	assert.Nil(t, srv.Admin.UpdateGroupPolicy(ctx, "eng", client.GroupPolicy{Approval: model.ApprovalOwner, Owners: &[]string{"ann"}}))
+	assert.Nil(t, srv.Client.DeleteUser(ctx, "ann"))
+	policy, err = srv.Client.GetGroupPolicy(ctx, "eng")
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{}, policy.Owners)
+}
+
+func Test_Request_ApproverIsTheCaller(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+
+	request, err := srv.Client.RequestMembership(ctx, "eng", "cat", "")
+	assert.Nil(t, err)
+
+	// anonymous callers and identities without a common name are not an owner, whatever the body says
+	_, err = srv.Client.ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.Equal(t, 401, client.StatusCode(err))
+	assert.True(t, client.HasCode(err, model.Unauthenticated))
+	_, err = srv.ClientAs("O=default").RejectMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.Unauthenticated))
+
+	// the admin of the policies is not an owner either
+	_, err = srv.Admin.ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.True(t, client.HasCode(err, model.ApprovalForbidden))
+
+	request, err = as(srv, "ann").ApproveMembershipRequest(ctx, "eng", request.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "ann", request.DecidedBy)
+}
+
+func Test_Request_PolicyUpdatedByOwnersAndAdmins(t *testing.T) {
+	srv := harness.New(t)
+	createApprovalGroup(t, srv, model.ApprovalOwner)
+	ctx := context.Background()
+	policy := client.GroupPolicy{Approval: model.ApprovalAuto, Owners: &[]string{"cat"}}
+
+	err := srv.Client.UpdateGroupPolicy(ctx, "eng", policy)
+	assert.Equal(t, 401, client.StatusCode(err))
+
+	// a non owner can not make themselves an owner
+	err = as(srv, "cat").UpdateGroupPolicy(ctx, "eng", policy)
+	assert.Equal(t, 403, client.StatusCode(err))
+	assert.True(t, client.HasCode(err, model.ApprovalForbidden))
+
+	current, err := srv.Client.GetGroupPolicy(ctx, "eng")
+	assert.Nil(t, err)
+	assert.Equal(t, model.ApprovalOwner, current.Approval)
+	assert.Equal(t, &[]string{"ann", "bob"}, current.Owners)
+
+	// an owner can hand the group over, after which only the new owner or an admin can update it
+	assert.Nil(t, as(srv, "ann").UpdateGroupPolicy(ctx, "eng", policy))
+	err = as(srv, "ann").UpdateGroupPolicy(ctx, "eng", policy)
+	assert.True(t, client.HasCode(err, model.ApprovalForbidden))
+	assert.Nil(t, as(srv, "CAT").UpdateGroupPolicy(ctx, "eng", policy))
+	assert.Nil(t, srv.Admin.UpdateGroupPolicy(ctx, "eng", client.GroupPolicy{Approval: model.ApprovalOwner, Owners: &[]string{"ann"}}))
+}
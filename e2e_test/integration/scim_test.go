@@ -0,0 +1,152 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func Test_ScimUsers_FilterByUserName(t *testing.T) {
+	srv := harness.New(t)
+	// create user through the rest api
+	randStr := util.RandStringBytes(32)
+	err := srv.Client.CreateUser(context.Background(), client.User{FirstName: randStr, LastName: randStr, UserId: randStr})
+
+	assert.Nil(t, err)
+
+	// find it through scim
+	filter := url.QueryEscape(`userName eq "` + randStr + `"`)
+	r, err := http.Get(fmt.Sprintf("%s/scim/v2/Users?filter=%s", srv.URL, filter))
+	var list struct {
+		TotalResults int              `json:"totalResults"`
+		Resources    []model.ScimUser `json:"Resources"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 1, list.TotalResults)
+	assert.Equal(t, randStr, list.Resources[0].UserName)
+	assert.Equal(t, randStr, list.Resources[0].Name.GivenName)
+}
+
+func Test_ScimUsers_UnsupportedFilter(t *testing.T) {
+	srv := harness.New(t)
+	filter := url.QueryEscape(`name.familyName co "x"`)
+	r, err := http.Get(fmt.Sprintf("%s/scim/v2/Users?filter=%s", srv.URL, filter))
+	var scimError model.ScimError
+	if err := json.NewDecoder(r.Body).Decode(&scimError); err != nil {
+		log.Fatal(err)
+		return
+	}
+	defer r.Body.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 400, r.StatusCode)
+	assert.Equal(t, "invalidFilter", scimError.ScimType)
+	assert.Equal(t, []string{model.ScimErrorSchema}, scimError.Schemas)
+}
+
+func Test_ScimUsers_CreateDuplicate(t *testing.T) {
+	srv := harness.New(t)
+	randStr := util.RandStringBytes(32)
+	payload := `{"schemas":["` + model.ScimUserSchema + `"],"userName":"` + randStr + `","name":{"givenName":"a","familyName":"b"}}`
+	r, err := http.Post(fmt.Sprintf("%s/scim/v2/Users", srv.URL), "application/scim+json", bytes.NewBufferString(payload))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 201, r.StatusCode)
+
+	r, err = http.Post(fmt.Sprintf("%s/scim/v2/Users", srv.URL), "application/scim+json", bytes.NewBufferString(payload))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 409, r.StatusCode)
+}
+
+func Test_ScimGroups_PatchMembers(t *testing.T) {
+	srv := harness.New(t)
+	// create two users
+	first := util.RandStringBytes(32)
+	second := util.RandStringBytes(32)
+	for _, userId := range []string{first, second} {
+		err := srv.Client.CreateUser(context.Background(), client.User{FirstName: userId, LastName: userId, UserId: userId})
+
+		assert.Nil(t, err)
+	}
+
+	// create group with the first user through scim
+	groupName := util.RandStringBytes(32)
+	payload := `{"schemas":["` + model.ScimGroupSchema + `"],"displayName":"` + groupName + `","members":[{"value":"` + first + `"}]}`
+	r, err := http.Post(fmt.Sprintf("%s/scim/v2/Groups", srv.URL), "application/scim+json", bytes.NewBufferString(payload))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 201, r.StatusCode)
+
+	// add the second user and remove the first one
+	payload = `{"schemas":["` + model.ScimPatchOpSchema + `"],"Operations":[
+		{"op":"add","path":"members","value":[{"value":"` + second + `"}]},
+		{"op":"remove","path":"members[value eq \"` + first + `\"]"}]}`
+	req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/scim/v2/Groups/%s", srv.URL, groupName), bytes.NewBufferString(payload))
+	r, err = http.DefaultClient.Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+
+	// both apis see the change
+	members, err := srv.Client.GetGroup(context.Background(), groupName)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{second}, members.UserIds)
+}
+
+func Test_ScimGroups_GroupDoesNotExist(t *testing.T) {
+	srv := harness.New(t)
+	groupName := util.RandStringBytes(32)
+
+	r, err := http.Get(fmt.Sprintf("%s/scim/v2/Groups/%s", srv.URL, groupName))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 404, r.StatusCode)
+}
+
+func Test_ScimGroups_ListPageWithMembers(t *testing.T) {
+	srv := harness.New(t)
+	first := srv.CreateUser(util.RandStringBytes(16)).UserId
+	second := srv.CreateUser(util.RandStringBytes(16)).UserId
+	srv.CreateGroup("a-group", first)
+	srv.CreateGroup("b-group", first, second)
+	srv.CreateGroup("c-group")
+
+	// the second page of one group
+	r, err := http.Get(fmt.Sprintf("%s/scim/v2/Groups?startIndex=2&count=1", srv.URL))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+
+	var list struct {
+		TotalResults int               `json:"totalResults"`
+		Resources    []model.ScimGroup `json:"Resources"`
+	}
+	assert.Nil(t, json.NewDecoder(r.Body).Decode(&list))
+	r.Body.Close()
+
+	assert.Equal(t, 3, list.TotalResults)
+	if assert.Len(t, list.Resources, 1) {
+		assert.Equal(t, "b-group", list.Resources[0].DisplayName)
+		assert.Len(t, list.Resources[0].Members, 2)
+	}
+}
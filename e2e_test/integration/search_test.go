@@ -0,0 +1,126 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+)
+
+// Creates five users, three of them with smith in their last name
+func createSmiths(t *testing.T, srv *harness.Server) {
+	ctx := context.Background()
+	for _, user := range []client.User{
+		{FirstName: "Anna", LastName: "Smith", UserId: "asmith"},
+		{FirstName: "Ben", LastName: "Smithers", UserId: "bsmithers"},
+		{FirstName: "Carl", LastName: "Goldsmith", UserId: "cgoldsmith"},
+		{FirstName: "Smi", LastName: "Jones", UserId: "djones"},
+		{FirstName: "Eve", LastName: "Brown", UserId: "ebrown"},
+	} {
+		assert.Nil(t, srv.Client.CreateUser(ctx, user))
+	}
+}
+
+func searchUserIds(t *testing.T, srv *harness.Server, search client.UserSearch) ([]string, uint64) {
+	page, err := srv.Client.SearchUsers(context.Background(), search)
+	assert.Nil(t, err)
+
+	userIds := []string{}
+	for _, user := range page.Users {
+		userIds = append(userIds, user.UserId)
+	}
+	return userIds, page.Total
+}
+
+func Test_UserSearch_Prefix(t *testing.T) {
+	srv := harness.New(t)
+	createSmiths(t, srv)
+
+	userIds, total := searchUserIds(t, srv, client.UserSearch{Query: "smi*"})
+
+	// the exact first name comes first, goldsmith does not start with smi
+	assert.Equal(t, []string{"djones", "asmith", "bsmithers"}, userIds)
+	assert.Equal(t, uint64(3), total)
+}
+
+func Test_UserSearch_Substring(t *testing.T) {
+	srv := harness.New(t)
+	createSmiths(t, srv)
+
+	userIds, total := searchUserIds(t, srv, client.UserSearch{Query: "smith"})
+
+	// exact last name, then prefix matches, then substring matches
+	assert.Equal(t, []string{"asmith", "bsmithers", "cgoldsmith"}, userIds)
+	assert.Equal(t, uint64(3), total)
+}
+
+func Test_UserSearch_WildcardsAreLiteral(t *testing.T) {
+	srv := harness.New(t)
+	createSmiths(t, srv)
+
+	userIds, total := searchUserIds(t, srv, client.UserSearch{Query: "%"})
+
+	assert.Equal(t, []string{}, userIds)
+	assert.Equal(t, uint64(0), total)
+}
+
+func Test_UserSearch_PercentInNameIsReturnedVerbatim(t *testing.T) {
+	srv := harness.New(t)
+	assert.Nil(t, srv.Client.CreateUser(context.Background(), client.User{FirstName: "100%d", LastName: "Smith", UserId: "asmith"}))
+
+	page, err := srv.Client.SearchUsers(context.Background(), client.UserSearch{Query: "asmith"})
+
+	assert.Nil(t, err)
+	assert.Len(t, page.Users, 1)
+	assert.Equal(t, "100%d", page.Users[0].FirstName)
+}
+
+func Test_UserSearch_Filters(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateGroup("admins")
+	createSmiths(t, srv)
+	srv.Client.UpdateGroup(context.Background(), "admins", client.GroupMembers{UserIds: &[]string{"asmith", "ebrown"}})
+
+	userIds, _ := searchUserIds(t, srv, client.UserSearch{LastName: "smith"})
+	assert.Equal(t, []string{"asmith"}, userIds)
+
+	userIds, _ = searchUserIds(t, srv, client.UserSearch{Group: "admins"})
+	assert.Equal(t, []string{"asmith", "ebrown"}, userIds)
+
+	userIds, _ = searchUserIds(t, srv, client.UserSearch{Query: "smith", NotInGroup: "admins"})
+	assert.Equal(t, []string{"bsmithers", "cgoldsmith"}, userIds)
+
+	// the groups of every user are returned
+	page, err := srv.Client.SearchUsers(context.Background(), client.UserSearch{Query: "ebrown"})
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"admins"}, page.Users[0].Groups)
+}
+
+func Test_UserSearch_Pagination(t *testing.T) {
+	srv := harness.New(t)
+	createSmiths(t, srv)
+
+	userIds, total := searchUserIds(t, srv, client.UserSearch{Offset: 1, Limit: 2})
+
+	assert.Equal(t, []string{"bsmithers", "cgoldsmith"}, userIds)
+	assert.Equal(t, uint64(5), total)
+
+	userIds, total = searchUserIds(t, srv, client.UserSearch{Offset: 10})
+
+	assert.Equal(t, []string{}, userIds)
+	assert.Equal(t, uint64(5), total)
+}
+
+func Test_UserSearch_Rejected(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+
+	_, err := srv.Client.SearchUsers(ctx, client.UserSearch{Query: "s*th"})
+	assert.True(t, client.HasCode(err, model.ValidationFailed))
+
+	_, err = srv.Client.SearchUsers(ctx, client.UserSearch{Limit: 101})
+	assert.True(t, client.HasCode(err, model.ValidationFailed))
+}
@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/memdb"
+)
+
+func Test_Shutdown_DrainsInFlightRequests(t *testing.T) {
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	db, err := dbx.OpenDb(memdb.DriverName, t.Name())
+	assert.Nil(t, err)
+	t.Cleanup(func() { memdb.Drop(t.Name()) })
+
+	a := &app.App{}
+	err = a.InitializeWithDb(&app.Config{READINESS_DRAIN_DELAY: 200 * time.Millisecond, SHUTDOWN_TIMEOUT: 5 * time.Second}, db)
+	assert.Nil(t, err)
+
+	// a request that only finishes once the test lets it
+	started, release := make(chan struct{}), make(chan struct{})
+	a.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := lis.Addr().String()
+	lis.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	stopped := make(chan error, 1)
+	go func() { stopped <- a.Run(ctx, addr, "") }()
+
+	// wait for the server
+	url := fmt.Sprintf("http://%s", addr)
+	assert.Eventually(t, func() bool {
+		r, err := http.Get(url + "/healthz")
+		if err != nil {
+			return false
+		}
+		r.Body.Close()
+		return r.StatusCode == 200
+	}, 5*time.Second, 10*time.Millisecond)
+
+	slow := make(chan int, 1)
+	go func() {
+		r, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- 0
+			return
+		}
+		r.Body.Close()
+		slow <- r.StatusCode
+	}()
+	<-started
+
+	// readiness fails for the drain delay, then the server stops taking connections
+	stop()
+	assert.Eventually(t, func() bool {
+		r, err := http.Get(url + "/readyz")
+		if err != nil {
+			return false
+		}
+		r.Body.Close()
+		return r.StatusCode == 503
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the in-flight request still completes and Run returns once it did
+	select {
+	case <-stopped:
+		t.Fatal("Run returned before the in-flight request finished")
+	default:
+	}
+	close(release)
+
+	assert.Equal(t, 200, <-slow)
+	select {
+	case err := <-stopped:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
@@ -0,0 +1,115 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/client"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func tenantClient(srv *harness.Server, tenant string) *client.Client {
+	return client.New(srv.URL, client.WithRetries(0, 0), client.WithTenant(tenant))
+}
+
+func Test_Tenant_SameNamesInEveryTenant(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+	acme, globex := tenantClient(srv, "acme"), tenantClient(srv, "globex")
+
+	for _, c := range []*client.Client{acme, globex, srv.Client} {
+		assert.Nil(t, c.CreateGroup(ctx, "admins"))
+		assert.Nil(t, c.CreateUser(ctx, client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex", Groups: &[]string{"admins"}}))
+	}
+	assert.Nil(t, acme.UpdateUser(ctx, client.User{FirstName: "Lex", LastName: "Acme", UserId: "lex"}))
+	assert.Nil(t, acme.DeleteGroup(ctx, "admins"))
+
+	user, err := acme.GetUser(ctx, "lex")
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme", user.LastName)
+	assert.Equal(t, &[]string{}, user.Groups)
+
+	// the other tenants did not change
+	user, err = globex.GetUser(ctx, "lex")
+	assert.Nil(t, err)
+	assert.Equal(t, "Luthor", user.LastName)
+	assert.Equal(t, &[]string{"admins"}, user.Groups)
+
+	members, err := srv.Client.GetGroup(ctx, "admins")
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"lex"}, members.UserIds)
+}
+
+func Test_Tenant_Isolated(t *testing.T) {
+	srv := harness.New(t)
+	ctx := context.Background()
+	acme, globex := tenantClient(srv, "acme"), tenantClient(srv, "globex")
+	assert.Nil(t, acme.CreateGroup(ctx, "admins"))
+	assert.Nil(t, acme.CreateUser(ctx, client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex"}))
+
+	_, err := globex.GetUser(ctx, "lex")
+	assert.True(t, client.IsNotFound(err))
+	_, err = srv.Client.GetGroup(ctx, "admins")
+	assert.True(t, client.IsNotFound(err))
+
+	// the groups and users of another tenant are unknown names, which are skipped
+	assert.Nil(t, globex.CreateUser(ctx, client.User{FirstName: "Clark", LastName: "Kent", UserId: "clark", Groups: &[]string{"admins"}}))
+	assert.Nil(t, acme.UpdateGroup(ctx, "admins", client.GroupMembers{UserIds: &[]string{"lex", "clark"}}))
+
+	user, err := globex.GetUser(ctx, "clark")
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{}, user.Groups)
+
+	members, err := acme.GetGroup(ctx, "admins")
+	assert.Nil(t, err)
+	assert.Equal(t, &[]string{"lex"}, members.UserIds)
+
+	page, err := globex.SearchUsers(ctx, client.UserSearch{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), page.Total)
+	assert.Equal(t, "clark", page.Users[0].UserId)
+}
+
+func Test_Tenant_DefaultWithoutPrefix(t *testing.T) {
+	srv := harness.New(t)
+	srv.CreateUser("lex")
+
+	user, err := tenantClient(srv, "default").GetUser(context.Background(), "lex")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "lex", user.UserId)
+}
+
+func Test_Tenant_InvalidName(t *testing.T) {
+	srv := harness.New(t)
+
+	_, err := tenantClient(srv, "a b").GetUser(context.Background(), "lex")
+	assert.True(t, client.HasCode(err, model.ValidationFailed))
+
+	// health, metrics and the openapi document are not per tenant
+	r, err := http.Get(srv.URL + "/tenants/acme/healthz")
+	assert.Nil(t, err)
+	r.Body.Close()
+	assert.Equal(t, http.StatusNotFound, r.StatusCode)
+}
+
+func Test_Tenant_Grpc(t *testing.T) {
+	srv := harness.New(t)
+	assert.Nil(t, tenantClient(srv, "acme").CreateUser(context.Background(), client.User{FirstName: "Lex", LastName: "Luthor", UserId: "lex"}))
+	users := pb.NewUserServiceClient(dialGrpc(t, srv))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", "acme")
+	user, err := users.GetUser(ctx, &pb.GetUserRequest{Userid: "lex"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Luthor", user.GetLastName())
+
+	_, err = users.GetUser(context.Background(), &pb.GetUserRequest{Userid: "lex"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
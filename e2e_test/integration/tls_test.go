@@ -0,0 +1,256 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/internal/app"
+	"github.com/yassinekhaliqui/go-rest-service/internal/certs"
+	"github.com/yassinekhaliqui/go-rest-service/internal/memdb"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+)
+
+// A CA that issues server and client certificates for a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// Issues a certificate, for 127.0.0.1 when usage is server auth
+func (ca *testCA) issue(t *testing.T, serial int64, subject pkix.Name, usage x509.ExtKeyUsage) (certPem []byte, keyPem []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if usage == x509.ExtKeyUsageServerAuth {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func (ca *testCA) clientCert(t *testing.T, subject pkix.Name) tls.Certificate {
+	certPem, keyPem := ca.issue(t, 2, subject, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	assert.Nil(t, err)
+	return cert
+}
+
+// Writes a file and moves its modification time forward, so a reload sees it changed even within the same second
+func writeFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	assert.Nil(t, os.WriteFile(path, content, 0600))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+// Writes a server certificate of ca to dir, and the client CA bundle when clientCA is set
+func writeServerFiles(t *testing.T, dir string, ca *testCA, serial int64, clientCA *testCA) (certFile string, keyFile string, caFile string) {
+	certFile, keyFile = filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	certPem, keyPem := ca.issue(t, serial, pkix.Name{CommonName: "membership-service"}, x509.ExtKeyUsageServerAuth)
+	modTime := time.Now().Add(time.Duration(serial) * time.Minute)
+	writeFile(t, certFile, certPem, modTime)
+	writeFile(t, keyFile, keyPem, modTime)
+
+	if clientCA != nil {
+		caFile = filepath.Join(dir, "clients.pem")
+		writeFile(t, caFile, clientCA.pem, modTime)
+	}
+	return certFile, keyFile, caFile
+}
+
+// Starts a server that answers with the caller identity of the verified client certificate
+func startTLSServer(t *testing.T, config *tls.Config) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, mw.IdentityFromTLS(r.TLS))
+	}))
+	srv.TLS = config
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Calls the server, returns the identity it saw or the error of the handshake
+func callTLSServer(srv *httptest.Server, ca *testCA, clientCerts ...tls.Certificate) (string, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	httpClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			// sent even when it is not signed by a CA the server asks for
+			if len(clientCerts) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &clientCerts[0], nil
+		}},
+		DisableKeepAlives: true,
+	}}
+
+	r, err := httpClient.Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	return string(body), err
+}
+
+func Test_TLS_ClientCertificateMatrix(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	otherCA := newTestCA(t, "other-ca")
+
+	subject := pkix.Name{CommonName: "billing", Organization: []string{"acme"}}
+	trusted := clientCA.clientCert(t, subject)
+	untrusted := otherCA.clientCert(t, subject)
+
+	cases := []struct {
+		name       string
+		clientCA   *testCA
+		require    bool
+		certs      []tls.Certificate
+		fails      bool
+		wantCaller string
+	}{
+		{name: "no ca, no cert", clientCA: nil, require: false},
+		{name: "no ca, cert is not requested", clientCA: nil, require: false, certs: []tls.Certificate{trusted}},
+		{name: "ca, no cert", clientCA: clientCA, require: false},
+		{name: "ca, trusted cert", clientCA: clientCA, require: false, certs: []tls.Certificate{trusted}, wantCaller: "CN=billing,O=acme"},
+		{name: "ca, untrusted cert", clientCA: clientCA, require: false, certs: []tls.Certificate{untrusted}, fails: true},
+		{name: "required, no cert", clientCA: clientCA, require: true, fails: true},
+		{name: "required, trusted cert", clientCA: clientCA, require: true, certs: []tls.Certificate{trusted}, wantCaller: "CN=billing,O=acme"},
+		{name: "required, untrusted cert", clientCA: clientCA, require: true, certs: []tls.Certificate{untrusted}, fails: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reloader, err := certs.NewReloader(writeServerFiles(t, t.TempDir(), serverCA, 1, c.clientCA))
+			assert.Nil(t, err)
+			config, err := reloader.TLSConfig(c.require)
+			assert.Nil(t, err)
+
+			caller, err := callTLSServer(startTLSServer(t, config), serverCA, c.certs...)
+
+			if c.fails {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, c.wantCaller, caller)
+			}
+		})
+	}
+}
+
+func Test_TLS_RequireClientCertWithoutCA(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	certFile, keyFile, _ := writeServerFiles(t, t.TempDir(), serverCA, 1, nil)
+
+	reloader, err := certs.NewReloader(certFile, keyFile, "")
+	assert.Nil(t, err)
+	_, err = reloader.TLSConfig(true)
+
+	assert.NotNil(t, err)
+
+	// the app does not start either, also when TLS is not configured at all
+	for _, config := range []*app.Config{
+		{TLS_CERT_FILE: certFile, TLS_KEY_FILE: keyFile, TLS_REQUIRE_CLIENT_CERT: true},
+		{TLS_REQUIRE_CLIENT_CERT: true},
+	} {
+		db, err := sql.Open(memdb.DriverName, t.Name())
+		assert.Nil(t, err)
+
+		err = (&app.App{}).InitializeWithDb(config, db)
+
+		assert.NotNil(t, err)
+		db.Close()
+		memdb.Drop(t.Name())
+	}
+}
+
+func Test_TLS_ReloadsChangedFiles(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	dir := t.TempDir()
+
+	reloader, err := certs.NewReloader(writeServerFiles(t, dir, serverCA, 1, nil))
+	assert.Nil(t, err)
+	config, err := reloader.TLSConfig(false)
+	assert.Nil(t, err)
+	srv := startTLSServer(t, config)
+
+	serial := func() int64 {
+		roots := x509.NewCertPool()
+		roots.AddCert(serverCA.cert)
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{RootCAs: roots})
+		if !assert.Nil(t, err) {
+			return 0
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	assert.Equal(t, int64(1), serial())
+
+	// nothing changed
+	assert.Nil(t, reloader.Reload(context.Background()))
+	assert.Equal(t, int64(1), serial())
+
+	// a rotated certificate is served to new connections
+	certFile, _, _ := writeServerFiles(t, dir, serverCA, 2, nil)
+	assert.Nil(t, reloader.Reload(context.Background()))
+	assert.Equal(t, int64(2), serial())
+
+	// a broken rotation keeps the current certificate
+	writeFile(t, certFile, []byte("not a certificate"), time.Now().Add(time.Hour))
+	assert.NotNil(t, reloader.Reload(context.Background()))
+	assert.Equal(t, int64(2), serial())
+}
@@ -0,0 +1,32 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+func Test_Tracing_ContinuesTraceparent(t *testing.T) {
+	srv := harness.New(t)
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/users/%s", srv.URL, util.RandStringBytes(32)), nil)
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceId))
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer r.Body.Close()
+
+	// the response carries the span of the server, in the same trace
+	traceparent := r.Header.Get("traceparent")
+	parts := strings.Split(traceparent, "-")
+	assert.Equal(t, 4, len(parts), "unexpected traceparent %q", traceparent)
+	if len(parts) == 4 {
+		assert.Equal(t, traceId, parts[1])
+		assert.NotEqual(t, "00f067aa0ba902b7", parts[2])
+	}
+}
@@ -1,39 +1,56 @@
 package integration
 
 import (
-	"fmt"
+	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
-	"encoding/json"
-	"log"
 
 	"github.com/stretchr/testify/assert"
-	e "github.com/yassinekhaliqui/go-rest-service/e2e_test"
-	h "github.com/yassinekhaliqui/go-rest-service/pkg/http"
-	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+	"github.com/yassinekhaliqui/go-rest-service/e2e_test/harness"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
 )
 
+// Sends a request with a raw JSON payload, none if it is empty, and returns the status and the user of a successful GET
+func sendUser(t *testing.T, method string, url string, payload string) (int, model.RestUser) {
+	var body io.Reader
+	if payload != "" {
+		body = strings.NewReader(payload)
+	}
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer r.Body.Close()
+
+	var user model.RestUser
+	if method == http.MethodGet && r.StatusCode == http.StatusOK {
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&user))
+	}
+	return r.StatusCode, user
+}
+
+// Gets the JSON payload of a user whose names are the given name
+func userPayload(name string, userId string, groups string) string {
+	return `{"first_name":"` + name + `", "last_name":"` + name + `", "userid":"` + userId + `", "groups":` + groups + `}`
+}
+
 func Test_UserGet_UserExistsWithNoGroup(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check fields
 	assert.Equal(t, randStr, user.FirstName)
@@ -43,33 +60,24 @@ func Test_UserGet_UserExistsWithNoGroup(t *testing.T) {
 }
 
 func Test_UserGet_UserExistsWithGroup(t *testing.T) {
+	srv := harness.New(t)
+
 	// create group
 	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/groups", `{"name":"`+groupName+`"}`)
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ = sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, `["`+groupName+`"]`))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check fields
 	assert.Equal(t, randStr, user.FirstName)
@@ -79,34 +87,27 @@ func Test_UserGet_UserExistsWithGroup(t *testing.T) {
 }
 
 func Test_UserGet_UserDoesNotExists(t *testing.T) {
+	srv := harness.New(t)
 	userId := util.RandStringBytes(32)
 
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, userId))
+	statusCode, _ := sendUser(t, http.MethodGet, srv.URL+"/users/"+userId, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, 404, statusCode)
 }
 
 func Test_UserPost_WithoutGroup(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check fields
 	assert.Equal(t, randStr, user.FirstName)
@@ -116,33 +117,24 @@ func Test_UserPost_WithoutGroup(t *testing.T) {
 }
 
 func Test_UserPost_WithGroup(t *testing.T) {
+	srv := harness.New(t)
+
 	// create group
 	groupName := util.RandStringBytes(32)
-	payload := `{"name":"` + groupName + `"}`
-	statusCode, err := h.SendPostRequest(e.URL, "/groups", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/groups", `{"name":"`+groupName+`"}`)
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ = sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, `["`+groupName+`"]`))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check fields
 	assert.Equal(t, randStr, user.FirstName)
@@ -152,49 +144,39 @@ func Test_UserPost_WithGroup(t *testing.T) {
 }
 
 func Test_UserPost_InvalidPayload(t *testing.T) {
-	payload := `{"first_name":"", "last_name":"", "userid":"", "groups":[""]}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	srv := harness.New(t)
+
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload("", "", `[""]`))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 400, statusCode)
 }
 
 func Test_UserPost_UserExists(t *testing.T) {
+	srv := harness.New(t)
+
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err = h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ = sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 400, statusCode)
 }
 
 func Test_UserPost_GroupDoesNotExists(t *testing.T) {
+	srv := harness.New(t)
 	groupName := util.RandStringBytes(32)
 	randStr := util.RandStringBytes(32)
 
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, `["`+groupName+`"]`))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user - group omitted because it does not exist
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check fields
 	assert.Equal(t, randStr, user.FirstName)
@@ -204,33 +186,24 @@ func Test_UserPost_GroupDoesNotExists(t *testing.T) {
 }
 
 func Test_UserPut_UserUpdated(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// update user
 	newRandStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + newRandStr + `", "last_name":"` + newRandStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err = h.SendPutRequest(e.URL, "/users", randStr, payload)
+	statusCode, _ = sendUser(t, http.MethodPut, srv.URL+"/users/"+randStr, userPayload(newRandStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 200, statusCode)
 
-	// retrieve user - group omitted because it does not exist
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	// retrieve user
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 
 	// check new fields
 	assert.Equal(t, newRandStr, user.FirstName)
@@ -240,122 +213,106 @@ func Test_UserPut_UserUpdated(t *testing.T) {
 }
 
 func Test_UserPut_AttemptToUpdateKey(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
-	// update user
+	// update user under the path of the existing userid with a new userid in the payload
 	newRandStr := util.RandStringBytes(32)
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + newRandStr + `", "groups":null}`
-	statusCode, err = h.SendPutRequest(e.URL, "/users", randStr, payload)
+	statusCode, _ = sendUser(t, http.MethodPut, srv.URL+"/users/"+randStr, userPayload(randStr, newRandStr, "null"))
 
-	assert.Nil(t, err)
 	// userid from payload is used, new one is not found
 	assert.Equal(t, 404, statusCode)
+
+	// the existing user is unchanged
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
+
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, randStr, user.UserId)
 }
 
 func Test_UserPut_InvalidPayload(t *testing.T) {
+	srv := harness.New(t)
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"", "last_name":"", "userid":"", "groups":null}`
-	statusCode, err := h.SendPutRequest(e.URL, "/users", randStr, payload)
 
-	assert.Nil(t, err)
+	statusCode, _ := sendUser(t, http.MethodPut, srv.URL+"/users/"+randStr, userPayload("", "", "null"))
+
 	assert.Equal(t, 400, statusCode)
 }
 
 func Test_UserPut_UserDoesNotExist(t *testing.T) {
+	srv := harness.New(t)
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"asd", "last_name":"asd", "userid":"asd", "groups":null}`
-	statusCode, err := h.SendPutRequest(e.URL, "/users", randStr, payload)
 
-	assert.Nil(t, err)
+	statusCode, _ := sendUser(t, http.MethodPut, srv.URL+"/users/"+randStr, userPayload("asd", "asd", "null"))
+
 	assert.Equal(t, 404, statusCode)
 }
 
 func Test_UserPut_UpdateGroup(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// retrieve user
-	var user model.RestUser
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user := sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 	// no group yet
 	assert.Equal(t, &[]string{}, user.Groups)
-	
+
 	// create group
 	groupName := util.RandStringBytes(32)
-	payload = `{"name":"` + groupName + `"}`
-	statusCode, err = h.SendPostRequest(e.URL, "/groups", payload)
+	statusCode, _ = sendUser(t, http.MethodPost, srv.URL+"/groups", `{"name":"`+groupName+`"}`)
 
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// update user by adding group
-	payload = `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":["` + groupName + `"]}`
-	statusCode, err = h.SendPutRequest(e.URL, "/users", randStr, payload)
+	statusCode, _ = sendUser(t, http.MethodPut, srv.URL+"/users/"+randStr, userPayload(randStr, randStr, `["`+groupName+`"]`))
 
-	assert.Nil(t, err)
 	assert.Equal(t, 200, statusCode)
 
 	// retrieve updated user
-	r, err = http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		log.Fatal(err)
-		return
-	}
-	defer r.Body.Close()
+	statusCode, user = sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, 200, statusCode)
 	// group updated
 	assert.Equal(t, &[]string{groupName}, user.Groups)
 }
 
 func Test_UserDelete_UserDeleted(t *testing.T) {
+	srv := harness.New(t)
+
 	// create user
 	randStr := util.RandStringBytes(32)
-	payload := `{"first_name":"` + randStr + `", "last_name":"` + randStr + `", "userid":"` + randStr + `", "groups":null}`
+	statusCode, _ := sendUser(t, http.MethodPost, srv.URL+"/users", userPayload(randStr, randStr, "null"))
 
-	statusCode, err := h.SendPostRequest(e.URL, "/users", payload)
-
-	assert.Nil(t, err)
 	assert.Equal(t, 201, statusCode)
 
 	// delete user
-	statusCode, err = h.SendDelRequest(e.URL, "/users", randStr)
+	statusCode, _ = sendUser(t, http.MethodDelete, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
 	assert.Equal(t, 200, statusCode)
 
 	// retrieve user
-	r, err := http.Get(fmt.Sprintf("%s/users/%s", e.URL, randStr))
+	statusCode, _ = sendUser(t, http.MethodGet, srv.URL+"/users/"+randStr, "")
 
-	assert.Nil(t, err)
-	assert.Equal(t, 404, r.StatusCode)
+	assert.Equal(t, 404, statusCode)
 }
 
 func Test_UserDelete_UserDoesNotExist(t *testing.T) {
+	srv := harness.New(t)
 	userId := util.RandStringBytes(32)
 
-	statusCode, err := h.SendDelRequest(e.URL, "/users", userId)
+	statusCode, _ := sendUser(t, http.MethodDelete, srv.URL+"/users/"+userId, "")
 
-	assert.Nil(t, err)
 	assert.Equal(t, 404, statusCode)
 }
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"log/slog"
+	"net"
+	"sync"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/yassinekhaliqui/go-rest-service/internal/apply"
+	"github.com/yassinekhaliqui/go-rest-service/internal/approval"
+	"github.com/yassinekhaliqui/go-rest-service/internal/batch"
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+	"github.com/yassinekhaliqui/go-rest-service/internal/certs"
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/gql"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/health"
+	"github.com/yassinekhaliqui/go-rest-service/internal/idempotency"
+	"github.com/yassinekhaliqui/go-rest-service/internal/metrics"
+	"github.com/yassinekhaliqui/go-rest-service/internal/openapi"
+	"github.com/yassinekhaliqui/go-rest-service/internal/rpc"
+	"github.com/yassinekhaliqui/go-rest-service/internal/scim"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+	"github.com/yassinekhaliqui/go-rest-service/internal/worker"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type App struct {
+	Router     *mux.Router
+	GrpcServer *grpc.Server
+	Db         *sql.DB
+	Health     *health.Registry
+	Workers    *worker.Runner
+	Config     *Config
+
+	// Set when the servers use TLS
+	TLSConfig *tls.Config
+}
+
+// Set up DB connection and routes
+func (a *App) Initialize(config *Config) error {
+	db, err := OpenDb(config)
+	if err != nil {
+		return err
+	}
+
+	return a.InitializeWithDb(config, db)
+}
+
+// Set up routes on an already opened DB, the App closes it on shutdown
+func (a *App) InitializeWithDb(config *Config, db *sql.DB) error {
+	a.Db = db
+	a.Config = config
+	cache.Configure(config.CACHE_SIZE, withDefault(config.CACHE_TTL, 30*time.Second))
+	a.Workers = worker.NewRunner()
+	a.Health = health.NewRegistry()
+	a.Health.Register("db", health.DbCheck(a.Db))
+	a.Health.Register("schema", health.SchemaCheck(a.Db))
+	a.Health.Register("workers", a.Workers.Check)
+
+	a.Router = mux.NewRouter()
+	// mux only runs the middlewares for matched routes, so the fallbacks are wrapped by hand
+	observe := func(h http.Handler) http.Handler {
+		return mw.RequestId(mw.ClientIdentity(mw.Trace(metrics.InstrumentHandler(mw.LogRequest(h)))))
+	}
+	a.Router.NotFoundHandler = observe(http.HandlerFunc(errhandler.NotFound))
+	a.Router.MethodNotAllowedHandler = observe(http.HandlerFunc(errhandler.NotAllowed))
+	a.Router.Use(mw.RequestId)
+	a.Router.Use(mw.ClientIdentity)
+	a.Router.Use(mw.Trace)
+	a.Router.Use(metrics.InstrumentHandler)
+	a.Router.Use(mw.LogRequest)
+	a.Router.Use(tenant.Middleware)
+
+	limiter := mw.NewRateLimiter(
+		mw.Limit{Rate: config.RATE_LIMIT_READ_RPS, Burst: config.RATE_LIMIT_READ_BURST},
+		mw.Limit{Rate: config.RATE_LIMIT_WRITE_RPS, Burst: config.RATE_LIMIT_WRITE_BURST},
+		errhandler.RateLimited,
+		"/healthz", "/readyz", "/metrics",
+	)
+	a.Workers.Every("rate-limit-cleanup", time.Minute, limiter.Cleanup)
+	a.Router.Use(limiter.Middleware)
+	a.Router.Use(mw.LimitBody(config.MaxBodyBytes()))
+	a.Router.Use(mw.AddJsonContentType)
+
+	if config.VALIDATE_REQUESTS {
+		validate, err := openapi.ValidateRequests()
+		if err != nil {
+			return err
+		}
+		a.Router.Use(validate)
+	}
+
+	idempotencyKeys := idempotency.NewStore(a.Db, withDefault(config.IDEMPOTENCY_TTL, 24*time.Hour), withDefault(config.IDEMPOTENCY_LEASE, time.Minute))
+	a.Workers.Every("idempotency-cleanup", time.Minute, idempotencyKeys.Cleanup)
+	a.Router.Use(idempotencyKeys.Middleware)
+
+	if err := metrics.RegisterDb(a.Db); err != nil {
+		return err
+	}
+	healthRouter := health.NewRouter(a.Health)
+	healthRouter.RegisterHandlers(a.Router)
+
+	metricsRouter := metrics.NewRouter()
+	metricsRouter.RegisterHandlers(a.Router)
+
+	openapiRouter := openapi.NewRouter()
+	openapiRouter.RegisterHandlers(a.Router)
+
+	// users, groups and memberships are served for the tenant of the caller or Default,
+	// and under /tenants/{tenant} for the tenant in the path
+	tenantRouter := a.Router.PathPrefix("/tenants/{" + tenant.PathVar + "}").Subrouter()
+
+	userRouter := user.NewRouter(a.Db)
+	userRouter.RegisterHandlers(a.Router)
+	userRouter.RegisterHandlers(tenantRouter)
+
+	groupRouter := group.NewRouter(a.Db)
+	groupRouter.RegisterHandlers(a.Router)
+	groupRouter.RegisterHandlers(tenantRouter)
+
+	applyRouter := apply.NewRouter(a.Db)
+	applyRouter.RegisterHandlers(a.Router)
+	applyRouter.RegisterHandlers(tenantRouter)
+
+	batchRouter := batch.NewRouter(a.Db)
+	batchRouter.RegisterHandlers(a.Router)
+	batchRouter.RegisterHandlers(tenantRouter)
+
+	scimRouter := scim.NewRouter(a.Db)
+	scimRouter.RegisterHandlers(a.Router)
+	scimRouter.RegisterHandlers(tenantRouter)
+
+	graphqlRouter := gql.NewRouter(a.Db)
+	graphqlRouter.RegisterHandlers(a.Router)
+	graphqlRouter.RegisterHandlers(tenantRouter)
+
+	requestTTL := withDefault(config.MEMBERSHIP_REQUEST_TTL, 7*24*time.Hour)
+	approvalRouter := approval.NewRouter(a.Db, requestTTL, config.MEMBERSHIP_ADMINS)
+	approvalRouter.RegisterHandlers(a.Router)
+	approvalRouter.RegisterHandlers(tenantRouter)
+	a.Workers.Every("membership-request-expiry", time.Minute, approval.NewService(a.Db, requestTTL, config.MEMBERSHIP_ADMINS).Expire)
+
+	grpcOptions := []grpc.ServerOption{}
+	if config.TLS_REQUIRE_CLIENT_CERT && config.TLS_CERT_FILE == "" {
+		return errors.New("client certificates are required but no tls_cert_file is set")
+	}
+	if config.TLS_CERT_FILE != "" {
+		reloader, err := certs.NewReloader(config.TLS_CERT_FILE, config.TLS_KEY_FILE, config.TLS_CLIENT_CA_FILE)
+		if err != nil {
+			return err
+		}
+		a.Workers.Every("tls-reload", withDefault(config.TLS_RELOAD_INTERVAL, 30*time.Second), reloader.Reload)
+
+		if a.TLSConfig, err = reloader.TLSConfig(config.TLS_REQUIRE_CLIENT_CERT); err != nil {
+			return err
+		}
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(a.TLSConfig)))
+	}
+
+	a.GrpcServer = rpc.NewServer(a.Db, grpcOptions...)
+	return nil
+}
+
+// Opens a connection pool to the DB described by the config
+// Pool limits left at 0 keep the database/sql defaults
+func OpenDb(config *Config) (*sql.DB, error) {
+	db, err := dbx.OpenDb(config.DB_TYPE, fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", config.DB_USER, config.DB_PASSWORD, config.DB_HOST, config.DB_PORT, config.DB_NAME))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.DB_MAX_OPEN_CONNS > 0 {
+		db.SetMaxOpenConns(config.DB_MAX_OPEN_CONNS)
+	}
+	if config.DB_MAX_IDLE_CONNS > 0 {
+		db.SetMaxIdleConns(config.DB_MAX_IDLE_CONNS)
+	}
+	if config.DB_CONN_MAX_LIFETIME > 0 {
+		db.SetConnMaxLifetime(config.DB_CONN_MAX_LIFETIME)
+	}
+	return db, nil
+}
+
+// Start the server, the gRPC server when grpcAddr is set, and the background workers
+// Runs until either server fails or ctx is done (SIGINT or SIGTERM), then shuts down in order:
+// readiness fails for the drain delay, the servers stop taking connections and finish in-flight requests,
+// the workers stop and the DB is closed. Everything after the drain delay shares the shutdown timeout
+func (a *App) Run(ctx context.Context, addr string, grpcAddr string) error {
+	srv := &http.Server{
+		Handler:           a.Router,
+		Addr:              addr,
+		ReadTimeout:       withDefault(a.Config.HTTP_READ_TIMEOUT, 15*time.Second),
+		ReadHeaderTimeout: withDefault(a.Config.HTTP_READ_HEADER_TIMEOUT, 5*time.Second),
+		WriteTimeout:      withDefault(a.Config.HTTP_WRITE_TIMEOUT, 15*time.Second),
+		IdleTimeout:       withDefault(a.Config.HTTP_IDLE_TIMEOUT, 60*time.Second),
+		TLSConfig:         a.TLSConfig,
+	}
+
+	errs := make(chan error, 2)
+
+	var lis net.Listener
+	if grpcAddr != "" {
+		var err error
+		if lis, err = net.Listen("tcp", grpcAddr); err != nil {
+			a.Db.Close()
+			return err
+		}
+	}
+
+	a.Workers.Start()
+
+	if lis != nil {
+		go func() {
+			slog.Info("grpc listening", slog.String("addr", grpcAddr))
+			errs <- a.GrpcServer.Serve(lis)
+		}()
+	}
+
+	go func() {
+		slog.Info("listening", slog.String("addr", addr), slog.Bool("tls", a.TLSConfig != nil))
+		if a.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS("", "")
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	var runErr error
+	select {
+	case runErr = <-errs:
+		slog.Error("server stopped", slog.Any("error", runErr))
+	case <-ctx.Done():
+		slog.Info("shutting down, readiness is failing", slog.Duration("drain_delay", a.Config.READINESS_DRAIN_DELAY))
+		a.Health.Drain()
+		time.Sleep(a.Config.READINESS_DRAIN_DELAY)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), withDefault(a.Config.SHUTDOWN_TIMEOUT, 30*time.Second))
+	defer cancel()
+
+	if err := a.shutdown(shutdownCtx, srv, lis != nil); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// Stops the servers, then the workers, then closes the DB
+// In-flight requests that do not finish before ctx is done are cut off
+func (a *App) shutdown(ctx context.Context, srv *http.Server, grpcRunning bool) error {
+	var wg sync.WaitGroup
+	if grpcRunning {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopGrpc(ctx, a.GrpcServer)
+		}()
+	}
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		slog.Error("in-flight requests did not finish in time", slog.Any("error", err))
+		srv.Close()
+	}
+	wg.Wait()
+
+	if workersErr := a.Workers.Stop(ctx); workersErr != nil {
+		slog.Error("workers did not stop in time", slog.Any("error", workersErr))
+		if err == nil {
+			err = workersErr
+		}
+	}
+
+	if dbErr := a.Db.Close(); dbErr != nil && err == nil {
+		err = dbErr
+	}
+
+	slog.Info("shut down")
+	return err
+}
+
+// Stops the gRPC server gracefully, and forcefully once ctx is done
+func stopGrpc(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Error("in-flight grpc calls did not finish in time")
+		server.Stop()
+	}
+}
+
+// Returns d, or fallback when d is not set
+func withDefault(d time.Duration, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ConfigName      string    = "local"
+	ConfigExtension string    = "yaml"
+	ConfigPath      [2]string = [2]string{".", "./config"}
+	EnvVarPrefix    string    = "ENV"
+)
+
+type Config struct {
+	DB_HOST     string
+	DB_TYPE     string
+	DB_USER     string
+	DB_PASSWORD string
+	DB_NAME     string
+	DB_PORT     string
+
+	DB_MAX_OPEN_CONNS    int
+	DB_MAX_IDLE_CONNS    int
+	DB_CONN_MAX_LIFETIME time.Duration
+
+	SERVE_ADDR string
+	GRPC_ADDR  string
+
+	HTTP_READ_TIMEOUT        time.Duration
+	HTTP_READ_HEADER_TIMEOUT time.Duration
+	HTTP_WRITE_TIMEOUT       time.Duration
+	HTTP_IDLE_TIMEOUT        time.Duration
+
+	TLS_CERT_FILE           string
+	TLS_KEY_FILE            string
+	TLS_CLIENT_CA_FILE      string
+	TLS_REQUIRE_CLIENT_CERT bool
+	TLS_RELOAD_INTERVAL     time.Duration
+
+	VALIDATE_REQUESTS bool
+
+	RATE_LIMIT_READ_RPS    float64
+	RATE_LIMIT_READ_BURST  int
+	RATE_LIMIT_WRITE_RPS   float64
+	RATE_LIMIT_WRITE_BURST int
+
+	MAX_BODY_BYTES int64
+
+	CACHE_SIZE int
+	CACHE_TTL  time.Duration
+
+	IDEMPOTENCY_TTL   time.Duration
+	IDEMPOTENCY_LEASE time.Duration
+
+	MEMBERSHIP_REQUEST_TTL time.Duration
+	MEMBERSHIP_ADMINS      []string
+
+	READINESS_DRAIN_DELAY time.Duration
+	SHUTDOWN_TIMEOUT      time.Duration
+
+	LOG_LEVEL  string
+	LOG_FORMAT string
+
+	TRACE_EXPORTER      string
+	TRACE_OTLP_ENDPOINT string
+}
+
+// Uses viper lib to read config file and env variables
+// Env variables have precedence
+// To read env vars, a config file must be read (hence why there exists ./skeleton.yaml)
+func InitializeConfig() (*Config, error) {
+	viper.SetConfigName(ConfigName)
+	viper.SetConfigType(ConfigExtension)
+
+	for _, path := range ConfigPath {
+		viper.AddConfigPath(path)
+	}
+
+	err := viper.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	viper.SetEnvPrefix(EnvVarPrefix)
+	viper.AutomaticEnv()
+
+	var config Config
+	err = viper.Unmarshal(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Gets the largest request body accepted, 1 MiB when not set
+func (c *Config) MaxBodyBytes() int64 {
+	if c.MAX_BODY_BYTES <= 0 {
+		return 1 << 20
+	}
+	return c.MAX_BODY_BYTES
+}
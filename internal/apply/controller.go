@@ -0,0 +1,105 @@
+package apply
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+type Controller interface {
+	Apply(w http.ResponseWriter, r *http.Request)
+}
+
+type controller struct {
+	service Service
+}
+
+// Creates a new instance of the apply controller
+func NewController(db *sql.DB) Controller {
+	return controller{NewService(db)}
+}
+
+// Converges the groups and their members to the desired state in the body
+// Only returns the plan when dry_run=true, deletes undeclared groups when prune=true
+// Returns 400 if the desired state or the query params are invalid
+func (a controller) Apply(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := boolParam(r, "dry_run")
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	prune, err := boolParam(r, "prune")
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	var desired model.RestDesiredState
+	if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err, _ := desired.Validate(); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	var actions []Action
+	if dryRun {
+		actions, err = a.service.Plan(r.Context(), desired, prune)
+	} else {
+		actions, err = a.service.Apply(r.Context(), desired, prune)
+	}
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	payload, err := json.Marshal(toRestPlan(actions, dryRun, prune))
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// Reads an optional boolean query param, defaults to false
+func boolParam(r *http.Request, key string) (bool, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, model.NewValidationError(key, "must be a boolean")
+	}
+	return b, nil
+}
+
+// Converts the actions of a plan to a RestPlan object
+func toRestPlan(actions []Action, dryRun bool, prune bool) model.RestPlan {
+	restActions := make([]model.RestAction, len(actions))
+	for i, action := range actions {
+		restActions[i] = model.RestAction{
+			Op:     string(action.Op),
+			Group:  action.Group,
+			UserId: action.UserId,
+		}
+	}
+
+	return model.RestPlan{
+		DryRun:  dryRun,
+		Prune:   prune,
+		Actions: restActions,
+	}
+}
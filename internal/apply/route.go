@@ -0,0 +1,26 @@
+package apply
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	controller Controller
+}
+
+// Creates a new apply router
+func NewRouter(db *sql.DB) Router {
+	return router{NewController(db)}
+}
+
+// Sets up the apply route
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/apply", r.controller.Apply).Methods(http.MethodPost)
+}
@@ -0,0 +1,201 @@
+package apply
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+type Op string
+
+const (
+	OpCreateGroup  Op = "create_group"
+	OpAddMember    Op = "add_member"
+	OpRemoveMember Op = "remove_member"
+	OpDeleteGroup  Op = "delete_group"
+)
+
+// A single change needed to converge to the desired state
+type Action struct {
+	Op     Op
+	Group  string
+	UserId string
+}
+
+// Formats the action as one line of a plan
+func (a Action) String() string {
+	switch a.Op {
+	case OpCreateGroup:
+		return fmt.Sprintf("+ group %s", a.Group)
+	case OpAddMember:
+		return fmt.Sprintf("+ member %s/%s", a.Group, a.UserId)
+	case OpRemoveMember:
+		return fmt.Sprintf("- member %s/%s", a.Group, a.UserId)
+	case OpDeleteGroup:
+		return fmt.Sprintf("- group %s", a.Group)
+	}
+	return fmt.Sprintf("? %s %s %s", a.Op, a.Group, a.UserId)
+}
+
+type Service interface {
+	Plan(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error)
+	Apply(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error)
+}
+
+type service struct {
+	groupService      group.Service
+	membershipService membership.Service
+	db                *sql.DB
+}
+
+// Creates a new apply service instance
+func NewService(db *sql.DB) Service {
+	return tracedService{service{group.NewService(db), membership.NewService(db), db}}
+}
+
+// Computes the actions needed to go from the current state to the desired state
+// Groups that are not declared are only deleted when prune is set
+func (s service) Plan(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error) {
+	var actions []Action
+	err := dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		actions, err = s.planTx(ctx, tx, desired, prune)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// Computes the plan from the current state as part of a transaction
+func (s service) planTx(ctx context.Context, tx *sql.Tx, desired model.RestDesiredState, prune bool) ([]Action, error) {
+	current, err := s.currentStateTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var creates, adds, removes, deletes []Action
+
+	declared := make(map[string]bool, len(desired.Groups))
+	for _, g := range desired.Groups {
+		declared[g.Name] = true
+
+		members, exists := current[g.Name]
+		if !exists {
+			creates = append(creates, Action{Op: OpCreateGroup, Group: g.Name})
+			members = map[string]bool{}
+		}
+
+		wanted := make(map[string]bool, len(g.Members))
+		for _, userId := range g.Members {
+			wanted[userId] = true
+			if !members[userId] {
+				adds = append(adds, Action{Op: OpAddMember, Group: g.Name, UserId: userId})
+			}
+		}
+
+		for userId := range members {
+			if !wanted[userId] {
+				removes = append(removes, Action{Op: OpRemoveMember, Group: g.Name, UserId: userId})
+			}
+		}
+	}
+
+	if prune {
+		for groupName := range current {
+			if !declared[groupName] {
+				deletes = append(deletes, Action{Op: OpDeleteGroup, Group: groupName})
+			}
+		}
+	}
+
+	actions := make([]Action, 0, len(creates)+len(adds)+len(removes)+len(deletes))
+	for _, batch := range [][]Action{creates, adds, removes, deletes} {
+		sortActions(batch)
+		actions = append(actions, batch...)
+	}
+
+	return actions, nil
+}
+
+// Computes the plan and runs every action of it in a single transaction
+// The current state is read in that transaction too, so the plan cannot go stale before it runs
+func (s service) Apply(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error) {
+	var actions []Action
+	err := dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		if actions, err = s.planTx(ctx, tx, desired, prune); err != nil {
+			return err
+		}
+
+		for _, action := range actions {
+			if err := s.run(ctx, tx, action); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// Runs one action as part of a transaction
+func (s service) run(ctx context.Context, tx *sql.Tx, action Action) error {
+	switch action.Op {
+	case OpCreateGroup:
+		_, err := s.groupService.InsertTx(ctx, tx, model.Group{Name: action.Group})
+		return err
+	case OpAddMember:
+		return s.membershipService.AddGroupMemberTx(ctx, tx, action.Group, action.UserId)
+	case OpRemoveMember:
+		return s.membershipService.RemoveGroupMemberTx(ctx, tx, action.Group, action.UserId)
+	case OpDeleteGroup:
+		return s.groupService.DeleteTx(ctx, tx, action.Group)
+	}
+	return fmt.Errorf("unknown op %s", action.Op)
+}
+
+// Maps every existing group name to the set of its members' userids, as part of a transaction
+func (s service) currentStateTx(ctx context.Context, tx *sql.Tx) (map[string]map[string]bool, error) {
+	groups, err := s.groupService.GetAllTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]map[string]bool, len(*groups))
+	for _, g := range *groups {
+		users, err := s.membershipService.GetUsersForGroupTx(ctx, tx, g.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		members := make(map[string]bool, len(*users))
+		for _, user := range *users {
+			members[user.UserId] = true
+		}
+		state[g.Name] = members
+	}
+
+	return state, nil
+}
+
+// Sorts actions by group then userid so plans are stable between runs
+func sortActions(actions []Action) {
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Group != actions[j].Group {
+			return actions[i].Group < actions[j].Group
+		}
+		return actions[i].UserId < actions[j].UserId
+	})
+}
@@ -0,0 +1,32 @@
+package apply
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/apply")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) Plan(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error) {
+	ctx, span := tracer.Start(ctx, "apply.Service.Plan", trace.WithAttributes(attribute.Bool("apply.prune", prune)))
+	actions, err := s.next.Plan(ctx, desired, prune)
+	tracing.End(span, err)
+	return actions, err
+}
+
+func (s tracedService) Apply(ctx context.Context, desired model.RestDesiredState, prune bool) ([]Action, error) {
+	ctx, span := tracer.Start(ctx, "apply.Service.Apply", trace.WithAttributes(attribute.Bool("apply.prune", prune)))
+	actions, err := s.next.Apply(ctx, desired, prune)
+	tracing.End(span, err)
+	return actions, err
+}
@@ -0,0 +1,299 @@
+package approval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
+)
+
+// Page size of a list when the limit param is not sent, and the largest one allowed
+const (
+	defaultListLimit = 50
+	maxListLimit     = 100
+)
+
+type Controller interface {
+	GetPolicy(w http.ResponseWriter, r *http.Request)
+	UpdatePolicy(w http.ResponseWriter, r *http.Request)
+	Create(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Approve(w http.ResponseWriter, r *http.Request)
+	Reject(w http.ResponseWriter, r *http.Request)
+}
+
+type controller struct {
+	service Service
+}
+
+// Creates new controller instance
+func NewController(db *sql.DB, ttl time.Duration, admins []string) Controller {
+	return controller{NewService(db, ttl, admins)}
+}
+
+// Retrieves the approval policy, owners and member constraints of a group
+// Returns 404 if group is not found
+func (a controller) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := a.service.GetPolicy(r.Context(), mux.Vars(r)["groupName"])
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	restPolicy := model.RestGroupPolicy{
+		Approval:      policy.Approval,
+		Owners:        &policy.Owners,
+		MaxMembers:    policy.MaxMembers,
+		MinMembers:    policy.MinMembers,
+		UserIdPattern: policy.UserIdPattern,
+	}
+	if len(policy.ExclusiveWith) != 0 {
+		restPolicy.ExclusiveWith = &policy.ExclusiveWith
+	}
+
+	writeJson(w, r, http.StatusOK, restPolicy)
+}
+
+// Replaces the approval policy, owners and member constraints of a group, as one of its owners or an admin
+// Returns 400 if the policy is invalid, 401 if the caller has no identity, 403 if it is neither an owner nor an admin,
+// 404 if the group, an owner or an exclusive group is not found and 409 if the current members break the constraints
+func (a controller) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["groupName"]
+
+	caller, err := callerUserId(r)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	var restPolicy model.RestGroupPolicy
+	if err := json.NewDecoder(r.Body).Decode(&restPolicy); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err, _ := restPolicy.Validate(); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	policy := model.GroupPolicy{
+		Approval:      restPolicy.Approval,
+		MaxMembers:    restPolicy.MaxMembers,
+		MinMembers:    restPolicy.MinMembers,
+		UserIdPattern: restPolicy.UserIdPattern,
+	}
+	if restPolicy.Owners != nil {
+		policy.Owners = *restPolicy.Owners
+	}
+	if restPolicy.ExclusiveWith != nil {
+		policy.ExclusiveWith = *restPolicy.ExclusiveWith
+	}
+
+	if err := a.service.UpdatePolicy(r.Context(), groupName, policy, caller); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(util.MessageJson("result", fmt.Sprintf("policy of group %s has been updated\n", groupName))))
+}
+
+// Creates a request of a user to join a group, approved right away under the auto policy
+// Returns 400 if the user is a member or already has a pending request, 404 if the group or user is not found
+func (a controller) Create(w http.ResponseWriter, r *http.Request) {
+	var restCreate model.RestMembershipRequestCreate
+	if err := json.NewDecoder(r.Body).Decode(&restCreate); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err, _ := restCreate.Validate(); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	request, err := a.service.Create(r.Context(), mux.Vars(r)["groupName"], restCreate.UserId, restCreate.Reason)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	writeJson(w, r, http.StatusCreated, toRestMembershipRequest(request))
+}
+
+// Retrieves a request to join a group
+// Returns 404 if the group or request is not found
+func (a controller) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := requestId(r)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	request, err := a.service.Get(r.Context(), mux.Vars(r)["groupName"], id)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	writeJson(w, r, http.StatusOK, toRestMembershipRequest(request))
+}
+
+// Retrieves one page of the requests to join a group, oldest first, optionally filtered by state and userid
+// Returns 404 if group is not found
+func (a controller) List(w http.ResponseWriter, r *http.Request) {
+	offset, err := uintParam(r, "offset", 0)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	limit, err := uintParam(r, "limit", defaultListLimit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxListLimit {
+		errhandler.Write(w, r, model.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxListLimit)))
+		return
+	}
+
+	filter := model.MembershipRequestFilter{State: r.URL.Query().Get("state"), UserId: r.URL.Query().Get("userid")}
+	switch filter.State {
+	case "", model.RequestPending, model.RequestApproved, model.RequestRejected, model.RequestExpired:
+	default:
+		errhandler.Write(w, r, model.NewValidationError("state", "must be pending, approved, rejected or expired"))
+		return
+	}
+
+	page, err := a.service.List(r.Context(), mux.Vars(r)["groupName"], filter, offset, limit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	restPage := model.RestMembershipRequestPage{Requests: make([]model.RestMembershipRequest, len(page.Requests)), Total: page.Total, Offset: offset, Limit: limit}
+	for i, request := range page.Requests {
+		restPage.Requests[i] = toRestMembershipRequest(request)
+	}
+
+	writeJson(w, r, http.StatusOK, restPage)
+}
+
+// Approves a pending request as an owner of the group, adding the user once enough owners approved
+// Returns 401 if the caller has no identity, 403 if it is not an owner or already approved, 409 if the request is not pending
+func (a controller) Approve(w http.ResponseWriter, r *http.Request) {
+	a.decide(w, r, a.service.Approve)
+}
+
+// Rejects a pending request as an owner of the group
+// Returns 401 if the caller has no identity, 403 if it is not an owner, 409 if the request is not pending
+func (a controller) Reject(w http.ResponseWriter, r *http.Request) {
+	a.decide(w, r, a.service.Reject)
+}
+
+// Reads the request id and passes it to the decision of the service, with the caller as the approver
+func (a controller) decide(w http.ResponseWriter, r *http.Request, decision func(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error)) {
+	id, err := requestId(r)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	approver, err := callerUserId(r)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	request, err := decision(r.Context(), mux.Vars(r)["groupName"], id, approver)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	writeJson(w, r, http.StatusOK, toRestMembershipRequest(request))
+}
+
+// Marshals the body and writes it with the status
+func writeJson(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	respBody, err := json.Marshal(body)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(respBody)
+}
+
+// Gets the userid of the caller, the common name of the subject of its verified client certificate
+// Returns an UNAUTHENTICATED error for anonymous callers and identities without a common name
+func callerUserId(r *http.Request) (string, error) {
+	for _, attribute := range strings.Split(mw.GetCallerIdentity(r.Context()), ",") {
+		if userId, ok := strings.CutPrefix(strings.TrimSpace(attribute), "CN="); ok && userId != "" {
+			return userId, nil
+		}
+	}
+	return "", errhandler.New(model.Unauthenticated, "the caller has to present a client certificate whose common name is its userid")
+}
+
+// Reads the {id} path variable
+func requestId(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, model.NewValidationError("id", "must be a non-negative integer")
+	}
+	return id, nil
+}
+
+// Reads an optional non-negative integer query param
+func uintParam(r *http.Request, key string, fallback uint64) (uint64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, model.NewValidationError(key, "must be a non-negative integer")
+	}
+	return i, nil
+}
+
+// Converts a MembershipRequest object to a RestMembershipRequest object
+func toRestMembershipRequest(request model.MembershipRequest) model.RestMembershipRequest {
+	approvers := []string{}
+	if request.FirstApprover != "" {
+		approvers = append(approvers, request.FirstApprover)
+	}
+	if request.State == model.RequestApproved && request.DecidedBy != "" && request.DecidedBy != request.FirstApprover {
+		approvers = append(approvers, request.DecidedBy)
+	}
+
+	return model.RestMembershipRequest{
+		Id:        request.Id,
+		Group:     request.GroupName,
+		UserId:    request.UserId,
+		State:     request.State,
+		Reason:    request.Reason,
+		Approvers: approvers,
+		DecidedBy: request.DecidedBy,
+		CreatedAt: request.CreatedAt,
+		ExpiresAt: request.ExpiresAt,
+	}
+}
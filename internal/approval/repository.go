@@ -0,0 +1,264 @@
+package approval
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+)
+
+type Repository interface {
+	GetPolicy(ctx context.Context, groupName string) (model.GroupPolicy, error)
+	UpdatePolicyTx(ctx context.Context, tx *sql.Tx, groupName string, policy model.GroupPolicy) error
+	InsertOwnerTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error
+	InsertExclusionTx(ctx context.Context, tx *sql.Tx, groupName string, excludedGroupName string) error
+	CheckMembersTx(ctx context.Context, tx *sql.Tx, groupId uint64) error
+	Get(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error)
+	GetPage(ctx context.Context, groupName string, filter model.MembershipRequestFilter, offset uint64, limit uint64) (*[]model.MembershipRequest, error)
+	Count(ctx context.Context, groupName string, filter model.MembershipRequestFilter) (uint64, error)
+	InsertTx(ctx context.Context, tx *sql.Tx, groupName string, userId string, reason string, ttl time.Duration) (uint64, error)
+	UpdateTx(ctx context.Context, tx *sql.Tx, request model.MembershipRequest, previousApprover string) (bool, error)
+	Expire(ctx context.Context) (int64, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+// Creates a new instance of the approval repo
+func NewRepository(db *sql.DB) Repository {
+	return repository{
+		db: db,
+	}
+}
+
+// Calls get_group_policy, get_group_owners and get_group_exclusions, GroupId is 0 if the group does not exist
+func (r repository) GetPolicy(ctx context.Context, groupName string) (model.GroupPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_group_policy(?, ?)", tenant.FromContext(ctx), groupName)
+	if err != nil {
+		return model.GroupPolicy{}, err
+	}
+	defer rows.Close()
+
+	var policy model.GroupPolicy
+	for rows.Next() {
+		var maxMembers, minMembers sql.NullInt64
+		if err := rows.Scan(&policy.GroupId, &policy.Approval, &maxMembers, &minMembers, &policy.UserIdPattern); err != nil {
+			return model.GroupPolicy{}, err
+		}
+		policy.MaxMembers, policy.MinMembers = toLimit(maxMembers), toLimit(minMembers)
+	}
+	if err := rows.Err(); err != nil || policy.GroupId == 0 {
+		return policy, err
+	}
+
+	if policy.ExclusiveWith, err = r.names(ctx, "call get_group_exclusions(?, ?)", policy.GroupId); err != nil {
+		return model.GroupPolicy{}, err
+	}
+	policy.Owners, err = r.names(ctx, "call get_group_owners(?, ?)", policy.GroupId)
+	return policy, err
+}
+
+// Calls a procedure listing the userids or names linked to a group
+func (r repository) names(ctx context.Context, query string, groupId uint64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, tenant.FromContext(ctx), groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// Sets the approval and limits of a group and removes its owners and exclusions as part of a transaction
+func (r repository) UpdatePolicyTx(ctx context.Context, tx *sql.Tx, groupName string, policy model.GroupPolicy) error {
+	rows, err := tx.QueryContext(ctx, "call upd_group_policy(?, ?, ?, ?, ?, ?)", tenant.FromContext(ctx), groupName,
+		policy.Approval, fromLimit(policy.MaxMembers), fromLimit(policy.MinMembers), policy.UserIdPattern)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Adds an owner to a group as part of a transaction
+func (r repository) InsertOwnerTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	rows, err := tx.QueryContext(ctx, "call ins_group_owner(?, ?, ?)", tenant.FromContext(ctx), groupName, userId)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Makes a group exclusive with another one as part of a transaction
+func (r repository) InsertExclusionTx(ctx context.Context, tx *sql.Tx, groupName string, excludedGroupName string) error {
+	rows, err := tx.QueryContext(ctx, "call ins_group_exclusion(?, ?, ?)", tenant.FromContext(ctx), groupName, excludedGroupName)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Calls chk_group_limits as if every member was just added, failing if the current members break the policy of the group
+func (r repository) CheckMembersTx(ctx context.Context, tx *sql.Tx, groupId uint64) error {
+	rows, err := tx.QueryContext(ctx, "call chk_group_limits(?, ?, ?, ?)", tenant.FromContext(ctx), groupId, 1, nil)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Calls get_membership_request, the request is empty if it is not a request to join the group
+func (r repository) Get(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_membership_request(?, ?, ?)", tenant.FromContext(ctx), groupName, id)
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+	defer rows.Close()
+
+	var request model.MembershipRequest
+	for rows.Next() {
+		if request, err = scanRequest(rows); err != nil {
+			return model.MembershipRequest{}, err
+		}
+	}
+
+	return request, rows.Err()
+}
+
+// Calls get_membership_requests and returns one page of the requests to join a group, oldest first
+func (r repository) GetPage(ctx context.Context, groupName string, filter model.MembershipRequestFilter, offset uint64, limit uint64) (*[]model.MembershipRequest, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_membership_requests(?, ?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), groupName, filter.State, filter.UserId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []model.MembershipRequest{}
+	for rows.Next() {
+		request, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	return &requests, rows.Err()
+}
+
+// Calls count_membership_requests and returns the number of matching requests
+func (r repository) Count(ctx context.Context, groupName string, filter model.MembershipRequestFilter) (uint64, error) {
+	rows, err := r.db.QueryContext(ctx, "call count_membership_requests(?, ?, ?, ?)",
+		tenant.FromContext(ctx), groupName, filter.State, filter.UserId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, rows.Err()
+}
+
+// Inserts a pending request that expires after ttl as part of a transaction and returns its id
+func (r repository) InsertTx(ctx context.Context, tx *sql.Tx, groupName string, userId string, reason string, ttl time.Duration) (uint64, error) {
+	rows, err := tx.QueryContext(ctx, "call ins_membership_request(?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), groupName, userId, reason, int64(ttl/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var id uint64
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, rows.Err()
+}
+
+// Stores the state and approvers of a pending request as part of a transaction
+// Returns false if the request is no longer pending or previousApprover is no longer its first approver
+func (r repository) UpdateTx(ctx context.Context, tx *sql.Tx, request model.MembershipRequest, previousApprover string) (bool, error) {
+	rows, err := tx.QueryContext(ctx, "call upd_membership_request(?, ?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), request.Id, previousApprover, request.State, request.FirstApprover, request.DecidedBy)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var changed int64
+	for rows.Next() {
+		if err := rows.Scan(&changed); err != nil {
+			return false, err
+		}
+	}
+
+	return changed == 1, rows.Err()
+}
+
+// Calls expire_membership_requests for every tenant and returns how many requests expired
+func (r repository) Expire(ctx context.Context) (int64, error) {
+	rows, err := r.db.QueryContext(ctx, "call expire_membership_requests()")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var expired int64
+	for rows.Next() {
+		if err := rows.Scan(&expired); err != nil {
+			return 0, err
+		}
+	}
+
+	return expired, rows.Err()
+}
+
+// Scans a row of get_membership_request, the times are unix seconds
+func scanRequest(rows *sql.Rows) (model.MembershipRequest, error) {
+	var request model.MembershipRequest
+	var createdAt, expiresAt int64
+	if err := rows.Scan(&request.Id, &request.GroupName, &request.UserId, &request.State, &request.Reason,
+		&request.FirstApprover, &request.DecidedBy, &createdAt, &expiresAt); err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	request.CreatedAt, request.ExpiresAt = time.Unix(createdAt, 0).UTC(), time.Unix(expiresAt, 0).UTC()
+	return request, nil
+}
+
+// Converts a nullable member limit column, NULL means no limit
+func toLimit(limit sql.NullInt64) *uint64 {
+	if !limit.Valid {
+		return nil
+	}
+	value := uint64(limit.Int64)
+	return &value
+}
+
+// Converts a member limit to a query arg, nil is stored as NULL
+func fromLimit(limit *uint64) interface{} {
+	if limit == nil {
+		return nil
+	}
+	return *limit
+}
@@ -0,0 +1,34 @@
+package approval
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	controller Controller
+}
+
+// Creates a new intance of approval router, pending requests expire after ttl
+// admins are the userids allowed to update the policy of any group
+func NewRouter(db *sql.DB, ttl time.Duration, admins []string) Router {
+	return router{NewController(db, ttl, admins)}
+}
+
+// Registers the group policy and membership request endpoints with the router
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/groups/{groupName}/policy", r.controller.GetPolicy).Methods(http.MethodGet)
+	mr.HandleFunc("/groups/{groupName}/policy", r.controller.UpdatePolicy).Methods(http.MethodPut)
+	mr.HandleFunc("/groups/{groupName}/requests", r.controller.Create).Methods(http.MethodPost)
+	mr.HandleFunc("/groups/{groupName}/requests", r.controller.List).Methods(http.MethodGet)
+	mr.HandleFunc("/groups/{groupName}/requests/{id}", r.controller.Get).Methods(http.MethodGet)
+	mr.HandleFunc("/groups/{groupName}/requests/{id}/approve", r.controller.Approve).Methods(http.MethodPost)
+	mr.HandleFunc("/groups/{groupName}/requests/{id}/reject", r.controller.Reject).Methods(http.MethodPost)
+}
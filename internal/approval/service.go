@@ -0,0 +1,279 @@
+package approval
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+type Service interface {
+	GetPolicy(ctx context.Context, groupName string) (model.GroupPolicy, error)
+	UpdatePolicy(ctx context.Context, groupName string, policy model.GroupPolicy, caller string) error
+	Create(ctx context.Context, groupName string, userId string, reason string) (model.MembershipRequest, error)
+	Get(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error)
+	List(ctx context.Context, groupName string, filter model.MembershipRequestFilter, offset uint64, limit uint64) (model.MembershipRequestPage, error)
+	Approve(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error)
+	Reject(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error)
+	Expire(ctx context.Context) error
+}
+
+type service struct {
+	repo              Repository
+	membershipService membership.Service
+	db                *sql.DB
+	ttl               time.Duration
+	// userids that update the policy of every group, owners or not
+	admins []string
+}
+
+// Creates a new approval service instance, pending requests expire after ttl
+// admins are the userids allowed to update the policy of any group
+func NewService(db *sql.DB, ttl time.Duration, admins []string) Service {
+	return tracedService{service{NewRepository(db), membership.NewService(db), db, ttl, admins}}
+}
+
+// Gets the approval policy and owners of a group
+// Returns a GROUP_NOT_FOUND error if the group does not exist
+func (s service) GetPolicy(ctx context.Context, groupName string) (model.GroupPolicy, error) {
+	policy, err := s.repo.GetPolicy(ctx, groupName)
+	if err != nil {
+		return model.GroupPolicy{}, err
+	}
+	if policy.GroupId == 0 {
+		return model.GroupPolicy{}, errhandler.New(model.GroupNotFound, "group %s not found", groupName)
+	}
+	return policy, nil
+}
+
+// Replaces the approval policy, owners and member constraints of a group in a transaction, as the caller
+// The requests already pending are decided under the new policy
+// Returns an APPROVAL_FORBIDDEN error if the caller is neither an owner of the group nor an admin,
+// and a POLICY_VIOLATION error if the current members of the group break the new constraints
+func (s service) UpdatePolicy(ctx context.Context, groupName string, policy model.GroupPolicy, caller string) error {
+	current, err := s.GetPolicy(ctx, groupName)
+	if err != nil {
+		return err
+	}
+	if !contains(current.Owners, caller) && !contains(s.admins, caller) {
+		return errhandler.New(model.ApprovalForbidden, "%s is not an owner of group %s", caller, groupName)
+	}
+	for _, excluded := range policy.ExclusiveWith {
+		if strings.EqualFold(excluded, groupName) {
+			return model.NewValidationError("exclusive_with", "must not contain the group itself")
+		}
+	}
+
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.repo.UpdatePolicyTx(ctx, tx, groupName, policy); err != nil {
+			return err
+		}
+
+		for _, owner := range policy.Owners {
+			if err := s.repo.InsertOwnerTx(ctx, tx, groupName, owner); err != nil {
+				return err
+			}
+		}
+		for _, excluded := range policy.ExclusiveWith {
+			if err := s.repo.InsertExclusionTx(ctx, tx, groupName, excluded); err != nil {
+				return err
+			}
+		}
+		return s.repo.CheckMembersTx(ctx, tx, current.GroupId)
+	})
+}
+
+// Creates a pending request of a user to join a group
+// Under the auto policy the request is approved and the user added to the group right away
+func (s service) Create(ctx context.Context, groupName string, userId string, reason string) (model.MembershipRequest, error) {
+	policy, err := s.GetPolicy(ctx, groupName)
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	var id uint64
+	err = dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if id, err = s.repo.InsertTx(ctx, tx, groupName, userId, reason, s.ttl); err != nil {
+			return err
+		}
+		if policy.Approval != model.ApprovalAuto {
+			return nil
+		}
+
+		approved := model.MembershipRequest{Id: id, State: model.RequestApproved}
+		if _, err := s.repo.UpdateTx(ctx, tx, approved, ""); err != nil {
+			return err
+		}
+		return s.membershipService.AddGroupMemberTx(ctx, tx, groupName, userId)
+	})
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	return s.Get(ctx, groupName, id)
+}
+
+// Gets a request to join a group
+// Returns a GROUP_NOT_FOUND error if the group does not exist, RESOURCE_NOT_FOUND if the request does not
+func (s service) Get(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error) {
+	if _, err := s.GetPolicy(ctx, groupName); err != nil {
+		return model.MembershipRequest{}, err
+	}
+	return s.request(ctx, groupName, id)
+}
+
+// Gets one page of the requests to join a group, oldest first
+// Returns a GROUP_NOT_FOUND error if the group does not exist
+func (s service) List(ctx context.Context, groupName string, filter model.MembershipRequestFilter, offset uint64, limit uint64) (model.MembershipRequestPage, error) {
+	if _, err := s.GetPolicy(ctx, groupName); err != nil {
+		return model.MembershipRequestPage{}, err
+	}
+
+	total, err := s.repo.Count(ctx, groupName, filter)
+	if err != nil {
+		return model.MembershipRequestPage{}, err
+	}
+
+	requests, err := s.repo.GetPage(ctx, groupName, filter, offset, limit)
+	if err != nil {
+		return model.MembershipRequestPage{}, err
+	}
+
+	return model.MembershipRequestPage{Requests: *requests, Total: total}, nil
+}
+
+// Approves a pending request as an owner of the group
+// Under the two_approvers policy the first approval is recorded and the request stays pending until
+// a different owner approves. Once approved the user is added to the group in the same transaction
+func (s service) Approve(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error) {
+	policy, request, owner, err := s.decidable(ctx, groupName, id, approver)
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	next := request
+	switch {
+	case policy.Approval == model.ApprovalTwoApprovers && request.FirstApprover == "":
+		next.FirstApprover = owner
+	case strings.EqualFold(request.FirstApprover, owner):
+		return model.MembershipRequest{}, errhandler.New(model.ApprovalForbidden, "%s already approved membership request %d, a different owner has to approve it", owner, id)
+	default:
+		if next.FirstApprover == "" {
+			next.FirstApprover = owner
+		}
+		next.State, next.DecidedBy = model.RequestApproved, owner
+	}
+
+	err = dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if err := s.update(ctx, tx, next, request.FirstApprover); err != nil {
+			return err
+		}
+		if next.State != model.RequestApproved {
+			return nil
+		}
+		return s.membershipService.AddGroupMemberTx(ctx, tx, groupName, request.UserId)
+	})
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	return s.request(ctx, groupName, id)
+}
+
+// Rejects a pending request as an owner of the group, a single owner is enough under every policy
+func (s service) Reject(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error) {
+	_, request, owner, err := s.decidable(ctx, groupName, id, approver)
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	next := request
+	next.State, next.DecidedBy = model.RequestRejected, owner
+
+	err = dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		return s.update(ctx, tx, next, request.FirstApprover)
+	})
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+
+	return s.request(ctx, groupName, id)
+}
+
+// Marks the pending requests past their expiry as expired, run periodically by a worker
+// Reads already show them as expired, this keeps the stored state in line and frees the pending slot
+func (s service) Expire(ctx context.Context) error {
+	expired, err := s.repo.Expire(ctx)
+	if err != nil {
+		return err
+	}
+	if expired != 0 {
+		slog.DebugContext(ctx, "expired membership requests", slog.Int64("count", expired))
+	}
+	return nil
+}
+
+// Gets the policy, the pending request and the owner deciding it
+// Returns an APPROVAL_FORBIDDEN error if the approver is not an owner of the group
+func (s service) decidable(ctx context.Context, groupName string, id uint64, approver string) (model.GroupPolicy, model.MembershipRequest, string, error) {
+	policy, err := s.GetPolicy(ctx, groupName)
+	if err != nil {
+		return model.GroupPolicy{}, model.MembershipRequest{}, "", err
+	}
+
+	request, err := s.request(ctx, groupName, id)
+	if err != nil {
+		return model.GroupPolicy{}, model.MembershipRequest{}, "", err
+	}
+	if request.State != model.RequestPending {
+		return model.GroupPolicy{}, model.MembershipRequest{}, "", errhandler.New(model.RequestNotPending, "membership request %d is %s", id, request.State)
+	}
+
+	for _, owner := range policy.Owners {
+		if strings.EqualFold(owner, approver) {
+			return policy, request, owner, nil
+		}
+	}
+	return model.GroupPolicy{}, model.MembershipRequest{}, "", errhandler.New(model.ApprovalForbidden, "%s is not an owner of group %s", approver, groupName)
+}
+
+// Gets a request to join a group, RESOURCE_NOT_FOUND if there is none with the id
+func (s service) request(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error) {
+	request, err := s.repo.Get(ctx, groupName, id)
+	if err != nil {
+		return model.MembershipRequest{}, err
+	}
+	if request.Id == 0 {
+		return model.MembershipRequest{}, errhandler.New(model.ResourceNotFound, "membership request %d not found", id)
+	}
+	return request, nil
+}
+
+// Stores the next state of a request as part of a transaction
+// Returns a REQUEST_NOT_PENDING error if another decision or the expiry came first
+func (s service) update(ctx context.Context, tx *sql.Tx, next model.MembershipRequest, previousApprover string) error {
+	changed, err := s.repo.UpdateTx(ctx, tx, next, previousApprover)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return errhandler.New(model.RequestNotPending, "membership request %d was decided or expired meanwhile", next.Id)
+	}
+	return nil
+}
+
+// Tells whether the userids contain the given one, userids compare case-insensitively
+func contains(userIds []string, userId string) bool {
+	for _, id := range userIds {
+		if strings.EqualFold(id, userId) {
+			return true
+		}
+	}
+	return false
+}
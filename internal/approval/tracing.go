@@ -0,0 +1,80 @@
+package approval
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/approval")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) GetPolicy(ctx context.Context, groupName string) (model.GroupPolicy, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.GetPolicy", trace.WithAttributes(attribute.String("group.name", groupName)))
+	policy, err := s.next.GetPolicy(ctx, groupName)
+	tracing.End(span, err)
+	return policy, err
+}
+
+func (s tracedService) UpdatePolicy(ctx context.Context, groupName string, policy model.GroupPolicy, caller string) error {
+	ctx, span := tracer.Start(ctx, "approval.Service.UpdatePolicy", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.String("group.approval", policy.Approval)))
+	err := s.next.UpdatePolicy(ctx, groupName, policy, caller)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) Create(ctx context.Context, groupName string, userId string, reason string) (model.MembershipRequest, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.Create", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.String("user.id", userId)))
+	request, err := s.next.Create(ctx, groupName, userId, reason)
+	tracing.End(span, err)
+	return request, err
+}
+
+func (s tracedService) Get(ctx context.Context, groupName string, id uint64) (model.MembershipRequest, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.Get", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.Int64("request.id", int64(id))))
+	request, err := s.next.Get(ctx, groupName, id)
+	tracing.End(span, err)
+	return request, err
+}
+
+func (s tracedService) List(ctx context.Context, groupName string, filter model.MembershipRequestFilter, offset uint64, limit uint64) (model.MembershipRequestPage, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.List", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.String("request.state", filter.State)))
+	page, err := s.next.List(ctx, groupName, filter, offset, limit)
+	tracing.End(span, err)
+	return page, err
+}
+
+func (s tracedService) Approve(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.Approve", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.Int64("request.id", int64(id))))
+	request, err := s.next.Approve(ctx, groupName, id, approver)
+	tracing.End(span, err)
+	return request, err
+}
+
+func (s tracedService) Reject(ctx context.Context, groupName string, id uint64, approver string) (model.MembershipRequest, error) {
+	ctx, span := tracer.Start(ctx, "approval.Service.Reject", trace.WithAttributes(
+		attribute.String("group.name", groupName), attribute.Int64("request.id", int64(id))))
+	request, err := s.next.Reject(ctx, groupName, id, approver)
+	tracing.End(span, err)
+	return request, err
+}
+
+func (s tracedService) Expire(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "approval.Service.Expire")
+	err := s.next.Expire(ctx)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+type Controller interface {
+	Run(w http.ResponseWriter, r *http.Request)
+}
+
+type controller struct {
+	service Service
+}
+
+// Creates a new instance of the batch controller
+func NewController(db *sql.DB) Controller {
+	return controller{NewService(db)}
+}
+
+// Runs the operations in the body in order, in a single transaction
+// Returns 400 if an operation is invalid, nothing is run then.
+// If an operation fails the batch is rolled back and the problem of that operation is returned with its index
+func (a controller) Run(w http.ResponseWriter, r *http.Request) {
+	var batch model.RestBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err, _ := batch.Validate(); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	if err := a.service.Run(r.Context(), batch.Operations); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	payload, err := json.Marshal(toRestBatchResult(batch.Operations))
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// Converts the operations of a batch that ran to a RestBatchResult object
+func toRestBatchResult(operations []model.RestOperation) model.RestBatchResult {
+	results := make([]model.RestOperationResult, len(operations))
+	for i, op := range operations {
+		status := http.StatusOK
+		if op.Op == model.BatchCreate {
+			status = http.StatusCreated
+		}
+
+		results[i] = model.RestOperationResult{
+			Index:    i,
+			Op:       op.Op,
+			Resource: op.Resource,
+			Status:   status,
+		}
+	}
+
+	return model.RestBatchResult{Results: results}
+}
@@ -0,0 +1,26 @@
+package batch
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	controller Controller
+}
+
+// Creates a new batch router
+func NewRouter(db *sql.DB) Router {
+	return router{NewController(db)}
+}
+
+// Sets up the batch route
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/batch", r.controller.Run).Methods(http.MethodPost)
+}
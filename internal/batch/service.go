@@ -0,0 +1,77 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+)
+
+type Service interface {
+	Run(ctx context.Context, operations []model.RestOperation) error
+}
+
+type service struct {
+	userService       user.Service
+	groupService      group.Service
+	membershipService membership.Service
+	db                *sql.DB
+}
+
+// Creates a new batch service instance
+func NewService(db *sql.DB) Service {
+	return tracedService{service{user.NewService(db), group.NewService(db), membership.NewService(db), db}}
+}
+
+// Runs the operations in order in a single transaction
+// The first operation to fail rolls back the whole batch and is returned as a model.OperationError.
+// The cache entries of the users and groups the operations touched are dropped once the batch commits
+func (s service) Run(ctx context.Context, operations []model.RestOperation) error {
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		for i, op := range operations {
+			if err := s.run(ctx, tx, op); err != nil {
+				return &model.OperationError{Index: i, Err: err}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Runs one operation as part of a transaction
+func (s service) run(ctx context.Context, tx *sql.Tx, op model.RestOperation) error {
+	switch op.Resource + " " + op.Op {
+	case model.BatchUser + " " + model.BatchCreate:
+		return s.userService.InsertInTx(ctx, tx, toUser(*op.User), op.User.Groups)
+	case model.BatchUser + " " + model.BatchUpdate:
+		return s.userService.UpdateInTx(ctx, tx, toUser(*op.User), op.User.Groups)
+	case model.BatchUser + " " + model.BatchDelete:
+		return s.userService.DeleteInTx(ctx, tx, op.UserId)
+	case model.BatchGroup + " " + model.BatchCreate:
+		_, err := s.groupService.InsertTx(ctx, tx, model.Group{Name: op.Group})
+		return err
+	case model.BatchGroup + " " + model.BatchUpdate:
+		return s.groupService.UpdateGroupMembershipTx(ctx, tx, op.Group, op.UserIds)
+	case model.BatchGroup + " " + model.BatchDelete:
+		return s.groupService.DeleteTx(ctx, tx, op.Group)
+	case model.BatchMembership + " " + model.BatchCreate:
+		return s.membershipService.AddGroupMemberTx(ctx, tx, op.Group, op.UserId)
+	case model.BatchMembership + " " + model.BatchDelete:
+		return s.membershipService.RemoveGroupMemberTx(ctx, tx, op.Group, op.UserId)
+	}
+	return fmt.Errorf("unknown operation %s on %s", op.Op, op.Resource)
+}
+
+// Converts a RestUser object to a User object
+func toUser(restUser model.RestUser) model.User {
+	return model.User{
+		FirstName: restUser.FirstName,
+		LastName:  restUser.LastName,
+		UserId:    restUser.UserId,
+	}
+}
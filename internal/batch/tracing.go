@@ -0,0 +1,25 @@
+package batch
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/batch")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) Run(ctx context.Context, operations []model.RestOperation) error {
+	ctx, span := tracer.Start(ctx, "batch.Service.Run", trace.WithAttributes(attribute.Int("batch.operations", len(operations))))
+	err := s.next.Run(ctx, operations)
+	tracing.End(span, err)
+	return err
+}
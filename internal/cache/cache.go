@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+)
+
+// A best-effort key value cache
+// Implementations must be safe for concurrent use. A shared cache (e.g. Redis) can implement it
+// by logging its errors, a failing cache must behave like a miss and never fail the request
+type Cache[V any] interface {
+	Get(ctx context.Context, key string) (V, bool)
+	Set(ctx context.Context, key string, value V)
+	Delete(ctx context.Context, keys ...string)
+}
+
+// A cache that never holds anything, used when caching is disabled
+type noop[V any] struct{}
+
+// Creates a cache that never holds anything
+func NewNoop[V any]() Cache[V] {
+	return noop[V]{}
+}
+
+func (noop[V]) Get(ctx context.Context, key string) (V, bool) {
+	var zero V
+	return zero, false
+}
+
+func (noop[V]) Set(ctx context.Context, key string, value V) {}
+
+func (noop[V]) Delete(ctx context.Context, keys ...string) {}
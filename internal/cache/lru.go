@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/metrics"
+)
+
+// An in-process cache holding at most size entries, each for at most ttl
+// The least recently used entry is evicted to make room
+type lru[V any] struct {
+	name string
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// Creates an in-process LRU cache, name labels its hit and miss metrics
+func NewLRU[V any](name string, size int, ttl time.Duration) Cache[V] {
+	return &lru[V]{name: name, size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *lru[V]) Get(ctx context.Context, key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		metrics.CacheMiss(c.name)
+		var zero V
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[V])
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		metrics.CacheMiss(c.name)
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	metrics.CacheHit(c.name)
+	return entry.value, true
+}
+
+func (c *lru[V]) Set(ctx context.Context, key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if element, found := c.entries[key]; found {
+		element.Value = &lruEntry[V]{key, value, expires}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key, value, expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		metrics.CacheEviction(c.name)
+	}
+}
+
+func (c *lru[V]) Delete(ctx context.Context, keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, found := c.entries[key]; found {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *lru[V]) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry[V]).key)
+}
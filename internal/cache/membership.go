@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+)
+
+// A user and the groups they belong to, keyed by Key of the userid
+type UserEntry struct {
+	User   model.User
+	Groups []model.Group
+}
+
+// A group and its users, keyed by Key of the group name
+type GroupEntry struct {
+	Group model.Group
+	Users []model.User
+}
+
+// Caches shared by the user, group and membership services
+// Every service that changes a user, a group or a membership invalidates the entries it touched
+var (
+	Users  Cache[UserEntry]  = NewNoop[UserEntry]()
+	Groups Cache[GroupEntry] = NewNoop[GroupEntry]()
+)
+
+// Replaces the caches with in-process LRU caches of size entries each, a size of 0 disables caching
+func Configure(size int, ttl time.Duration) {
+	if size <= 0 {
+		Users = NewNoop[UserEntry]()
+		Groups = NewNoop[GroupEntry]()
+		return
+	}
+
+	Users = NewLRU[UserEntry]("users", size, ttl)
+	Groups = NewLRU[GroupEntry]("groups", size, ttl)
+}
+
+// Gets the cache key of a userid or a group name, which are only unique within the tenant of the context
+func Key(ctx context.Context, name string) string {
+	return tenant.FromContext(ctx) + "/" + name
+}
+
+// Drops the entries of the users and the groups that changed
+// Under a context of Defer the entries are only dropped once the transaction commits
+func Invalidate(ctx context.Context, userIds []string, groupNames []string) {
+	userKeys, groupKeys := keys(ctx, userIds), keys(ctx, groupNames)
+	if d, ok := ctx.Value(deferredKey{}).(*deferred); ok {
+		d.add(userKeys, groupKeys)
+		return
+	}
+	drop(ctx, userKeys, groupKeys)
+}
+
+// Makes Invalidate under the returned context collect the entries, and returns the function that drops them
+// A transaction calls it after it commits, an entry dropped before could be refilled with the old state by a concurrent read
+func Defer(ctx context.Context) (context.Context, func()) {
+	d := &deferred{}
+	return context.WithValue(ctx, deferredKey{}, d), func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		drop(ctx, d.userKeys, d.groupKeys)
+	}
+}
+
+type deferredKey struct{}
+
+// The keys of the entries a transaction invalidated
+type deferred struct {
+	mu        sync.Mutex
+	userKeys  []string
+	groupKeys []string
+}
+
+func (d *deferred) add(userKeys []string, groupKeys []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.userKeys = append(d.userKeys, userKeys...)
+	d.groupKeys = append(d.groupKeys, groupKeys...)
+}
+
+func drop(ctx context.Context, userKeys []string, groupKeys []string) {
+	if len(userKeys) != 0 {
+		Users.Delete(ctx, userKeys...)
+	}
+	if len(groupKeys) != 0 {
+		Groups.Delete(ctx, groupKeys...)
+	}
+}
+
+func keys(ctx context.Context, names []string) []string {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = Key(ctx, name)
+	}
+	return keys
+}
@@ -0,0 +1,232 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/metrics"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/dbx")
+
+// Opens a connection pool whose queries are timed and traced by stored procedure
+// The driver must implement driver.DriverContext, like the mysql driver does
+func OpenDb(driverName string, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	driverContext, ok := db.Driver().(driver.DriverContext)
+	if !ok {
+		return db, nil
+	}
+	db.Close()
+
+	connector, err := driverContext.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(instrumentedConnector{connector}), nil
+}
+
+// Gets the label of a query, the procedure name for "call proc(...)" or the first keyword
+func queryLabel(query string) string {
+	query = strings.TrimSpace(query)
+	keyword := query
+	if i := strings.IndexAny(query, " \t\n("); i >= 0 {
+		keyword = query[:i]
+	}
+	keyword = strings.ToLower(keyword)
+
+	if keyword != "call" {
+		return keyword
+	}
+
+	name := strings.TrimSpace(query[len(keyword):])
+	if i := strings.IndexAny(name, " \t\n("); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+// Starts a span for a query, the returned func ends it and records the duration
+// A skipped query is not recorded because database/sql retries it another way
+func startQuery(ctx context.Context, query string) (context.Context, func(error)) {
+	label := queryLabel(query)
+	ctx, span := tracer.Start(ctx, label, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "mysql"),
+		attribute.String("db.operation", label),
+		attribute.String("db.statement", query),
+	))
+	start := time.Now()
+
+	return ctx, func(err error) {
+		if err == driver.ErrSkip {
+			span.End()
+			return
+		}
+
+		metrics.ObserveQuery(label, err, time.Since(start))
+		tracing.End(span, err)
+	}
+}
+
+// Hands out connections whose queries are timed and traced
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn{inner}, nil
+}
+
+// Times and traces queries run directly on the connection and wraps its prepared statements
+// Every optional interface is forwarded, or reports it is unsupported so database/sql falls back
+type conn struct {
+	driver.Conn
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt{s, query}, nil
+}
+
+func (c conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+
+	s, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt{s, query}, nil
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, done := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, done := startQuery(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	done(err)
+	return result, err
+}
+
+func (c conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c conn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// Times and traces the queries of a prepared statement
+// The connection checks the arguments, so the statement does not implement NamedValueChecker
+type stmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, done := startQuery(ctx, s.query)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(toValues(args))
+	}
+
+	done(err)
+	return rows, err
+}
+
+func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, done := startQuery(ctx, s.query)
+
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(toValues(args))
+	}
+
+	done(err)
+	return result, err
+}
+
+func (s stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if converter, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return converter.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// Converts named args to positional values for drivers without context support
+func toValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,34 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+)
+
+// Runs fn in a transaction, rolling back if it fails
+// The cache entries fn invalidates under its ctx are dropped once the transaction commits
+func InTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, invalidate := cache.Defer(ctx)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}()
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	invalidate()
+	return nil
+}
@@ -2,65 +2,203 @@ package errhandler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"log"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
 )
 
-type RestError struct {
-	Message string `json:"error"`
+const ContentType = "application/problem+json"
+
+// Status code and title of every error code
+var problems = map[model.ErrorCode]struct {
+	status int
+	title  string
+}{
+	model.ValidationFailed:     {http.StatusBadRequest, "Validation failed"},
+	model.MalformedRequest:     {http.StatusBadRequest, "Malformed request"},
+	model.RequestTooLarge:      {http.StatusRequestEntityTooLarge, "Request too large"},
+	model.RateLimited:          {http.StatusTooManyRequests, "Too many requests"},
+	model.UserNotFound:         {http.StatusNotFound, "User not found"},
+	model.GroupNotFound:        {http.StatusNotFound, "Group not found"},
+	model.ResourceNotFound:     {http.StatusNotFound, "Resource not found"},
+	model.RouteNotFound:        {http.StatusNotFound, "Route not found"},
+	model.MethodNotAllowed:     {http.StatusMethodNotAllowed, "Method not allowed"},
+	model.DuplicateUser:        {http.StatusBadRequest, "User already exists"},
+	model.DuplicateGroup:       {http.StatusBadRequest, "Group already exists"},
+	model.DuplicateMembership:  {http.StatusBadRequest, "Membership already exists"},
+	model.DuplicateResource:    {http.StatusBadRequest, "Resource already exists"},
+	model.DuplicateRequest:     {http.StatusBadRequest, "Membership request already exists"},
+	model.IdempotencyKeyReuse:  {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	model.RequestInProgress:    {http.StatusConflict, "Request in progress"},
+	model.UnsupportedMediaType: {http.StatusUnsupportedMediaType, "Unsupported media type"},
+	model.PatchFailed:          {http.StatusConflict, "Patch could not be applied"},
+	model.Unauthenticated:      {http.StatusUnauthorized, "Unauthenticated"},
+	model.TenantForbidden:      {http.StatusForbidden, "Tenant forbidden"},
+	model.ApprovalForbidden:    {http.StatusForbidden, "Approval forbidden"},
+	model.RequestNotPending:    {http.StatusConflict, "Request is not pending"},
+	model.PolicyViolation:      {http.StatusConflict, "Membership policy violated"},
+	model.InternalError:        {http.StatusInternalServerError, "Internal error"},
+}
+
+// An error with a known error code and a detail that is safe to show to clients
+type Error struct {
+	Code   model.ErrorCode
+	Detail string
 }
 
-// Writes message and status code to handler
-func WriteMessage(w http.ResponseWriter, msg string, statusCode int) {
-	payload, success := getJson(w, RestError{msg})
-	if !success {
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// Creates an error with a code and a client facing detail
+func New(code model.ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{code, fmt.Sprintf(format, args...)}
+}
+
+// Writes the problem+json body for an error, depending on the error
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	problem := FromError(err)
+	problem.Instance = r.URL.Path
+	problem.RequestId = mw.GetRequestId(r.Context())
+
+	if problem.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", slog.String("code", string(problem.Code)), slog.Any("error", err))
+	} else {
+		slog.InfoContext(r.Context(), "request rejected", slog.String("code", string(problem.Code)), slog.String("detail", problem.Detail))
+	}
+
+	payload, jsonErr := json.Marshal(problem)
+	if jsonErr != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("error: " + msg)
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(payload)
+}
+
+// Writes the problem of a request over its rate limit, see mw.RateLimiter
+func RateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	WriteCode(w, r, model.RateLimited, "too many requests, retry in %s", retryAfter.Round(time.Millisecond))
+}
+
+// Writes a problem with a known code
+func WriteCode(w http.ResponseWriter, r *http.Request, code model.ErrorCode, format string, args ...interface{}) {
+	Write(w, r, New(code, format, args...))
+}
+
+// Handler for requests that match no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteCode(w, r, model.RouteNotFound, "no route for %s %s", r.Method, r.URL.Path)
+}
 
-	// every other error
-	w.WriteHeader(statusCode)
-	fmt.Fprintf(w, payload)
+// Handler for requests whose route does not support the method
+func NotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteCode(w, r, model.MethodNotAllowed, "%s is not allowed on %s", r.Method, r.URL.Path)
 }
 
-// Writes a particular status code to the response, depending on the error
-func Write(w http.ResponseWriter, err error) {
-	var status int
-	var msg string
-	me, success := err.(*mysql.MySQLError)
-	if success {
-		switch me.Number {
-		// constraint conflict
-		case 1062:
-			status = http.StatusBadRequest
-			break
-		// entity not found
-		case 3000:
-			status = http.StatusNotFound
-		// other mysql errors
-		default:
-			status = http.StatusInternalServerError
+// Converts an error to the problem returned to the client
+// Raw database messages are never returned, unknown errors become an INTERNAL_ERROR
+func FromError(err error) model.RestProblem {
+	code, detail, fields := classify(err)
+
+	p, found := problems[code]
+	if !found {
+		p = problems[model.InternalError]
+	}
+
+	problem := model.RestProblem{
+		Type:   "/problems/" + strings.ToLower(strings.ReplaceAll(string(code), "_", "-")),
+		Title:  p.title,
+		Status: p.status,
+		Code:   code,
+		Detail: detail,
+		Errors: fields,
+	}
+
+	var opErr *model.OperationError
+	if errors.As(err, &opErr) {
+		problem.Index = &opErr.Index
+		problem.Detail = fmt.Sprintf("operation %d failed, the batch was rolled back: %s", opErr.Index, detail)
+	}
+
+	return problem
+}
+
+// Works out the error code, detail and invalid fields of an error
+func classify(err error) (model.ErrorCode, string, []model.RestFieldError) {
+	var known *Error
+	if errors.As(err, &known) {
+		return known.Code, known.Detail, nil
+	}
+
+	var validation *model.ValidationError
+	if errors.As(err, &validation) {
+		return model.ValidationFailed, validation.Error(), validation.Fields
+	}
+
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		return classifyMySQL(me)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return model.RequestTooLarge, fmt.Sprintf("the request body is larger than %d bytes", tooLarge.Limit), nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return model.MalformedRequest, "the request body has a field of the wrong type", []model.RestFieldError{
+			{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", typeErr.Type)},
 		}
-		msg = me.Message
-	} else {
-		// everything else
-		status = http.StatusInternalServerError
-		msg = err.Error()
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return model.MalformedRequest, "the request body is not valid json", nil
 	}
 
-	WriteMessage(w, msg, status)
+	return model.InternalError, "an internal error occurred", nil
 }
 
-func getJson(w http.ResponseWriter, restError RestError) (string, bool) {
-	payload, err := json.Marshal(restError)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, fmt.Sprintf("'{\"inner error\":\"%s\"", err.Error()))
-		return "", false
+// Maps the MySQL errors the stored procedures raise to error codes
+func classifyMySQL(me *mysql.MySQLError) (model.ErrorCode, string, []model.RestFieldError) {
+	switch me.Number {
+	// constraint conflict
+	case 1062:
+		switch {
+		case strings.Contains(me.Message, "uniq_user_id"):
+			return model.DuplicateUser, "a user with this userid already exists", nil
+		case strings.Contains(me.Message, "uniq_name"):
+			return model.DuplicateGroup, "a group with this name already exists", nil
+		case strings.Contains(me.Message, "uniq_group_id_user_id"):
+			return model.DuplicateMembership, "the user is already a member of the group", nil
+		case strings.Contains(me.Message, "uniq_pending_request"):
+			return model.DuplicateRequest, "the user already has a pending request to join the group", nil
+		}
+		return model.DuplicateResource, "the resource already exists", nil
+	// entity not found, signaled by the stored procedures
+	case 3000:
+		switch {
+		case strings.HasPrefix(me.Message, "user"):
+			return model.UserNotFound, me.Message, nil
+		case strings.HasPrefix(me.Message, "group"):
+			return model.GroupNotFound, me.Message, nil
+		}
+		return model.ResourceNotFound, me.Message, nil
+	// a membership write broke the policy of a group, the message names the rule
+	case 3001:
+		return model.PolicyViolation, me.Message, nil
 	}
-	return string(payload), true
+
+	return model.InternalError, "an internal error occurred", nil
 }
@@ -0,0 +1,178 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+const (
+	// How long a loader waits for more keys before fetching
+	batchWait = 2 * time.Millisecond
+	// A batch is fetched right away once it has this many keys
+	maxBatchSize = 100
+	// How long a batch fetch may take, it no longer follows the cancellation of the request that started it
+	fetchTimeout = 10 * time.Second
+)
+
+type loadersKey struct{}
+
+// The loaders of a single request
+// Results are cached for the lifetime of the request
+type loaders struct {
+	groupsForUser *loader[uint64, []model.Group]
+	usersForGroup *loader[uint64, []model.User]
+}
+
+// Creates the loaders for a request, backed by the batched membership lookups
+func newLoaders(membershipService membership.Service) *loaders {
+	return &loaders{
+		groupsForUser: newLoader(membershipService.GetGroupsForUsers),
+		usersForGroup: newLoader(membershipService.GetUsersForGroups),
+	}
+}
+
+// Drops every cached result, used after a mutation
+func (l *loaders) clear() {
+	l.groupsForUser.clear()
+	l.usersForGroup.clear()
+}
+
+// Adds the loaders to the context
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+// Gets the loaders of the request from the context
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// Collects the keys requested by concurrent resolvers and fetches them with one call
+// This avoids one get_user_membership or get_group_membership call per node
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu    sync.Mutex
+	cache map[K]V
+	batch *batch[K, V]
+}
+
+// Keys waiting to be fetched together
+type batch[K comparable, V any] struct {
+	keys   []K
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+// Creates a new loader around a batch fetch function
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, cache: map[K]V{}}
+}
+
+// Gets the value for a key, waiting for the batch it was added to
+// Keys without a value get the zero value of V
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	if value, found := l.cache[key]; found {
+		l.mu.Unlock()
+		return value, nil
+	}
+
+	b := l.batch
+	if b == nil {
+		b = &batch[K, V]{done: make(chan struct{})}
+		l.batch = b
+		time.AfterFunc(batchWait, func() { l.run(ctx, b) })
+	}
+
+	b.keys = append(b.keys, key)
+	if len(b.keys) >= maxBatchSize {
+		l.batch = nil
+		go l.run(ctx, b)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+
+	if b.err != nil {
+		var zero V
+		return zero, b.err
+	}
+	return b.values[key], nil
+}
+
+// Fetches a batch once, whichever of the timer or the size limit triggers first
+// The batch is shared by every waiter, so it runs detached from the cancellation of the caller that started it
+func (l *loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	l.mu.Lock()
+	if l.batch == b {
+		l.batch = nil
+	} else if b.keys == nil {
+		l.mu.Unlock()
+		return
+	}
+	keys := unique(b.keys)
+	b.keys = nil
+	l.mu.Unlock()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	b.values, b.err = l.safeFetch(ctx, keys)
+
+	if b.err == nil {
+		l.mu.Lock()
+		for _, key := range keys {
+			l.cache[key] = b.values[key]
+		}
+		l.mu.Unlock()
+	}
+
+	close(b.done)
+}
+
+// Calls fetch with a timeout, a panic in it becomes the error of the batch so the waiters are still released
+func (l *loader[K, V]) safeFetch(ctx context.Context, keys []K) (values map[K]V, err error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			values, err = nil, fmt.Errorf("loader fetch panicked: %v", r)
+		}
+	}()
+
+	return l.fetch(ctx, keys)
+}
+
+// Drops every cached value
+func (l *loader[K, V]) clear() {
+	l.mu.Lock()
+	l.cache = map[K]V{}
+	l.mu.Unlock()
+}
+
+// Removes duplicate keys, keeping the first occurrence
+func unique[K comparable](keys []K) []K {
+	seen := make(map[K]bool, len(keys))
+	result := make([]K, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	return result
+}
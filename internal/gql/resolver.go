@@ -0,0 +1,378 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+)
+
+// Largest page a client can ask for
+const maxPageSize = 100
+
+type resolver struct {
+	userService       user.Service
+	groupService      group.Service
+	membershipService membership.Service
+}
+
+type pageArgs struct {
+	First  int32
+	Offset int32
+}
+
+type userInput struct {
+	Userid    string
+	FirstName string
+	LastName  string
+	Groups    *[]string
+}
+
+// An error with the problem errhandler would have written
+// The status and error code are returned in the extensions of the error
+type resolverError struct {
+	problem model.RestProblem
+}
+
+func (e resolverError) Error() string {
+	return e.problem.Detail
+}
+
+func (e resolverError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"status": e.problem.Status, "code": e.problem.Code}
+	if len(e.problem.Errors) != 0 {
+		extensions["errors"] = e.problem.Errors
+	}
+	return extensions
+}
+
+// Converts an error to a resolverError the same way errhandler.Write classifies it
+func toResolverError(err error) error {
+	return resolverError{errhandler.FromError(err)}
+}
+
+// Gets a user by userid
+func (r *resolver) User(ctx context.Context, args struct{ Userid string }) (*userResolver, error) {
+	u, err := r.userService.Get(ctx, args.Userid)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	if u == (model.User{}) {
+		return nil, nil
+	}
+	return &userResolver{u}, nil
+}
+
+// Gets a group by name
+func (r *resolver) Group(ctx context.Context, args struct{ Name string }) (*groupResolver, error) {
+	g, err := r.groupService.Get(ctx, args.Name)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	if g == (model.Group{}) {
+		return nil, nil
+	}
+	return &groupResolver{g}, nil
+}
+
+// Lists one page of users
+func (r *resolver) Users(ctx context.Context, args pageArgs) (*userConnectionResolver, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	users, total, err := r.userService.GetPage(ctx, uint64(args.Offset), uint64(args.First))
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return &userConnectionResolver{
+		total:       int32(total),
+		users:       *users,
+		hasNextPage: uint64(args.Offset)+uint64(len(*users)) < total,
+	}, nil
+}
+
+// Lists one page of groups
+func (r *resolver) Groups(ctx context.Context, args pageArgs) (*groupConnectionResolver, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	groups, err := r.groupService.GetAll(ctx)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return newGroupConnection(*groups, args), nil
+}
+
+// Creates a user and returns it
+func (r *resolver) CreateUser(ctx context.Context, args struct{ Input userInput }) (*userResolver, error) {
+	defer loadersFrom(ctx).clear()
+
+	u, groupNames, err := args.Input.toUser()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.userService.InsertTx(ctx, u, groupNames); err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return r.mustGetUser(ctx, u.UserId)
+}
+
+// Updates a user and returns it
+func (r *resolver) UpdateUser(ctx context.Context, args struct{ Input userInput }) (*userResolver, error) {
+	defer loadersFrom(ctx).clear()
+
+	u, groupNames, err := args.Input.toUser()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.userService.UpdateTx(ctx, u, groupNames); err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return r.mustGetUser(ctx, u.UserId)
+}
+
+// Deletes a user
+func (r *resolver) DeleteUser(ctx context.Context, args struct{ Userid string }) (bool, error) {
+	defer loadersFrom(ctx).clear()
+
+	if err := r.userService.Delete(ctx, args.Userid); err != nil {
+		return false, toResolverError(err)
+	}
+	return true, nil
+}
+
+// Creates a group and returns it
+func (r *resolver) CreateGroup(ctx context.Context, args struct{ Name string }) (*groupResolver, error) {
+	defer loadersFrom(ctx).clear()
+
+	restGroup := model.RestGroup{Name: args.Name}
+	if err, _ := restGroup.Validate(); err != nil {
+		return nil, toResolverError(err)
+	}
+
+	if _, err := r.groupService.Insert(ctx, model.Group{Name: args.Name}); err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return r.mustGetGroup(ctx, args.Name)
+}
+
+// Replaces the members of a group and returns it
+func (r *resolver) UpdateGroupMembers(ctx context.Context, args struct {
+	Name    string
+	Userids []string
+}) (*groupResolver, error) {
+	defer loadersFrom(ctx).clear()
+
+	if err := r.groupService.UpdateGroupMembership(ctx, args.Name, &args.Userids); err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return r.mustGetGroup(ctx, args.Name)
+}
+
+// Deletes a group
+func (r *resolver) DeleteGroup(ctx context.Context, args struct{ Name string }) (bool, error) {
+	defer loadersFrom(ctx).clear()
+
+	if err := r.groupService.Delete(ctx, args.Name); err != nil {
+		return false, toResolverError(err)
+	}
+	return true, nil
+}
+
+// Gets a user that was just written, a missing user is a 404
+func (r *resolver) mustGetUser(ctx context.Context, userId string) (*userResolver, error) {
+	u, err := r.User(ctx, struct{ Userid string }{userId})
+	if err == nil && u == nil {
+		err = toResolverError(errhandler.New(model.UserNotFound, "user id %s was not found", userId))
+	}
+	return u, err
+}
+
+// Gets a group that was just written, a missing group is a 404
+func (r *resolver) mustGetGroup(ctx context.Context, groupName string) (*groupResolver, error) {
+	g, err := r.Group(ctx, struct{ Name string }{groupName})
+	if err == nil && g == nil {
+		err = toResolverError(errhandler.New(model.GroupNotFound, "group %s not found", groupName))
+	}
+	return g, err
+}
+
+type userResolver struct {
+	user model.User
+}
+
+func (r *userResolver) Userid() string {
+	return r.user.UserId
+}
+
+func (r *userResolver) FirstName() string {
+	return r.user.FirstName
+}
+
+func (r *userResolver) LastName() string {
+	return r.user.LastName
+}
+
+// Gets one page of the user's groups through the batch loader
+func (r *userResolver) Groups(ctx context.Context, args pageArgs) (*groupConnectionResolver, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	groups, err := loadersFrom(ctx).groupsForUser.Load(ctx, r.user.Id)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	return newGroupConnection(groups, args), nil
+}
+
+type groupResolver struct {
+	group model.Group
+}
+
+func (r *groupResolver) Name() string {
+	return r.group.Name
+}
+
+// Gets one page of the group's members through the batch loader
+func (r *groupResolver) Members(ctx context.Context, args pageArgs) (*userConnectionResolver, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	users, err := loadersFrom(ctx).usersForGroup.Load(ctx, r.group.Id)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+
+	start, end := args.bounds(len(users))
+	return &userConnectionResolver{
+		total:       int32(len(users)),
+		users:       users[start:end],
+		hasNextPage: end < len(users),
+	}, nil
+}
+
+type userConnectionResolver struct {
+	total       int32
+	users       []model.User
+	hasNextPage bool
+}
+
+func (r *userConnectionResolver) TotalCount() int32 {
+	return r.total
+}
+
+func (r *userConnectionResolver) Nodes() []*userResolver {
+	nodes := make([]*userResolver, len(r.users))
+	for i, u := range r.users {
+		nodes[i] = &userResolver{u}
+	}
+	return nodes
+}
+
+func (r *userConnectionResolver) PageInfo() *pageInfoResolver {
+	return &pageInfoResolver{r.hasNextPage}
+}
+
+type groupConnectionResolver struct {
+	total       int32
+	groups      []model.Group
+	hasNextPage bool
+}
+
+// Slices one page out of all of the groups
+func newGroupConnection(groups []model.Group, args pageArgs) *groupConnectionResolver {
+	start, end := args.bounds(len(groups))
+	return &groupConnectionResolver{
+		total:       int32(len(groups)),
+		groups:      groups[start:end],
+		hasNextPage: end < len(groups),
+	}
+}
+
+func (r *groupConnectionResolver) TotalCount() int32 {
+	return r.total
+}
+
+func (r *groupConnectionResolver) Nodes() []*groupResolver {
+	nodes := make([]*groupResolver, len(r.groups))
+	for i, g := range r.groups {
+		nodes[i] = &groupResolver{g}
+	}
+	return nodes
+}
+
+func (r *groupConnectionResolver) PageInfo() *pageInfoResolver {
+	return &pageInfoResolver{r.hasNextPage}
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+// Validates first is between 0 and maxPageSize and offset is not negative
+func (p pageArgs) validate() error {
+	if p.First < 0 || p.First > maxPageSize {
+		return toResolverError(model.NewValidationError("first", fmt.Sprintf("must be between 0 and %d", maxPageSize)))
+	}
+	if p.Offset < 0 {
+		return toResolverError(model.NewValidationError("offset", "must not be negative"))
+	}
+	return nil
+}
+
+// Gets the start and end index of the page in a list of n items
+func (p pageArgs) bounds(n int) (int, int) {
+	start := int(p.Offset)
+	if start > n {
+		start = n
+	}
+
+	end := start + int(p.First)
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// Validates the input the same way the REST API validates a RestUser
+func (i userInput) toUser() (model.User, *[]string, error) {
+	restUser := model.RestUser{
+		FirstName: i.FirstName,
+		LastName:  i.LastName,
+		UserId:    i.Userid,
+		Groups:    i.Groups,
+	}
+
+	if err, _ := restUser.Validate(); err != nil {
+		return model.User{}, nil, toResolverError(err)
+	}
+
+	return model.User{
+		FirstName: restUser.FirstName,
+		LastName:  restUser.LastName,
+		UserId:    restUser.UserId,
+	}, restUser.Groups, nil
+}
@@ -0,0 +1,49 @@
+package gql
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+)
+
+// Lets the resolvers of a list resolve concurrently so the loaders can batch them
+const maxParallelism = 50
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	handler           http.Handler
+	membershipService membership.Service
+}
+
+// Creates a new GraphQL router
+// Panics if the schema does not match the resolvers
+func NewRouter(db *sql.DB) Router {
+	membershipService := membership.NewService(db)
+	schema := graphql.MustParseSchema(schema, &resolver{
+		userService:       user.NewService(db),
+		groupService:      group.NewService(db),
+		membershipService: membershipService,
+	}, graphql.MaxParallelism(maxParallelism))
+
+	return router{&relay.Handler{Schema: schema}, membershipService}
+}
+
+// Sets up the /graphql route
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/graphql", r.serve).Methods(http.MethodPost)
+}
+
+// Runs a query with fresh loaders for the request
+func (r router) serve(w http.ResponseWriter, req *http.Request) {
+	ctx := withLoaders(req.Context(), newLoaders(r.membershipService))
+	r.handler.ServeHTTP(w, req.WithContext(ctx))
+}
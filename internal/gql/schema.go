@@ -0,0 +1,71 @@
+package gql
+
+// GraphQL schema of the membership graph
+// Users and groups link to each other through the groups and members edges
+const schema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# Gets a user by userid, null if not found
+	user(userid: String!): User
+	# Gets a group by name, null if not found
+	group(name: String!): Group
+	# Lists users ordered by userid
+	users(first: Int = 50, offset: Int = 0): UserConnection!
+	# Lists groups ordered by name
+	groups(first: Int = 50, offset: Int = 0): GroupConnection!
+}
+
+type Mutation {
+	# Creates a new user with any groups (if provided)
+	createUser(input: UserInput!): User!
+	# Updates a user and replaces the groups they belong to
+	updateUser(input: UserInput!): User!
+	# Deletes a user and their links to groups
+	deleteUser(userid: String!): Boolean!
+	# Creates an empty group
+	createGroup(name: String!): Group!
+	# Replaces the members of a group
+	updateGroupMembers(name: String!, userids: [String!]!): Group!
+	# Deletes a group and any links to users for that group
+	deleteGroup(name: String!): Boolean!
+}
+
+type User {
+	userid: String!
+	firstName: String!
+	lastName: String!
+	groups(first: Int = 50, offset: Int = 0): GroupConnection!
+}
+
+type Group {
+	name: String!
+	members(first: Int = 50, offset: Int = 0): UserConnection!
+}
+
+type UserConnection {
+	totalCount: Int!
+	nodes: [User!]!
+	pageInfo: PageInfo!
+}
+
+type GroupConnection {
+	totalCount: Int!
+	nodes: [Group!]!
+	pageInfo: PageInfo!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+}
+
+input UserInput {
+	userid: String!
+	firstName: String!
+	lastName: String!
+	groups: [String!]
+}
+`
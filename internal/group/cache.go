@@ -0,0 +1,125 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Serves GetWithUsers from cache.Groups and invalidates the groups and users every mutation touches
+type cachedService struct {
+	Service
+}
+
+// Gets the group and its users, from the cache when possible
+// Missing groups are not cached
+func (s cachedService) GetWithUsers(ctx context.Context, groupName string) (model.Group, *[]model.User, error) {
+	if entry, found := cache.Groups.Get(ctx, cache.Key(ctx, groupName)); found {
+		users := append([]model.User{}, entry.Users...)
+		return entry.Group, &users, nil
+	}
+
+	group, users, err := s.Service.GetWithUsers(ctx, groupName)
+	if err != nil || group == (model.Group{}) {
+		return group, users, err
+	}
+
+	cache.Groups.Set(ctx, cache.Key(ctx, groupName), cache.GroupEntry{Group: group, Users: append([]model.User{}, *users...)})
+	return group, users, nil
+}
+
+// Inserts a new group
+func (s cachedService) Insert(ctx context.Context, group model.Group) (uint64, error) {
+	id, err := s.Service.Insert(ctx, group)
+	cache.Invalidate(ctx, nil, []string{group.Name})
+	return id, err
+}
+
+// Inserts a new group as part of a transaction
+// The caller runs the transaction under cache.Defer, so the entry is only dropped once it commits
+func (s cachedService) InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error) {
+	id, err := s.Service.InsertTx(ctx, tx, group)
+	cache.Invalidate(ctx, nil, []string{group.Name})
+	return id, err
+}
+
+// Deletes the group, which changes the users that were in it
+func (s cachedService) Delete(ctx context.Context, groupName string) error {
+	oldUsers := s.currentUsers(ctx, groupName)
+	err := s.Service.Delete(ctx, groupName)
+	cache.Invalidate(ctx, oldUsers, []string{groupName})
+	return err
+}
+
+// Deletes the group as part of a transaction, see InsertTx
+func (s cachedService) DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error {
+	oldUsers := s.currentUsersTx(ctx, tx, groupName)
+	err := s.Service.DeleteTx(ctx, tx, groupName)
+	cache.Invalidate(ctx, oldUsers, []string{groupName})
+	return err
+}
+
+// Replaces the users of the group, which changes the users that were in it and the users in it now
+func (s cachedService) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
+	oldUsers := s.currentUsers(ctx, groupName)
+	err := s.Service.UpdateGroupMembership(ctx, groupName, userIds)
+
+	changed := oldUsers
+	if userIds != nil {
+		changed = append(changed, *userIds...)
+	}
+	cache.Invalidate(ctx, changed, []string{groupName})
+	return err
+}
+
+// Replaces the users of the group as part of a transaction, see InsertTx
+func (s cachedService) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	oldUsers := s.currentUsersTx(ctx, tx, groupName)
+	err := s.Service.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+
+	changed := oldUsers
+	if userIds != nil {
+		changed = append(changed, *userIds...)
+	}
+	cache.Invalidate(ctx, changed, []string{groupName})
+	return err
+}
+
+// Adds and removes single users of the group, which changes only those users
+func (s cachedService) PatchGroupMembership(ctx context.Context, groupName string, addUserIds []string, removeUserIds []string) error {
+	err := s.Service.PatchGroupMembership(ctx, groupName, addUserIds, removeUserIds)
+	cache.Invalidate(ctx, append(append([]string{}, addUserIds...), removeUserIds...), []string{groupName})
+	return err
+}
+
+// Gets the userids of the users of a group from the DB, bypassing the cache
+func (s cachedService) currentUsers(ctx context.Context, groupName string) []string {
+	_, users, err := s.Service.GetWithUsers(ctx, groupName)
+	if err != nil {
+		return nil
+	}
+	return userIds(users)
+}
+
+// Gets the userids of the users of a group as part of a transaction, including the users earlier writes of it changed
+func (s cachedService) currentUsersTx(ctx context.Context, tx *sql.Tx, groupName string) []string {
+	_, users, err := s.Service.GetWithUsersTx(ctx, tx, groupName)
+	if err != nil {
+		return nil
+	}
+	return userIds(users)
+}
+
+func userIds(users *[]model.User) []string {
+	if users == nil {
+		return nil
+	}
+
+	userIds := make([]string, len(*users))
+	for i, user := range *users {
+		userIds[i] = user.UserId
+	}
+	return userIds
+}
@@ -5,18 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/patch"
 	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
 )
 
+// Page size of a query when the limit param is not sent, and the largest one allowed
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 100
+)
+
 type Controller interface {
 	Get(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Query(w http.ResponseWriter, r *http.Request)
 	Create(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
 }
 
 type controller struct {
@@ -36,20 +47,19 @@ func (a controller) Get(w http.ResponseWriter, r *http.Request) {
 
 	group, users, err := a.service.GetWithUsers(r.Context(), groupName)
 	if err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	if group == (model.Group{}) {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, util.MessageJson("result", fmt.Sprintf("group %s not found\n", groupName)))
+		errhandler.WriteCode(w, r, model.GroupNotFound, "group %s not found", groupName)
 		return
 	}
 
 	restGroupMembers := toRestGroupMembers(users)
 	respBody, err := json.Marshal(restGroupMembers)
 	if err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -57,24 +67,87 @@ func (a controller) Get(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, string(respBody))
 }
 
+// Retrieves the names of every group ordered by name
+func (a controller) List(w http.ResponseWriter, r *http.Request) {
+	groups, err := a.service.GetAll(r.Context())
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	restGroupList := model.RestGroupList{Groups: make([]model.RestGroup, len(*groups))}
+	for i, g := range *groups {
+		restGroupList.Groups[i] = model.RestGroup{Name: g.Name}
+	}
+
+	respBody, err := json.Marshal(restGroupList)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// Retrieves the users of a set expression over groups, e.g. eng intersect oncall
+// Returns one page of users with their groups ordered by userid, and 404 if a group is not found
+func (a controller) Query(w http.ResponseWriter, r *http.Request) {
+	offset, err := uintParam(r, "offset", 0)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	limit, err := uintParam(r, "limit", defaultQueryLimit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxQueryLimit {
+		errhandler.Write(w, r, model.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxQueryLimit)))
+		return
+	}
+
+	page, err := a.service.Query(r.Context(), r.URL.Query().Get("expr"), offset, limit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	restPage := model.RestUserPage{Users: make([]model.RestUser, len(page.Users)), Total: page.Total, Offset: offset, Limit: limit}
+	for i, user := range page.Users {
+		restPage.Users[i] = toRestUser(user, page.Groups[user.Id])
+	}
+
+	respBody, err := json.Marshal(restPage)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
 // Creates an empty group
 // Returns 400 if group already exists
 func (a controller) Create(w http.ResponseWriter, r *http.Request) {
 	var restGroup model.RestGroup
 	if err := json.NewDecoder(r.Body).Decode(&restGroup); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	if err, statusCode := restGroup.Validate(); err != nil {
-		errhandler.WriteMessage(w, err.Error(), statusCode)
+	if err, _ := restGroup.Validate(); err != nil {
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	_, err := a.service.Insert(r.Context(), model.Group{Name: restGroup.Name})
 	if err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -89,7 +162,7 @@ func (a controller) Delete(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["groupName"]
 
 	if err := a.service.Delete(r.Context(), groupName); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -105,13 +178,13 @@ func (a controller) Update(w http.ResponseWriter, r *http.Request) {
 
 	var restGroupMembers model.RestGroupMembers
 	if err := json.NewDecoder(r.Body).Decode(&restGroupMembers); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
 	if err := a.service.UpdateGroupMembership(r.Context(), groupName, restGroupMembers.UserIds); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -119,9 +192,84 @@ func (a controller) Update(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, util.MessageJson("result", fmt.Sprintf("group %s has been updated\n", groupName)))
 }
 
+// Applies a merge patch or a json patch to the members of a group
+// Changes to userids add and remove single users instead of replacing every member
+// Returns 404 if group is not found
+func (a controller) Patch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupName := vars["groupName"]
+
+	group, users, err := a.service.GetWithUsers(r.Context(), groupName)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	if group == (model.Group{}) {
+		errhandler.WriteCode(w, r, model.GroupNotFound, "group %s not found", groupName)
+		return
+	}
+
+	// an empty group is patched as an empty list, so "add /userids/-" works on it
+	members := []string{}
+	if current := toRestGroupMembers(users); current.UserIds != nil {
+		members = append(members, *current.UserIds...)
+	}
+
+	var restGroupMembers model.RestGroupMembers
+	if err := patch.Apply(r, model.RestGroupMembers{UserIds: &members}, &restGroupMembers); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var newMembers []string
+	if restGroupMembers.UserIds != nil {
+		newMembers = *restGroupMembers.UserIds
+	}
+	addUserIds, removeUserIds := patch.Diff(members, newMembers)
+
+	if err := a.service.PatchGroupMembership(r.Context(), group.Name, addUserIds, removeUserIds); err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(util.MessageJson("result", fmt.Sprintf("group %s has been updated\n", group.Name))))
+}
+
+// Reads an optional non-negative integer query param
+func uintParam(r *http.Request, key string, fallback uint64) (uint64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, model.NewValidationError(key, "must be a non-negative integer")
+	}
+	return i, nil
+}
+
+// Converts a user and their groups to a RestUser object
+func toRestUser(user model.User, groups []model.Group) model.RestUser {
+	groupNames := make([]string, len(groups))
+	for i, g := range groups {
+		groupNames[i] = g.Name
+	}
+
+	return model.RestUser{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		UserId:    user.UserId,
+		Groups:    &groupNames,
+	}
+}
+
 // Converts a Group object to a RestGroup object
 func toRestGroup(group model.Group) model.RestGroup {
-	return model.RestGroup{group.Name}
+	return model.RestGroup{Name: group.Name}
 }
 
 // Converts an array of users to a RestGroupMembers object
@@ -132,5 +280,5 @@ func toRestGroupMembers(users *[]model.User) model.RestGroupMembers {
 		userIds = append(userIds, user.UserId)
 	}
 
-	return model.RestGroupMembers{&userIds}
+	return model.RestGroupMembers{UserIds: &userIds}
 }
@@ -0,0 +1,227 @@
+package group
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Most groups an expression can name
+const maxExpressionGroups = 50
+
+// Set operators of an expression, intersect binds tighter than union and except
+const (
+	opUnion     = "union"
+	opIntersect = "intersect"
+	opExcept    = "except"
+)
+
+// The symbol of every operator in the predicate of membership.Repository.QueryUsers
+var predicateOps = map[string]string{
+	opUnion:     "|",
+	opIntersect: "&",
+	opExcept:    "-",
+}
+
+// A set expression over the members of groups, e.g. (eng union ops) except "on call"
+type expression interface {
+	// Writes the expression as a predicate over group ids for membership.Repository.QueryUsers
+	// ids is keyed by the lower case group name
+	predicate(ids map[string]uint64) string
+	// Appends the names of the groups the expression uses
+	groups(names []string) []string
+}
+
+type groupName string
+
+func (g groupName) predicate(ids map[string]uint64) string {
+	return strconv.FormatUint(ids[strings.ToLower(string(g))], 10)
+}
+
+func (g groupName) groups(names []string) []string {
+	return append(names, string(g))
+}
+
+type setOp struct {
+	op    string
+	left  expression
+	right expression
+}
+
+// Every operation is put in parentheses, so the predicate does not depend on the precedence of the operators
+func (o setOp) predicate(ids map[string]uint64) string {
+	return "(" + o.left.predicate(ids) + predicateOps[o.op] + o.right.predicate(ids) + ")"
+}
+
+func (o setOp) groups(names []string) []string {
+	return o.right.groups(o.left.groups(names))
+}
+
+// Parses an expression of group names joined by union, intersect and except, grouped with parentheses
+// Names that have spaces or parentheses, or are an operator, are written in double quotes
+func parseExpression(expr string) (expression, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, model.NewValidationError("expr", "must be populated")
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+
+	if len(e.groups(nil)) > maxExpressionGroups {
+		return nil, model.NewValidationError("expr", fmt.Sprintf("must name at most %d groups", maxExpressionGroups))
+	}
+	return e, nil
+}
+
+type token struct {
+	text string
+	// set for names in double quotes, which are never operators
+	quoted bool
+	pos    int
+}
+
+// Splits an expression into parentheses, names and operators
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, token{text: string(r), pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, model.NewValidationError("expr", fmt.Sprintf("has an unterminated quote at position %d", i))
+			}
+			tokens = append(tokens, token{text: string(runes[i+1 : end]), quoted: true, pos: i})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{text: string(runes[i:end]), pos: i})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// A recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// union and except, left to right
+func (p *parser) parseUnion() (expression, error) {
+	left, err := p.parseIntersect()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekOp(opUnion, opExcept) {
+		op := strings.ToLower(p.tokens[p.pos].text)
+		p.pos++
+
+		right, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		left = setOp{op, left, right}
+	}
+	return left, nil
+}
+
+// intersect, left to right
+func (p *parser) parseIntersect() (expression, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekOp(opIntersect) {
+		p.pos++
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = setOp{opIntersect, left, right}
+	}
+	return left, nil
+}
+
+// A group name or an expression in parentheses
+func (p *parser) parseOperand() (expression, error) {
+	if p.pos == len(p.tokens) {
+		return nil, p.errorf("ends where a group name was expected")
+	}
+
+	t := p.tokens[p.pos]
+	switch {
+	case t.quoted:
+		if t.text == "" {
+			return nil, p.errorf("has an empty group name")
+		}
+	case t.text == "(":
+		p.pos++
+		e, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.tokens) || p.tokens[p.pos].quoted || p.tokens[p.pos].text != ")" {
+			return nil, p.errorf("is missing a )")
+		}
+		p.pos++
+		return e, nil
+	case t.text == ")" || p.peekOp(opUnion, opIntersect, opExcept):
+		return nil, p.errorf("has %s where a group name was expected", t.text)
+	}
+
+	p.pos++
+	return groupName(t.text), nil
+}
+
+// Checks whether the next token is one of the operators
+func (p *parser) peekOp(ops ...string) bool {
+	if p.pos == len(p.tokens) || p.tokens[p.pos].quoted {
+		return false
+	}
+	for _, op := range ops {
+		if strings.EqualFold(p.tokens[p.pos].text, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a validation error of the expr param at the current token
+func (p *parser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.pos < len(p.tokens) {
+		msg += fmt.Sprintf(" at position %d", p.tokens[p.pos].pos)
+	}
+	return model.NewValidationError("expr", msg)
+}
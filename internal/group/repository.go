@@ -5,12 +5,17 @@ import (
 	"database/sql"
 
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
 )
 
 type Repository interface {
 	Get(ctx context.Context, groupName string) (model.Group, error)
+	GetTx(ctx context.Context, tx *sql.Tx, groupName string) (model.Group, error)
+	GetAll(ctx context.Context) (*[]model.Group, error)
+	GetAllTx(ctx context.Context, tx *sql.Tx) (*[]model.Group, error)
 	Insert(ctx context.Context, group model.Group) (uint64, error)
-	Delete(ctx context.Context, groupName string) error
+	InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error)
+	DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error
 }
 
 type repository struct {
@@ -26,7 +31,7 @@ func NewRepository(db *sql.DB) Repository {
 
 // Calls the get_group sp and returns a Group object
 func (r repository) Get(ctx context.Context, groupName string) (model.Group, error) {
-	rows, err := r.db.QueryContext(ctx, "call get_group(?)", groupName)
+	rows, err := r.db.QueryContext(ctx, "call get_group(?, ?)", tenant.FromContext(ctx), groupName)
 	if err != nil {
 		return model.Group{}, err
 	}
@@ -42,9 +47,85 @@ func (r repository) Get(ctx context.Context, groupName string) (model.Group, err
 	return group, nil
 }
 
+// Calls the get_group sp as part of a transaction, the group is empty if it does not exist
+func (r repository) GetTx(ctx context.Context, tx *sql.Tx, groupName string) (model.Group, error) {
+	rows, err := tx.QueryContext(ctx, "call get_group(?, ?)", tenant.FromContext(ctx), groupName)
+	if err != nil {
+		return model.Group{}, err
+	}
+	defer rows.Close()
+
+	var group model.Group
+	for rows.Next() {
+		if err := rows.Scan(&group.Id, &group.Name); err != nil {
+			return model.Group{}, err
+		}
+	}
+
+	return group, rows.Err()
+}
+
+// Calls the get_groups sp and returns every group ordered by name
+func (r repository) GetAll(ctx context.Context) (*[]model.Group, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_groups(?)", tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		var group model.Group
+		if err := rows.Scan(&group.Id, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return &groups, nil
+}
+
+// Calls the get_groups sp as part of a transaction and returns every group ordered by name
+func (r repository) GetAllTx(ctx context.Context, tx *sql.Tx) (*[]model.Group, error) {
+	rows, err := tx.QueryContext(ctx, "call get_groups(?)", tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		var group model.Group
+		if err := rows.Scan(&group.Id, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return &groups, rows.Err()
+}
+
 // Calls ins_group sp and returns the id of that row
 func (r repository) Insert(ctx context.Context, group model.Group) (uint64, error) {
-	rows, err := r.db.QueryContext(ctx, "call ins_group(?)", group.Name)
+	rows, err := r.db.QueryContext(ctx, "call ins_group(?, ?)", tenant.FromContext(ctx), group.Name)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var id uint64
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// Calls ins_group sp as part of a transaction
+func (r repository) InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error) {
+	rows, err := tx.QueryContext(ctx, "call ins_group(?, ?)", tenant.FromContext(ctx), group.Name)
 	if err != nil {
 		return 0, err
 	}
@@ -60,8 +141,11 @@ func (r repository) Insert(ctx context.Context, group model.Group) (uint64, erro
 	return id, nil
 }
 
-// Calls the del_group sp
-func (r repository) Delete(ctx context.Context, groupName string) error {
-	_, err := r.db.QueryContext(ctx, "call del_group(?)", groupName)
-	return err
+// Calls the del_group sp as part of a transaction
+func (r repository) DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error {
+	rows, err := tx.QueryContext(ctx, "call del_group(?, ?)", tenant.FromContext(ctx), groupName)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
 }
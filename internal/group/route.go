@@ -22,8 +22,11 @@ func NewRouter(db *sql.DB) Router {
 
 // Registers the group endpoints with the router
 func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/groups:query", r.controller.Query).Methods(http.MethodGet)
 	mr.HandleFunc("/groups/{groupName}", r.controller.Get).Methods(http.MethodGet)
+	mr.HandleFunc("/groups", r.controller.List).Methods(http.MethodGet)
 	mr.HandleFunc("/groups", r.controller.Create).Methods(http.MethodPost)
 	mr.HandleFunc("/groups/{groupName}", r.controller.Delete).Methods(http.MethodDelete)
 	mr.HandleFunc("/groups/{groupName}", r.controller.Update).Methods(http.MethodPut)
+	mr.HandleFunc("/groups/{groupName}", r.controller.Patch).Methods(http.MethodPatch)
 }
@@ -3,26 +3,44 @@ package group
 import (
 	"context"
 	"database/sql"
+	"strings"
 
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
 	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
 )
 
 type Service interface {
+	Get(ctx context.Context, groupName string) (model.Group, error)
 	GetWithUsers(ctx context.Context, groupName string) (model.Group, *[]model.User, error)
+	GetWithUsersTx(ctx context.Context, tx *sql.Tx, groupName string) (model.Group, *[]model.User, error)
+	GetAll(ctx context.Context) (*[]model.Group, error)
+	GetAllTx(ctx context.Context, tx *sql.Tx) (*[]model.Group, error)
 	Insert(ctx context.Context, group model.Group) (uint64, error)
+	InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error)
 	Delete(ctx context.Context, groupName string) error
+	DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error
 	UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error
+	UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error
+	PatchGroupMembership(ctx context.Context, groupName string, addUserIds []string, removeUserIds []string) error
+	Query(ctx context.Context, expr string, offset uint64, limit uint64) (model.UserPage, error)
 }
 
 type service struct {
 	repo              Repository
 	membershipService membership.Service
+	db                *sql.DB
 }
 
 // Creates a new group service instance
 func NewService(db *sql.DB) Service {
-	return service{NewRepository(db), membership.NewService(db)}
+	return tracedService{cachedService{service{NewRepository(db), membership.NewService(db), db}}}
+}
+
+// Gets the group without its users
+func (s service) Get(ctx context.Context, groupName string) (model.Group, error) {
+	return s.repo.Get(ctx, groupName)
 }
 
 // Gets the group and the linked users
@@ -40,17 +58,137 @@ func (s service) GetWithUsers(ctx context.Context, groupName string) (model.Grou
 	return group, users, nil
 }
 
+// Gets the group and the linked users as part of a transaction, with the writes of the transaction
+func (s service) GetWithUsersTx(ctx context.Context, tx *sql.Tx, groupName string) (model.Group, *[]model.User, error) {
+	group, err := s.repo.GetTx(ctx, tx, groupName)
+	if err != nil {
+		return model.Group{}, nil, err
+	}
+
+	users, err := s.membershipService.GetUsersForGroupTx(ctx, tx, group.Id)
+	if err != nil {
+		return model.Group{}, nil, err
+	}
+
+	return group, users, nil
+}
+
+// Gets every group
+func (s service) GetAll(ctx context.Context) (*[]model.Group, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// Gets every group as part of a transaction
+func (s service) GetAllTx(ctx context.Context, tx *sql.Tx) (*[]model.Group, error) {
+	return s.repo.GetAllTx(ctx, tx)
+}
+
 // Inserts a new group
 func (s service) Insert(ctx context.Context, group model.Group) (uint64, error) {
 	return s.repo.Insert(ctx, group)
 }
 
-// Deletes the group
+// Inserts a new group as part of a transaction
+func (s service) InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error) {
+	return s.repo.InsertTx(ctx, tx, group)
+}
+
+// Deletes the group and its links to users in a transaction
 func (s service) Delete(ctx context.Context, groupName string) error {
-	return s.repo.Delete(ctx, groupName)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if err := s.repo.DeleteTx(ctx, tx, groupName); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}()
+
+	if err != nil {
+		tx.Rollback()
+	}
+
+	return err
+}
+
+// Deletes the group and its links to users as part of a transaction
+func (s service) DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error {
+	return s.repo.DeleteTx(ctx, tx, groupName)
 }
 
 // Updates the membership of the group
 func (s service) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
 	return s.membershipService.UpdateGroupMembership(ctx, groupName, userIds)
 }
+
+// Updates the membership of the group as part of a transaction
+func (s service) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	return s.membershipService.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+}
+
+// Adds and removes single users of the group in a transaction
+// Users that are in neither list stay in the group, the cache entries of the others are dropped after the commit
+func (s service) PatchGroupMembership(ctx context.Context, groupName string, addUserIds []string, removeUserIds []string) error {
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		for _, userId := range removeUserIds {
+			if err := s.membershipService.RemoveGroupMemberTx(ctx, tx, groupName, userId); err != nil {
+				return err
+			}
+		}
+
+		for _, userId := range addUserIds {
+			if err := s.membershipService.AddGroupMemberTx(ctx, tx, groupName, userId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Gets one page of the users of a set expression over groups, ordered by userid, with their groups
+// The expression is worked out by the database, only the users of the page and their groups are loaded
+// Returns a GROUP_NOT_FOUND error if a group does not exist
+func (s service) Query(ctx context.Context, expr string, offset uint64, limit uint64) (model.UserPage, error) {
+	e, err := parseExpression(expr)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	ids := map[string]uint64{}
+	for _, name := range e.groups(nil) {
+		if _, found := ids[strings.ToLower(name)]; found {
+			continue
+		}
+		group, err := s.repo.Get(ctx, name)
+		if err != nil {
+			return model.UserPage{}, err
+		}
+		if group == (model.Group{}) {
+			return model.UserPage{}, errhandler.New(model.GroupNotFound, "group %s not found", name)
+		}
+		ids[strings.ToLower(name)] = group.Id
+	}
+
+	page, err := s.membershipService.QueryUsers(ctx, e.predicate(ids), offset, limit)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	page.Groups = map[uint64][]model.Group{}
+	userIds := make([]uint64, len(page.Users))
+	for i, user := range page.Users {
+		userIds[i] = user.Id
+	}
+	if len(userIds) != 0 {
+		if page.Groups, err = s.membershipService.GetGroupsForUsers(ctx, userIds); err != nil {
+			return model.UserPage{}, err
+		}
+	}
+
+	return page, nil
+}
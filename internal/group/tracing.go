@@ -0,0 +1,110 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/group")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) Get(ctx context.Context, groupName string) (model.Group, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.Get", trace.WithAttributes(attribute.String("group.name", groupName)))
+	group, err := s.next.Get(ctx, groupName)
+	tracing.End(span, err)
+	return group, err
+}
+
+func (s tracedService) GetWithUsers(ctx context.Context, groupName string) (model.Group, *[]model.User, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.GetWithUsers", trace.WithAttributes(attribute.String("group.name", groupName)))
+	group, users, err := s.next.GetWithUsers(ctx, groupName)
+	tracing.End(span, err)
+	return group, users, err
+}
+
+func (s tracedService) GetWithUsersTx(ctx context.Context, tx *sql.Tx, groupName string) (model.Group, *[]model.User, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.GetWithUsersTx", trace.WithAttributes(attribute.String("group.name", groupName)))
+	group, users, err := s.next.GetWithUsersTx(ctx, tx, groupName)
+	tracing.End(span, err)
+	return group, users, err
+}
+
+func (s tracedService) GetAll(ctx context.Context) (*[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.GetAll")
+	groups, err := s.next.GetAll(ctx)
+	tracing.End(span, err)
+	return groups, err
+}
+
+func (s tracedService) GetAllTx(ctx context.Context, tx *sql.Tx) (*[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.GetAllTx")
+	groups, err := s.next.GetAllTx(ctx, tx)
+	tracing.End(span, err)
+	return groups, err
+}
+
+func (s tracedService) Insert(ctx context.Context, group model.Group) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.Insert", trace.WithAttributes(attribute.String("group.name", group.Name)))
+	id, err := s.next.Insert(ctx, group)
+	tracing.End(span, err)
+	return id, err
+}
+
+func (s tracedService) InsertTx(ctx context.Context, tx *sql.Tx, group model.Group) (uint64, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.InsertTx", trace.WithAttributes(attribute.String("group.name", group.Name)))
+	id, err := s.next.InsertTx(ctx, tx, group)
+	tracing.End(span, err)
+	return id, err
+}
+
+func (s tracedService) Delete(ctx context.Context, groupName string) error {
+	ctx, span := tracer.Start(ctx, "group.Service.Delete", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.Delete(ctx, groupName)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) DeleteTx(ctx context.Context, tx *sql.Tx, groupName string) error {
+	ctx, span := tracer.Start(ctx, "group.Service.DeleteTx", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.DeleteTx(ctx, tx, groupName)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
+	ctx, span := tracer.Start(ctx, "group.Service.UpdateGroupMembership", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.UpdateGroupMembership(ctx, groupName, userIds)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	ctx, span := tracer.Start(ctx, "group.Service.UpdateGroupMembershipTx", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) PatchGroupMembership(ctx context.Context, groupName string, addUserIds []string, removeUserIds []string) error {
+	ctx, span := tracer.Start(ctx, "group.Service.PatchGroupMembership", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.PatchGroupMembership(ctx, groupName, addUserIds, removeUserIds)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) Query(ctx context.Context, expr string, offset uint64, limit uint64) (model.UserPage, error) {
+	ctx, span := tracer.Start(ctx, "group.Service.Query", trace.WithAttributes(attribute.String("group.expr", expr)))
+	page, err := s.next.Query(ctx, expr, offset, limit)
+	tracing.End(span, err)
+	return page, err
+}
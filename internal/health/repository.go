@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Version of the schema in db/docker/init.sql this build expects
+// Bump it with the insert into schema_version whenever the schema or a procedure changes
+const SchemaVersion = 10
+
+type repository struct {
+	db *sql.DB
+}
+
+// Calls get_schema_version and returns the version of the schema in the DB
+func (r repository) getSchemaVersion(ctx context.Context) (int, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_schema_version()")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int
+	for rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, rows.Err()
+}
+
+// Creates a check that the DB answers a ping
+func DbCheck(db *sql.DB) Check {
+	return db.PingContext
+}
+
+// Creates a check that the schema of the DB is the one this build expects
+func SchemaCheck(db *sql.DB) Check {
+	repo := repository{db}
+	return func(ctx context.Context) error {
+		version, err := repo.getSchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if version != SchemaVersion {
+			return fmt.Errorf("schema version is %d, expected %d", version, SchemaVersion)
+		}
+		return nil
+	}
+}
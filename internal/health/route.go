@@ -0,0 +1,55 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	registry *Registry
+}
+
+// Creates a new router serving the checks of the registry
+func NewRouter(registry *Registry) Router {
+	return router{registry}
+}
+
+// Sets up the /healthz and /readyz routes
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/healthz", r.healthz).Methods(http.MethodGet)
+	mr.HandleFunc("/readyz", r.readyz).Methods(http.MethodGet)
+}
+
+// Liveness, the process is up and serving requests
+func (r router) healthz(w http.ResponseWriter, req *http.Request) {
+	writeJson(w, http.StatusOK, Report{Status: StatusOk, Checks: map[string]CheckResult{}})
+}
+
+// Readiness, every dependency check passes and the service is not shutting down
+// Returns 503 with the breakdown of the checks otherwise
+func (r router) readyz(w http.ResponseWriter, req *http.Request) {
+	report := r.registry.Ready(req.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+	writeJson(w, status, report)
+}
+
+func writeJson(w http.ResponseWriter, status int, report Report) {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(payload)
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracks that the background workers are still running their loops
+type Workers struct {
+	mu      sync.Mutex
+	workers map[string]*Heartbeat
+}
+
+// Proof of life of a background worker
+// A worker is unhealthy when it has not beaten for longer than its interval times three
+type Heartbeat struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     time.Time
+	err      error
+}
+
+// Creates an empty set of workers, which is healthy
+func NewWorkers() *Workers {
+	return &Workers{workers: map[string]*Heartbeat{}}
+}
+
+// Adds a worker that is expected to call Beat at least every interval
+func (w *Workers) Add(name string, interval time.Duration) *Heartbeat {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	heartbeat := &Heartbeat{interval: interval, last: time.Now()}
+	w.workers[name] = heartbeat
+	return heartbeat
+}
+
+// Removes a worker that stopped on purpose
+func (w *Workers) Remove(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.workers, name)
+}
+
+// Checks every worker beat recently and its last run did not fail
+func (w *Workers) Check(ctx context.Context) error {
+	w.mu.Lock()
+	names := make([]string, 0, len(w.workers))
+	for name := range w.workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := []string{}
+	for _, name := range names {
+		if err := w.workers[name].check(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	w.mu.Unlock()
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Records that the worker ran, err is the result of the run
+func (h *Heartbeat) Beat(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+	h.err = err
+}
+
+func (h *Heartbeat) check() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if since := time.Since(h.last); since > 3*h.interval {
+		return fmt.Errorf("no heartbeat for %s", since.Round(time.Second))
+	}
+	return h.err
+}
@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// A stored key, Status is 0 while the request that reserved it is running
+type record struct {
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+// Calls ins_idempotency_key, returns false if the key is already reserved
+// The reservation expires after the lease unless the response is stored first
+func (r repository) reserve(ctx context.Context, id string, requestHash string, lease time.Duration) (bool, error) {
+	rows, err := r.db.QueryContext(ctx, "call ins_idempotency_key(?, ?, ?)", id, requestHash, seconds(lease))
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1062 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, rows.Close()
+}
+
+// Calls get_idempotency_key, returns false if the key is not reserved or expired
+func (r repository) get(ctx context.Context, id string) (record, bool, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_idempotency_key(?)", id)
+	if err != nil {
+		return record{}, false, err
+	}
+	defer rows.Close()
+
+	var rec record
+	var found bool
+	for rows.Next() {
+		var status sql.NullInt64
+		var contentType sql.NullString
+		if err := rows.Scan(&rec.RequestHash, &status, &contentType, &rec.Body); err != nil {
+			return record{}, false, err
+		}
+		rec.Status, rec.ContentType, found = int(status.Int64), contentType.String, true
+	}
+
+	return rec, found, rows.Err()
+}
+
+// Calls upd_idempotency_key to store the response of the request that reserved the key for the ttl
+func (r repository) complete(ctx context.Context, id string, status int, contentType string, body []byte, ttl time.Duration) error {
+	rows, err := r.db.QueryContext(ctx, "call upd_idempotency_key(?, ?, ?, ?, ?)", id, status, contentType, body, seconds(ttl))
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Calls del_idempotency_key so the key can be used again
+func (r repository) release(ctx context.Context, id string) error {
+	rows, err := r.db.QueryContext(ctx, "call del_idempotency_key(?)", id)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Calls del_expired_idempotency_keys and returns the number of keys deleted
+func (r repository) deleteExpired(ctx context.Context) (int64, error) {
+	rows, err := r.db.QueryContext(ctx, "call del_expired_idempotency_keys()")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var deleted int64
+	for rows.Next() {
+		if err := rows.Scan(&deleted); err != nil {
+			return 0, err
+		}
+	}
+	return deleted, rows.Err()
+}
+
+// Rounds up to whole seconds, so a duration under a second does not expire at once
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,170 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+)
+
+const (
+	// Header a client sets to the same value on every retry of a POST
+	Header = "Idempotency-Key"
+	// Header set on responses replayed from a previous request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// Makes POST requests sent with an Idempotency-Key header safe to retry
+// The first request reserves the key for the lease and its response is stored for the TTL. A retry with the same key,
+// method, path and body gets the stored response replayed, one with a different request is rejected with a 422,
+// and one sent while the first is still running is rejected with a 409. 5xx responses are not stored,
+// and a reservation whose request panicked or never finished is freed, or expires after the lease.
+// Keys are scoped to the verified identity of the caller, or its IP
+type Store struct {
+	repo  repository
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// Creates a store keeping responses for ttl and reservations of running requests for lease
+func NewStore(db *sql.DB, ttl time.Duration, lease time.Duration) *Store {
+	return &Store{repository{db}, ttl, lease}
+}
+
+// Reserves the key of POST requests that have one and replays the response of retries
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			errhandler.Write(w, r, model.NewValidationError(Header, "must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			errhandler.Write(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		id, requestHash := scopedKey(r, key), hashRequest(r, body)
+
+		reserved, err := s.repo.reserve(r.Context(), id, requestHash, s.lease)
+		if err != nil {
+			errhandler.Write(w, r, err)
+			return
+		}
+		if !reserved {
+			s.replay(w, r, id, requestHash)
+			return
+		}
+
+		// the key is stored or released even if the client went away
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			if p := recover(); p != nil {
+				if err := s.repo.release(ctx, id); err != nil {
+					slog.ErrorContext(ctx, "releasing idempotency key failed", slog.Any("error", err))
+				}
+				panic(p)
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			err = s.repo.release(ctx, id)
+		} else {
+			err = s.repo.complete(ctx, id, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes(), s.ttl)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "storing idempotency key failed", slog.Any("error", err))
+		}
+	})
+}
+
+// Writes the stored response of a key, if the request matches the one that reserved it
+func (s *Store) replay(w http.ResponseWriter, r *http.Request, id string, requestHash string) {
+	stored, found, err := s.repo.get(r.Context(), id)
+	switch {
+	case err != nil:
+		errhandler.Write(w, r, err)
+	case found && stored.RequestHash != requestHash:
+		errhandler.WriteCode(w, r, model.IdempotencyKeyReuse, "the %s was used with a different request", Header)
+	case !found || stored.Status == 0:
+		errhandler.WriteCode(w, r, model.RequestInProgress, "a request with this %s is still in progress, retry later", Header)
+	default:
+		if stored.ContentType != "" {
+			w.Header().Set("Content-Type", stored.ContentType)
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// Deletes the expired keys
+func (s *Store) Cleanup(ctx context.Context) error {
+	deleted, err := s.repo.deleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+	if deleted != 0 {
+		slog.DebugContext(ctx, "deleted expired idempotency keys", slog.Int64("count", deleted))
+	}
+	return nil
+}
+
+// Hashes the key with the tenant and the caller, so clients can not replay each other's responses
+func scopedKey(r *http.Request, key string) string {
+	return hash(tenant.FromContext(r.Context()), mw.ClientKey(r), key)
+}
+
+// Hashes what makes two requests with the same key identical
+func hashRequest(r *http.Request, body []byte) string {
+	return hash(r.Method, r.URL.RequestURI(), string(body))
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Passes the response through and keeps a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
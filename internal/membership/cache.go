@@ -0,0 +1,54 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+)
+
+// Invalidates the user and group entries of cache.Users and cache.Groups a membership change touches
+// InsertTx and UpdateTx only know the internal id of the user, user.Service invalidates for them.
+// UpdateGroupMembership does not know the users that left the group, group.Service invalidates them
+type cachedService struct {
+	Service
+}
+
+func (s cachedService) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
+	err := s.Service.UpdateGroupMembership(ctx, groupName, userIds)
+	cache.Invalidate(ctx, nil, []string{groupName})
+	return err
+}
+
+// See AddGroupMemberTx
+func (s cachedService) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	err := s.Service.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+	cache.Invalidate(ctx, nil, []string{groupName})
+	return err
+}
+
+func (s cachedService) AddGroupMember(ctx context.Context, groupName string, userId string) error {
+	err := s.Service.AddGroupMember(ctx, groupName, userId)
+	cache.Invalidate(ctx, []string{userId}, []string{groupName})
+	return err
+}
+
+// The caller runs the transaction under cache.Defer, so the entries are only dropped once it commits
+func (s cachedService) AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	err := s.Service.AddGroupMemberTx(ctx, tx, groupName, userId)
+	cache.Invalidate(ctx, []string{userId}, []string{groupName})
+	return err
+}
+
+func (s cachedService) RemoveGroupMember(ctx context.Context, groupName string, userId string) error {
+	err := s.Service.RemoveGroupMember(ctx, groupName, userId)
+	cache.Invalidate(ctx, []string{userId}, []string{groupName})
+	return err
+}
+
+// See AddGroupMemberTx
+func (s cachedService) RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	err := s.Service.RemoveGroupMemberTx(ctx, tx, groupName, userId)
+	cache.Invalidate(ctx, []string{userId}, []string{groupName})
+	return err
+}
@@ -4,17 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
 )
 
 type Repository interface {
 	GetGroupsForUser(ctx context.Context, userId uint64) (*[]model.Group, error)
 	GetUsersForGroup(ctx context.Context, groupId uint64) (*[]model.User, error)
+	GetGroupsForUsers(ctx context.Context, userIds []uint64) (map[uint64][]model.Group, error)
+	GetUsersForGroups(ctx context.Context, groupIds []uint64) (map[uint64][]model.User, error)
+	QueryUsers(ctx context.Context, predicate string, offset uint64, limit uint64) (*[]model.User, error)
+	CountQueryUsers(ctx context.Context, predicate string) (uint64, error)
+	GetGroupsForUserTx(ctx context.Context, tx *sql.Tx, userId uint64) (*[]model.Group, error)
+	GetUsersForGroupTx(ctx context.Context, tx *sql.Tx, groupId uint64) (*[]model.User, error)
 	InsertTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error
 	UpdateTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error
-	UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error
+	UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error
+	AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error
+	RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error
+	RemoveUserTx(ctx context.Context, tx *sql.Tx, userId uint64) error
 }
 
 type repository struct {
@@ -28,7 +40,7 @@ func NewRepository(db *sql.DB) Repository {
 
 // Gets the groups that the user belongs to
 func (r repository) GetGroupsForUser(ctx context.Context, userId uint64) (*[]model.Group, error) {
-	rows, err := r.db.QueryContext(ctx, "call get_user_membership(?)", userId)
+	rows, err := r.db.QueryContext(ctx, "call get_user_membership(?, ?)", tenant.FromContext(ctx), userId)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +61,7 @@ func (r repository) GetGroupsForUser(ctx context.Context, userId uint64) (*[]mod
 
 // Gets the users that are inside of a group
 func (r repository) GetUsersForGroup(ctx context.Context, groupId uint64) (*[]model.User, error) {
-	rows, err := r.db.QueryContext(ctx, "call get_group_membership(?)", groupId)
+	rows, err := r.db.QueryContext(ctx, "call get_group_membership(?, ?)", tenant.FromContext(ctx), groupId)
 	if err != nil {
 		return nil, err
 	}
@@ -68,36 +80,316 @@ func (r repository) GetUsersForGroup(ctx context.Context, groupId uint64) (*[]mo
 	return &users, nil
 }
 
+// Gets the groups of several users in one call, keyed by user id
+func (r repository) GetGroupsForUsers(ctx context.Context, userIds []uint64) (map[uint64][]model.Group, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_users_membership(?, ?)", tenant.FromContext(ctx), toIdList(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[uint64][]model.Group, len(userIds))
+
+	for rows.Next() {
+		var userId uint64
+		var group model.Group
+		if err := rows.Scan(&userId, &group.Id, &group.Name); err != nil {
+			return nil, err
+		}
+		groups[userId] = append(groups[userId], group)
+	}
+
+	return groups, nil
+}
+
+// Gets the users of several groups in one call, keyed by group id
+func (r repository) GetUsersForGroups(ctx context.Context, groupIds []uint64) (map[uint64][]model.User, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_groups_membership(?, ?)", tenant.FromContext(ctx), toIdList(groupIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make(map[uint64][]model.User, len(groupIds))
+
+	for rows.Next() {
+		var groupId uint64
+		var user model.User
+		if err := rows.Scan(&groupId, &user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return nil, err
+		}
+		users[groupId] = append(users[groupId], user)
+	}
+
+	return users, nil
+}
+
+// Calls query_group_users and returns one page of the users whose groups make the predicate true, ordered by userid
+// The predicate is a fully parenthesized expression of group ids joined by & (in both), | (in either)
+// and - (in the first but not the second), e.g. ((3|5)-7)
+func (r repository) QueryUsers(ctx context.Context, predicate string, offset uint64, limit uint64) (*[]model.User, error) {
+	rows, err := r.db.QueryContext(ctx, "call query_group_users(?, ?, ?, ?)", tenant.FromContext(ctx), predicate, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return &users, rows.Err()
+}
+
+// Calls count_query_group_users and returns the number of users whose groups make the predicate true
+func (r repository) CountQueryUsers(ctx context.Context, predicate string) (uint64, error) {
+	rows, err := r.db.QueryContext(ctx, "call count_query_group_users(?, ?)", tenant.FromContext(ctx), predicate)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, rows.Err()
+}
+
+// Gets the groups that the user belongs to as part of a transaction, with the writes of the transaction
+func (r repository) GetGroupsForUserTx(ctx context.Context, tx *sql.Tx, userId uint64) (*[]model.Group, error) {
+	rows, err := tx.QueryContext(ctx, "call get_user_membership(?, ?)", tenant.FromContext(ctx), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []model.Group
+
+	for rows.Next() {
+		var group model.Group
+		if err := rows.Scan(&group.Id, &group.Name); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return &groups, rows.Err()
+}
+
+// Gets the users that are inside of a group as part of a transaction, with the writes of the transaction
+func (r repository) GetUsersForGroupTx(ctx context.Context, tx *sql.Tx, groupId uint64) (*[]model.User, error) {
+	rows, err := tx.QueryContext(ctx, "call get_group_membership(?, ?)", tenant.FromContext(ctx), groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return &users, rows.Err()
+}
+
 // Inserts a link between a user and an array of groups
-// Done in a transaction
+// Done in a transaction, fails with a policy violation when a group can not take the user
 func (r repository) InsertTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error {
 	groupNamesStr := toDelimitedString(groupNames, ",")
 	if groupNamesStr == "" {
 		return nil
 	}
-	_, err := tx.QueryContext(ctx, "call ins_membership(?, ?)", userId, groupNamesStr)
-	return err
+
+	return r.changeUserTx(ctx, tx, userId, groupNamesStr, "call ins_membership(?, ?, ?)")
 }
 
 // Removes existing user - group rows and inserts new ones
-// Done in a transaction
+// Done in a transaction, fails with a policy violation when a group can not take or lose the user
 func (r repository) UpdateTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error {
 	groupNamesStr := toDelimitedString(groupNames, ",")
 	if groupNamesStr == "" {
 		return nil
 	}
-	_, err := tx.QueryContext(ctx, "call upd_membership(?, ?)", userId, groupNamesStr)
-	return err
+
+	return r.changeUserTx(ctx, tx, userId, groupNamesStr, "call upd_membership(?, ?, ?)")
+}
+
+// Removes a user from all of its groups, before the user is deleted
+// Done in a transaction, fails with a policy violation when a group can not lose the user
+func (r repository) RemoveUserTx(ctx context.Context, tx *sql.Tx, userId uint64) error {
+	return r.changeUserTx(ctx, tx, userId, "", "call upd_membership(?, ?, ?)")
 }
 
 // Removes existing users of a group, and inserts new users
-func (r repository) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
+// Done in a transaction, fails with a policy violation when the new members break the policy of the group
+func (r repository) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
 	userIdsStr := toDelimitedString(userIds, ",")
 	if userIdsStr == "" {
 		return nil
 	}
-	_, err := r.db.QueryContext(ctx, "call upd_group_membership(?, ?)", groupName, userIdsStr)
-	return err
+
+	return r.changeGroupTx(ctx, tx, groupName, "call upd_group_membership(?, ?, ?)", tenant.FromContext(ctx), groupName, userIdsStr)
+}
+
+// Links a single user to a group
+// Done in a transaction, fails with a policy violation when the group can not take the user
+func (r repository) AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	return r.changeGroupTx(ctx, tx, groupName, "call ins_group_membership(?, ?, ?)", tenant.FromContext(ctx), groupName, userId)
+}
+
+// Unlinks a single user from a group
+// Done in a transaction, fails with a policy violation when the group can not lose the user
+func (r repository) RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	return r.changeGroupTx(ctx, tx, groupName, "call del_group_membership(?, ?, ?)", tenant.FromContext(ctx), groupName, userId)
+}
+
+// Locks groups until the transaction ends and gets their members, keyed by group id
+// The members are read with a locking read, so they include the members committed since the transaction began
+func (r repository) lockGroupsTx(ctx context.Context, tx *sql.Tx, groupNamesStr string) (map[uint64]map[uint64]bool, error) {
+	members := map[uint64]map[uint64]bool{}
+	if groupNamesStr == "" {
+		return members, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "call lock_groups(?, ?)", tenant.FromContext(ctx), groupNamesStr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupId uint64
+		var userId sql.NullInt64
+		if err := rows.Scan(&groupId, &userId); err != nil {
+			return nil, err
+		}
+		if members[groupId] == nil {
+			members[groupId] = map[uint64]bool{}
+		}
+		if userId.Valid {
+			members[groupId][uint64(userId.Int64)] = true
+		}
+	}
+
+	return members, rows.Err()
+}
+
+// Runs a write to the groups of a user and checks the policies of the groups the user joined or left, as part of a transaction
+// The groups the user is in and the groups of the write are locked first, so concurrent writes to a group run one after the other
+func (r repository) changeUserTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNamesStr string, query string) error {
+	groups, err := r.GetGroupsForUserTx(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+	lockNames := groupNamesStr
+	if len(*groups) != 0 {
+		current := make([]string, len(*groups))
+		for i, group := range *groups {
+			current[i] = group.Name
+		}
+		lockNames = strings.TrimSuffix(toDelimitedString(&current, ",")+","+groupNamesStr, ",")
+	}
+
+	before, err := r.lockGroupsTx(ctx, tx, lockNames)
+	if err != nil {
+		return err
+	}
+	if err := callTx(ctx, tx, query, tenant.FromContext(ctx), userId, groupNamesStr); err != nil {
+		return err
+	}
+	after, err := r.lockGroupsTx(ctx, tx, lockNames)
+	if err != nil {
+		return err
+	}
+
+	// checked in a fixed order so the same write always reports the same rule
+	groupIds := make([]uint64, 0, len(after))
+	for groupId := range after {
+		groupIds = append(groupIds, groupId)
+	}
+	sort.Slice(groupIds, func(i, j int) bool { return groupIds[i] < groupIds[j] })
+
+	for _, groupId := range groupIds {
+		joined, left := after[groupId][userId] && !before[groupId][userId], before[groupId][userId] && !after[groupId][userId]
+		switch {
+		case joined:
+			err = callTx(ctx, tx, "call chk_group_limits(?, ?, ?, ?)", tenant.FromContext(ctx), groupId, 1, toIdList([]uint64{userId}))
+		case left:
+			err = callTx(ctx, tx, "call chk_group_limits(?, ?, ?, ?)", tenant.FromContext(ctx), groupId, -1, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs a write to the members of a group and checks the policy of the group when its members changed, as part of a transaction
+// The group is locked first, so concurrent writes to it run one after the other
+func (r repository) changeGroupTx(ctx context.Context, tx *sql.Tx, groupName string, query string, args ...interface{}) error {
+	groupNamesStr := toDelimitedString(&[]string{groupName}, ",")
+	before, err := r.lockGroupsTx(ctx, tx, groupNamesStr)
+	if err != nil {
+		return err
+	}
+	if err := callTx(ctx, tx, query, args...); err != nil {
+		return err
+	}
+	after, err := r.lockGroupsTx(ctx, tx, groupNamesStr)
+	if err != nil {
+		return err
+	}
+
+	for groupId, members := range after {
+		var added []uint64
+		for userId := range members {
+			if !before[groupId][userId] {
+				added = append(added, userId)
+			}
+		}
+		if len(added) == 0 && len(members) == len(before[groupId]) {
+			continue
+		}
+
+		sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+		delta := len(members) - len(before[groupId])
+		if err := callTx(ctx, tx, "call chk_group_limits(?, ?, ?, ?)", tenant.FromContext(ctx), groupId, delta, toIdList(added)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls a procedure that returns no rows as part of a transaction
+func callTx(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// Converts a list of ids to the comma separated list FIND_IN_SET expects
+func toIdList(ids []uint64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(strs, ",")
 }
 
 // Converts a list to a delimited separated string
@@ -4,24 +4,37 @@ import (
 	"context"
 	"database/sql"
 
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
 )
 
 type Service interface {
 	GetGroupsForUser(ctx context.Context, userId uint64) (*[]model.Group, error)
 	GetUsersForGroup(ctx context.Context, groupId uint64) (*[]model.User, error)
+	GetGroupsForUsers(ctx context.Context, userIds []uint64) (map[uint64][]model.Group, error)
+	GetUsersForGroups(ctx context.Context, groupIds []uint64) (map[uint64][]model.User, error)
+	QueryUsers(ctx context.Context, predicate string, offset uint64, limit uint64) (model.UserPage, error)
+	GetGroupsForUserTx(ctx context.Context, tx *sql.Tx, userId uint64) (*[]model.Group, error)
+	GetUsersForGroupTx(ctx context.Context, tx *sql.Tx, groupId uint64) (*[]model.User, error)
 	InsertTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error
 	UpdateTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error
 	UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error
+	UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error
+	AddGroupMember(ctx context.Context, groupName string, userId string) error
+	AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error
+	RemoveGroupMember(ctx context.Context, groupName string, userId string) error
+	RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error
+	RemoveUserTx(ctx context.Context, tx *sql.Tx, userId uint64) error
 }
 
 type service struct {
 	repo Repository
+	db   *sql.DB
 }
 
 // Creates a new membership service instance
 func NewService(db *sql.DB) Service {
-	return service{NewRepository(db)}
+	return tracedService{cachedService{service{NewRepository(db), db}}}
 }
 
 // Gets groups for a user
@@ -34,6 +47,42 @@ func (s service) GetUsersForGroup(ctx context.Context, groupId uint64) (*[]model
 	return s.repo.GetUsersForGroup(ctx, groupId)
 }
 
+// Gets groups for several users at once
+func (s service) GetGroupsForUsers(ctx context.Context, userIds []uint64) (map[uint64][]model.Group, error) {
+	return s.repo.GetGroupsForUsers(ctx, userIds)
+}
+
+// Gets users for several groups at once
+func (s service) GetUsersForGroups(ctx context.Context, groupIds []uint64) (map[uint64][]model.User, error) {
+	return s.repo.GetUsersForGroups(ctx, groupIds)
+}
+
+// Gets one page of the users whose groups make the predicate true, ordered by userid, with the number of them
+// See Repository.QueryUsers for the predicate. The groups of the users are not loaded
+func (s service) QueryUsers(ctx context.Context, predicate string, offset uint64, limit uint64) (model.UserPage, error) {
+	total, err := s.repo.CountQueryUsers(ctx, predicate)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	users, err := s.repo.QueryUsers(ctx, predicate, offset, limit)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	return model.UserPage{Users: *users, Total: total}, nil
+}
+
+// Gets groups for a user as part of a transaction
+func (s service) GetGroupsForUserTx(ctx context.Context, tx *sql.Tx, userId uint64) (*[]model.Group, error) {
+	return s.repo.GetGroupsForUserTx(ctx, tx, userId)
+}
+
+// Gets users for a group as part of a transaction
+func (s service) GetUsersForGroupTx(ctx context.Context, tx *sql.Tx, groupId uint64) (*[]model.User, error) {
+	return s.repo.GetUsersForGroupTx(ctx, tx, groupId)
+}
+
 // Inserts user to groups linkage as part of a transaction
 func (s service) InsertTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error {
 	return s.repo.InsertTx(ctx, tx, userId, groupNames)
@@ -44,7 +93,43 @@ func (s service) UpdateTx(ctx context.Context, tx *sql.Tx, userId uint64, groupN
 	return s.repo.UpdateTx(ctx, tx, userId, groupNames)
 }
 
-// Updates group membership
+// Updates group membership in its own transaction
 func (s service) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
-	return s.repo.UpdateGroupMembership(ctx, groupName, userIds)
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		return s.repo.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+	})
+}
+
+// Updates group membership as part of a transaction
+func (s service) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	return s.repo.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+}
+
+// Adds a user to a group in its own transaction
+func (s service) AddGroupMember(ctx context.Context, groupName string, userId string) error {
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		return s.repo.AddGroupMemberTx(ctx, tx, groupName, userId)
+	})
+}
+
+// Adds a user to a group as part of a transaction
+func (s service) AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	return s.repo.AddGroupMemberTx(ctx, tx, groupName, userId)
+}
+
+// Removes a user from a group in its own transaction
+func (s service) RemoveGroupMember(ctx context.Context, groupName string, userId string) error {
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		return s.repo.RemoveGroupMemberTx(ctx, tx, groupName, userId)
+	})
+}
+
+// Removes a user from a group as part of a transaction
+func (s service) RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	return s.repo.RemoveGroupMemberTx(ctx, tx, groupName, userId)
+}
+
+// Removes a user from all of its groups as part of a transaction, before the user is deleted
+func (s service) RemoveUserTx(ctx context.Context, tx *sql.Tx, userId uint64) error {
+	return s.repo.RemoveUserTx(ctx, tx, userId)
 }
@@ -0,0 +1,131 @@
+package membership
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/membership")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) GetGroupsForUser(ctx context.Context, userId uint64) (*[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetGroupsForUser")
+	groups, err := s.next.GetGroupsForUser(ctx, userId)
+	tracing.End(span, err)
+	return groups, err
+}
+
+func (s tracedService) GetUsersForGroup(ctx context.Context, groupId uint64) (*[]model.User, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetUsersForGroup")
+	users, err := s.next.GetUsersForGroup(ctx, groupId)
+	tracing.End(span, err)
+	return users, err
+}
+
+func (s tracedService) GetGroupsForUsers(ctx context.Context, userIds []uint64) (map[uint64][]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetGroupsForUsers")
+	groups, err := s.next.GetGroupsForUsers(ctx, userIds)
+	tracing.End(span, err)
+	return groups, err
+}
+
+func (s tracedService) GetUsersForGroups(ctx context.Context, groupIds []uint64) (map[uint64][]model.User, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetUsersForGroups")
+	users, err := s.next.GetUsersForGroups(ctx, groupIds)
+	tracing.End(span, err)
+	return users, err
+}
+
+func (s tracedService) QueryUsers(ctx context.Context, predicate string, offset uint64, limit uint64) (model.UserPage, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.QueryUsers", trace.WithAttributes(attribute.String("membership.predicate", predicate)))
+	page, err := s.next.QueryUsers(ctx, predicate, offset, limit)
+	tracing.End(span, err)
+	return page, err
+}
+
+func (s tracedService) GetGroupsForUserTx(ctx context.Context, tx *sql.Tx, userId uint64) (*[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetGroupsForUserTx")
+	groups, err := s.next.GetGroupsForUserTx(ctx, tx, userId)
+	tracing.End(span, err)
+	return groups, err
+}
+
+func (s tracedService) GetUsersForGroupTx(ctx context.Context, tx *sql.Tx, groupId uint64) (*[]model.User, error) {
+	ctx, span := tracer.Start(ctx, "membership.Service.GetUsersForGroupTx")
+	users, err := s.next.GetUsersForGroupTx(ctx, tx, groupId)
+	tracing.End(span, err)
+	return users, err
+}
+
+func (s tracedService) InsertTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.InsertTx")
+	err := s.next.InsertTx(ctx, tx, userId, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateTx(ctx context.Context, tx *sql.Tx, userId uint64, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.UpdateTx")
+	err := s.next.UpdateTx(ctx, tx, userId, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateGroupMembership(ctx context.Context, groupName string, userIds *[]string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.UpdateGroupMembership", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.UpdateGroupMembership(ctx, groupName, userIds)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateGroupMembershipTx(ctx context.Context, tx *sql.Tx, groupName string, userIds *[]string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.UpdateGroupMembershipTx", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.UpdateGroupMembershipTx(ctx, tx, groupName, userIds)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) AddGroupMember(ctx context.Context, groupName string, userId string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.AddGroupMember", trace.WithAttributes(attribute.String("group.name", groupName), attribute.String("user.id", userId)))
+	err := s.next.AddGroupMember(ctx, groupName, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) AddGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.AddGroupMemberTx", trace.WithAttributes(attribute.String("group.name", groupName), attribute.String("user.id", userId)))
+	err := s.next.AddGroupMemberTx(ctx, tx, groupName, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) RemoveGroupMember(ctx context.Context, groupName string, userId string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.RemoveGroupMember", trace.WithAttributes(attribute.String("group.name", groupName), attribute.String("user.id", userId)))
+	err := s.next.RemoveGroupMember(ctx, groupName, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) RemoveGroupMemberTx(ctx context.Context, tx *sql.Tx, groupName string, userId string) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.RemoveGroupMemberTx", trace.WithAttributes(attribute.String("group.name", groupName), attribute.String("user.id", userId)))
+	err := s.next.RemoveGroupMemberTx(ctx, tx, groupName, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) RemoveUserTx(ctx context.Context, tx *sql.Tx, userId uint64) error {
+	ctx, span := tracer.Start(ctx, "membership.Service.RemoveUserTx")
+	err := s.next.RemoveUserTx(ctx, tx, userId)
+	tracing.End(span, err)
+	return err
+}
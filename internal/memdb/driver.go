@@ -0,0 +1,268 @@
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Name the driver is registered under with database/sql
+const DriverName = "memdb"
+
+func init() {
+	sql.Register(DriverName, Driver{})
+}
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]*store{}
+)
+
+// Runs the stored procedures of db/docker/init.sql against in-memory tables
+// The dsn names the database, every connection opened with the same dsn shares it
+type Driver struct{}
+
+func (d Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (d Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	s, ok := stores[dsn]
+	if !ok {
+		s = newStore()
+		stores[dsn] = s
+	}
+	return connector{d, s}, nil
+}
+
+// Deletes the database named dsn, the next connection to it starts empty
+func Drop(dsn string) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	delete(stores, dsn)
+}
+
+// Empties the database named dsn, connections already open to it see the empty tables
+func Reset(dsn string) {
+	storesMu.Lock()
+	s, ok := stores[dsn]
+	storesMu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = newState()
+}
+
+type connector struct {
+	driver Driver
+	store  *store
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{store: c.store}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// A connection runs each call on its own, or inside its open transaction
+type conn struct {
+	store  *store
+	tx     *tx
+	closed bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if _, _, err := parseCall(query); err != nil {
+		return nil, err
+	}
+	return stmt{c, query}, nil
+}
+
+func (c *conn) Close() error {
+	if c.tx != nil {
+		c.store.rollback(c.tx)
+	}
+	c.closed = true
+	c.tx = nil
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("memdb: a transaction is already open on this connection")
+	}
+	c.tx = c.store.begin()
+	return txHandle{c}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.call(query, args)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := c.call(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(r.values)), nil
+}
+
+func (c *conn) IsValid() bool {
+	return !c.closed
+}
+
+// Runs a "call proc(?, ...)" query
+func (c *conn) call(query string, args []driver.NamedValue) (*rows, error) {
+	name, params, err := parseCall(query)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, ok := procedures[name]
+	if !ok {
+		return nil, mysqlError(1305, fmt.Sprintf("PROCEDURE membership_service.%s does not exist", name))
+	}
+	if params != len(args) {
+		return nil, fmt.Errorf("memdb: %d placeholders in %q but %d args", params, query, len(args))
+	}
+	if params != proc.params {
+		return nil, mysqlError(1318, fmt.Sprintf("Incorrect number of arguments for PROCEDURE membership_service.%s; expected %d, got %d", name, proc.params, params))
+	}
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	// a call to MySQL waits for a round trip, which lets other transactions run in between
+	runtime.Gosched()
+
+	if c.tx != nil {
+		return c.tx.call(name, proc.run, values)
+	}
+	return c.store.call(name, proc.run, values)
+}
+
+// Gets the procedure name and the number of placeholders of a "call proc(?, ?)" query
+func parseCall(query string) (string, int, error) {
+	q := strings.TrimSpace(query)
+	if len(q) < 5 || !strings.EqualFold(q[:5], "call ") {
+		return "", 0, fmt.Errorf("memdb: only stored procedure calls are supported, got %q", query)
+	}
+
+	q = strings.TrimSpace(q[5:])
+	open := strings.Index(q, "(")
+	if open < 0 || !strings.HasSuffix(q, ")") {
+		return "", 0, fmt.Errorf("memdb: malformed call %q", query)
+	}
+
+	name := strings.ToLower(strings.TrimSpace(q[:open]))
+	return name, strings.Count(q[open:], "?"), nil
+}
+
+type txHandle struct {
+	conn *conn
+}
+
+func (t txHandle) Commit() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	if tx == nil {
+		return errors.New("memdb: no open transaction")
+	}
+	return t.conn.store.commit(tx)
+}
+
+func (t txHandle) Rollback() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	if tx == nil {
+		return errors.New("memdb: no open transaction")
+	}
+	t.conn.store.rollback(tx)
+	return nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s stmt) Close() error {
+	return nil
+}
+
+func (s stmt) NumInput() int {
+	_, params, _ := parseCall(s.query)
+	return params
+}
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, toNamed(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, toNamed(args))
+}
+
+func toNamed(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// The result set of a procedure
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	r.next = len(r.values)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,136 @@
+package memdb
+
+import (
+	"database/sql/driver"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a call waits for a row lock, innodb_lock_wait_timeout is 50s but tests should fail sooner
+const lockWaitTimeout = 5 * time.Second
+
+// Gets the keys of the rows a locking procedure locks, like SELECT ... FOR UPDATE would
+var locking = map[string]func(s *state, args []driver.Value) []string{
+	"lock_groups": func(s *state, args []driver.Value) []string {
+		var keys []string
+		for _, name := range quotedList(str(args[1])) {
+			keys = append(keys, groupKey(str(args[0]), name))
+		}
+		return keys
+	},
+	"chk_group_limits": func(s *state, args []driver.Value) []string {
+		g := s.groups[num(args[1])]
+		return []string{groupKey(g.tenant, g.name)}
+	},
+	"lock_user": func(s *state, args []driver.Value) []string {
+		return []string{userKey(str(args[0]), str(args[1]))}
+	},
+}
+
+// Procedures that read the latest committed rows, with the writes of the transaction, instead of its snapshot
+var currentReads = map[string]bool{
+	"lock_groups":      true,
+	"chk_group_limits": true,
+	"lock_user":        true,
+}
+
+// Gets the keys a call locks on a state, none unless the procedure is locking
+func lockKeys(s *state, name string, args []driver.Value) []string {
+	if keysOf, ok := locking[name]; ok {
+		return keysOf(s, args)
+	}
+	return nil
+}
+
+// The key of the row of a group, names compare case-insensitively
+func groupKey(tenant string, name string) string {
+	return "group:" + strings.ToLower(tenant) + "/" + strings.ToLower(name)
+}
+
+// The key of the row of a user, userids compare case-insensitively
+func userKey(tenant string, userId string) string {
+	return "user:" + strings.ToLower(tenant) + "/" + strings.ToLower(userId)
+}
+
+// Row locks held until the transaction that took them ends, like InnoDB record locks
+type lockTable struct {
+	mu      sync.Mutex
+	holders map[string]*tx
+	waiting map[*tx]string
+	// closed whenever a transaction drops its locks
+	released chan struct{}
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{holders: map[string]*tx{}, waiting: map[*tx]string{}, released: make(chan struct{})}
+}
+
+// Takes the locks in key order, waiting for the transactions holding them to end
+// Fails like InnoDB with 1213 when the wait would never end, and with 1205 after lockWaitTimeout
+func (l *lockTable) acquire(t *tx, keys []string) error {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	timeout := time.NewTimer(lockWaitTimeout)
+	defer timeout.Stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		for {
+			holder, held := l.holders[key]
+			if !held || holder == t {
+				l.holders[key] = t
+				break
+			}
+			if l.waitsFor(holder, t) {
+				return mysqlError(1213, "Deadlock found when trying to get lock; try restarting transaction")
+			}
+
+			l.waiting[t] = key
+			released := l.released
+			l.mu.Unlock()
+			select {
+			case <-released:
+				l.mu.Lock()
+				delete(l.waiting, t)
+			case <-timeout.C:
+				l.mu.Lock()
+				delete(l.waiting, t)
+				return mysqlError(1205, "Lock wait timeout exceeded; try restarting transaction")
+			}
+		}
+	}
+	return nil
+}
+
+// Tells whether holder waits, directly or through other transactions, for a lock t holds
+func (l *lockTable) waitsFor(holder *tx, t *tx) bool {
+	for i := 0; i <= len(l.waiting); i++ {
+		key, waiting := l.waiting[holder]
+		if !waiting {
+			return false
+		}
+		if holder = l.holders[key]; holder == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Drops every lock of the transaction and wakes the calls waiting for one
+func (l *lockTable) release(t *tx) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, holder := range l.holders {
+		if holder == t {
+			delete(l.holders, key)
+		}
+	}
+	delete(l.waiting, t)
+	close(l.released)
+	l.released = make(chan struct{})
+}
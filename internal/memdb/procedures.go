@@ -0,0 +1,921 @@
+package memdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of db/docker/init.sql the procedures below implement
+// It is reported by get_schema_version, so the schema health check fails when it lags behind
+const SchemaVersion = 10
+
+// Runs a stored procedure on a state and returns its result set
+// Procedures check everything before writing so a failed call changes nothing
+type procedure func(s *state, args []driver.Value) (*rows, error)
+
+// Every procedure by name, with the number of parameters it is declared with in init.sql
+var procedures = map[string]struct {
+	params int
+	run    procedure
+}{
+	"get_user":                {2, getUser},
+	"lock_user":               {2, lockUser},
+	"get_users":               {3, getUsers},
+	"count_users":             {1, countUsers},
+	"search_users":            {8, searchUsers},
+	"count_search_users":      {6, countSearchUsers},
+	"get_user_membership":     {2, getUserMembership},
+	"get_users_membership":    {2, getUsersMembership},
+	"get_group":               {2, getGroup},
+	"get_groups":              {1, getGroups},
+	"get_group_membership":    {2, getGroupMembership},
+	"get_groups_membership":   {2, getGroupsMembership},
+	"query_group_users":       {4, queryGroupUsers},
+	"count_query_group_users": {2, countQueryGroupUsers},
+	"ins_user":                {4, insUser},
+	"ins_membership":          {3, insMembership},
+	"del_user":                {2, delUser},
+	"upd_user":                {4, updUser},
+	"upd_membership":          {3, updMembership},
+	"ins_group":               {2, insGroup},
+	"upd_group_membership":    {3, updGroupMembership},
+	"del_group":               {2, delGroup},
+	"ins_group_membership":    {3, insGroupMembership},
+	"del_group_membership":    {3, delGroupMembership},
+	"get_group_policy":        {2, getGroupPolicy},
+	"get_group_owners":        {2, getGroupOwners},
+	"upd_group_policy":        {6, updGroupPolicy},
+	"ins_group_owner":         {3, insGroupOwner},
+	"get_group_exclusions":    {2, getGroupExclusions},
+	"ins_group_exclusion":     {3, insGroupExclusion},
+	"lock_groups":             {2, lockGroups},
+	"chk_group_limits":        {4, chkGroupLimits},
+	"get_schema_version":      {0, getSchemaVersion},
+	"get_counts":              {0, getCounts},
+
+	"ins_membership_request":     {5, insMembershipRequest},
+	"get_membership_request":     {3, getMembershipRequest},
+	"get_membership_requests":    {6, getMembershipRequests},
+	"count_membership_requests":  {4, countMembershipRequests},
+	"upd_membership_request":     {6, updMembershipRequest},
+	"expire_membership_requests": {0, expireMembershipRequests},
+
+	"ins_idempotency_key":          {3, insIdempotencyKey},
+	"get_idempotency_key":          {1, getIdempotencyKey},
+	"upd_idempotency_key":          {5, updIdempotencyKey},
+	"del_idempotency_key":          {1, delIdempotencyKey},
+	"del_expired_idempotency_keys": {0, delExpiredIdempotencyKeys},
+}
+
+// Gets the number of parameters of every procedure by name, to check them against init.sql
+func Procedures() map[string]int {
+	params := make(map[string]int, len(procedures))
+	for name, proc := range procedures {
+		params[name] = proc.params
+	}
+	return params
+}
+
+var (
+	userColumns    = []string{"id", "first_name", "last_name", "user_id"}
+	groupColumns   = []string{"id", "name"}
+	requestColumns = []string{"id", "name", "user_id", "state", "reason", "first_approver", "decided_by", "created_at", "expires_at"}
+
+	errUserNotFound  = mysqlError(3000, "user does not exist")
+	errGroupNotFound = mysqlError(3000, "group does not exist")
+)
+
+func userValues(u userRow) []driver.Value {
+	return []driver.Value{u.id, u.firstName, u.lastName, u.userId}
+}
+
+func groupValues(g groupRow) []driver.Value {
+	return []driver.Value{g.id, g.name}
+}
+
+func (s *state) requestValues(r requestRow, now time.Time) []driver.Value {
+	return []driver.Value{
+		r.id, s.groups[r.groupId].name, s.users[r.userId].userId, r.currentState(now),
+		r.reason, r.firstApprover, r.decidedBy, r.createdAt.Unix(), r.expiresAt.Unix(),
+	}
+}
+
+// The procedures on users, groups and memberships take the tenant as their first argument
+func getUser(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: userColumns}
+	if u, ok := s.userByUserId(str(args[0]), str(args[1])); ok {
+		r.values = append(r.values, userValues(u))
+	}
+	return r, nil
+}
+
+// The lock is taken by the caller, see locking
+func lockUser(s *state, args []driver.Value) (*rows, error) {
+	tenant := str(args[0])
+
+	r := &rows{columns: append(append([]string{}, userColumns...), groupColumns...)}
+	u, ok := s.userByUserId(tenant, str(args[1]))
+	if !ok {
+		return r, nil
+	}
+
+	groups := s.sortedGroups(tenant, func(g groupRow) bool { return s.memberships[membershipRow{g.id, u.id}] })
+	if len(groups) == 0 {
+		r.values = append(r.values, append(userValues(u), nil, nil))
+	}
+	for _, g := range groups {
+		r.values = append(r.values, append(userValues(u), groupValues(g)...))
+	}
+	return r, nil
+}
+
+func getUsers(s *state, args []driver.Value) (*rows, error) {
+	offset, limit := num(args[1]), num(args[2])
+
+	r := &rows{columns: userColumns}
+	for i, u := range s.sortedUsers(str(args[0]), all[userRow]) {
+		if int64(i) >= offset && int64(len(r.values)) < limit {
+			r.values = append(r.values, userValues(u))
+		}
+	}
+	return r, nil
+}
+
+func countUsers(s *state, args []driver.Value) (*rows, error) {
+	count := len(s.sortedUsers(str(args[0]), all[userRow]))
+	return &rows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(count)}}}, nil
+}
+
+func searchUsers(s *state, args []driver.Value) (*rows, error) {
+	offset, limit := num(args[6]), num(args[7])
+
+	users := s.sortedUsers(str(args[0]), userSearch(s, args))
+	sort.SliceStable(users, func(i, j int) bool {
+		return searchRank(users[i], str(args[1])) < searchRank(users[j], str(args[1]))
+	})
+
+	r := &rows{columns: userColumns}
+	for i, u := range users {
+		if int64(i) >= offset && int64(len(r.values)) < limit {
+			r.values = append(r.values, userValues(u))
+		}
+	}
+	return r, nil
+}
+
+func countSearchUsers(s *state, args []driver.Value) (*rows, error) {
+	count := len(s.sortedUsers(str(args[0]), userSearch(s, args)))
+	return &rows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(count)}}}, nil
+}
+
+func queryGroupUsers(s *state, args []driver.Value) (*rows, error) {
+	offset, limit := num(args[2]), num(args[3])
+
+	keep, err := groupPredicate(s, str(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rows{columns: userColumns}
+	for i, u := range s.sortedUsers(str(args[0]), keep) {
+		if int64(i) >= offset && int64(len(r.values)) < limit {
+			r.values = append(r.values, userValues(u))
+		}
+	}
+	return r, nil
+}
+
+func countQueryGroupUsers(s *state, args []driver.Value) (*rows, error) {
+	keep, err := groupPredicate(s, str(args[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(s.sortedUsers(str(args[0]), keep))
+	return &rows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(count)}}}, nil
+}
+
+// Keeps the users whose groups make the predicate of query_group_users true
+func groupPredicate(s *state, predicate string) (func(userRow) bool, error) {
+	eval, rest, ok := parsePredicate(predicate)
+	if !ok || rest != "" {
+		return nil, mysqlError(1644, "invalid group predicate")
+	}
+
+	return func(u userRow) bool {
+		return eval(func(groupId int64) bool { return s.memberships[membershipRow{groupId, u.id}] })
+	}, nil
+}
+
+// Parses a group id, or two operands in parentheses joined by &, | or -, from the start of a predicate
+// Returns the rest of the predicate
+func parsePredicate(p string) (func(in func(groupId int64) bool) bool, string, bool) {
+	if strings.HasPrefix(p, "(") {
+		left, rest, ok := parsePredicate(p[1:])
+		if !ok || rest == "" {
+			return nil, "", false
+		}
+		op := rest[0]
+		right, rest, ok := parsePredicate(rest[1:])
+		if !ok || !strings.HasPrefix(rest, ")") {
+			return nil, "", false
+		}
+
+		eval := func(in func(int64) bool) bool {
+			switch op {
+			case '&':
+				return left(in) && right(in)
+			case '|':
+				return left(in) || right(in)
+			default:
+				return left(in) && !right(in)
+			}
+		}
+		return eval, rest[1:], op == '&' || op == '|' || op == '-'
+	}
+
+	end := 0
+	for end < len(p) && p[end] >= '0' && p[end] <= '9' {
+		end++
+	}
+	id, err := strconv.ParseInt(p[:end], 10, 64)
+	if err != nil {
+		return nil, "", false
+	}
+	return func(in func(int64) bool) bool { return in(id) }, p[end:], true
+}
+
+// Keeps the users matching the q, prefix_only, last_name, group_name and not_in_group arguments of search_users
+func userSearch(s *state, args []driver.Value) func(userRow) bool {
+	tenant := str(args[0])
+	q, prefixOnly := strings.ToLower(str(args[1])), num(args[2]) != 0
+	lastName, groupName, notInGroup := str(args[3]), str(args[4]), str(args[5])
+
+	matches := func(value string) bool {
+		if prefixOnly {
+			return strings.HasPrefix(strings.ToLower(value), q)
+		}
+		return strings.Contains(strings.ToLower(value), q)
+	}
+	inGroup := func(u userRow, name string) bool {
+		g, ok := s.groupByName(tenant, name)
+		return ok && s.memberships[membershipRow{g.id, u.id}]
+	}
+
+	return func(u userRow) bool {
+		return (q == "" || matches(u.userId) || matches(u.firstName) || matches(u.lastName)) &&
+			(lastName == "" || strings.EqualFold(u.lastName, lastName)) &&
+			(groupName == "" || inGroup(u, groupName)) &&
+			(notInGroup == "" || !inGroup(u, notInGroup))
+	}
+}
+
+// Ranks exact matches of q before prefix matches before substring matches
+func searchRank(u userRow, q string) int {
+	fields := []string{u.userId, u.firstName, u.lastName}
+	if q == "" || containsFold(fields, q) {
+		return 0
+	}
+	for _, field := range fields {
+		if strings.HasPrefix(strings.ToLower(field), strings.ToLower(q)) {
+			return 1
+		}
+	}
+	return 2
+}
+
+func getUserMembership(s *state, args []driver.Value) (*rows, error) {
+	userId := num(args[1])
+
+	r := &rows{columns: groupColumns}
+	for _, g := range s.sortedGroups(str(args[0]), func(g groupRow) bool { return s.memberships[membershipRow{g.id, userId}] }) {
+		r.values = append(r.values, groupValues(g))
+	}
+	return r, nil
+}
+
+func getUsersMembership(s *state, args []driver.Value) (*rows, error) {
+	tenant, userIds := str(args[0]), idSet(str(args[1]))
+
+	r := &rows{columns: append([]string{"user_id"}, groupColumns...)}
+	for _, g := range s.sortedGroups(tenant, all[groupRow]) {
+		for _, u := range s.sortedUsers(tenant, all[userRow]) {
+			if userIds[u.id] && s.memberships[membershipRow{g.id, u.id}] {
+				r.values = append(r.values, append([]driver.Value{u.id}, groupValues(g)...))
+			}
+		}
+	}
+	return r, nil
+}
+
+func getGroup(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: groupColumns}
+	if g, ok := s.groupByName(str(args[0]), str(args[1])); ok {
+		r.values = append(r.values, groupValues(g))
+	}
+	return r, nil
+}
+
+func getGroups(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: groupColumns}
+	for _, g := range s.sortedGroups(str(args[0]), all[groupRow]) {
+		r.values = append(r.values, groupValues(g))
+	}
+	return r, nil
+}
+
+func getGroupMembership(s *state, args []driver.Value) (*rows, error) {
+	groupId := num(args[1])
+
+	r := &rows{columns: userColumns}
+	for _, u := range s.sortedUsers(str(args[0]), func(u userRow) bool { return s.memberships[membershipRow{groupId, u.id}] }) {
+		r.values = append(r.values, userValues(u))
+	}
+	return r, nil
+}
+
+func getGroupsMembership(s *state, args []driver.Value) (*rows, error) {
+	tenant, groupIds := str(args[0]), idSet(str(args[1]))
+
+	r := &rows{columns: append([]string{"group_id"}, userColumns...)}
+	for _, u := range s.sortedUsers(tenant, all[userRow]) {
+		for _, g := range s.sortedGroups(tenant, all[groupRow]) {
+			if groupIds[g.id] && s.memberships[membershipRow{g.id, u.id}] {
+				r.values = append(r.values, append([]driver.Value{g.id}, userValues(u)...))
+			}
+		}
+	}
+	return r, nil
+}
+
+func insUser(s *state, args []driver.Value) (*rows, error) {
+	tenant, userId := str(args[0]), str(args[3])
+	if _, ok := s.userByUserId(tenant, userId); ok {
+		return nil, duplicate(tenant+"-"+userId, "user.uniq_user_id")
+	}
+
+	id := s.insertUser(tenant, str(args[1]), str(args[2]), userId)
+	return &rows{columns: []string{"id"}, values: [][]driver.Value{{id}}}, nil
+}
+
+// The group names are a list of quoted strings spliced into an IN clause
+func insMembership(s *state, args []driver.Value) (*rows, error) {
+	tenant, userId := str(args[0]), num(args[1])
+	groups := s.sortedGroups(tenant, inList(quotedList(str(args[2]))))
+
+	for _, g := range groups {
+		if s.memberships[membershipRow{g.id, userId}] {
+			return nil, duplicate(fmt.Sprintf("%d-%d", g.id, userId), "membership.uniq_group_id_user_id")
+		}
+	}
+	// the foreign key includes the tenant, so the user must be in the tenant of the groups
+	if u, ok := s.users[userId]; (!ok || !strings.EqualFold(u.tenant, tenant)) && len(groups) != 0 {
+		return nil, mysqlError(1452, "Cannot add or update a child row: a foreign key constraint fails")
+	}
+
+	for _, g := range groups {
+		s.insertMembership(g.id, userId)
+	}
+	return &rows{}, nil
+}
+
+func delUser(s *state, args []driver.Value) (*rows, error) {
+	u, ok := s.userByUserId(str(args[0]), str(args[1]))
+	if !ok {
+		return nil, errUserNotFound
+	}
+
+	s.deleteMemberships(func(m membershipRow) bool { return m.userId == u.id })
+	s.deletePolicies(func(groupId int64, userId int64) bool { return userId == u.id })
+	delete(s.users, u.id)
+	s.changes++
+	return &rows{}, nil
+}
+
+func updUser(s *state, args []driver.Value) (*rows, error) {
+	u, ok := s.userByUserId(str(args[0]), str(args[3]))
+	if !ok {
+		return nil, errUserNotFound
+	}
+
+	u.firstName, u.lastName = str(args[1]), str(args[2])
+	s.users[u.id] = u
+	s.changes++
+	return &rows{columns: []string{"id"}, values: [][]driver.Value{{u.id}}}, nil
+}
+
+func updMembership(s *state, args []driver.Value) (*rows, error) {
+	tenant, userId := str(args[0]), num(args[1])
+	if u, ok := s.users[userId]; !ok || !strings.EqualFold(u.tenant, tenant) {
+		return nil, errUserNotFound
+	}
+
+	s.deleteMemberships(func(m membershipRow) bool { return m.userId == userId })
+	for _, g := range s.sortedGroups(tenant, inList(quotedList(str(args[2])))) {
+		s.insertMembership(g.id, userId)
+	}
+	return &rows{}, nil
+}
+
+func insGroup(s *state, args []driver.Value) (*rows, error) {
+	tenant, name := str(args[0]), str(args[1])
+	if _, ok := s.groupByName(tenant, name); ok {
+		return nil, duplicate(tenant+"-"+name, "group.uniq_name")
+	}
+
+	s.insertGroup(tenant, name)
+	return &rows{}, nil
+}
+
+// The userids are a list of quoted strings spliced into an IN clause
+func updGroupMembership(s *state, args []driver.Value) (*rows, error) {
+	tenant := str(args[0])
+	g, ok := s.groupByName(tenant, str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+
+	userIds := quotedList(str(args[2]))
+	s.deleteMemberships(func(m membershipRow) bool { return m.groupId == g.id })
+	for _, u := range s.sortedUsers(tenant, func(u userRow) bool { return containsFold(userIds, u.userId) }) {
+		s.insertMembership(g.id, u.id)
+	}
+	return &rows{}, nil
+}
+
+func delGroup(s *state, args []driver.Value) (*rows, error) {
+	g, ok := s.groupByName(str(args[0]), str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+
+	s.deleteMemberships(func(m membershipRow) bool { return m.groupId == g.id })
+	s.deletePolicies(func(groupId int64, userId int64) bool { return groupId == g.id })
+	delete(s.groups, g.id)
+	s.changes++
+	return &rows{}, nil
+}
+
+func insGroupMembership(s *state, args []driver.Value) (*rows, error) {
+	g, ok := s.groupByName(str(args[0]), str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+	u, ok := s.userByUserId(str(args[0]), str(args[2]))
+	if !ok {
+		return nil, errUserNotFound
+	}
+
+	// INSERT IGNORE
+	if !s.memberships[membershipRow{g.id, u.id}] {
+		s.insertMembership(g.id, u.id)
+	}
+	return &rows{}, nil
+}
+
+func delGroupMembership(s *state, args []driver.Value) (*rows, error) {
+	g, groupFound := s.groupByName(str(args[0]), str(args[1]))
+	u, userFound := s.userByUserId(str(args[0]), str(args[2]))
+	if groupFound && userFound {
+		s.deleteMemberships(func(m membershipRow) bool { return m == membershipRow{g.id, u.id} })
+	}
+	return &rows{}, nil
+}
+
+func getGroupPolicy(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: []string{"id", "approval", "max_members", "min_members", "userid_pattern"}}
+	if g, ok := s.groupByName(str(args[0]), str(args[1])); ok {
+		p, found := s.policies[g.id]
+		if !found {
+			p.approval = "owner"
+		}
+		r.values = append(r.values, []driver.Value{g.id, p.approval, nullable(p.maxMembers), nullable(p.minMembers), p.useridPattern})
+	}
+	return r, nil
+}
+
+func getGroupOwners(s *state, args []driver.Value) (*rows, error) {
+	groupId := num(args[1])
+
+	r := &rows{columns: []string{"user_id"}}
+	for _, u := range s.sortedUsers(str(args[0]), func(u userRow) bool { return s.owners[membershipRow{groupId, u.id}] }) {
+		r.values = append(r.values, []driver.Value{u.userId})
+	}
+	return r, nil
+}
+
+func updGroupPolicy(s *state, args []driver.Value) (*rows, error) {
+	g, ok := s.groupByName(str(args[0]), str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+
+	for o := range s.owners {
+		if o.groupId == g.id {
+			delete(s.owners, o)
+		}
+	}
+	for e := range s.exclusions {
+		if e.groupId == g.id {
+			delete(s.exclusions, e)
+		}
+	}
+	s.policies[g.id] = policyRow{str(args[2]), nullableNum(args[3]), nullableNum(args[4]), str(args[5])}
+	s.changes++
+	return &rows{}, nil
+}
+
+func insGroupOwner(s *state, args []driver.Value) (*rows, error) {
+	g, ok := s.groupByName(str(args[0]), str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+	u, ok := s.userByUserId(str(args[0]), str(args[2]))
+	if !ok {
+		return nil, errUserNotFound
+	}
+
+	// INSERT IGNORE
+	if !s.owners[membershipRow{g.id, u.id}] {
+		s.owners[membershipRow{g.id, u.id}] = true
+		s.changes++
+	}
+	return &rows{}, nil
+}
+
+func getGroupExclusions(s *state, args []driver.Value) (*rows, error) {
+	groupId := num(args[1])
+
+	r := &rows{columns: []string{"name"}}
+	for _, g := range s.sortedGroups(str(args[0]), func(g groupRow) bool { return s.exclusions[exclusionRow{groupId, g.id}] }) {
+		r.values = append(r.values, []driver.Value{g.name})
+	}
+	return r, nil
+}
+
+func insGroupExclusion(s *state, args []driver.Value) (*rows, error) {
+	g, groupFound := s.groupByName(str(args[0]), str(args[1]))
+	excluded, excludedFound := s.groupByName(str(args[0]), str(args[2]))
+	if !groupFound || !excludedFound {
+		return nil, errGroupNotFound
+	}
+
+	// INSERT IGNORE
+	if !s.exclusions[exclusionRow{g.id, excluded.id}] {
+		s.exclusions[exclusionRow{g.id, excluded.id}] = true
+		s.changes++
+	}
+	return &rows{}, nil
+}
+
+// The locks are taken by the caller, see locking
+func lockGroups(s *state, args []driver.Value) (*rows, error) {
+	tenant := str(args[0])
+
+	r := &rows{columns: []string{"id", "user_id"}}
+	groups := s.sortedGroups(tenant, inList(quotedList(str(args[1]))))
+	sort.Slice(groups, func(i, j int) bool { return groups[i].id < groups[j].id })
+	for _, g := range groups {
+		users := s.sortedUsers(tenant, func(u userRow) bool { return s.memberships[membershipRow{g.id, u.id}] })
+		sort.Slice(users, func(i, j int) bool { return users[i].id < users[j].id })
+		if len(users) == 0 {
+			r.values = append(r.values, []driver.Value{g.id, nil})
+		}
+		for _, u := range users {
+			r.values = append(r.values, []driver.Value{g.id, u.id})
+		}
+	}
+	return r, nil
+}
+
+// Signals 3001 with the first rule of the policy or an exclusion the members of the group break
+// The member limits only apply in the direction of delta, and the pattern and exclusions to the added users, like chk_group_limits
+func chkGroupLimits(s *state, args []driver.Value) (*rows, error) {
+	tenant, groupId, delta := str(args[0]), num(args[1]), num(args[2])
+	g := s.groups[groupId]
+	p := s.policies[groupId]
+	members := s.memberCount(groupId)
+
+	if delta > 0 && p.maxMembers != nil && members > *p.maxMembers {
+		return nil, policyViolation("group %s is full (max_members is %d)", g.name, *p.maxMembers)
+	}
+	if delta < 0 && p.minMembers != nil && members < *p.minMembers {
+		return nil, policyViolation("group %s can not lose members (min_members is %d)", g.name, *p.minMembers)
+	}
+
+	// a NULL list checks every member
+	added := idSet(str(args[3]))
+	users := s.sortedUsers(tenant, func(u userRow) bool {
+		return s.memberships[membershipRow{groupId, u.id}] && (args[3] == nil || added[u.id])
+	})
+	if p.useridPattern != "" {
+		// REGEXP compares case-insensitively under the default collation
+		pattern, err := regexp.Compile("(?i)" + p.useridPattern)
+		if err != nil {
+			return nil, mysqlError(3685, "Illegal argument to a regular expression.")
+		}
+		for _, u := range users {
+			if !pattern.MatchString(u.userId) {
+				return nil, policyViolation("userid %s does not match the userid_pattern of group %s", u.userId, g.name)
+			}
+		}
+	}
+
+	for _, u := range users {
+		for _, other := range s.sortedGroups(tenant, func(o groupRow) bool { return s.memberships[membershipRow{o.id, u.id}] }) {
+			if s.exclusions[exclusionRow{groupId, other.id}] || s.exclusions[exclusionRow{other.id, groupId}] {
+				return nil, policyViolation("user %s can not be in both %s and %s (exclusive_with)", u.userId, g.name, other.name)
+			}
+		}
+	}
+	return &rows{}, nil
+}
+
+func getSchemaVersion(s *state, args []driver.Value) (*rows, error) {
+	return &rows{columns: []string{"MAX(version)"}, values: [][]driver.Value{{int64(SchemaVersion)}}}, nil
+}
+
+func getCounts(s *state, args []driver.Value) (*rows, error) {
+	return &rows{
+		columns: []string{"users", "groups", "memberships"},
+		values:  [][]driver.Value{{int64(len(s.users)), int64(len(s.groups)), int64(len(s.memberships))}},
+	}, nil
+}
+
+func insMembershipRequest(s *state, args []driver.Value) (*rows, error) {
+	tenant, now := str(args[0]), time.Now()
+	g, ok := s.groupByName(tenant, str(args[1]))
+	if !ok {
+		return nil, errGroupNotFound
+	}
+	u, ok := s.userByUserId(tenant, str(args[2]))
+	if !ok {
+		return nil, errUserNotFound
+	}
+	if s.memberships[membershipRow{g.id, u.id}] {
+		return nil, mysqlError(1062, "Duplicate entry for key 'membership.uniq_group_id_user_id'")
+	}
+
+	for id, r := range s.requests {
+		if r.groupId == g.id && r.userId == u.id && r.state == "pending" {
+			if r.expiresAt.After(now) {
+				return nil, duplicate(fmt.Sprintf("%d-%d", g.id, u.id), "membership_request.uniq_pending_request")
+			}
+			r.state = "expired"
+			s.requests[id] = r
+		}
+	}
+
+	id := s.nextId(&s.ids.request)
+	s.requests[id] = requestRow{
+		id: id, tenant: tenant, groupId: g.id, userId: u.id, state: "pending", reason: str(args[3]),
+		createdAt: now, expiresAt: now.Add(time.Duration(num(args[4])) * time.Second),
+	}
+	s.changes++
+	return &rows{columns: []string{"LAST_INSERT_ID()"}, values: [][]driver.Value{{id}}}, nil
+}
+
+func getMembershipRequest(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: requestColumns}
+	req, ok := s.requests[num(args[2])]
+	if g, found := s.groupByName(str(args[0]), str(args[1])); ok && found && req.groupId == g.id {
+		r.values = append(r.values, s.requestValues(req, time.Now()))
+	}
+	return r, nil
+}
+
+func getMembershipRequests(s *state, args []driver.Value) (*rows, error) {
+	offset, limit := num(args[4]), num(args[5])
+	now := time.Now()
+
+	r := &rows{columns: requestColumns}
+	for i, req := range s.membershipRequests(args, now) {
+		if int64(i) >= offset && int64(len(r.values)) < limit {
+			r.values = append(r.values, s.requestValues(req, now))
+		}
+	}
+	return r, nil
+}
+
+func countMembershipRequests(s *state, args []driver.Value) (*rows, error) {
+	count := len(s.membershipRequests(args, time.Now()))
+	return &rows{columns: []string{"COUNT(*)"}, values: [][]driver.Value{{int64(count)}}}, nil
+}
+
+// Gets the requests matching the group_name, state and user_id arguments of get_membership_requests ordered by id
+func (s *state) membershipRequests(args []driver.Value, now time.Time) []requestRow {
+	requests := []requestRow{}
+	g, ok := s.groupByName(str(args[0]), str(args[1]))
+	if !ok {
+		return requests
+	}
+
+	state, userId := str(args[2]), str(args[3])
+	for _, r := range s.requests {
+		if r.groupId == g.id &&
+			(state == "" || strings.EqualFold(r.currentState(now), state)) &&
+			(userId == "" || strings.EqualFold(s.users[r.userId].userId, userId)) {
+			requests = append(requests, r)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].id < requests[j].id })
+	return requests
+}
+
+func updMembershipRequest(s *state, args []driver.Value) (*rows, error) {
+	var changed int64
+	r, ok := s.requests[num(args[1])]
+	if ok && strings.EqualFold(r.tenant, str(args[0])) && r.currentState(time.Now()) == "pending" && strings.EqualFold(r.firstApprover, str(args[2])) {
+		r.state, r.firstApprover, r.decidedBy = str(args[3]), str(args[4]), str(args[5])
+		s.requests[r.id] = r
+		s.changes++
+		changed = 1
+	}
+	return &rows{columns: []string{"ROW_COUNT()"}, values: [][]driver.Value{{changed}}}, nil
+}
+
+func expireMembershipRequests(s *state, args []driver.Value) (*rows, error) {
+	var expired int64
+	now := time.Now()
+	for id, r := range s.requests {
+		if r.state == "pending" && r.currentState(now) == "expired" {
+			r.state = "expired"
+			s.requests[id] = r
+			expired++
+		}
+	}
+	s.changes += int(expired)
+	return &rows{columns: []string{"ROW_COUNT()"}, values: [][]driver.Value{{expired}}}, nil
+}
+
+func insIdempotencyKey(s *state, args []driver.Value) (*rows, error) {
+	id, now := str(args[0]), time.Now()
+	if k, ok := s.idempotencyKeys[id]; ok && k.expiresAt.After(now) {
+		return nil, duplicate(id, "idempotency_key.PRIMARY")
+	}
+
+	s.idempotencyKeys[id] = idempotencyRow{requestHash: str(args[1]), expiresAt: now.Add(time.Duration(num(args[2])) * time.Second)}
+	s.changes++
+	return &rows{}, nil
+}
+
+func getIdempotencyKey(s *state, args []driver.Value) (*rows, error) {
+	r := &rows{columns: []string{"request_hash", "status", "content_type", "body"}}
+	if k, ok := s.idempotencyKeys[str(args[0])]; ok && k.expiresAt.After(time.Now()) {
+		r.values = append(r.values, []driver.Value{k.requestHash, k.status, k.contentType, k.body})
+	}
+	return r, nil
+}
+
+func updIdempotencyKey(s *state, args []driver.Value) (*rows, error) {
+	id := str(args[0])
+	if k, ok := s.idempotencyKeys[id]; ok {
+		k.status, k.contentType, k.body = args[1], args[2], args[3]
+		k.expiresAt = time.Now().Add(time.Duration(num(args[4])) * time.Second)
+		if b, isBytes := k.body.([]byte); isBytes {
+			k.body = append([]byte{}, b...)
+		}
+		s.idempotencyKeys[id] = k
+		s.changes++
+	}
+	return &rows{}, nil
+}
+
+func delIdempotencyKey(s *state, args []driver.Value) (*rows, error) {
+	id := str(args[0])
+	if _, ok := s.idempotencyKeys[id]; ok {
+		delete(s.idempotencyKeys, id)
+		s.changes++
+	}
+	return &rows{}, nil
+}
+
+func delExpiredIdempotencyKeys(s *state, args []driver.Value) (*rows, error) {
+	var deleted int64
+	now := time.Now()
+	for id, k := range s.idempotencyKeys {
+		if !k.expiresAt.After(now) {
+			delete(s.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	s.changes += int(deleted)
+	return &rows{columns: []string{"ROW_COUNT()"}, values: [][]driver.Value{{deleted}}}, nil
+}
+
+func policyViolation(format string, args ...interface{}) error {
+	return mysqlError(3001, fmt.Sprintf(format, args...))
+}
+
+func duplicate(value string, key string) error {
+	return mysqlError(1062, fmt.Sprintf("Duplicate entry '%s' for key '%s'", value, key))
+}
+
+func all[T any](T) bool {
+	return true
+}
+
+// Keeps the groups whose name is in names
+func inList(names []string) func(groupRow) bool {
+	return func(g groupRow) bool {
+		return containsFold(names, g.name)
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses the comma separated ids given to FIND_IN_SET
+func idSet(list string) map[int64]bool {
+	ids := map[int64]bool{}
+	for _, item := range strings.Split(list, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64); err == nil {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// Parses a list like "a","b" built by the repositories for the IN clauses
+func quotedList(list string) []string {
+	var items []string
+	for rest := strings.TrimSpace(list); rest != ""; {
+		quote := rest[0]
+		if quote != '"' && quote != '\'' {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			items = append(items, strings.TrimSpace(rest[:end]))
+			rest = strings.TrimSpace(strings.TrimPrefix(rest[end:], ","))
+			continue
+		}
+
+		end := strings.IndexByte(rest[1:], quote)
+		if end < 0 {
+			items = append(items, rest[1:])
+			break
+		}
+		items = append(items, rest[1:end+1])
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest[end+2:]), ","))
+	}
+	return items
+}
+
+// Converts a string or []byte argument
+func str(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Converts a nullable integer argument, nil stays nil
+func nullableNum(v driver.Value) *int64 {
+	if v == nil {
+		return nil
+	}
+	n := num(v)
+	return &n
+}
+
+// Converts a nullable integer column value
+func nullable(n *int64) driver.Value {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+// Converts an integer argument, strings are parsed like MySQL casts them
+func num(v driver.Value) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimSpace(str(v)), 10, 64)
+	return n
+}
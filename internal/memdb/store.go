@@ -0,0 +1,417 @@
+package memdb
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The committed state of a database, with the isolation of InnoDB under REPEATABLE READ
+// A transaction reads a snapshot taken when it began, like a consistent read, and logs the calls that wrote.
+// On commit the logged calls run again on the latest committed state, like DML reads the latest rows, so
+// transactions writing different rows both commit. A write that fails there fails the commit, and one that
+// no longer returns what it returned on the snapshot fails it like a deadlock, which InnoDB would have
+// avoided by blocking on the row lock. The procedures in locking hold row locks until the transaction ends,
+// and those in currentReads read the latest committed state, like a locking read
+type store struct {
+	mu    sync.Mutex
+	state *state
+	locks *lockTable
+}
+
+// A write that ran in a transaction, with the ids it took and the result it returned on the snapshot
+type loggedCall struct {
+	proc   procedure
+	args   []driver.Value
+	ids    []int64
+	result *rows
+}
+
+type tx struct {
+	store *store
+	state *state
+	log   []loggedCall
+}
+
+func newStore() *store {
+	return &store{state: newState(), locks: newLockTable()}
+}
+
+// Runs a procedure on the committed state, a locking one waits for its locks and drops them when it returns
+func (s *store) call(name string, proc procedure, args []driver.Value) (*rows, error) {
+	s.mu.Lock()
+	keys := lockKeys(s.state, name, args)
+	s.mu.Unlock()
+
+	if len(keys) != 0 {
+		owner := &tx{}
+		defer s.locks.release(owner)
+		if err := s.locks.acquire(owner, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return proc(s.state, args)
+}
+
+func (s *store) begin() *tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &tx{store: s, state: s.state.clone()}
+}
+
+// Replays the writes of the transaction on the committed state and drops its locks
+func (s *store) commit(t *tx) error {
+	defer s.locks.release(t)
+	if len(t.log) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := t.replay(s.state)
+	if err != nil {
+		return err
+	}
+	s.state = next
+	return nil
+}
+
+// Drops the writes and the locks of the transaction
+func (s *store) rollback(t *tx) {
+	s.locks.release(t)
+}
+
+// Runs a procedure in the transaction, a write on its snapshot and a current read on the latest committed state
+func (t *tx) call(name string, proc procedure, args []driver.Value) (*rows, error) {
+	if keys := lockKeys(t.state, name, args); len(keys) != 0 {
+		if err := t.store.locks.acquire(t, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if currentReads[name] {
+		t.store.mu.Lock()
+		current, err := t.replay(t.store.state)
+		t.store.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return proc(current, args)
+	}
+
+	changes := t.state.changes
+	t.state.takenIds = nil
+	r, err := proc(t.state, args)
+	if err == nil && t.state.changes != changes {
+		t.log = append(t.log, loggedCall{proc, args, t.state.takenIds, r})
+	}
+	return r, err
+}
+
+// Runs the logged writes again on a copy of committed, reusing the ids they took the first time
+func (t *tx) replay(committed *state) (*state, error) {
+	next := committed.clone()
+	for _, c := range t.log {
+		next.replayIds = c.ids
+		r, err := c.proc(next, c.args)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(r.values, c.result.values) {
+			return nil, mysqlError(1213, "Deadlock found when trying to get lock; try restarting transaction")
+		}
+	}
+	next.replayIds = nil
+	return next, nil
+}
+
+type userRow struct {
+	id        int64
+	tenant    string
+	firstName string
+	lastName  string
+	userId    string
+}
+
+type groupRow struct {
+	id     int64
+	tenant string
+	name   string
+}
+
+type membershipRow struct {
+	groupId int64
+	userId  int64
+}
+
+// A row of group_policy, the member limits are nil and the pattern empty when not set
+type policyRow struct {
+	approval      string
+	maxMembers    *int64
+	minMembers    *int64
+	useridPattern string
+}
+
+// A row of group_exclusion, a user can not be in both groups
+type exclusionRow struct {
+	groupId         int64
+	excludedGroupId int64
+}
+
+// A row of membership_request, the pending_key unique index is a pending request of the same group and user
+type requestRow struct {
+	id            int64
+	tenant        string
+	groupId       int64
+	userId        int64
+	state         string
+	reason        string
+	firstApprover string
+	decidedBy     string
+	createdAt     time.Time
+	expiresAt     time.Time
+}
+
+// Gets the state of the request, a pending request past its expiry is expired
+func (r requestRow) currentState(now time.Time) string {
+	if r.state == "pending" && !r.expiresAt.After(now) {
+		return "expired"
+	}
+	return r.state
+}
+
+// status, contentType and body are nil until the response is stored
+type idempotencyRow struct {
+	requestHash string
+	status      driver.Value
+	contentType driver.Value
+	body        driver.Value
+	expiresAt   time.Time
+}
+
+// The user, group, membership, group_policy, group_owner, group_exclusion, membership_request and idempotency_key tables
+// Keys compare case-insensitively, like the default MySQL collation, and userids and names are unique per tenant
+type state struct {
+	users           map[int64]userRow
+	groups          map[int64]groupRow
+	memberships     map[membershipRow]bool
+	policies        map[int64]policyRow
+	owners          map[membershipRow]bool
+	exclusions      map[exclusionRow]bool
+	requests        map[int64]requestRow
+	idempotencyKeys map[string]idempotencyRow
+
+	// shared by every copy, ids are never handed out twice even when a transaction rolls back
+	ids *autoIncrement
+	// ids a replayed call takes again, and the ids the last call took
+	replayIds []int64
+	takenIds  []int64
+
+	// number of writes, to know whether a call changed anything
+	changes int
+}
+
+// The AUTO_INCREMENT counters of the user, group and membership_request tables
+type autoIncrement struct {
+	user    atomic.Int64
+	group   atomic.Int64
+	request atomic.Int64
+}
+
+func newState() *state {
+	return &state{
+		users:           map[int64]userRow{},
+		groups:          map[int64]groupRow{},
+		memberships:     map[membershipRow]bool{},
+		policies:        map[int64]policyRow{},
+		owners:          map[membershipRow]bool{},
+		exclusions:      map[exclusionRow]bool{},
+		requests:        map[int64]requestRow{},
+		idempotencyKeys: map[string]idempotencyRow{},
+		ids:             &autoIncrement{},
+	}
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		users:           make(map[int64]userRow, len(s.users)),
+		groups:          make(map[int64]groupRow, len(s.groups)),
+		memberships:     make(map[membershipRow]bool, len(s.memberships)),
+		policies:        make(map[int64]policyRow, len(s.policies)),
+		owners:          make(map[membershipRow]bool, len(s.owners)),
+		exclusions:      make(map[exclusionRow]bool, len(s.exclusions)),
+		requests:        make(map[int64]requestRow, len(s.requests)),
+		idempotencyKeys: make(map[string]idempotencyRow, len(s.idempotencyKeys)),
+		ids:             s.ids,
+	}
+	for id, u := range s.users {
+		c.users[id] = u
+	}
+	for id, g := range s.groups {
+		c.groups[id] = g
+	}
+	for m := range s.memberships {
+		c.memberships[m] = true
+	}
+	for id, p := range s.policies {
+		c.policies[id] = p
+	}
+	for o := range s.owners {
+		c.owners[o] = true
+	}
+	for e := range s.exclusions {
+		c.exclusions[e] = true
+	}
+	for id, r := range s.requests {
+		c.requests[id] = r
+	}
+	for id, k := range s.idempotencyKeys {
+		c.idempotencyKeys[id] = k
+	}
+	return c
+}
+
+// Finds a user of a tenant by userid
+func (s *state) userByUserId(tenant string, userId string) (userRow, bool) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.tenant, tenant) && strings.EqualFold(u.userId, userId) {
+			return u, true
+		}
+	}
+	return userRow{}, false
+}
+
+// Finds a group of a tenant by name
+func (s *state) groupByName(tenant string, name string) (groupRow, bool) {
+	for _, g := range s.groups {
+		if strings.EqualFold(g.tenant, tenant) && strings.EqualFold(g.name, name) {
+			return g, true
+		}
+	}
+	return groupRow{}, false
+}
+
+// Gets the users of a tenant matching keep ordered by userid
+func (s *state) sortedUsers(tenant string, keep func(userRow) bool) []userRow {
+	users := []userRow{}
+	for _, u := range s.users {
+		if strings.EqualFold(u.tenant, tenant) && keep(u) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].userId) < strings.ToLower(users[j].userId)
+	})
+	return users
+}
+
+// Gets the groups of a tenant matching keep ordered by name
+func (s *state) sortedGroups(tenant string, keep func(groupRow) bool) []groupRow {
+	groups := []groupRow{}
+	for _, g := range s.groups {
+		if strings.EqualFold(g.tenant, tenant) && keep(g) {
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].name) < strings.ToLower(groups[j].name)
+	})
+	return groups
+}
+
+// Takes the next id of a table, or the id a replayed call took the first time
+func (s *state) nextId(counter *atomic.Int64) int64 {
+	if len(s.replayIds) != 0 {
+		id := s.replayIds[0]
+		s.replayIds = s.replayIds[1:]
+		return id
+	}
+
+	id := counter.Add(1)
+	s.takenIds = append(s.takenIds, id)
+	return id
+}
+
+func (s *state) insertUser(tenant string, firstName string, lastName string, userId string) int64 {
+	id := s.nextId(&s.ids.user)
+	s.users[id] = userRow{id, tenant, firstName, lastName, userId}
+	s.changes++
+	return id
+}
+
+func (s *state) insertGroup(tenant string, name string) int64 {
+	id := s.nextId(&s.ids.group)
+	s.groups[id] = groupRow{id, tenant, name}
+	s.changes++
+	return id
+}
+
+func (s *state) insertMembership(groupId int64, userId int64) {
+	s.memberships[membershipRow{groupId, userId}] = true
+	s.changes++
+}
+
+// Counts the members of a group
+func (s *state) memberCount(groupId int64) int64 {
+	var members int64
+	for m := range s.memberships {
+		if m.groupId == groupId {
+			members++
+		}
+	}
+	return members
+}
+
+// Deletes the memberships matching remove
+func (s *state) deleteMemberships(remove func(membershipRow) bool) {
+	for m := range s.memberships {
+		if remove(m) {
+			delete(s.memberships, m)
+			s.changes++
+		}
+	}
+}
+
+// Deletes the owners, requests, policy and exclusion rows of a user or a group before it is deleted
+func (s *state) deletePolicies(remove func(groupId int64, userId int64) bool) {
+	for o := range s.owners {
+		if remove(o.groupId, o.userId) {
+			delete(s.owners, o)
+			s.changes++
+		}
+	}
+	for id, r := range s.requests {
+		if remove(r.groupId, r.userId) {
+			delete(s.requests, id)
+			s.changes++
+		}
+	}
+	for id := range s.policies {
+		if remove(id, 0) {
+			delete(s.policies, id)
+			s.changes++
+		}
+	}
+	for e := range s.exclusions {
+		if remove(e.groupId, 0) || remove(e.excludedGroupId, 0) {
+			delete(s.exclusions, e)
+			s.changes++
+		}
+	}
+}
+
+func mysqlError(number uint16, message string) error {
+	return &mysql.MySQLError{Number: number, Message: message}
+}
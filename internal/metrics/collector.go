@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Longest a scrape waits for the domain counts
+const countsTimeout = 2 * time.Second
+
+var (
+	usersDesc       = prometheus.NewDesc(namespace+"_users", "Number of users.", nil, nil)
+	groupsDesc      = prometheus.NewDesc(namespace+"_groups", "Number of groups.", nil, nil)
+	membershipsDesc = prometheus.NewDesc(namespace+"_memberships", "Number of group memberships.", nil, nil)
+)
+
+// Collects the domain gauges with one query per scrape
+type domainCollector struct {
+	repo repository
+}
+
+func (c domainCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- groupsDesc
+	ch <- membershipsDesc
+}
+
+// Reports nothing when the DB is unavailable, so the gauges go stale instead of dropping to 0
+func (c domainCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countsTimeout)
+	defer cancel()
+
+	counts, err := c.repo.getCounts(ctx)
+	if err != nil {
+		slog.Error("could not count rows for metrics", slog.Any("error", err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(counts.users))
+	ch <- prometheus.MustNewConstMetric(groupsDesc, prometheus.GaugeValue, float64(counts.groups))
+	ch <- prometheus.MustNewConstMetric(membershipsDesc, prometheus.GaugeValue, float64(counts.memberships))
+}
+
+var (
+	dbMu         sync.Mutex
+	dbCollectors []prometheus.Collector
+)
+
+// Registers the pool stats of the DB and the domain gauges
+// The collectors of a DB registered before are replaced, so an App can be initialized again in tests
+func RegisterDb(db *sql.DB) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	for _, c := range dbCollectors {
+		Registry.Unregister(c)
+	}
+	dbCollectors = nil
+
+	for _, c := range []prometheus.Collector{collectors.NewDBStatsCollector(db, namespace), domainCollector{repository{db}}} {
+		if err := Registry.Register(c); err != nil {
+			return err
+		}
+		dbCollectors = append(dbCollectors, c)
+	}
+	return nil
+}
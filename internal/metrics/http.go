@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+)
+
+// Records the count and latency of requests by method, route template and status code
+func InstrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := mw.NewResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		route := mw.RouteTemplate(r)
+		code := strconv.Itoa(recorder.Status)
+		httpRequests.WithLabelValues(r.Method, route, code).Inc()
+		httpDuration.WithLabelValues(r.Method, route, code).Observe(time.Since(start).Seconds())
+	})
+}
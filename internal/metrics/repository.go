@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Number of rows in each table
+type counts struct {
+	users       uint64
+	groups      uint64
+	memberships uint64
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+// Calls get_counts and returns the number of users, groups and memberships
+func (r repository) getCounts(ctx context.Context) (counts, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_counts()")
+	if err != nil {
+		return counts{}, err
+	}
+	defer rows.Close()
+
+	var c counts
+	for rows.Next() {
+		if err := rows.Scan(&c.users, &c.groups, &c.memberships); err != nil {
+			return counts{}, err
+		}
+	}
+
+	return c, rows.Err()
+}
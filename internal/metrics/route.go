@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct{}
+
+// Creates a new instance of the metrics router
+func NewRouter() Router {
+	return router{}
+}
+
+// Registers GET /metrics in the prometheus text format
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+}
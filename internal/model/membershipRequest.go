@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// States of a membership request, only a pending request can be approved or rejected
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+	RequestExpired  = "expired"
+)
+
+// How the requests to join a group are approved
+const (
+	// every request is approved as soon as it is made
+	ApprovalAuto = "auto"
+	// one owner of the group approves
+	ApprovalOwner = "owner"
+	// two different owners of the group approve
+	ApprovalTwoApprovers = "two_approvers"
+)
+
+// Used to store a row of the group_policy table, the owners of the group and the groups it excludes
+// GroupId is 0 when the group does not exist, the member limits are nil when not set
+type GroupPolicy struct {
+	GroupId       uint64
+	Approval      string
+	Owners        []string
+	MaxMembers    *uint64
+	MinMembers    *uint64
+	UserIdPattern string
+	ExclusiveWith []string
+}
+
+// Used to store a row of data from the membership_request table
+// FirstApprover and DecidedBy are empty until an owner approves or rejects
+type MembershipRequest struct {
+	Id            uint64
+	GroupName     string
+	UserId        string
+	State         string
+	Reason        string
+	FirstApprover string
+	DecidedBy     string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+// Used to filter the requests to join a group, empty fields match every request
+type MembershipRequestFilter struct {
+	State  string
+	UserId string
+}
+
+// One page of membership requests, Total is the number of requests matching the filter
+type MembershipRequestPage struct {
+	Requests []MembershipRequest
+	Total    uint64
+}
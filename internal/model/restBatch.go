@@ -0,0 +1,130 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Most operations a single batch can run
+const MaxBatchOperations = 100
+
+// Ops and resources of a batch operation
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+
+	BatchUser       = "user"
+	BatchGroup      = "group"
+	BatchMembership = "membership"
+)
+
+// Used to run several operations in one transaction as the body of POST /batch
+type RestBatch struct {
+	Operations []RestOperation `json:"operations"`
+}
+
+// A single operation of a batch, the fields it needs depend on the resource:
+// user takes user on create and update and userid on delete,
+// group takes group, and userids to replace its members on update,
+// membership takes group and userid on create and delete
+type RestOperation struct {
+	Op       string    `json:"op"`
+	Resource string    `json:"resource"`
+	User     *RestUser `json:"user,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	UserId   string    `json:"userid,omitempty"`
+	UserIds  *[]string `json:"userids,omitempty"`
+}
+
+// Validates every operation has the fields its op and resource need
+// Returns a bad request status code otherwise
+func (b RestBatch) Validate() (error, int) {
+	if len(b.Operations) == 0 {
+		return NewValidationError("operations", "must not be empty"), http.StatusBadRequest
+	}
+	if len(b.Operations) > MaxBatchOperations {
+		return NewValidationError("operations", fmt.Sprintf("must have at most %d operations", MaxBatchOperations)), http.StatusBadRequest
+	}
+
+	var fields []RestFieldError
+	for i, op := range b.Operations {
+		fields = append(fields, op.validate(fmt.Sprintf("operations[%d]", i))...)
+	}
+
+	if len(fields) != 0 {
+		return &ValidationError{fields}, http.StatusBadRequest
+	}
+	return nil, 0
+}
+
+func (o RestOperation) validate(prefix string) []RestFieldError {
+	required := func(name string, value string) []RestFieldError {
+		if value == "" {
+			return []RestFieldError{{Field: prefix + "." + name, Message: "must be populated"}}
+		}
+		return nil
+	}
+
+	switch o.Op {
+	case BatchCreate, BatchUpdate, BatchDelete:
+	default:
+		return []RestFieldError{{Field: prefix + ".op", Message: fmt.Sprintf("must be one of %s, %s or %s", BatchCreate, BatchUpdate, BatchDelete)}}
+	}
+
+	switch o.Resource {
+	case BatchUser:
+		if o.Op == BatchDelete {
+			return required("userid", o.UserId)
+		}
+		if o.User == nil {
+			return []RestFieldError{{Field: prefix + ".user", Message: "must be populated"}}
+		}
+		if err, _ := o.User.Validate(); err != nil {
+			fields := err.(*ValidationError).Fields
+			for i := range fields {
+				fields[i].Field = prefix + ".user." + fields[i].Field
+			}
+			return fields
+		}
+	case BatchGroup:
+		return required("group", o.Group)
+	case BatchMembership:
+		if o.Op == BatchUpdate {
+			return []RestFieldError{{Field: prefix + ".op", Message: "memberships can only be created or deleted"}}
+		}
+		return append(required("group", o.Group), required("userid", o.UserId)...)
+	default:
+		return []RestFieldError{{Field: prefix + ".resource", Message: fmt.Sprintf("must be one of %s, %s or %s", BatchUser, BatchGroup, BatchMembership)}}
+	}
+
+	return nil
+}
+
+// Used to return the outcome of a batch as the body of a response object
+// Results are in the order of the operations
+type RestBatchResult struct {
+	Results []RestOperationResult `json:"results"`
+}
+
+// The outcome of a single operation, with the status the same request on its own would have returned
+type RestOperationResult struct {
+	Index    int    `json:"index"`
+	Op       string `json:"op"`
+	Resource string `json:"resource"`
+	Status   int    `json:"status"`
+}
+
+// Returned when an operation of a batch fails, the whole batch is rolled back
+type OperationError struct {
+	Index int
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
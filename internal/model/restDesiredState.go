@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Used to describe the groups and members the service should converge to
+// Read from a yaml file by the apply command or from the body of POST /apply
+type RestDesiredState struct {
+	Groups []RestDesiredGroup `json:"groups" yaml:"groups"`
+}
+
+// A single group and the userids that must be its members
+type RestDesiredGroup struct {
+	Name    string   `json:"name" yaml:"name"`
+	Members []string `json:"members" yaml:"members"`
+}
+
+// Validates every group has a name, is only declared once and lists each of its members once
+// Returns a bad request status code otherwise
+func (d RestDesiredState) Validate() (error, int) {
+	var fields []RestFieldError
+	seen := make(map[string]bool, len(d.Groups))
+	for i, group := range d.Groups {
+		field := fmt.Sprintf("groups[%d].name", i)
+		if group.Name == "" {
+			fields = append(fields, RestFieldError{Field: field, Message: "must be populated"})
+		} else if seen[group.Name] {
+			fields = append(fields, RestFieldError{Field: field, Message: fmt.Sprintf("group %s is declared more than once", group.Name)})
+		}
+		seen[group.Name] = true
+
+		members := make(map[string]bool, len(group.Members))
+		for j, userId := range group.Members {
+			if members[userId] {
+				fields = append(fields, RestFieldError{Field: fmt.Sprintf("groups[%d].members[%d]", i, j), Message: fmt.Sprintf("user %s is listed more than once", userId)})
+			}
+			members[userId] = true
+		}
+	}
+
+	if len(fields) != 0 {
+		return &ValidationError{fields}, http.StatusBadRequest
+	}
+	return nil, 0
+}
+
+// Used to return the plan computed by an apply as the body of a request object
+type RestPlan struct {
+	DryRun  bool         `json:"dry_run"`
+	Prune   bool         `json:"prune"`
+	Actions []RestAction `json:"actions"`
+}
+
+// A single change of a plan
+// UserId is only populated for membership changes
+type RestAction struct {
+	Op     string `json:"op"`
+	Group  string `json:"group"`
+	UserId string `json:"userid,omitempty"`
+}
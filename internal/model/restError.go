@@ -1,6 +1,73 @@
 package model
 
-// Used to return an error message as the body of a request object
-type RestError struct {
+import "strings"
+
+// Stable, machine-readable error codes returned in the code field of a RestProblem
+// Clients should branch on these instead of the status code or the detail text
+type ErrorCode string
+
+const (
+	ValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	MalformedRequest     ErrorCode = "MALFORMED_REQUEST"
+	RequestTooLarge      ErrorCode = "REQUEST_TOO_LARGE"
+	RateLimited          ErrorCode = "RATE_LIMITED"
+	UserNotFound         ErrorCode = "USER_NOT_FOUND"
+	GroupNotFound        ErrorCode = "GROUP_NOT_FOUND"
+	ResourceNotFound     ErrorCode = "RESOURCE_NOT_FOUND"
+	RouteNotFound        ErrorCode = "ROUTE_NOT_FOUND"
+	MethodNotAllowed     ErrorCode = "METHOD_NOT_ALLOWED"
+	DuplicateUser        ErrorCode = "DUPLICATE_USER"
+	DuplicateGroup       ErrorCode = "DUPLICATE_GROUP"
+	DuplicateMembership  ErrorCode = "DUPLICATE_MEMBERSHIP"
+	DuplicateResource    ErrorCode = "DUPLICATE_RESOURCE"
+	DuplicateRequest     ErrorCode = "DUPLICATE_REQUEST"
+	IdempotencyKeyReuse  ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	RequestInProgress    ErrorCode = "REQUEST_IN_PROGRESS"
+	UnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	PatchFailed          ErrorCode = "PATCH_FAILED"
+	Unauthenticated      ErrorCode = "UNAUTHENTICATED"
+	TenantForbidden      ErrorCode = "TENANT_FORBIDDEN"
+	ApprovalForbidden    ErrorCode = "APPROVAL_FORBIDDEN"
+	RequestNotPending    ErrorCode = "REQUEST_NOT_PENDING"
+	PolicyViolation      ErrorCode = "POLICY_VIOLATION"
+	InternalError        ErrorCode = "INTERNAL_ERROR"
+)
+
+// Used to return an error as an RFC 7807 problem+json body
+type RestProblem struct {
+	Type      string           `json:"type"`
+	Title     string           `json:"title"`
+	Status    int              `json:"status"`
+	Code      ErrorCode        `json:"code"`
+	Detail    string           `json:"detail,omitempty"`
+	Instance  string           `json:"instance,omitempty"`
+	RequestId string           `json:"request_id,omitempty"`
+	Errors    []RestFieldError `json:"errors,omitempty"`
+	// Index of the operation that failed, when a batch was rolled back
+	Index *int `json:"index,omitempty"`
+}
+
+// Describes why a single field of the request is invalid
+type RestFieldError struct {
+	Field   string `json:"field"`
 	Message string `json:"message"`
 }
+
+// Returned by the Validate methods, and anywhere else input is rejected field by field
+type ValidationError struct {
+	Fields []RestFieldError
+}
+
+// Joins the invalid fields into one message
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Creates a ValidationError for a single field
+func NewValidationError(field string, message string) *ValidationError {
+	return &ValidationError{[]RestFieldError{{Field: field, Message: message}}}
+}
@@ -1,7 +1,6 @@
 package model
 
 import (
-	"errors"
 	"net/http"
 )
 
@@ -14,11 +13,16 @@ type RestGroup struct {
 // Returns a bad request status code otherwise
 func (r RestGroup) Validate() (error, int) {
 	if r.Name == "" {
-		return errors.New("name field must be populated"), http.StatusBadRequest
+		return NewValidationError("name", "must be populated"), http.StatusBadRequest
 	}
 	return nil, 0
 }
 
+// Used to return every group as the body of a response object
+type RestGroupList struct {
+	Groups []RestGroup `json:"groups"`
+}
+
 // Used to return a list of users in a group as the body of a request object
 type RestGroupMembers struct {
 	UserIds *[]string `json:"userids"`
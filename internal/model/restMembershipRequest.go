@@ -0,0 +1,91 @@
+package model
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Used to return the approval policy and member limits of a group as the body of a request object
+type RestGroupPolicy struct {
+	Approval      string    `json:"approval"`
+	Owners        *[]string `json:"owners"`
+	MaxMembers    *uint64   `json:"max_members,omitempty"`
+	MinMembers    *uint64   `json:"min_members,omitempty"`
+	UserIdPattern string    `json:"userid_pattern,omitempty"`
+	ExclusiveWith *[]string `json:"exclusive_with,omitempty"`
+}
+
+// Validates the approval is known, there are enough owners to approve and the member limits make sense
+// Returns a bad request status code otherwise
+func (p RestGroupPolicy) Validate() (error, int) {
+	if p.MaxMembers != nil && p.MinMembers != nil && *p.MinMembers > *p.MaxMembers {
+		return NewValidationError("min_members", "must not be greater than max_members"), http.StatusBadRequest
+	}
+	if len(p.UserIdPattern) > 256 {
+		return NewValidationError("userid_pattern", "must be at most 256 characters"), http.StatusBadRequest
+	}
+	if _, err := regexp.Compile(p.UserIdPattern); err != nil {
+		return NewValidationError("userid_pattern", "must be a valid regular expression"), http.StatusBadRequest
+	}
+
+	owners := 0
+	if p.Owners != nil {
+		owners = len(*p.Owners)
+	}
+
+	switch p.Approval {
+	case ApprovalAuto:
+	case ApprovalOwner:
+		if owners < 1 {
+			return NewValidationError("owners", "must have at least 1 owner when approval is owner"), http.StatusBadRequest
+		}
+	case ApprovalTwoApprovers:
+		if owners < 2 {
+			return NewValidationError("owners", "must have at least 2 owners when approval is two_approvers"), http.StatusBadRequest
+		}
+	default:
+		return NewValidationError("approval", "must be auto, owner or two_approvers"), http.StatusBadRequest
+	}
+	return nil, 0
+}
+
+// Used to receive a request to join a group as the body of a request object
+type RestMembershipRequestCreate struct {
+	UserId string `json:"userid"`
+	Reason string `json:"reason"`
+}
+
+// Validates the object has the userid field populated and a reason that fits
+// Returns a bad request status code otherwise
+func (r RestMembershipRequestCreate) Validate() (error, int) {
+	if r.UserId == "" {
+		return NewValidationError("userid", "must be populated"), http.StatusBadRequest
+	}
+	if len(r.Reason) > 256 {
+		return NewValidationError("reason", "must be at most 256 characters"), http.StatusBadRequest
+	}
+	return nil, 0
+}
+
+// Used to return a membership request as the body of a response object
+// Approvers are the owners that approved it so far, DecidedBy the owner that approved or rejected it last
+type RestMembershipRequest struct {
+	Id        uint64    `json:"id"`
+	Group     string    `json:"group"`
+	UserId    string    `json:"userid"`
+	State     string    `json:"state"`
+	Reason    string    `json:"reason,omitempty"`
+	Approvers []string  `json:"approvers"`
+	DecidedBy string    `json:"decided_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Used to return one page of the requests to join a group as the body of a response object
+type RestMembershipRequestPage struct {
+	Requests []RestMembershipRequest `json:"requests"`
+	Total    uint64                  `json:"total"`
+	Offset   uint64                  `json:"offset"`
+	Limit    uint64                  `json:"limit"`
+}
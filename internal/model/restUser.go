@@ -2,8 +2,8 @@ package model
 
 import (
 	"net/http"
-	"errors"
 )
+
 // Used to return a user and the groups it belongs to as the body of a request object
 type RestUser struct {
 	FirstName string    `json:"first_name"`
@@ -15,8 +15,28 @@ type RestUser struct {
 // Validates the user object has all of the required fields
 // Returns bad request status code otherwise
 func (u RestUser) Validate() (error, int) {
-	if u.FirstName == "" || u.LastName == "" || u.UserId == "" {
-		return errors.New("first_name, last_name, and userid must all be populated"), http.StatusBadRequest
+	var fields []RestFieldError
+	if u.FirstName == "" {
+		fields = append(fields, RestFieldError{Field: "first_name", Message: "must be populated"})
+	}
+	if u.LastName == "" {
+		fields = append(fields, RestFieldError{Field: "last_name", Message: "must be populated"})
+	}
+	if u.UserId == "" {
+		fields = append(fields, RestFieldError{Field: "userid", Message: "must be populated"})
+	}
+
+	if len(fields) != 0 {
+		return &ValidationError{fields}, http.StatusBadRequest
 	}
 	return nil, 0
 }
+
+// Used to return one page of a user search as the body of a response object
+// Users are ordered best match first, total is the number of users matching the search
+type RestUserPage struct {
+	Users  []RestUser `json:"users"`
+	Total  uint64     `json:"total"`
+	Offset uint64     `json:"offset"`
+	Limit  uint64     `json:"limit"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import "encoding/json"
+
+const (
+	ScimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Used to send and receive a user as a SCIM 2.0 resource
+// The id of the resource is the userid
+type ScimUser struct {
+	Schemas  []string        `json:"schemas"`
+	Id       string          `json:"id,omitempty"`
+	UserName string          `json:"userName"`
+	Name     ScimName        `json:"name"`
+	Active   bool            `json:"active"`
+	Groups   []ScimReference `json:"groups,omitempty"`
+	Meta     *ScimMeta       `json:"meta,omitempty"`
+}
+
+// The name component of a SCIM user
+type ScimName struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+// Used to send and receive a group as a SCIM 2.0 resource
+// The id of the resource is the group name
+type ScimGroup struct {
+	Schemas     []string        `json:"schemas"`
+	Id          string          `json:"id,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []ScimReference `json:"members"`
+	Meta        *ScimMeta       `json:"meta,omitempty"`
+}
+
+// Points to another resource, a group member or a group the user belongs to
+type ScimReference struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Resource metadata returned with every SCIM resource
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// Used to return one page of resources
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// Body of a SCIM PATCH request
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// A single add, remove or replace operation
+// Value is kept raw as its shape depends on the op and the path
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Used to return an error with the SCIM error schema
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
@@ -7,3 +7,20 @@ type User struct {
 	LastName  string
 	UserId    string
 }
+
+// Filters of a user search, empty fields match every user
+type UserSearch struct {
+	// Matched against the first name, last name and userid, anywhere in them unless Prefix is set
+	Query      string
+	Prefix     bool
+	LastName   string
+	Group      string
+	NotInGroup string
+}
+
+// One page of the users a search found, with the groups of each user keyed by User.Id
+type UserPage struct {
+	Users  []User
+	Groups map[uint64][]Group
+	Total  uint64
+}
@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+)
+
+// Creates a middleware that validates requests against the OpenAPI document
+// Must be added with mux.Router.Use so the matched route is known
+// Routes that are not in the document are passed through untouched
+func ValidateRequests() (mux.MiddlewareFunc, error) {
+	s, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the operations under /tenants/{tenant} are the ones of the default tenant
+			path = strings.TrimPrefix(path, "/tenants/{"+tenant.PathVar+"}")
+			op, found := s.operation(path, r.Method)
+			if !found {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			fields, err := s.validateRequest(op, r)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				errhandler.Write(w, r, err)
+				return
+			} else if err != nil {
+				errhandler.WriteCode(w, r, model.MalformedRequest, "the request body could not be read")
+				return
+			}
+
+			if len(fields) != 0 {
+				errhandler.Write(w, r, &model.ValidationError{Fields: fields})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// Validates the parameters and json body of a request
+// The body is read and replaced so the handler can still decode it
+func (s *spec) validateRequest(op *operation, r *http.Request) ([]model.RestFieldError, error) {
+	var fields []model.RestFieldError
+
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = vars[param.Name]
+		case "query":
+			present = query.Get(param.Name) != ""
+			value = query.Get(param.Name)
+		default:
+			continue
+		}
+
+		if !present {
+			if param.Required {
+				fields = append(fields, model.RestFieldError{Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		fields = append(fields, validateParam(param, value)...)
+	}
+
+	if op.RequestBody == nil {
+		return fields, nil
+	}
+
+	content, found := op.RequestBody.Content["application/json"]
+	if !found {
+		return fields, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			fields = append(fields, model.RestFieldError{Field: "body", Message: "is required"})
+		}
+		return fields, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		fields = append(fields, model.RestFieldError{Field: "body", Message: "must be valid json"})
+		return fields, nil
+	}
+
+	return append(fields, s.validate(content.Schema, value, "")...), nil
+}
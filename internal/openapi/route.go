@@ -0,0 +1,29 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct{}
+
+// Creates a new router serving the OpenAPI document
+func NewRouter() Router {
+	return router{}
+}
+
+// Sets up the /openapi.json route
+func (r router) RegisterHandlers(mr *mux.Router) {
+	mr.HandleFunc("/openapi.json", serve).Methods(http.MethodGet)
+}
+
+// Writes the OpenAPI document
+func serve(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write(Document())
+}
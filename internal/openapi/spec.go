@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// The parts of an OpenAPI 3 document needed to validate requests
+type spec struct {
+	Paths      map[string]pathItem `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    map[string]*schema   `json:"schemas"`
+	} `json:"components"`
+}
+
+// Operations of a path keyed by lower case http method, plus parameters shared by all of them
+type pathItem map[string]json.RawMessage
+
+type operation struct {
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+// The subset of JSON schema the validator understands
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Nullable   bool               `json:"nullable"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	Enum       []string           `json:"enum"`
+}
+
+// Returns the raw OpenAPI document
+func Document() []byte {
+	return document
+}
+
+// Parses the embedded document
+func load() (*spec, error) {
+	var s spec
+	if err := json.Unmarshal(document, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Finds the operation of a path template and method
+// Path level parameters are merged into the operation's parameters
+func (s *spec) operation(path string, method string) (*operation, bool) {
+	item, found := s.Paths[path]
+	if !found {
+		return nil, false
+	}
+
+	raw, found := item[strings.ToLower(method)]
+	if !found {
+		return nil, false
+	}
+
+	var op operation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, false
+	}
+
+	if shared, found := item["parameters"]; found {
+		var params []parameter
+		if err := json.Unmarshal(shared, &params); err == nil {
+			op.Parameters = append(params, op.Parameters...)
+		}
+	}
+
+	for i, param := range op.Parameters {
+		if param.Ref != "" {
+			op.Parameters[i] = s.Components.Parameters[refName(param.Ref)]
+		}
+	}
+
+	return &op, true
+}
+
+// Follows a $ref to a component schema
+func (s *spec) resolve(sch *schema) *schema {
+	for sch != nil && sch.Ref != "" {
+		sch = s.Components.Schemas[refName(sch.Ref)]
+	}
+	return sch
+}
+
+// Gets the name of the component a $ref points to
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
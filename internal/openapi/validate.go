@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Validates a decoded json value against a schema
+// Every problem is reported with the path of the field it was found on
+func (s *spec) validate(sch *schema, value interface{}, field string) []model.RestFieldError {
+	sch = s.resolve(sch)
+	if sch == nil {
+		return nil
+	}
+
+	if value == nil {
+		if sch.Nullable {
+			return nil
+		}
+		return fieldError(field, "must not be null")
+	}
+
+	switch sch.Type {
+	case "object":
+		obj, isObject := value.(map[string]interface{})
+		if !isObject {
+			return fieldError(field, "must be an object")
+		}
+		return s.validateObject(sch, obj, field)
+	case "array":
+		arr, isArray := value.([]interface{})
+		if !isArray {
+			return fieldError(field, "must be an array")
+		}
+		var errs []model.RestFieldError
+		for i, item := range arr {
+			errs = append(errs, s.validate(sch.Items, item, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+		return errs
+	case "string":
+		str, isString := value.(string)
+		if !isString {
+			return fieldError(field, "must be a string")
+		}
+		return validateString(sch, str, field)
+	case "boolean":
+		if _, isBool := value.(bool); !isBool {
+			return fieldError(field, "must be a boolean")
+		}
+	case "integer":
+		num, isNumber := value.(json.Number)
+		if _, err := num.Int64(); !isNumber || err != nil {
+			return fieldError(field, "must be an integer")
+		}
+	}
+
+	return nil
+}
+
+// Checks required properties are present and validates every known property
+func (s *spec) validateObject(sch *schema, obj map[string]interface{}, field string) []model.RestFieldError {
+	var errs []model.RestFieldError
+
+	for _, name := range sch.Required {
+		if _, found := obj[name]; !found {
+			errs = append(errs, model.RestFieldError{Field: join(field, name), Message: "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if propSchema, found := sch.Properties[name]; found {
+			errs = append(errs, s.validate(propSchema, obj[name], join(field, name))...)
+		}
+	}
+
+	return errs
+}
+
+// Checks the length and allowed values of a string
+func validateString(sch *schema, str string, field string) []model.RestFieldError {
+	length := utf8.RuneCountInString(str)
+	if sch.MinLength != nil && length < *sch.MinLength {
+		if *sch.MinLength == 1 {
+			return fieldError(field, "must not be empty")
+		}
+		return fieldError(field, fmt.Sprintf("must be at least %d characters", *sch.MinLength))
+	}
+	if sch.MaxLength != nil && length > *sch.MaxLength {
+		return fieldError(field, fmt.Sprintf("must be at most %d characters", *sch.MaxLength))
+	}
+
+	if len(sch.Enum) != 0 {
+		for _, allowed := range sch.Enum {
+			if str == allowed {
+				return nil
+			}
+		}
+		return fieldError(field, fmt.Sprintf("must be one of %v", sch.Enum))
+	}
+
+	return nil
+}
+
+// Validates a query or path parameter, which always arrive as strings
+func validateParam(param parameter, value string) []model.RestFieldError {
+	if param.Schema == nil {
+		return nil
+	}
+
+	switch param.Schema.Type {
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fieldError(param.Name, "must be a boolean")
+		}
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fieldError(param.Name, "must be an integer")
+		}
+	case "string":
+		return validateString(param.Schema, value, param.Name)
+	}
+
+	return nil
+}
+
+// Creates a list with a single field error
+func fieldError(field string, msg string) []model.RestFieldError {
+	if field == "" {
+		field = "body"
+	}
+	return []model.RestFieldError{{Field: field, Message: msg}}
+}
+
+// Joins the path of an object and the name of one of its properties
+func join(field string, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
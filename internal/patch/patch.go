@@ -0,0 +1,93 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Media types of the two patch formats PATCH requests accept
+const (
+	// RFC 7396, an object whose fields replace the fields of the resource and null removes them
+	MergePatch = "application/merge-patch+json"
+	// RFC 6902, a list of add, remove, replace, move, copy and test operations
+	JsonPatch = "application/json-patch+json"
+)
+
+// Applies the patch in the body of the request to doc and decodes the patched document into out
+// The format is picked by the Content-Type of the request
+func Apply(r *http.Request, doc interface{}, out interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != MergePatch && mediaType != JsonPatch) {
+		return errhandler.New(model.UnsupportedMediaType, "the Content-Type must be %s or %s", MergePatch, JsonPatch)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	original, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	if mediaType == MergePatch {
+		if !json.Valid(body) {
+			return errhandler.New(model.MalformedRequest, "the request body is not valid json")
+		}
+		if patched, err = jsonpatch.MergePatch(original, body); err != nil {
+			return errhandler.New(model.MalformedRequest, "the merge patch is malformed: %s", err)
+		}
+	} else {
+		operations, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return errhandler.New(model.MalformedRequest, "the json patch is malformed: %s", err)
+		}
+		if patched, err = operations.Apply(original); err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) || errors.Is(err, jsonpatch.ErrMissing) || errors.Is(err, jsonpatch.ErrInvalidIndex) {
+				return errhandler.New(model.PatchFailed, "the json patch could not be applied: %s", err)
+			}
+			return errhandler.New(model.MalformedRequest, "the json patch is malformed: %s", err)
+		}
+	}
+
+	return json.Unmarshal(patched, out)
+}
+
+// Works out the names to add and to remove to turn the old list into the new one
+// Names compare case-insensitively, like the default MySQL collation, and duplicates count once
+func Diff(old []string, new []string) (added []string, removed []string) {
+	oldSet := toSet(old)
+	newSet := toSet(new)
+
+	for _, name := range new {
+		if key := strings.ToLower(name); !oldSet[key] {
+			added = append(added, name)
+			oldSet[key] = true
+		}
+	}
+	for _, name := range old {
+		if key := strings.ToLower(name); !newSet[key] {
+			removed = append(removed, name)
+			newSet[key] = true
+		}
+	}
+	return added, removed
+}
+
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type groupServer struct {
+	pb.UnimplementedGroupServiceServer
+	service group.Service
+}
+
+// Retrieves a group and the userids of its members
+// Returns NotFound if group is not found
+func (s groupServer) GetGroup(ctx context.Context, req *pb.GetGroupRequest) (*pb.Group, error) {
+	g, users, err := s.service.GetWithUsers(ctx, req.GetName())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if g == (model.Group{}) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("group %s not found", req.GetName()))
+	}
+
+	return toPbGroup(g, users), nil
+}
+
+// Creates an empty group
+// Returns AlreadyExists if group already exists
+func (s groupServer) CreateGroup(ctx context.Context, req *pb.CreateGroupRequest) (*pb.Group, error) {
+	restGroup := model.RestGroup{Name: req.GetName()}
+	if err, _ := restGroup.Validate(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	if _, err := s.service.Insert(ctx, model.Group{Name: restGroup.Name}); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.Group{Name: restGroup.Name, Userids: []string{}}, nil
+}
+
+// Deletes a group and any links to users for that group
+// Returns NotFound if group is not found
+func (s groupServer) DeleteGroup(ctx context.Context, req *pb.DeleteGroupRequest) (*emptypb.Empty, error) {
+	if err := s.service.Delete(ctx, req.GetName()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Replaces the members of a group
+// Returns NotFound if group is not found
+func (s groupServer) UpdateGroupMembers(ctx context.Context, req *pb.UpdateGroupMembersRequest) (*pb.Group, error) {
+	userIds := req.GetUserids()
+	if err := s.service.UpdateGroupMembership(ctx, req.GetName(), &userIds); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return s.GetGroup(ctx, &pb.GetGroupRequest{Name: req.GetName()})
+}
+
+// Converts a Group and its users to a pb.Group
+func toPbGroup(g model.Group, users *[]model.User) *pb.Group {
+	userIds := make([]string, len(*users))
+	for i, u := range *users {
+		userIds[i] = u.UserId
+	}
+
+	return &pb.Group{
+		Name:    g.Name,
+		Userids: userIds,
+	}
+}
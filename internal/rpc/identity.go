@@ -0,0 +1,22 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Stores the subject of the verified client certificate of a call as the caller identity, like mw.ClientIdentity
+func identityInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if identity := mw.IdentityFromTLS(&tlsInfo.State); identity != "" {
+				ctx = mw.WithCallerIdentity(ctx, identity)
+			}
+		}
+	}
+	return handler(ctx, req)
+}
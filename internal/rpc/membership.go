@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type membershipServer struct {
+	pb.UnimplementedMembershipServiceServer
+	userService       user.Service
+	groupService      group.Service
+	membershipService membership.Service
+}
+
+// Lists the names of the groups a user belongs to
+// Returns NotFound if user is not found
+func (s membershipServer) ListUserGroups(ctx context.Context, req *pb.ListUserGroupsRequest) (*pb.ListUserGroupsResponse, error) {
+	u, groups, err := s.userService.GetWithGroup(ctx, req.GetUserid())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if u == (model.User{}) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("user id %s was not found", req.GetUserid()))
+	}
+
+	return &pb.ListUserGroupsResponse{Groups: toPbUser(u, groups).Groups}, nil
+}
+
+// Lists the userids of the members of a group
+// Returns NotFound if group is not found
+func (s membershipServer) ListGroupMembers(ctx context.Context, req *pb.ListGroupMembersRequest) (*pb.ListGroupMembersResponse, error) {
+	g, users, err := s.groupService.GetWithUsers(ctx, req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if g == (model.Group{}) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("group %s not found", req.GetGroup()))
+	}
+
+	return &pb.ListGroupMembersResponse{Userids: toPbGroup(g, users).Userids}, nil
+}
+
+// Adds a user to a group, does nothing if they are already a member
+// Returns NotFound if the user or the group is not found
+func (s membershipServer) AddGroupMember(ctx context.Context, req *pb.AddGroupMemberRequest) (*emptypb.Empty, error) {
+	if err := s.membershipService.AddGroupMember(ctx, req.GetGroup(), req.GetUserid()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Removes a user from a group, does nothing if they are not a member
+func (s membershipServer) RemoveGroupMember(ctx context.Context, req *pb.RemoveGroupMemberRequest) (*emptypb.Empty, error) {
+	if err := s.membershipService.RemoveGroupMember(ctx, req.GetGroup(), req.GetUserid()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
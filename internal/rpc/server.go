@@ -0,0 +1,33 @@
+package rpc
+
+import (
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Creates a gRPC server with the user, group and membership services registered
+// The services share the same user and group services as the REST controllers
+func NewServer(db *sql.DB, opts ...grpc.ServerOption) *grpc.Server {
+	userService := user.NewService(db)
+	groupService := group.NewService(db)
+	membershipService := membership.NewService(db)
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(identityInterceptor, tenantInterceptor))
+	srv := grpc.NewServer(opts...)
+	pb.RegisterUserServiceServer(srv, userServer{service: userService})
+	pb.RegisterGroupServiceServer(srv, groupServer{service: groupService})
+	pb.RegisterMembershipServiceServer(srv, membershipServer{
+		userService:       userService,
+		groupService:      groupService,
+		membershipService: membershipService,
+	})
+	reflection.Register(srv)
+
+	return srv
+}
@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC code for every error code errhandler can produce
+var errorToCode = map[model.ErrorCode]codes.Code{
+	model.ValidationFailed:    codes.InvalidArgument,
+	model.MalformedRequest:    codes.InvalidArgument,
+	model.UserNotFound:        codes.NotFound,
+	model.GroupNotFound:       codes.NotFound,
+	model.ResourceNotFound:    codes.NotFound,
+	model.DuplicateUser:       codes.AlreadyExists,
+	model.DuplicateGroup:      codes.AlreadyExists,
+	model.DuplicateMembership: codes.AlreadyExists,
+	model.DuplicateResource:   codes.AlreadyExists,
+	model.DuplicateRequest:    codes.AlreadyExists,
+	model.RequestTooLarge:     codes.InvalidArgument,
+	model.RateLimited:         codes.ResourceExhausted,
+	model.Unauthenticated:     codes.Unauthenticated,
+	model.TenantForbidden:     codes.PermissionDenied,
+	model.ApprovalForbidden:   codes.PermissionDenied,
+	model.RequestNotPending:   codes.FailedPrecondition,
+	model.PolicyViolation:     codes.FailedPrecondition,
+	model.InternalError:       codes.Internal,
+}
+
+// Converts an error to a gRPC status error
+// Uses errhandler.FromError so a failure gets the same meaning over REST and gRPC
+func toStatus(err error) error {
+	switch err {
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	problem := errhandler.FromError(err)
+	code, found := errorToCode[problem.Code]
+	if !found {
+		code = codes.Unknown
+	}
+	return status.Error(code, problem.Detail)
+}
@@ -0,0 +1,33 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Metadata key of the tenant a call asks for, like the /tenants/{tenant} prefix over REST
+const tenantMetadata = "tenant"
+
+// Stores the tenant of a call in its context, like tenant.Middleware
+func tenantInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var requested, caller string
+	if values := metadata.ValueFromIncomingContext(ctx, tenantMetadata); len(values) != 0 {
+		requested = values[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			caller = tenant.FromTLS(&tlsInfo.State)
+		}
+	}
+
+	t, err := tenant.Resolve(requested, caller)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return handler(tenant.WithTenant(ctx, t), req)
+}
@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type userServer struct {
+	pb.UnimplementedUserServiceServer
+	service user.Service
+}
+
+// Gets a user and the groups they belong to
+// Returns NotFound if user is not found
+func (s userServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	u, groups, err := s.service.GetWithGroup(ctx, req.GetUserid())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if u == (model.User{}) {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("user id %s was not found", req.GetUserid()))
+	}
+
+	return toPbUser(u, groups), nil
+}
+
+// Creates a new user with any groups (if provided)
+// Returns AlreadyExists if userid is duplicated
+func (s userServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	restUser := toRestUser(req.GetUser())
+	if err, _ := restUser.Validate(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	u, groupNames := fromRestUser(restUser)
+	if err := s.service.InsertTx(ctx, u, groupNames); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return s.GetUser(ctx, &pb.GetUserRequest{Userid: u.UserId})
+}
+
+// Updates a user and their linkages to groups
+// Returns NotFound if user is not found
+func (s userServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	restUser := toRestUser(req.GetUser())
+	if err, _ := restUser.Validate(); err != nil {
+		return nil, toStatus(err)
+	}
+
+	u, groupNames := fromRestUser(restUser)
+	if err := s.service.UpdateTx(ctx, u, groupNames); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return s.GetUser(ctx, &pb.GetUserRequest{Userid: u.UserId})
+}
+
+// Deletes a user and their linkages to groups
+// Returns NotFound if user is not found
+func (s userServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := s.service.Delete(ctx, req.GetUserid()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Converts a User and its groups to a pb.User
+func toPbUser(u model.User, groups *[]model.Group) *pb.User {
+	groupNames := make([]string, len(*groups))
+	for i, g := range *groups {
+		groupNames[i] = g.Name
+	}
+
+	return &pb.User{
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Userid:    u.UserId,
+		Groups:    groupNames,
+	}
+}
+
+// Converts a pb.User to the RestUser the REST API would have received
+// An empty list of groups is sent as null, same as an omitted groups field
+func toRestUser(u *pb.User) model.RestUser {
+	restUser := model.RestUser{
+		FirstName: u.GetFirstName(),
+		LastName:  u.GetLastName(),
+		UserId:    u.GetUserid(),
+	}
+
+	if groups := u.GetGroups(); len(groups) != 0 {
+		restUser.Groups = &groups
+	}
+	return restUser
+}
+
+// Breaks the RestUser object up into a User obj and an array of group names
+func fromRestUser(restUser model.RestUser) (model.User, *[]string) {
+	return model.User{
+		FirstName: restUser.FirstName,
+		LastName:  restUser.LastName,
+		UserId:    restUser.UserId,
+	}, restUser.Groups
+}
@@ -0,0 +1,291 @@
+package scim
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+const (
+	contentType  = "application/scim+json"
+	defaultCount = 100
+	maxCount     = 1000
+)
+
+type Controller interface {
+	ListUsers(w http.ResponseWriter, r *http.Request)
+	GetUser(w http.ResponseWriter, r *http.Request)
+	CreateUser(w http.ResponseWriter, r *http.Request)
+	ReplaceUser(w http.ResponseWriter, r *http.Request)
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+	ListGroups(w http.ResponseWriter, r *http.Request)
+	GetGroup(w http.ResponseWriter, r *http.Request)
+	CreateGroup(w http.ResponseWriter, r *http.Request)
+	ReplaceGroup(w http.ResponseWriter, r *http.Request)
+	PatchGroup(w http.ResponseWriter, r *http.Request)
+	DeleteGroup(w http.ResponseWriter, r *http.Request)
+}
+
+type controller struct {
+	service Service
+}
+
+// Creates a new instance of the SCIM controller
+func NewController(db *sql.DB) Controller {
+	return controller{NewService(db)}
+}
+
+// Lists users, supports the userName eq filter and startIndex/count pagination
+func (a controller) ListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, err := pagination(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	list, err := a.service.ListUsers(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, list)
+}
+
+// Gets a user by userid
+// Returns 404 if user is not found
+func (a controller) GetUser(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["id"]
+
+	scimUser, err := a.service.GetUser(r.Context(), userId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if scimUser == nil {
+		writeError(w, r, notFound("user %s not found", userId))
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, scimUser)
+}
+
+// Creates a user
+// Returns 409 if the userName is taken
+func (a controller) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var body model.ScimUser
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	scimUser, err := a.service.CreateUser(r.Context(), body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusCreated, scimUser)
+}
+
+// Replaces the name of a user
+// Returns 404 if user is not found
+func (a controller) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var body model.ScimUser
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	scimUser, err := a.service.ReplaceUser(r.Context(), mux.Vars(r)["id"], body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, scimUser)
+}
+
+// Deletes a user
+// Returns 404 if user is not found
+func (a controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := a.service.DeleteUser(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists groups, supports the displayName eq filter and startIndex/count pagination
+func (a controller) ListGroups(w http.ResponseWriter, r *http.Request) {
+	startIndex, count, err := pagination(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	list, err := a.service.ListGroups(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, list)
+}
+
+// Gets a group and its members by name
+// Returns 404 if group is not found
+func (a controller) GetGroup(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["id"]
+
+	scimGroup, err := a.service.GetGroup(r.Context(), groupName)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if scimGroup == nil {
+		writeError(w, r, notFound("group %s not found", groupName))
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, scimGroup)
+}
+
+// Creates a group with its members
+// Returns 409 if the displayName is taken
+func (a controller) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var scimGroup model.ScimGroup
+	if err := decode(r, &scimGroup); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	created, err := a.service.CreateGroup(r.Context(), scimGroup)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusCreated, created)
+}
+
+// Replaces the members of a group
+// Returns 404 if group is not found
+func (a controller) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var scimGroup model.ScimGroup
+	if err := decode(r, &scimGroup); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	replaced, err := a.service.ReplaceGroup(r.Context(), mux.Vars(r)["id"], scimGroup)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, replaced)
+}
+
+// Adds, removes or replaces members of a group
+// Returns 404 if group is not found
+func (a controller) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var patch model.ScimPatchRequest
+	if err := decode(r, &patch); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	patched, err := a.service.PatchGroup(r.Context(), mux.Vars(r)["id"], patch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeResource(w, r, http.StatusOK, patched)
+}
+
+// Deletes a group
+// Returns 404 if group is not found
+func (a controller) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := a.service.DeleteGroup(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reads startIndex (1-based) and count from the query string
+// Out of range values are clamped as described in RFC 7644 section 3.4.2.4
+func pagination(r *http.Request) (int, int, error) {
+	startIndex, err := intParam(r, "startIndex", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := intParam(r, "count", defaultCount)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+
+	return startIndex, count, nil
+}
+
+// Reads an optional integer query param
+func intParam(r *http.Request, key string, fallback int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, badRequest(invalidValue, "%s must be an integer", key)
+	}
+	return i, nil
+}
+
+// Decodes the json body of the request
+func decode(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return badRequest(invalidSyntax, "request body is not valid json: %v", err)
+	}
+	return nil
+}
+
+// Writes a SCIM resource as the response
+func writeResource(w http.ResponseWriter, r *http.Request, status int, resource interface{}) {
+	payload, err := json.Marshal(resource)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(payload)
+}
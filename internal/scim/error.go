@@ -0,0 +1,77 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// scimType values from RFC 7644 section 3.12
+const (
+	invalidFilter = "invalidFilter"
+	invalidSyntax = "invalidSyntax"
+	invalidPath   = "invalidPath"
+	invalidValue  = "invalidValue"
+	mutability    = "mutability"
+	uniqueness    = "uniqueness"
+)
+
+// An error that is returned to the client with the SCIM error schema
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e scimError) Error() string {
+	return e.detail
+}
+
+// Creates a bad request error of the given scim type
+func badRequest(scimType string, format string, args ...interface{}) error {
+	return scimError{http.StatusBadRequest, scimType, fmt.Sprintf(format, args...)}
+}
+
+// Creates a not found error
+func notFound(format string, args ...interface{}) error {
+	return scimError{http.StatusNotFound, "", fmt.Sprintf(format, args...)}
+}
+
+// Writes the error with the SCIM error schema
+// Other errors are classified by errhandler.FromError, except duplicates are a 409, and logged like errhandler.Write does
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	se, success := err.(scimError)
+	if !success {
+		problem := errhandler.FromError(err)
+		se = scimError{status: problem.Status, detail: problem.Detail}
+
+		if problem.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(r.Context(), "request failed", slog.String("code", string(problem.Code)), slog.Any("error", err))
+		} else {
+			slog.InfoContext(r.Context(), "request rejected", slog.String("code", string(problem.Code)), slog.String("detail", problem.Detail))
+		}
+
+		switch problem.Code {
+		case model.DuplicateUser, model.DuplicateGroup, model.DuplicateMembership, model.DuplicateResource:
+			se = scimError{http.StatusConflict, uniqueness, problem.Detail}
+		case model.ValidationFailed, model.MalformedRequest:
+			se.scimType = invalidValue
+		}
+	}
+
+	payload, _ := json.Marshal(model.ScimError{
+		Schemas:  []string{model.ScimErrorSchema},
+		Status:   strconv.Itoa(se.status),
+		ScimType: se.scimType,
+		Detail:   se.detail,
+	})
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(se.status)
+	w.Write(payload)
+}
@@ -0,0 +1,36 @@
+package scim
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parses a filter of the form `attr eq "value"` and returns the value
+// Only equality on the given attribute is supported, attribute names are case insensitive
+// Returns an empty value when there is no filter
+func parseEqFilter(filter string, attr string) (string, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return "", nil
+	}
+
+	parts := strings.SplitN(filter, " ", 3)
+	if len(parts) != 3 {
+		return "", badRequest(invalidFilter, "filter %q is not of the form 'attribute eq \"value\"'", filter)
+	}
+
+	if !strings.EqualFold(parts[0], attr) {
+		return "", badRequest(invalidFilter, "filtering is only supported on %s", attr)
+	}
+
+	if !strings.EqualFold(parts[1], "eq") {
+		return "", badRequest(invalidFilter, "operator %s is not supported, only eq is", parts[1])
+	}
+
+	value, err := strconv.Unquote(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return "", badRequest(invalidFilter, "value of filter %q must be a quoted string", filter)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,39 @@
+package scim
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Router interface {
+	RegisterHandlers(r *mux.Router)
+}
+
+type router struct {
+	controller Controller
+}
+
+// Creates a new SCIM router
+func NewRouter(db *sql.DB) Router {
+	return router{NewController(db)}
+}
+
+// Sets up the SCIM 2.0 Users and Groups routes under /scim/v2
+func (r router) RegisterHandlers(mr *mux.Router) {
+	sr := mr.PathPrefix(basePath).Subrouter()
+
+	sr.HandleFunc("/Users", r.controller.ListUsers).Methods(http.MethodGet)
+	sr.HandleFunc("/Users", r.controller.CreateUser).Methods(http.MethodPost)
+	sr.HandleFunc("/Users/{id}", r.controller.GetUser).Methods(http.MethodGet)
+	sr.HandleFunc("/Users/{id}", r.controller.ReplaceUser).Methods(http.MethodPut)
+	sr.HandleFunc("/Users/{id}", r.controller.DeleteUser).Methods(http.MethodDelete)
+
+	sr.HandleFunc("/Groups", r.controller.ListGroups).Methods(http.MethodGet)
+	sr.HandleFunc("/Groups", r.controller.CreateGroup).Methods(http.MethodPost)
+	sr.HandleFunc("/Groups/{id}", r.controller.GetGroup).Methods(http.MethodGet)
+	sr.HandleFunc("/Groups/{id}", r.controller.ReplaceGroup).Methods(http.MethodPut)
+	sr.HandleFunc("/Groups/{id}", r.controller.PatchGroup).Methods(http.MethodPatch)
+	sr.HandleFunc("/Groups/{id}", r.controller.DeleteGroup).Methods(http.MethodDelete)
+}
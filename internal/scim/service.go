@@ -0,0 +1,503 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/group"
+	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/user"
+)
+
+const basePath = "/scim/v2"
+
+// Matches a patch path that targets one member, e.g. members[value eq "jdoe"]
+var memberPathRegex = regexp.MustCompile(`(?i)^members\[value eq "([^"]*)"\]$`)
+
+type Service interface {
+	GetUser(ctx context.Context, userId string) (*model.ScimUser, error)
+	ListUsers(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error)
+	CreateUser(ctx context.Context, scimUser model.ScimUser) (*model.ScimUser, error)
+	ReplaceUser(ctx context.Context, userId string, scimUser model.ScimUser) (*model.ScimUser, error)
+	DeleteUser(ctx context.Context, userId string) error
+	GetGroup(ctx context.Context, groupName string) (*model.ScimGroup, error)
+	ListGroups(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error)
+	CreateGroup(ctx context.Context, scimGroup model.ScimGroup) (*model.ScimGroup, error)
+	ReplaceGroup(ctx context.Context, groupName string, scimGroup model.ScimGroup) (*model.ScimGroup, error)
+	PatchGroup(ctx context.Context, groupName string, patch model.ScimPatchRequest) (*model.ScimGroup, error)
+	DeleteGroup(ctx context.Context, groupName string) error
+}
+
+type service struct {
+	userService       user.Service
+	groupService      group.Service
+	membershipService membership.Service
+	db                *sql.DB
+}
+
+// Creates a new SCIM service instance
+func NewService(db *sql.DB) Service {
+	return tracedService{service{user.NewService(db), group.NewService(db), membership.NewService(db), db}}
+}
+
+// Gets a user as a SCIM resource, nil if the user does not exist
+func (s service) GetUser(ctx context.Context, userId string) (*model.ScimUser, error) {
+	u, groups, err := s.userService.GetWithGroup(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if u == (model.User{}) {
+		return nil, nil
+	}
+
+	scimUser := toScimUser(u, groups)
+	return &scimUser, nil
+}
+
+// Lists one page of users, optionally filtered with `userName eq "x"`
+func (s service) ListUsers(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error) {
+	userName, err := parseEqFilter(filter, "userName")
+	if err != nil {
+		return model.ScimListResponse{}, err
+	}
+
+	resources := []model.ScimUser{}
+
+	if userName != "" {
+		scimUser, err := s.GetUser(ctx, userName)
+		if err != nil {
+			return model.ScimListResponse{}, err
+		}
+
+		total := 0
+		if scimUser != nil {
+			total = 1
+			if startIndex == 1 && count > 0 {
+				resources = append(resources, *scimUser)
+			}
+		}
+		return toListResponse(resources, len(resources), total, startIndex), nil
+	}
+
+	users, total, err := s.userService.GetPage(ctx, uint64(startIndex-1), uint64(count))
+	if err != nil {
+		return model.ScimListResponse{}, err
+	}
+
+	ids := make([]uint64, len(*users))
+	for i, u := range *users {
+		ids[i] = u.Id
+	}
+
+	groups := map[uint64][]model.Group{}
+	if len(ids) != 0 {
+		if groups, err = s.membershipService.GetGroupsForUsers(ctx, ids); err != nil {
+			return model.ScimListResponse{}, err
+		}
+	}
+
+	for _, u := range *users {
+		userGroups := groups[u.Id]
+		resources = append(resources, toScimUser(u, &userGroups))
+	}
+
+	return toListResponse(resources, len(resources), int(total), startIndex), nil
+}
+
+// Creates a user without any groups, groups are managed through the Groups resource
+func (s service) CreateUser(ctx context.Context, scimUser model.ScimUser) (*model.ScimUser, error) {
+	if err := validateUser(scimUser); err != nil {
+		return nil, err
+	}
+
+	if err := s.userService.InsertTx(ctx, fromScimUser(scimUser), nil); err != nil {
+		return nil, err
+	}
+
+	return s.GetUser(ctx, scimUser.UserName)
+}
+
+// Replaces the name of a user, the userName can not be changed
+func (s service) ReplaceUser(ctx context.Context, userId string, scimUser model.ScimUser) (*model.ScimUser, error) {
+	if err := validateUser(scimUser); err != nil {
+		return nil, err
+	}
+
+	if scimUser.UserName != userId {
+		return nil, badRequest(mutability, "userName can not be changed from %s to %s", userId, scimUser.UserName)
+	}
+
+	// no group names leaves the existing memberships untouched
+	if err := s.userService.UpdateTx(ctx, fromScimUser(scimUser), nil); err != nil {
+		return nil, err
+	}
+
+	return s.GetUser(ctx, userId)
+}
+
+// Deletes a user and their memberships
+func (s service) DeleteUser(ctx context.Context, userId string) error {
+	return s.userService.Delete(ctx, userId)
+}
+
+// Gets a group and its members as a SCIM resource, nil if the group does not exist
+func (s service) GetGroup(ctx context.Context, groupName string) (*model.ScimGroup, error) {
+	g, users, err := s.groupService.GetWithUsers(ctx, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if g == (model.Group{}) {
+		return nil, nil
+	}
+
+	scimGroup := toScimGroup(g, users)
+	return &scimGroup, nil
+}
+
+// Lists one page of groups, optionally filtered with `displayName eq "x"`
+func (s service) ListGroups(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error) {
+	displayName, err := parseEqFilter(filter, "displayName")
+	if err != nil {
+		return model.ScimListResponse{}, err
+	}
+
+	var groups []model.Group
+	if displayName != "" {
+		g, _, err := s.groupService.GetWithUsers(ctx, displayName)
+		if err != nil {
+			return model.ScimListResponse{}, err
+		}
+		if g != (model.Group{}) {
+			groups = append(groups, g)
+		}
+	} else {
+		all, err := s.groupService.GetAll(ctx)
+		if err != nil {
+			return model.ScimListResponse{}, err
+		}
+		groups = *all
+	}
+
+	var page []model.Group
+	if start := startIndex - 1; start < len(groups) && count > 0 {
+		page = groups[start:min(start+count, len(groups))]
+	}
+
+	ids := make([]uint64, len(page))
+	for i, g := range page {
+		ids[i] = g.Id
+	}
+
+	users := map[uint64][]model.User{}
+	if len(ids) != 0 {
+		if users, err = s.membershipService.GetUsersForGroups(ctx, ids); err != nil {
+			return model.ScimListResponse{}, err
+		}
+	}
+
+	resources := []model.ScimGroup{}
+	for _, g := range page {
+		groupUsers := users[g.Id]
+		resources = append(resources, toScimGroup(g, &groupUsers))
+	}
+
+	return toListResponse(resources, len(resources), len(groups), startIndex), nil
+}
+
+// Creates a group and its members in a transaction
+func (s service) CreateGroup(ctx context.Context, scimGroup model.ScimGroup) (*model.ScimGroup, error) {
+	if scimGroup.DisplayName == "" {
+		return nil, badRequest(invalidValue, "displayName must be populated")
+	}
+
+	err := dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := s.groupService.InsertTx(ctx, tx, model.Group{Name: scimGroup.DisplayName}); err != nil {
+			return err
+		}
+
+		for _, member := range scimGroup.Members {
+			if err := s.membershipService.AddGroupMemberTx(ctx, tx, scimGroup.DisplayName, member.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(ctx, scimGroup.DisplayName)
+}
+
+// Replaces the members of a group, the displayName can not be changed
+func (s service) ReplaceGroup(ctx context.Context, groupName string, scimGroup model.ScimGroup) (*model.ScimGroup, error) {
+	if scimGroup.DisplayName != groupName {
+		return nil, badRequest(mutability, "displayName can not be changed from %s to %s", groupName, scimGroup.DisplayName)
+	}
+
+	err := dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := s.currentMembersTx(ctx, tx, groupName)
+		if err != nil {
+			return err
+		}
+		return s.replaceMembersTx(ctx, tx, groupName, current, scimGroup.Members)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(ctx, groupName)
+}
+
+// Applies the add, remove and replace operations on the members of a group in a transaction
+func (s service) PatchGroup(ctx context.Context, groupName string, patch model.ScimPatchRequest) (*model.ScimGroup, error) {
+	if len(patch.Operations) == 0 {
+		return nil, badRequest(invalidValue, "at least one operation is required")
+	}
+
+	err := dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		current, err := s.currentMembersTx(ctx, tx, groupName)
+		if err != nil {
+			return err
+		}
+
+		for _, operation := range patch.Operations {
+			if err := s.patchOperationTx(ctx, tx, groupName, current, operation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(ctx, groupName)
+}
+
+// Deletes a group and its memberships
+func (s service) DeleteGroup(ctx context.Context, groupName string) error {
+	return s.groupService.Delete(ctx, groupName)
+}
+
+// Applies a single patch operation and keeps the current member set in sync
+func (s service) patchOperationTx(ctx context.Context, tx *sql.Tx, groupName string, current map[string]bool, operation model.ScimPatchOperation) error {
+	op := strings.ToLower(operation.Op)
+	path := strings.TrimSpace(operation.Path)
+
+	if match := memberPathRegex.FindStringSubmatch(path); match != nil {
+		if op != "remove" {
+			return badRequest(invalidPath, "path %s is only supported with the remove op", path)
+		}
+		return s.removeMemberTx(ctx, tx, groupName, current, match[1])
+	}
+
+	var members []model.ScimReference
+	switch {
+	case strings.EqualFold(path, "members"):
+		if len(operation.Value) != 0 {
+			if err := json.Unmarshal(operation.Value, &members); err != nil {
+				return badRequest(invalidValue, "value of members must be a list of {\"value\": userid}")
+			}
+		}
+	case path == "":
+		var value model.ScimGroup
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return badRequest(invalidValue, "value must be an object when there is no path")
+		}
+		if value.DisplayName != "" && value.DisplayName != groupName {
+			return badRequest(mutability, "displayName can not be changed from %s to %s", groupName, value.DisplayName)
+		}
+		members = value.Members
+	case strings.EqualFold(path, "displayName"):
+		return badRequest(mutability, "displayName can not be changed")
+	default:
+		return badRequest(invalidPath, "path %s is not supported", path)
+	}
+
+	switch op {
+	case "add":
+		for _, member := range members {
+			if err := s.addMemberTx(ctx, tx, groupName, current, member.Value); err != nil {
+				return err
+			}
+		}
+	case "remove":
+		// removing the members attribute without a value removes everyone
+		if len(members) == 0 && path != "" {
+			for userId := range current {
+				members = append(members, model.ScimReference{Value: userId})
+			}
+		}
+		for _, member := range members {
+			if err := s.removeMemberTx(ctx, tx, groupName, current, member.Value); err != nil {
+				return err
+			}
+		}
+	case "replace":
+		return s.replaceMembersTx(ctx, tx, groupName, current, members)
+	default:
+		return badRequest(invalidSyntax, "op %s is not one of add, remove or replace", operation.Op)
+	}
+
+	return nil
+}
+
+// Adds and removes members so the group ends up with exactly the given members
+func (s service) replaceMembersTx(ctx context.Context, tx *sql.Tx, groupName string, current map[string]bool, members []model.ScimReference) error {
+	wanted := make(map[string]bool, len(members))
+	for _, member := range members {
+		wanted[member.Value] = true
+	}
+
+	for userId := range current {
+		if !wanted[userId] {
+			if err := s.removeMemberTx(ctx, tx, groupName, current, userId); err != nil {
+				return err
+			}
+		}
+	}
+
+	for userId := range wanted {
+		if err := s.addMemberTx(ctx, tx, groupName, current, userId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Adds a member unless they are already part of the group
+func (s service) addMemberTx(ctx context.Context, tx *sql.Tx, groupName string, current map[string]bool, userId string) error {
+	if current[userId] {
+		return nil
+	}
+
+	if err := s.membershipService.AddGroupMemberTx(ctx, tx, groupName, userId); err != nil {
+		return err
+	}
+	current[userId] = true
+	return nil
+}
+
+// Removes a member if they are part of the group
+func (s service) removeMemberTx(ctx context.Context, tx *sql.Tx, groupName string, current map[string]bool, userId string) error {
+	if !current[userId] {
+		return nil
+	}
+
+	if err := s.membershipService.RemoveGroupMemberTx(ctx, tx, groupName, userId); err != nil {
+		return err
+	}
+	delete(current, userId)
+	return nil
+}
+
+// Gets the set of userids in a group as part of a transaction, errors if the group does not exist
+func (s service) currentMembersTx(ctx context.Context, tx *sql.Tx, groupName string) (map[string]bool, error) {
+	g, users, err := s.groupService.GetWithUsersTx(ctx, tx, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if g == (model.Group{}) {
+		return nil, notFound("group %s not found", groupName)
+	}
+
+	members := make(map[string]bool, len(*users))
+	for _, u := range *users {
+		members[u.UserId] = true
+	}
+	return members, nil
+}
+
+// Validates the fields the user table requires are populated
+func validateUser(scimUser model.ScimUser) error {
+	if scimUser.UserName == "" || scimUser.Name.GivenName == "" || scimUser.Name.FamilyName == "" {
+		return badRequest(invalidValue, "userName, name.givenName and name.familyName must all be populated")
+	}
+	return nil
+}
+
+// Converts a User and its groups to a ScimUser
+func toScimUser(u model.User, groups *[]model.Group) model.ScimUser {
+	var refs []model.ScimReference
+	if groups != nil {
+		for _, g := range *groups {
+			refs = append(refs, model.ScimReference{
+				Value:   g.Name,
+				Display: g.Name,
+				Ref:     fmt.Sprintf("%s/Groups/%s", basePath, g.Name),
+			})
+		}
+	}
+
+	return model.ScimUser{
+		Schemas:  []string{model.ScimUserSchema},
+		Id:       u.UserId,
+		UserName: u.UserId,
+		Name: model.ScimName{
+			GivenName:  u.FirstName,
+			FamilyName: u.LastName,
+		},
+		Active: true,
+		Groups: refs,
+		Meta: &model.ScimMeta{
+			ResourceType: "User",
+			Location:     fmt.Sprintf("%s/Users/%s", basePath, u.UserId),
+		},
+	}
+}
+
+// Converts a ScimUser to a User
+func fromScimUser(scimUser model.ScimUser) model.User {
+	return model.User{
+		FirstName: scimUser.Name.GivenName,
+		LastName:  scimUser.Name.FamilyName,
+		UserId:    scimUser.UserName,
+	}
+}
+
+// Converts a Group and its users to a ScimGroup
+func toScimGroup(g model.Group, users *[]model.User) model.ScimGroup {
+	refs := []model.ScimReference{}
+	if users != nil {
+		for _, u := range *users {
+			refs = append(refs, model.ScimReference{
+				Value:   u.UserId,
+				Display: fmt.Sprintf("%s %s", u.FirstName, u.LastName),
+				Ref:     fmt.Sprintf("%s/Users/%s", basePath, u.UserId),
+			})
+		}
+	}
+
+	return model.ScimGroup{
+		Schemas:     []string{model.ScimGroupSchema},
+		Id:          g.Name,
+		DisplayName: g.Name,
+		Members:     refs,
+		Meta: &model.ScimMeta{
+			ResourceType: "Group",
+			Location:     fmt.Sprintf("%s/Groups/%s", basePath, g.Name),
+		},
+	}
+}
+
+// Wraps one page of resources in a ListResponse
+func toListResponse(resources interface{}, itemsPerPage int, total int, startIndex int) model.ScimListResponse {
+	return model.ScimListResponse{
+		Schemas:      []string{model.ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
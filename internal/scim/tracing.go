@@ -0,0 +1,95 @@
+package scim
+
+import (
+	"context"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/scim")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) GetUser(ctx context.Context, userId string) (*model.ScimUser, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.GetUser", trace.WithAttributes(attribute.String("user.id", userId)))
+	scimUser, err := s.next.GetUser(ctx, userId)
+	tracing.End(span, err)
+	return scimUser, err
+}
+
+func (s tracedService) ListUsers(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.ListUsers", trace.WithAttributes(attribute.String("scim.filter", filter)))
+	list, err := s.next.ListUsers(ctx, filter, startIndex, count)
+	tracing.End(span, err)
+	return list, err
+}
+
+func (s tracedService) CreateUser(ctx context.Context, scimUser model.ScimUser) (*model.ScimUser, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.CreateUser")
+	result, err := s.next.CreateUser(ctx, scimUser)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (s tracedService) ReplaceUser(ctx context.Context, userId string, scimUser model.ScimUser) (*model.ScimUser, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.ReplaceUser", trace.WithAttributes(attribute.String("user.id", userId)))
+	result, err := s.next.ReplaceUser(ctx, userId, scimUser)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (s tracedService) DeleteUser(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "scim.Service.DeleteUser", trace.WithAttributes(attribute.String("user.id", userId)))
+	err := s.next.DeleteUser(ctx, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) GetGroup(ctx context.Context, groupName string) (*model.ScimGroup, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.GetGroup", trace.WithAttributes(attribute.String("group.name", groupName)))
+	scimGroup, err := s.next.GetGroup(ctx, groupName)
+	tracing.End(span, err)
+	return scimGroup, err
+}
+
+func (s tracedService) ListGroups(ctx context.Context, filter string, startIndex int, count int) (model.ScimListResponse, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.ListGroups", trace.WithAttributes(attribute.String("scim.filter", filter)))
+	list, err := s.next.ListGroups(ctx, filter, startIndex, count)
+	tracing.End(span, err)
+	return list, err
+}
+
+func (s tracedService) CreateGroup(ctx context.Context, scimGroup model.ScimGroup) (*model.ScimGroup, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.CreateGroup")
+	result, err := s.next.CreateGroup(ctx, scimGroup)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (s tracedService) ReplaceGroup(ctx context.Context, groupName string, scimGroup model.ScimGroup) (*model.ScimGroup, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.ReplaceGroup", trace.WithAttributes(attribute.String("group.name", groupName)))
+	result, err := s.next.ReplaceGroup(ctx, groupName, scimGroup)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (s tracedService) PatchGroup(ctx context.Context, groupName string, patch model.ScimPatchRequest) (*model.ScimGroup, error) {
+	ctx, span := tracer.Start(ctx, "scim.Service.PatchGroup", trace.WithAttributes(attribute.String("group.name", groupName)))
+	scimGroup, err := s.next.PatchGroup(ctx, groupName, patch)
+	tracing.End(span, err)
+	return scimGroup, err
+}
+
+func (s tracedService) DeleteGroup(ctx context.Context, groupName string) error {
+	ctx, span := tracer.Start(ctx, "scim.Service.DeleteGroup", trace.WithAttributes(attribute.String("group.name", groupName)))
+	err := s.next.DeleteGroup(ctx, groupName)
+	tracing.End(span, err)
+	return err
+}
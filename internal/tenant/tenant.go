@@ -0,0 +1,83 @@
+package tenant
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Tenant of the requests that name none, so a single tenant deployment never has to
+const Default = "default"
+
+// Name of the path variable of the /tenants/{tenant} prefix
+const PathVar = "tenant"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type tenantKey struct{}
+
+// Stores the tenant in the context
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Gets the tenant from the context, Default if none was set
+// Tenants compare case-insensitively like the rest of the keys, so the name is lower cased
+func FromContext(ctx context.Context) string {
+	if tenant, _ := ctx.Value(tenantKey{}).(string); tenant != "" {
+		return strings.ToLower(tenant)
+	}
+	return Default
+}
+
+// Gets the tenant of the verified client certificate, the first organization of its subject
+// Empty if the client did not present one or it names no organization
+func FromTLS(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	if organizations := state.VerifiedChains[0][0].Subject.Organization; len(organizations) != 0 {
+		return organizations[0]
+	}
+	return ""
+}
+
+// Works out the tenant of a call from the tenant it asked for and the tenant of the caller
+// A caller bound to a tenant can only ask for its own, everyone else gets the one asked for or Default
+func Resolve(requested string, caller string) (string, error) {
+	tenant := requested
+	switch {
+	case caller == "":
+	case requested == "" || strings.EqualFold(requested, caller):
+		tenant = caller
+	default:
+		return "", errhandler.New(model.TenantForbidden, "the caller belongs to tenant %s and can not access tenant %s", caller, requested)
+	}
+
+	if tenant == "" {
+		return Default, nil
+	}
+	if !namePattern.MatchString(tenant) {
+		return "", model.NewValidationError("tenant", "must be 1 to 64 letters, digits, '_', '.' or '-'")
+	}
+	return tenant, nil
+}
+
+// Stores the tenant of a request in its context
+// It is the {tenant} of the /tenants/{tenant} prefix, the organization of the client certificate or Default
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := Resolve(mux.Vars(r)[PathVar], FromTLS(r.TLS))
+		if err != nil {
+			errhandler.Write(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/cache"
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Serves GetWithGroup from cache.Users and invalidates the users and groups every mutation touches
+type cachedService struct {
+	Service
+}
+
+// Gets the user and their groups, from the cache when possible
+// Missing users are not cached
+func (s cachedService) GetWithGroup(ctx context.Context, userId string) (model.User, *[]model.Group, error) {
+	if entry, found := cache.Users.Get(ctx, cache.Key(ctx, userId)); found {
+		groups := append([]model.Group{}, entry.Groups...)
+		return entry.User, &groups, nil
+	}
+
+	user, groups, err := s.Service.GetWithGroup(ctx, userId)
+	if err != nil || user == (model.User{}) {
+		return user, groups, err
+	}
+
+	cache.Users.Set(ctx, cache.Key(ctx, userId), cache.UserEntry{User: user, Groups: append([]model.Group{}, *groups...)})
+	return user, groups, nil
+}
+
+// Inserts the user, a new user changes the groups they are linked to
+func (s cachedService) InsertTx(ctx context.Context, user model.User, groupNames *[]string) error {
+	err := s.Service.InsertTx(ctx, user, groupNames)
+	cache.Invalidate(ctx, []string{user.UserId}, derefNames(groupNames))
+	return err
+}
+
+// Deletes the user, which changes the groups they were in
+func (s cachedService) Delete(ctx context.Context, userId string) error {
+	oldGroups := s.currentGroups(ctx, userId)
+	err := s.Service.Delete(ctx, userId)
+	cache.Invalidate(ctx, []string{userId}, oldGroups)
+	return err
+}
+
+// Updates the user, which changes the groups they were in and the groups they are in now
+func (s cachedService) UpdateTx(ctx context.Context, user model.User, groupNames *[]string) error {
+	oldGroups := s.currentGroups(ctx, user.UserId)
+	err := s.Service.UpdateTx(ctx, user, groupNames)
+	cache.Invalidate(ctx, []string{user.UserId}, append(oldGroups, derefNames(groupNames)...))
+	return err
+}
+
+// Patches the user, which changes the groups they joined and left, and the groups they stay in through their name
+// The groups are the ones apply saw in the transaction
+func (s cachedService) Patch(ctx context.Context, userId string, apply PatchFunc) error {
+	var touched []string
+	err := s.Service.Patch(ctx, userId, func(user model.User, groups *[]model.Group) (model.User, *[]string, error) {
+		updated, newGroups, err := apply(user, groups)
+		touched = append(groupNames(groups), derefNames(newGroups)...)
+		return updated, newGroups, err
+	})
+	cache.Invalidate(ctx, []string{userId}, touched)
+	return err
+}
+
+// Inserts the user as part of a transaction
+// The caller runs the transaction under cache.Defer, so the entries are only dropped once it commits
+func (s cachedService) InsertInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	err := s.Service.InsertInTx(ctx, tx, user, groupNames)
+	cache.Invalidate(ctx, []string{user.UserId}, derefNames(groupNames))
+	return err
+}
+
+// Updates the user as part of a transaction, see InsertInTx
+func (s cachedService) UpdateInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	oldGroups := s.currentGroupsTx(ctx, tx, user.UserId)
+	err := s.Service.UpdateInTx(ctx, tx, user, groupNames)
+	cache.Invalidate(ctx, []string{user.UserId}, append(oldGroups, derefNames(groupNames)...))
+	return err
+}
+
+// Deletes the user as part of a transaction, see InsertInTx
+func (s cachedService) DeleteInTx(ctx context.Context, tx *sql.Tx, userId string) error {
+	oldGroups := s.currentGroupsTx(ctx, tx, userId)
+	err := s.Service.DeleteInTx(ctx, tx, userId)
+	cache.Invalidate(ctx, []string{userId}, oldGroups)
+	return err
+}
+
+// Gets the names of the groups of a user from the DB, bypassing the cache
+func (s cachedService) currentGroups(ctx context.Context, userId string) []string {
+	_, groups, _ := s.Service.GetWithGroup(ctx, userId)
+	return groupNames(groups)
+}
+
+// Gets the names of the groups of a user as part of a transaction, including the groups earlier writes of it changed
+func (s cachedService) currentGroupsTx(ctx context.Context, tx *sql.Tx, userId string) []string {
+	_, groups, _ := s.Service.GetWithGroupTx(ctx, tx, userId)
+	return groupNames(groups)
+}
+
+func groupNames(groups *[]model.Group) []string {
+	if groups == nil {
+		return nil
+	}
+
+	names := make([]string, len(*groups))
+	for i, group := range *groups {
+		names[i] = group.Name
+	}
+	return names
+}
+
+func derefNames(names *[]string) []string {
+	if names == nil {
+		return nil
+	}
+	return *names
+}
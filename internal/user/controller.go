@@ -5,18 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/patch"
 	"github.com/yassinekhaliqui/go-rest-service/pkg/util"
 )
 
+// Page size of a user search when the limit param is not sent, and the largest one allowed
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 100
+)
+
 type Controller interface {
 	Get(w http.ResponseWriter, r *http.Request)
+	Search(w http.ResponseWriter, r *http.Request)
 	Create(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
 }
 
 type controller struct {
@@ -38,45 +49,102 @@ func (a controller) Get(w http.ResponseWriter, r *http.Request) {
 
 	user, groups, err := a.service.GetWithGroup(r.Context(), userId)
 	if err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	if user == (model.User{}) {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, util.MessageJson("result", fmt.Sprintf("user id %s was not found", userId)))
+		errhandler.WriteCode(w, r, model.UserNotFound, "user id %s was not found", userId)
 		return
 	}
 
 	restUser := merge(user, groups)
 	payload, err := json.Marshal(restUser)
 	if err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	fmt.Fprintf(w, string(payload))
 }
 
+// Finds users by a partial name or userid in q, "smi*" matches from the start and "smi" anywhere,
+// and by the last_name, group and not_in_group filters
+// Returns one page of users with their groups, best matches first
+func (a controller) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := model.UserSearch{
+		Query:      strings.TrimSpace(query.Get("q")),
+		LastName:   query.Get("last_name"),
+		Group:      query.Get("group"),
+		NotInGroup: query.Get("not_in_group"),
+	}
+
+	if strings.HasSuffix(search.Query, "*") {
+		search.Query = strings.TrimSuffix(search.Query, "*")
+		search.Prefix = true
+	}
+	if strings.Contains(search.Query, "*") {
+		errhandler.Write(w, r, model.NewValidationError("q", "may only end with a *"))
+		return
+	}
+
+	offset, err := uintParam(r, "offset", 0)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	limit, err := uintParam(r, "limit", defaultSearchLimit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+	if limit < 1 || limit > maxSearchLimit {
+		errhandler.Write(w, r, model.NewValidationError("limit", fmt.Sprintf("must be between 1 and %d", maxSearchLimit)))
+		return
+	}
+
+	page, err := a.service.Search(r.Context(), search, offset, limit)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	restPage := model.RestUserPage{Users: make([]model.RestUser, len(page.Users)), Total: page.Total, Offset: offset, Limit: limit}
+	for i, user := range page.Users {
+		groups := page.Groups[user.Id]
+		restPage.Users[i] = merge(user, &groups)
+	}
+
+	payload, err := json.Marshal(restPage)
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.Write(payload)
+}
+
 // Creates a new user with any groups (if provided)
 // Returns 400 if userid is duplicated
 func (a controller) Create(w http.ResponseWriter, r *http.Request) {
 	var restUser model.RestUser
 	if err := json.NewDecoder(r.Body).Decode(&restUser); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	if err, statusCode := restUser.Validate(); err != nil {
-		errhandler.WriteMessage(w, err.Error(), statusCode)
+	if err, _ := restUser.Validate(); err != nil {
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	user, groupNames := deconstruct(restUser)
 
 	if err := a.service.InsertTx(r.Context(), user, groupNames); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -91,7 +159,7 @@ func (a controller) Delete(w http.ResponseWriter, r *http.Request) {
 	userId := vars["userid"]
 
 	if err := a.service.Delete(r.Context(), userId); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -104,20 +172,20 @@ func (a controller) Delete(w http.ResponseWriter, r *http.Request) {
 func (a controller) Update(w http.ResponseWriter, r *http.Request) {
 	var restUser model.RestUser
 	if err := json.NewDecoder(r.Body).Decode(&restUser); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 	defer r.Body.Close()
 
-	if err, statusCode := restUser.Validate(); err != nil {
-		errhandler.WriteMessage(w, err.Error(), statusCode)
+	if err, _ := restUser.Validate(); err != nil {
+		errhandler.Write(w, r, err)
 		return
 	}
 
 	user, groupNames := deconstruct(restUser)
 
 	if err := a.service.UpdateTx(r.Context(), user, groupNames); err != nil {
-		errhandler.Write(w, err)
+		errhandler.Write(w, r, err)
 		return
 	}
 
@@ -125,6 +193,57 @@ func (a controller) Update(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, util.MessageJson("result", fmt.Sprintf("user %s has been updated\n", restUser.UserId)))
 }
 
+// Applies a merge patch or a json patch to a user
+// Changes to groups add and remove single memberships, the userid can not be changed
+// Returns 404 if user is not found
+func (a controller) Patch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["userid"]
+	defer r.Body.Close()
+
+	// the patch is applied to the user as the transaction of the update reads them
+	var patchedId string
+	err := a.service.Patch(r.Context(), userId, func(user model.User, groups *[]model.Group) (model.User, *[]string, error) {
+		var restUser model.RestUser
+		if err := patch.Apply(r, merge(user, groups), &restUser); err != nil {
+			return model.User{}, nil, err
+		}
+
+		if err, _ := restUser.Validate(); err != nil {
+			return model.User{}, nil, err
+		}
+
+		if !strings.EqualFold(restUser.UserId, user.UserId) {
+			return model.User{}, nil, model.NewValidationError("userid", "can not be changed")
+		}
+
+		patchedId = user.UserId
+		updated, groupNames := deconstruct(restUser)
+		return updated, groupNames, nil
+	})
+	if err != nil {
+		errhandler.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(util.MessageJson("result", fmt.Sprintf("user %s has been updated\n", patchedId))))
+}
+
+// Reads an optional non-negative integer query param
+func uintParam(r *http.Request, key string, fallback uint64) (uint64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	i, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, model.NewValidationError(key, "must be a non-negative integer")
+	}
+	return i, nil
+}
+
 // Creates a RestUser from a User and an array of Groups
 func merge(user model.User, groups *[]model.Group) model.RestUser {
 	groupNames := make([]string, len(*groups))
@@ -5,12 +5,19 @@ import (
 	"database/sql"
 
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tenant"
 )
 
 type Repository interface {
 	Get(ctx context.Context, userId string) (model.User, error)
+	GetTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, error)
+	LockTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, *[]model.Group, error)
+	GetPage(ctx context.Context, offset uint64, limit uint64) (*[]model.User, error)
+	Count(ctx context.Context) (uint64, error)
+	Search(ctx context.Context, search model.UserSearch, offset uint64, limit uint64) (*[]model.User, error)
+	CountSearch(ctx context.Context, search model.UserSearch) (uint64, error)
 	InsertTx(ctx context.Context, tx *sql.Tx, user model.User) (uint64, error)
-	Delete(ctx context.Context, userId string) error
+	DeleteTx(ctx context.Context, tx *sql.Tx, userId string) error
 	UpdateTx(ctx context.Context, tx *sql.Tx, user model.User) (uint64, error)
 }
 
@@ -27,7 +34,7 @@ func NewRepository(db *sql.DB) Repository {
 
 // Calls get_user and returns a User object
 func (r repository) Get(ctx context.Context, userId string) (model.User, error) {
-	rows, err := r.db.QueryContext(ctx, "call get_user(?)", userId)
+	rows, err := r.db.QueryContext(ctx, "call get_user(?, ?)", tenant.FromContext(ctx), userId)
 	if err != nil {
 		return model.User{}, err
 	}
@@ -43,9 +50,130 @@ func (r repository) Get(ctx context.Context, userId string) (model.User, error)
 	return user, nil
 }
 
+// Calls get_user as part of a transaction, the user is empty if it does not exist
+func (r repository) GetTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, error) {
+	rows, err := tx.QueryContext(ctx, "call get_user(?, ?)", tenant.FromContext(ctx), userId)
+	if err != nil {
+		return model.User{}, err
+	}
+	defer rows.Close()
+
+	var user model.User
+	for rows.Next() {
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return model.User{}, err
+		}
+	}
+
+	return user, rows.Err()
+}
+
+// Calls lock_user as part of a transaction, which locks the user until it ends, and returns the user and their groups
+// The user is empty if it does not exist
+func (r repository) LockTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, *[]model.Group, error) {
+	rows, err := tx.QueryContext(ctx, "call lock_user(?, ?)", tenant.FromContext(ctx), userId)
+	if err != nil {
+		return model.User{}, nil, err
+	}
+	defer rows.Close()
+
+	var user model.User
+	groups := []model.Group{}
+	for rows.Next() {
+		var groupId sql.NullInt64
+		var groupName sql.NullString
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId, &groupId, &groupName); err != nil {
+			return model.User{}, nil, err
+		}
+		if groupId.Valid {
+			groups = append(groups, model.Group{Id: uint64(groupId.Int64), Name: groupName.String})
+		}
+	}
+
+	return user, &groups, rows.Err()
+}
+
+// Calls get_users and returns one page of users ordered by userid
+func (r repository) GetPage(ctx context.Context, offset uint64, limit uint64) (*[]model.User, error) {
+	rows, err := r.db.QueryContext(ctx, "call get_users(?, ?, ?)", tenant.FromContext(ctx), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return &users, nil
+}
+
+// Calls count_users and returns the total number of users
+func (r repository) Count(ctx context.Context) (uint64, error) {
+	rows, err := r.db.QueryContext(ctx, "call count_users(?)", tenant.FromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// Calls search_users and returns one page of the matching users, best matches first
+func (r repository) Search(ctx context.Context, search model.UserSearch, offset uint64, limit uint64) (*[]model.User, error) {
+	rows, err := r.db.QueryContext(ctx, "call search_users(?, ?, ?, ?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), search.Query, search.Prefix, search.LastName, search.Group, search.NotInGroup, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.UserId); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return &users, nil
+}
+
+// Calls count_search_users and returns the number of matching users
+func (r repository) CountSearch(ctx context.Context, search model.UserSearch) (uint64, error) {
+	rows, err := r.db.QueryContext(ctx, "call count_search_users(?, ?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), search.Query, search.Prefix, search.LastName, search.Group, search.NotInGroup)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count uint64
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
 // Inserts a user as part of a transaction
 func (r repository) InsertTx(ctx context.Context, tx *sql.Tx, user model.User) (uint64, error) {
-	rows, err := tx.QueryContext(ctx, "call ins_user(?, ?, ?)", user.FirstName, user.LastName, user.UserId)
+	rows, err := tx.QueryContext(ctx, "call ins_user(?, ?, ?, ?)", tenant.FromContext(ctx), user.FirstName, user.LastName, user.UserId)
 	if err != nil {
 		return 0, err
 	}
@@ -61,15 +189,18 @@ func (r repository) InsertTx(ctx context.Context, tx *sql.Tx, user model.User) (
 	return id, nil
 }
 
-// Deletes a user
-func (r repository) Delete(ctx context.Context, userId string) error {
-	_, err := r.db.QueryContext(ctx, "call del_user(?)", userId)
-	return err
+// Deletes a user as part of a transaction
+func (r repository) DeleteTx(ctx context.Context, tx *sql.Tx, userId string) error {
+	rows, err := tx.QueryContext(ctx, "call del_user(?, ?)", tenant.FromContext(ctx), userId)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
 }
 
 // Updates a user as part of a transacion
 func (r repository) UpdateTx(ctx context.Context, tx *sql.Tx, user model.User) (uint64, error) {
-	rows, err := tx.QueryContext(ctx, "call upd_user(?, ?, ?)", user.FirstName, user.LastName, user.UserId)
+	rows, err := tx.QueryContext(ctx, "call upd_user(?, ?, ?, ?)", tenant.FromContext(ctx), user.FirstName, user.LastName, user.UserId)
 	if err != nil {
 		return 0, err
 	}
@@ -23,7 +23,9 @@ func NewRouter(db *sql.DB) Router {
 // Sets up user routes
 func (r router) RegisterHandlers(mr *mux.Router) {
 	mr.HandleFunc("/users/{userid}", r.controller.Get).Methods(http.MethodGet)
+	mr.HandleFunc("/users", r.controller.Search).Methods(http.MethodGet)
 	mr.HandleFunc("/users", r.controller.Create).Methods(http.MethodPost)
 	mr.HandleFunc("/users/{userid}", r.controller.Delete).Methods(http.MethodDelete)
 	mr.HandleFunc("/users/{userid}", r.controller.Update).Methods(http.MethodPut)
+	mr.HandleFunc("/users/{userid}", r.controller.Patch).Methods(http.MethodPatch)
 }
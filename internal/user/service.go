@@ -4,17 +4,32 @@ import (
 	"context"
 	"database/sql"
 
+	"github.com/yassinekhaliqui/go-rest-service/internal/dbx"
+	"github.com/yassinekhaliqui/go-rest-service/internal/errhandler"
 	"github.com/yassinekhaliqui/go-rest-service/internal/membership"
 	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/patch"
 )
 
 type Service interface {
+	Get(ctx context.Context, userId string) (model.User, error)
 	GetWithGroup(ctx context.Context, userId string) (model.User, *[]model.Group, error)
+	GetWithGroupTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, *[]model.Group, error)
+	GetPage(ctx context.Context, offset uint64, limit uint64) (*[]model.User, uint64, error)
+	Search(ctx context.Context, search model.UserSearch, offset uint64, limit uint64) (model.UserPage, error)
 	InsertTx(ctx context.Context, user model.User, groupNames *[]string) error
 	Delete(ctx context.Context, userId string) error
 	UpdateTx(ctx context.Context, user model.User, groupNames *[]string) error
+	Patch(ctx context.Context, userId string, apply PatchFunc) error
+	InsertInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error
+	UpdateInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error
+	DeleteInTx(ctx context.Context, tx *sql.Tx, userId string) error
 }
 
+// Works out the new user and the names of their groups from the current ones, inside the transaction of Patch
+// A nil list of names takes the user out of every group
+type PatchFunc func(user model.User, groups *[]model.Group) (model.User, *[]string, error)
+
 type service struct {
 	repo              Repository
 	membershipService membership.Service
@@ -23,7 +38,12 @@ type service struct {
 
 // Creates a new instance of the user service
 func NewService(db *sql.DB) Service {
-	return service{NewRepository(db), membership.NewService(db), db}
+	return tracedService{cachedService{service{NewRepository(db), membership.NewService(db), db}}}
+}
+
+// Gets the user without their groups
+func (s service) Get(ctx context.Context, userId string) (model.User, error) {
+	return s.repo.Get(ctx, userId)
 }
 
 // Gets the user and their groups
@@ -41,6 +61,63 @@ func (s service) GetWithGroup(ctx context.Context, userId string) (model.User, *
 	return user, groups, nil
 }
 
+// Gets the user and their groups as part of a transaction, with the writes of the transaction
+func (s service) GetWithGroupTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, *[]model.Group, error) {
+	user, err := s.repo.GetTx(ctx, tx, userId)
+	if err != nil {
+		return model.User{}, nil, err
+	}
+
+	groups, err := s.membershipService.GetGroupsForUserTx(ctx, tx, user.Id)
+	if err != nil {
+		return model.User{}, nil, err
+	}
+
+	return user, groups, nil
+}
+
+// Gets one page of users along with the total number of users
+func (s service) GetPage(ctx context.Context, offset uint64, limit uint64) (*[]model.User, uint64, error) {
+	total, err := s.repo.Count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users, err := s.repo.GetPage(ctx, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// Gets one page of the users matching the search, their groups and the number of matching users
+func (s service) Search(ctx context.Context, search model.UserSearch, offset uint64, limit uint64) (model.UserPage, error) {
+	total, err := s.repo.CountSearch(ctx, search)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	users, err := s.repo.Search(ctx, search, offset, limit)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+
+	ids := make([]uint64, len(*users))
+	for i, user := range *users {
+		ids[i] = user.Id
+	}
+
+	groups := map[uint64][]model.Group{}
+	if len(ids) != 0 {
+		if groups, err = s.membershipService.GetGroupsForUsers(ctx, ids); err != nil {
+			return model.UserPage{}, err
+		}
+	}
+
+	return model.UserPage{Users: *users, Groups: groups, Total: total}, nil
+}
+
 // Inserts the user and their links to groups in a transaction
 func (s service) InsertTx(ctx context.Context, user model.User, groupNames *[]string) error {
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -49,18 +126,10 @@ func (s service) InsertTx(ctx context.Context, user model.User, groupNames *[]st
 	}
 
 	err = func() error {
-		userId, err := s.repo.InsertTx(ctx, tx, user)
-		if err != nil {
+		if err := s.InsertInTx(ctx, tx, user, groupNames); err != nil {
 			return err
 		}
 
-		if groupNames != nil && len(*groupNames) != 0 {
-			err = s.membershipService.InsertTx(ctx, tx, userId, groupNames)
-			if err != nil {
-				return err
-			}
-		}
-
 		return tx.Commit()
 	}()
 
@@ -71,9 +140,26 @@ func (s service) InsertTx(ctx context.Context, user model.User, groupNames *[]st
 	return err
 }
 
-// Deletes a user and their links to groups
+// Deletes a user and their links to groups in a transaction
 func (s service) Delete(ctx context.Context, userId string) error {
-	return s.repo.Delete(ctx, userId)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if err := s.DeleteInTx(ctx, tx, userId); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}()
+
+	if err != nil {
+		tx.Rollback()
+	}
+
+	return err
 }
 
 // Updates the user and their links to groups in a transaction
@@ -84,12 +170,7 @@ func (s service) UpdateTx(ctx context.Context, user model.User, groupNames *[]st
 	}
 
 	err = func() error {
-		userId, err := s.repo.UpdateTx(ctx, tx, user)
-		if err != nil {
-			return err
-		}
-
-		if err = s.membershipService.UpdateTx(ctx, tx, userId, groupNames); err != nil {
+		if err := s.UpdateInTx(ctx, tx, user, groupNames); err != nil {
 			return err
 		}
 
@@ -102,3 +183,83 @@ func (s service) UpdateTx(ctx context.Context, user model.User, groupNames *[]st
 
 	return err
 }
+
+// Updates the user and adds them to and removes them from single groups in a transaction
+// The user and their groups are read with a locking read and passed to apply, so no other write changes them
+// before the update. Groups that are in neither the old nor the new list keep the user, the userid can not change
+// Returns a USER_NOT_FOUND error if the user does not exist
+func (s service) Patch(ctx context.Context, userId string, apply PatchFunc) error {
+	return dbx.InTx(ctx, s.db, func(ctx context.Context, tx *sql.Tx) error {
+		user, groups, err := s.repo.LockTx(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+		if user == (model.User{}) {
+			return errhandler.New(model.UserNotFound, "user id %s was not found", userId)
+		}
+
+		updated, newGroups, err := apply(user, groups)
+		if err != nil {
+			return err
+		}
+		updated.UserId = user.UserId
+		addGroups, removeGroups := patch.Diff(groupNames(groups), derefNames(newGroups))
+
+		if _, err := s.repo.UpdateTx(ctx, tx, updated); err != nil {
+			return err
+		}
+
+		for _, groupName := range removeGroups {
+			if err := s.membershipService.RemoveGroupMemberTx(ctx, tx, groupName, user.UserId); err != nil {
+				return err
+			}
+		}
+
+		for _, groupName := range addGroups {
+			if err := s.membershipService.AddGroupMemberTx(ctx, tx, groupName, user.UserId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Inserts the user and their links to groups as part of the caller's transaction
+func (s service) InsertInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	userId, err := s.repo.InsertTx(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	if groupNames != nil && len(*groupNames) != 0 {
+		return s.membershipService.InsertTx(ctx, tx, userId, groupNames)
+	}
+	return nil
+}
+
+// Updates the user and their links to groups as part of the caller's transaction
+func (s service) UpdateInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	userId, err := s.repo.UpdateTx(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	return s.membershipService.UpdateTx(ctx, tx, userId, groupNames)
+}
+
+// Deletes a user and their links to groups as part of the caller's transaction
+// The user leaves its groups first, which fails if a group would drop below its min_members
+func (s service) DeleteInTx(ctx context.Context, tx *sql.Tx, userId string) error {
+	user, err := s.repo.GetTx(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+
+	if user.Id != 0 {
+		if err := s.membershipService.RemoveUserTx(ctx, tx, user.Id); err != nil {
+			return err
+		}
+	}
+	return s.repo.DeleteTx(ctx, tx, userId)
+}
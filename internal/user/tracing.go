@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/yassinekhaliqui/go-rest-service/internal/user")
+
+// Starts a child span for every call to the service
+type tracedService struct {
+	next Service
+}
+
+func (s tracedService) Get(ctx context.Context, userId string) (model.User, error) {
+	ctx, span := tracer.Start(ctx, "user.Service.Get", trace.WithAttributes(attribute.String("user.id", userId)))
+	user, err := s.next.Get(ctx, userId)
+	tracing.End(span, err)
+	return user, err
+}
+
+func (s tracedService) GetWithGroup(ctx context.Context, userId string) (model.User, *[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "user.Service.GetWithGroup", trace.WithAttributes(attribute.String("user.id", userId)))
+	user, groups, err := s.next.GetWithGroup(ctx, userId)
+	tracing.End(span, err)
+	return user, groups, err
+}
+
+func (s tracedService) GetWithGroupTx(ctx context.Context, tx *sql.Tx, userId string) (model.User, *[]model.Group, error) {
+	ctx, span := tracer.Start(ctx, "user.Service.GetWithGroupTx", trace.WithAttributes(attribute.String("user.id", userId)))
+	user, groups, err := s.next.GetWithGroupTx(ctx, tx, userId)
+	tracing.End(span, err)
+	return user, groups, err
+}
+
+func (s tracedService) GetPage(ctx context.Context, offset uint64, limit uint64) (*[]model.User, uint64, error) {
+	ctx, span := tracer.Start(ctx, "user.Service.GetPage")
+	users, total, err := s.next.GetPage(ctx, offset, limit)
+	tracing.End(span, err)
+	return users, total, err
+}
+
+func (s tracedService) Search(ctx context.Context, search model.UserSearch, offset uint64, limit uint64) (model.UserPage, error) {
+	ctx, span := tracer.Start(ctx, "user.Service.Search", trace.WithAttributes(attribute.String("user.search.query", search.Query)))
+	page, err := s.next.Search(ctx, search, offset, limit)
+	tracing.End(span, err)
+	return page, err
+}
+
+func (s tracedService) InsertTx(ctx context.Context, user model.User, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.InsertTx", trace.WithAttributes(attribute.String("user.id", user.UserId)))
+	err := s.next.InsertTx(ctx, user, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) Delete(ctx context.Context, userId string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.Delete", trace.WithAttributes(attribute.String("user.id", userId)))
+	err := s.next.Delete(ctx, userId)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateTx(ctx context.Context, user model.User, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.UpdateTx", trace.WithAttributes(attribute.String("user.id", user.UserId)))
+	err := s.next.UpdateTx(ctx, user, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) Patch(ctx context.Context, userId string, apply PatchFunc) error {
+	ctx, span := tracer.Start(ctx, "user.Service.Patch", trace.WithAttributes(attribute.String("user.id", userId)))
+	err := s.next.Patch(ctx, userId, apply)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) InsertInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.InsertInTx", trace.WithAttributes(attribute.String("user.id", user.UserId)))
+	err := s.next.InsertInTx(ctx, tx, user, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) UpdateInTx(ctx context.Context, tx *sql.Tx, user model.User, groupNames *[]string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.UpdateInTx", trace.WithAttributes(attribute.String("user.id", user.UserId)))
+	err := s.next.UpdateInTx(ctx, tx, user, groupNames)
+	tracing.End(span, err)
+	return err
+}
+
+func (s tracedService) DeleteInTx(ctx context.Context, tx *sql.Tx, userId string) error {
+	ctx, span := tracer.Start(ctx, "user.Service.DeleteInTx", trace.WithAttributes(attribute.String("user.id", userId)))
+	err := s.next.DeleteInTx(ctx, tx, userId)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/health"
+)
+
+// A job run by a background worker, ctx is cancelled when the runner stops
+type Job func(ctx context.Context) error
+
+type worker struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Runs background jobs on an interval and stops them on shutdown
+// Every worker beats a heartbeat, so a stuck or failing worker fails readiness
+type Runner struct {
+	heartbeats *health.Workers
+	workers    []worker
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Creates a runner without workers
+func NewRunner() *Runner {
+	return &Runner{heartbeats: health.NewWorkers()}
+}
+
+// Adds a worker running job every interval, must be called before Start
+func (r *Runner) Every(name string, interval time.Duration, job Job) {
+	r.workers = append(r.workers, worker{name, interval, job})
+}
+
+// Starts every worker, each runs its job once right away
+func (r *Runner) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	for _, w := range r.workers {
+		heartbeat := r.heartbeats.Add(w.name, w.interval)
+
+		r.wg.Add(1)
+		go func(w worker) {
+			defer r.wg.Done()
+			defer r.heartbeats.Remove(w.name)
+			r.loop(ctx, w, heartbeat)
+		}(w)
+	}
+}
+
+func (r *Runner) loop(ctx context.Context, w worker, heartbeat *health.Heartbeat) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		err := w.job(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("worker failed", slog.String("worker", w.name), slog.Any("error", err))
+		}
+		heartbeat.Beat(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stops every worker and waits for their current runs, or until ctx is done
+func (r *Runner) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Checks every worker is healthy, see health.Workers
+func (r *Runner) Check(ctx context.Context) error {
+	return r.heartbeats.Check(ctx)
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Options of an apply call
+type ApplyOptions struct {
+	// Only computes the plan without changing anything
+	DryRun bool
+	// Deletes groups missing from the desired state
+	Prune bool
+}
+
+// Reconciles groups and memberships with the desired state and returns the actions taken
+func (c *Client) Apply(ctx context.Context, desired DesiredState, opts ApplyOptions) (Plan, error) {
+	query := url.Values{}
+	query.Set("dry_run", strconv.FormatBool(opts.DryRun))
+	query.Set("prune", strconv.FormatBool(opts.Prune))
+
+	var plan Plan
+	err := c.do(ctx, http.MethodPost, "/apply", query, desired, &plan)
+	return plan, err
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+)
+
+// Ops and resources of an Operation
+const (
+	OpCreate = model.BatchCreate
+	OpUpdate = model.BatchUpdate
+	OpDelete = model.BatchDelete
+
+	ResourceUser       = model.BatchUser
+	ResourceGroup      = model.BatchGroup
+	ResourceMembership = model.BatchMembership
+)
+
+// Runs the operations in order in a single transaction and returns the result of each
+// If one fails nothing is changed, and the error is an *Error whose Problem.Index is the failed operation
+func (c *Client) Batch(ctx context.Context, operations ...Operation) ([]OperationResult, error) {
+	var result model.RestBatchResult
+	err := c.do(ctx, http.MethodPost, "/batch", nil, model.RestBatch{Operations: operations}, &result)
+	return result.Results, err
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yassinekhaliqui/go-rest-service/internal/model"
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+)
+
+// Aliases of the REST models so callers outside this module can name them
+type (
+	User            = model.RestUser
+	UserPage        = model.RestUserPage
+	Group           = model.RestGroup
+	GroupList       = model.RestGroupList
+	GroupMembers    = model.RestGroupMembers
+	DesiredState    = model.RestDesiredState
+	DesiredGroup    = model.RestDesiredGroup
+	Plan            = model.RestPlan
+	Operation       = model.RestOperation
+	OperationResult = model.RestOperationResult
+	Problem         = model.RestProblem
+	ErrorCode       = model.ErrorCode
+
+	GroupPolicy             = model.RestGroupPolicy
+	MembershipRequest       = model.RestMembershipRequest
+	MembershipRequestCreate = model.RestMembershipRequestCreate
+	MembershipRequestPage   = model.RestMembershipRequestPage
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetries    = 2
+	defaultBackoff    = 100 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+	maxErrorBodyBytes = 1 << 20
+)
+
+// Client of the membership REST api
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+	retries    int
+	backoff    time.Duration
+}
+
+// Configures a Client created by New
+type Option func(*Client)
+
+// Uses the given http client, e.g. one configured for TLS
+// The timeout of the client is overridden when WithTimeout is also given
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		copied := *httpClient
+		c.httpClient = &copied
+	}
+}
+
+// Sets the time limit of a single attempt, including reading the response body
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// Retries idempotent calls up to max times, waiting an exponentially growing delay
+// starting at backoff between attempts. Zero retries disables retrying
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = max
+		c.backoff = backoff
+	}
+}
+
+// Sends the key in the X-API-Key header of every request
+func WithAPIKey(key string) Option {
+	return WithHeader(mw.ApiKeyHeader, key)
+}
+
+// Sends the token as a bearer Authorization header of every request
+func WithBearerToken(token string) Option {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// Sends a header with every request
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// Sends every request to the users, groups and memberships of the tenant, under /tenants/{tenant}
+// Without it the service picks the tenant of the client certificate, or the default tenant
+func WithTenant(tenant string) Option {
+	return func(c *Client) {
+		c.baseURL += "/tenants/" + segment(tenant)
+	}
+}
+
+// Creates a client for the service at baseURL, e.g. http://127.0.0.1:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		header:     http.Header{},
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Sends a request with an optional json body and decodes a json response into out when given
+// Non-2xx responses are returned as *Error. GET, PUT and DELETE are retried on network
+// errors and on 429, 502, 503 and 504 responses
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	// the same id is sent on every attempt so retries can be correlated in the logs
+	requestId := mw.NewRequestId()
+
+	retries := 0
+	if idempotent(method) {
+		retries = c.retries
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, target, requestId, body)
+
+		if attempt < retries && retryable(resp, err) && ctx.Err() == nil {
+			delay := c.delay(attempt, resp)
+			if resp != nil {
+				drain(resp)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return newError(resp)
+		}
+
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+		}
+		return nil
+	}
+}
+
+// Sends a single attempt of a request
+func (c *Client) send(ctx context.Context, method, target, requestId string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(mw.RequestIdHeader, requestId)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// Gets the delay before the next attempt, honouring the Retry-After header of the response
+func (c *Client) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	delay := c.backoff << attempt
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	// full jitter keeps clients retrying together from hitting the server in lockstep
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// Checks whether repeating the request has the same effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Checks whether the attempt failed in a way a later attempt might not
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Reads and closes the body so the connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+	resp.Body.Close()
+}
+
+// Escapes a key used as a path segment
+func segment(key string) string {
+	return url.PathEscape(key)
+}
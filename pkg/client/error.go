@@ -0,0 +1,63 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/yassinekhaliqui/go-rest-service/pkg/mw"
+)
+
+// Error returned for a non-2xx response, carrying the problem details sent by the server
+type Error struct {
+	StatusCode int
+	Problem    Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Detail)
+	}
+	if e.Problem.Code != "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, e.Problem.Code)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Creates an Error from a response, falling back to the status when the body is not a problem
+func newError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err := json.Unmarshal(body, &e.Problem); err != nil || e.Problem.Status == 0 {
+		e.Problem = Problem{
+			Title:     http.StatusText(resp.StatusCode),
+			Status:    resp.StatusCode,
+			RequestId: resp.Header.Get(mw.RequestIdHeader),
+		}
+	}
+
+	return e
+}
+
+// Gets the status code of an Error, 0 when err is not one
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// Checks whether err is an Error with the given problem code
+func HasCode(err error, code ErrorCode) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Problem.Code == code
+}
+
+// Checks whether err is a 404 response
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Gets the user ids of the members of a group
+func (c *Client) GetGroup(ctx context.Context, name string) (GroupMembers, error) {
+	var members GroupMembers
+	err := c.do(ctx, http.MethodGet, "/groups/"+segment(name), nil, nil, &members)
+	return members, err
+}
+
+// Gets every group ordered by name
+func (c *Client) ListGroups(ctx context.Context) ([]Group, error) {
+	var list GroupList
+	err := c.do(ctx, http.MethodGet, "/groups", nil, nil, &list)
+	return list.Groups, err
+}
+
+// Gets one page of the users of a set expression over groups, e.g. "eng intersect oncall", ordered by userid
+// A limit of 0 uses the page size of the server
+func (c *Client) QueryGroups(ctx context.Context, expr string, offset uint64, limit uint64) (UserPage, error) {
+	query := url.Values{"expr": {expr}}
+	if offset != 0 {
+		query.Set("offset", strconv.FormatUint(offset, 10))
+	}
+	if limit != 0 {
+		query.Set("limit", strconv.FormatUint(limit, 10))
+	}
+
+	var page UserPage
+	err := c.do(ctx, http.MethodGet, "/groups:query", query, nil, &page)
+	return page, err
+}
+
+// Creates an empty group
+func (c *Client) CreateGroup(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/groups", nil, Group{Name: name}, nil)
+}
+
+// Replaces the members of a group
+func (c *Client) UpdateGroup(ctx context.Context, name string, members GroupMembers) error {
+	return c.do(ctx, http.MethodPut, "/groups/"+segment(name), nil, members, nil)
+}
+
+// Deletes a group and its memberships
+func (c *Client) DeleteGroup(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/groups/"+segment(name), nil, nil, nil)
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Filters and page of ListMembershipRequests, empty fields are not sent
+type MembershipRequestList struct {
+	// pending, approved, rejected or expired
+	State  string
+	UserId string
+	Offset uint64
+	// 0 uses the page size of the server
+	Limit uint64
+}
+
+// Gets the approval policy and owners of a group
+func (c *Client) GetGroupPolicy(ctx context.Context, group string) (GroupPolicy, error) {
+	var policy GroupPolicy
+	err := c.do(ctx, http.MethodGet, "/groups/"+segment(group)+"/policy", nil, nil, &policy)
+	return policy, err
+}
+
+// Replaces the approval policy and owners of a group
+func (c *Client) UpdateGroupPolicy(ctx context.Context, group string, policy GroupPolicy) error {
+	return c.do(ctx, http.MethodPut, "/groups/"+segment(group)+"/policy", nil, policy, nil)
+}
+
+// Asks for a user to join a group, the request is approved right away when the group approves automatically
+func (c *Client) RequestMembership(ctx context.Context, group string, userId string, reason string) (MembershipRequest, error) {
+	var request MembershipRequest
+	err := c.do(ctx, http.MethodPost, "/groups/"+segment(group)+"/requests", nil,
+		MembershipRequestCreate{UserId: userId, Reason: reason}, &request)
+	return request, err
+}
+
+// Gets a request to join a group
+func (c *Client) GetMembershipRequest(ctx context.Context, group string, id uint64) (MembershipRequest, error) {
+	var request MembershipRequest
+	err := c.do(ctx, http.MethodGet, requestPath(group, id), nil, nil, &request)
+	return request, err
+}
+
+// Gets one page of the requests to join a group, oldest first, along with the number of requests matching
+func (c *Client) ListMembershipRequests(ctx context.Context, group string, list MembershipRequestList) (MembershipRequestPage, error) {
+	query := url.Values{}
+	if list.State != "" {
+		query.Set("state", list.State)
+	}
+	if list.UserId != "" {
+		query.Set("userid", list.UserId)
+	}
+	if list.Offset != 0 {
+		query.Set("offset", strconv.FormatUint(list.Offset, 10))
+	}
+	if list.Limit != 0 {
+		query.Set("limit", strconv.FormatUint(list.Limit, 10))
+	}
+
+	var page MembershipRequestPage
+	err := c.do(ctx, http.MethodGet, "/groups/"+segment(group)+"/requests", query, nil, &page)
+	return page, err
+}
+
+// Approves a pending request as an owner of the group, the owner is the identity of the client certificate
+func (c *Client) ApproveMembershipRequest(ctx context.Context, group string, id uint64) (MembershipRequest, error) {
+	var request MembershipRequest
+	err := c.do(ctx, http.MethodPost, requestPath(group, id)+"/approve", nil, nil, &request)
+	return request, err
+}
+
+// Rejects a pending request as an owner of the group, the owner is the identity of the client certificate
+func (c *Client) RejectMembershipRequest(ctx context.Context, group string, id uint64) (MembershipRequest, error) {
+	var request MembershipRequest
+	err := c.do(ctx, http.MethodPost, requestPath(group, id)+"/reject", nil, nil, &request)
+	return request, err
+}
+
+// Gets the path of a request to join a group
+func requestPath(group string, id uint64) string {
+	return "/groups/" + segment(group) + "/requests/" + strconv.FormatUint(id, 10)
+}
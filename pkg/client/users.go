@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Filters and page of SearchUsers, empty fields are not sent
+type UserSearch struct {
+	// A partial name or userid, "smi*" matches from the start and "smi" anywhere
+	Query      string
+	LastName   string
+	Group      string
+	NotInGroup string
+	Offset     uint64
+	// 0 uses the page size of the server
+	Limit uint64
+}
+
+// Gets a user and the groups they belong to
+func (c *Client) GetUser(ctx context.Context, userId string) (User, error) {
+	var user User
+	err := c.do(ctx, http.MethodGet, "/users/"+segment(userId), nil, nil, &user)
+	return user, err
+}
+
+// Finds one page of users, best matches first, along with the number of users matching
+func (c *Client) SearchUsers(ctx context.Context, search UserSearch) (UserPage, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{"q": search.Query, "last_name": search.LastName, "group": search.Group, "not_in_group": search.NotInGroup} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if search.Offset != 0 {
+		query.Set("offset", strconv.FormatUint(search.Offset, 10))
+	}
+	if search.Limit != 0 {
+		query.Set("limit", strconv.FormatUint(search.Limit, 10))
+	}
+
+	var page UserPage
+	err := c.do(ctx, http.MethodGet, "/users", query, nil, &page)
+	return page, err
+}
+
+// Creates a user with any groups listed in it
+func (c *Client) CreateUser(ctx context.Context, user User) error {
+	return c.do(ctx, http.MethodPost, "/users", nil, user, nil)
+}
+
+// Replaces the names and groups of an existing user
+func (c *Client) UpdateUser(ctx context.Context, user User) error {
+	return c.do(ctx, http.MethodPut, "/users/"+segment(user.UserId), nil, user, nil)
+}
+
+// Deletes a user and their memberships
+func (c *Client) DeleteUser(ctx context.Context, userId string) error {
+	return c.do(ctx, http.MethodDelete, "/users/"+segment(userId), nil, nil, nil)
+}
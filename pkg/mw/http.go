@@ -1,9 +1,10 @@
 package mw
 
 import (
-	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
-	"log"
+	"time"
 )
 
 // Adds json content type to a handler
@@ -14,10 +15,31 @@ func AddJsonContentType(next http.Handler) http.Handler {
 	})
 }
 
-// Adds request logging to a handler
+// Logs an access record for every request once the handler is done
 func LogRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Println(fmt.Sprintf("%s:\t%s", r.Method, r.URL.Path))
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		recorder := NewResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", RouteTemplate(r)),
+			slog.Int("status", recorder.Status),
+			slog.Int("bytes", recorder.Bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client", client),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if caller := GetCallerIdentity(r.Context()); caller != "" {
+			attrs = append(attrs, slog.String("caller", caller))
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
 	})
 }
@@ -0,0 +1,58 @@
+package mw
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// Sent by clients that authenticate with an API key, the service does not verify it
+// so it never tells clients apart, a gateway in front of the service may check it
+const ApiKeyHeader = "X-API-Key"
+
+type callerIdentityKey struct{}
+
+// Stores the subject of the verified client certificate of a request as the caller identity
+// Requests without a verified certificate have no identity
+func ClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity := IdentityFromTLS(r.TLS); identity != "" {
+			r = r.WithContext(WithCallerIdentity(r.Context(), identity))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Gets the subject of the verified client certificate, empty if the client did not present one
+func IdentityFromTLS(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.String()
+}
+
+// Stores the caller identity in the context
+func WithCallerIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, callerIdentityKey{}, identity)
+}
+
+// Gets the caller identity from the context, empty if the caller is anonymous
+func GetCallerIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(callerIdentityKey{}).(string)
+	return identity
+}
+
+// Gets the key that tells the client of a request apart from other clients
+// It is the verified caller identity, or the IP for anonymous callers, never a header the client chooses
+func ClientKey(r *http.Request) string {
+	if identity := GetCallerIdentity(r.Context()); identity != "" {
+		return "caller:" + identity
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
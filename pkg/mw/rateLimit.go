@@ -0,0 +1,113 @@
+package mw
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Requests per second and burst of a token bucket, a zero rate disables the limit
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Writes the response of a request over its limit, the Retry-After header is already set
+type RejectFunc func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+
+// Token buckets per client and route class
+// Clients are keyed by ClientKey, their verified caller identity or their IP.
+// GET, HEAD and OPTIONS requests are reads, every other method is a write
+type RateLimiter struct {
+	read   Limit
+	write  Limit
+	exempt map[string]bool
+	reject RejectFunc
+
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// Creates a rate limiter, requests to the exempt route templates (e.g. probes) are never limited
+func NewRateLimiter(read Limit, write Limit, reject RejectFunc, exempt ...string) *RateLimiter {
+	l := &RateLimiter{read: read, write: write, reject: reject, exempt: map[string]bool{}, buckets: map[string]*rate.Limiter{}}
+	for _, route := range exempt {
+		l.exempt[route] = true
+	}
+	return l
+}
+
+// Rejects requests once the bucket of their client and class is empty
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, limit := l.classify(r)
+		if limit.Rate <= 0 || l.exempt[RouteTemplate(r)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reservation := l.bucket(class+"|"+ClientKey(r), limit).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			l.reject(w, r, delay)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Forgets the buckets of clients idle for long enough that their bucket is full again
+func (l *RateLimiter) Cleanup(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, limiter := range l.buckets {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(l.buckets, key)
+		}
+	}
+	return nil
+}
+
+func (l *RateLimiter) classify(r *http.Request) (string, Limit) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read", l.read
+	default:
+		return "write", l.write
+	}
+}
+
+func (l *RateLimiter) bucket(key string, limit Limit) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, found := l.buckets[key]
+	if !found {
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(limit.Rate), burst)
+		l.buckets[key] = limiter
+	}
+	return limiter
+}
+
+// Limits the size of request bodies, reading past maxBytes fails with an *http.MaxBytesError
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package mw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+type requestIdKey struct{}
+
+// Propagates the X-Request-ID header of a request, or generates one when missing
+// The id is echoed in the response headers and stored in the request context
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIdHeader)
+		if id == "" || len(id) > 128 {
+			id = NewRequestId()
+		}
+
+		w.Header().Set(RequestIdHeader, id)
+		ctx := context.WithValue(r.Context(), requestIdKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Gets the id of the request from the context, empty if there is none
+func GetRequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// Creates a random 32 character request id
+func NewRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
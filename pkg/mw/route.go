@@ -0,0 +1,20 @@
+package mw
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Route of requests that did not match a route, keeps raw paths out of metrics and span names
+const UnmatchedRoute = "unmatched"
+
+// Gets the template of the route a request matched, e.g. /users/{userid}
+func RouteTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return UnmatchedRoute
+}
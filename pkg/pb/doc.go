@@ -0,0 +1,5 @@
+// Package pb contains the generated gRPC stubs for the membership service
+// Regenerate after changing membership.proto
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative membership.proto